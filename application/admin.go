@@ -0,0 +1,263 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/config"
+	"github.com/Leul-Michael/image-generation/model"
+)
+
+// planCodePattern keeps plan codes usable in bot callback data.
+var planCodePattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Admin runs an operator command against the database:
+//
+//	grant-credits -telegram-id ID -amount N [-type image] [-reason TEXT]
+//	set-role -telegram-id ID -role ROLE
+//	create-promo -code CODE (-credits N | -bonus-percent P) [-max-redemptions N]
+//	             [-per-user N] [-starts TIME] [-ends TIME] [-langs en,am] [-segment new|customers]
+//	create-plan -code CODE -name NAME -price ETB -credits N [-rollover N] [-priority N] [-premium]
+func Admin(ctx context.Context, cfg *config.Config, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("admin needs a command: grant-credits, set-role, create-promo or create-plan")
+	}
+
+	switch args[0] {
+	case "grant-credits":
+		return grantCredits(ctx, cfg, args[1:], out)
+	case "set-role":
+		return setRole(ctx, cfg, args[1:], out)
+	case "create-promo":
+		return createPromo(ctx, cfg, args[1:], out)
+	case "create-plan":
+		return createPlan(ctx, cfg, args[1:], out)
+	default:
+		return fmt.Errorf("unknown admin command %q (want grant-credits, set-role, create-promo or create-plan)", args[0])
+	}
+}
+
+// grantCredits adds (or, with a negative amount, removes) credits and records
+// an adjustment transaction.
+func grantCredits(ctx context.Context, cfg *config.Config, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("admin grant-credits", flag.ContinueOnError)
+	flags.SetOutput(out)
+	telegramID := flags.Uint("telegram-id", 0, "Telegram ID of the user")
+	amount := flags.Int("amount", 0, "credits to add; negative to remove")
+	creditType := flags.String("type", string(model.CreditTypeImage), "credit type: image or video")
+	reason := flags.String("reason", "Manual adjustment", "description stored on the transaction")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *telegramID == 0 {
+		return errors.New("-telegram-id is required")
+	}
+	if *amount == 0 {
+		return errors.New("-amount must not be zero")
+	}
+	kind := model.CreditType(*creditType)
+	if kind != model.CreditTypeImage && kind != model.CreditTypeVideo {
+		return fmt.Errorf("invalid credit type %q", *creditType)
+	}
+
+	app, err := openApp(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer app.close()
+
+	user, err := app.repos.Users.GetByTelegramID(ctx, *telegramID)
+	if err != nil {
+		return fmt.Errorf("failed to find user %d: %w", *telegramID, err)
+	}
+
+	transaction := model.Transaction{
+		UserID:      user.ID,
+		CreditType:  kind,
+		Amount:      *amount,
+		Type:        model.TransactionTypeAdjustment,
+		Description: *reason,
+	}
+	userCredit, err := app.repos.Credits.Apply(ctx, &transaction)
+	if err != nil {
+		return fmt.Errorf("failed to grant credits: %w", err)
+	}
+
+	fmt.Fprintf(out, "user %d now has %d %s credits\n", *telegramID, userCredit.Credits, kind)
+	return nil
+}
+
+func setRole(ctx context.Context, cfg *config.Config, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("admin set-role", flag.ContinueOnError)
+	flags.SetOutput(out)
+	telegramID := flags.Uint("telegram-id", 0, "Telegram ID of the user")
+	role := flags.String("role", "", "user, admin or super_admin")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *telegramID == 0 {
+		return errors.New("-telegram-id is required")
+	}
+	switch model.Role(*role) {
+	case model.RoleUser, model.RoleAdmin, model.RoleSuperAdmin:
+	default:
+		return fmt.Errorf("invalid role %q (want user, admin or super_admin)", *role)
+	}
+
+	app, err := openApp(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer app.close()
+
+	user, err := app.repos.Users.GetByTelegramID(ctx, *telegramID)
+	if err != nil {
+		return fmt.Errorf("failed to find user %d: %w", *telegramID, err)
+	}
+
+	if err := app.repos.Users.UpdateField(ctx, user.ID, "role", *role); err != nil {
+		return fmt.Errorf("failed to update role: %w", err)
+	}
+
+	fmt.Fprintf(out, "user %d is now %s\n", *telegramID, *role)
+	return nil
+}
+
+// createPromo adds a promo code. Times are RFC 3339, e.g.
+// 2026-01-31T23:59:59+03:00.
+func createPromo(ctx context.Context, cfg *config.Config, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("admin create-promo", flag.ContinueOnError)
+	flags.SetOutput(out)
+	code := flags.String("code", "", "the code users type, e.g. LAUNCH50")
+	credits := flags.Int("credits", 0, "image credits granted on redemption")
+	bonusPercent := flags.Int("bonus-percent", 0, "extra credits on the next deposit, in percent")
+	maxRedemptions := flags.Int("max-redemptions", 0, "redemptions across all users; 0 for no limit")
+	perUser := flags.Int("per-user", 1, "redemptions per user; 0 for no limit")
+	starts := flags.String("starts", "", "first moment the code is valid")
+	ends := flags.String("ends", "", "moment the code stops being valid")
+	langs := flags.String("langs", "", "comma-separated languages allowed; empty for all")
+	segment := flags.String("segment", "", "new (never bought credits) or customers; empty for all")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	promo := model.PromoCode{
+		Code:           model.NormalizePromoCode(*code),
+		Credits:        *credits,
+		BonusPercent:   *bonusPercent,
+		MaxRedemptions: *maxRedemptions,
+		PerUserLimit:   *perUser,
+		Segment:        model.PromoSegment(*segment),
+		IsActive:       true,
+	}
+	if promo.Code == "" {
+		return errors.New("-code is required")
+	}
+	if promo.Credits < 0 || promo.BonusPercent < 0 || promo.Credits == 0 && promo.BonusPercent == 0 {
+		return errors.New("-credits or -bonus-percent must be positive")
+	}
+	if promo.MaxRedemptions < 0 || promo.PerUserLimit < 0 {
+		return errors.New("-max-redemptions and -per-user must not be negative")
+	}
+	switch promo.Segment {
+	case model.PromoSegmentAll, model.PromoSegmentNew, model.PromoSegmentCustomers:
+	default:
+		return fmt.Errorf("invalid segment %q (want new or customers)", *segment)
+	}
+	for _, lang := range strings.Split(*langs, ",") {
+		if lang = strings.TrimSpace(lang); lang != "" {
+			promo.Langs = append(promo.Langs, lang)
+		}
+	}
+	for _, bound := range []struct {
+		flag  string
+		value string
+		dst   **time.Time
+	}{{"-starts", *starts, &promo.StartsAt}, {"-ends", *ends, &promo.EndsAt}} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, bound.value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", bound.flag, err)
+		}
+		*bound.dst = &t
+	}
+	if promo.StartsAt != nil && promo.EndsAt != nil && !promo.EndsAt.After(*promo.StartsAt) {
+		return errors.New("-ends must be after -starts")
+	}
+
+	app, err := openApp(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer app.close()
+
+	if err := app.repos.PromoCodes.Create(ctx, &promo); err != nil {
+		return fmt.Errorf("failed to create promo code: %w", err)
+	}
+
+	fmt.Fprintf(out, "promo code %s created\n", promo.Code)
+	return nil
+}
+
+// createPlan adds a subscription plan users can pick from the bot's plans
+// screen.
+func createPlan(ctx context.Context, cfg *config.Config, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("admin create-plan", flag.ContinueOnError)
+	flags.SetOutput(out)
+	code := flags.String("code", "", "short identifier, e.g. pro")
+	name := flags.String("name", "", "name shown to users, e.g. Pro")
+	price := flags.Int("price", 0, "monthly price in etb")
+	credits := flags.Int("credits", 0, "image credits granted every month")
+	rollover := flags.Int("rollover", 0, "unused monthly credits carried over to the next month")
+	priority := flags.Int("priority", 0, "generation queue priority; higher goes first")
+	premium := flags.Bool("premium", false, "open premium categories to subscribers")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	plan := model.Plan{
+		Code:              strings.ToLower(strings.TrimSpace(*code)),
+		Name:              strings.TrimSpace(*name),
+		PriceEtb:          *price,
+		MonthlyCredits:    *credits,
+		MaxRollover:       *rollover,
+		Priority:          *priority,
+		PremiumCategories: *premium,
+		IsActive:          true,
+	}
+	if plan.Code == "" || plan.Name == "" {
+		return errors.New("-code and -name are required")
+	}
+	if !planCodePattern.MatchString(plan.Code) {
+		return fmt.Errorf("invalid code %q (want lowercase letters, digits and dashes)", *code)
+	}
+	if plan.PriceEtb <= 0 || plan.MonthlyCredits <= 0 {
+		return errors.New("-price and -credits must be positive")
+	}
+	if plan.MaxRollover < 0 || plan.Priority < 0 {
+		return errors.New("-rollover and -priority must not be negative")
+	}
+
+	app, err := openApp(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer app.close()
+
+	if err := app.repos.Subscriptions.CreatePlan(ctx, &plan); err != nil {
+		return fmt.Errorf("failed to create plan: %w", err)
+	}
+
+	fmt.Fprintf(out, "plan %s created\n", plan.Code)
+	return nil
+}
@@ -3,37 +3,98 @@ package application
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
-	"time"
 
+	"github.com/Leul-Michael/image-generation/auth"
+	"github.com/Leul-Michael/image-generation/billing"
+	"github.com/Leul-Michael/image-generation/config"
+	"github.com/Leul-Michael/image-generation/generation"
 	"github.com/Leul-Michael/image-generation/handler"
-	"github.com/Leul-Michael/image-generation/model"
+	"github.com/Leul-Michael/image-generation/i18n"
+	"github.com/Leul-Michael/image-generation/llm"
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/Leul-Michael/image-generation/mail"
+	"github.com/Leul-Michael/image-generation/metrics"
 	tele "gopkg.in/telebot.v3"
 	"gorm.io/gorm"
 )
 
 type App struct {
-	router http.Handler
-	DB     *gorm.DB
-	bot    *tele.Bot
+	config  *config.Config
+	logger  *slog.Logger
+	metrics *metrics.Metrics
+	router  http.Handler
+	DB      *gorm.DB
+	repos   handler.Repos
+	bot     *tele.Bot
+	i18n    *i18n.Bundle
+
+	webhook *handler.WebhookPoller
+
+	sessions *auth.Sessions
+	mailer   mail.Mailer
+
+	llm        *llm.Client
+	translator generation.Translator
+	enhancer   generation.Enhancer
+
+	botHandler  *handler.BotHandler
+	worker      *generation.Worker
+	videoWorker *generation.VideoWorker
+	renewer     *billing.Renewer
+	expirer     *billing.Expirer
+
+	shutdownTracing func(context.Context) error
 }
 
-func New() (*App, error) {
-	app := &App{}
+func New(cfg *config.Config) (*App, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	app, err := newApp(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Features.SeedOnStart {
+		if err := app.seedOnStart(context.Background()); err != nil {
+			app.logger.Warn("Failed to seed catalog", logging.Err(err))
+		}
+	}
+
+	app.botHandler.RegisterHandlers()
+
+	if err := app.loadRoutes(); err != nil {
+		return nil, err
+	}
+
+	return app, nil
+}
+
+// newApp connects everything the serve and worker commands share: the
+// database, metrics, tracing, the bot client, translations, the LLM, auth,
+// the generation workers and subscription renewals.
+// It does not register bot handlers or HTTP routes.
+func newApp(cfg *config.Config) (*App, error) {
+	app := &App{config: cfg, logger: newLogger(cfg.Log)}
 
 	err := app.connectToDB()
 	if err != nil {
 		return nil, fmt.Errorf("error: %w", err)
 	}
 
-	app.DB.AutoMigrate(&model.User{}, &model.Category{}, &model.GeneratedImage{}, &model.ImageGenerationRequest{}, &model.Transaction{}, &model.UserCredit{}, &model.TrendingPrompt{})
+	if err := app.checkSchema(context.Background()); err != nil {
+		return nil, fmt.Errorf("error: %w", err)
+	}
 
-	if err := app.SeedCategories(); err != nil {
-		fmt.Printf("Warning: Failed to seed categories: %v\n", err)
+	if err := app.connectToMetrics(); err != nil {
+		return nil, fmt.Errorf("error: %w", err)
 	}
 
-	if err := app.SeedTrendingPrompts(); err != nil {
-		fmt.Printf("Warning: Failed to seed trending prompts: %v\n", err)
+	if err := app.connectToTracing(); err != nil {
+		return nil, fmt.Errorf("error: %w", err)
 	}
 
 	err = app.connectToBot()
@@ -41,24 +102,61 @@ func New() (*App, error) {
 		return nil, fmt.Errorf("error: %w", err)
 	}
 
-	botHandler := handler.NewBotHandler(app.bot, app.DB)
-	botHandler.RegisterHandlers()
+	app.i18n, err = i18n.NewBundle()
+	if err != nil {
+		return nil, fmt.Errorf("error: %w", err)
+	}
+
+	app.connectToLLM()
 
-	app.loadRoutes()
+	if err := app.connectToAuth(); err != nil {
+		return nil, fmt.Errorf("error: %w", err)
+	}
+
+	app.botHandler = handler.NewBotHandler(app.bot, app.repos, handler.BotHandlerOptions{
+		I18n:           app.i18n,
+		Translator:     app.translator,
+		Enhancer:       app.enhancer,
+		Pricing:        cfg.Pricing,
+		Referral:       cfg.Referral,
+		FreeTier:       cfg.FreeTier,
+		RateLimit:      cfg.RateLimit,
+		Idempotency:    cfg.Idempotency,
+		CallbackSecret: app.callbackSecret(),
+		Metrics:        app.metrics,
+		Logger:         app.logger,
+	})
+
+	app.connectToWorker()
+	app.connectToBilling()
 
 	return app, nil
 }
 
 func (a *App) Start(ctx context.Context) error {
+	defer a.flushTracing()
+
 	server := &http.Server{
-		Addr:    ":5000",
+		Addr:    a.config.Server.Addr,
 		Handler: a.router,
 	}
 
+	if err := a.syncWebhook(); err != nil {
+		return err
+	}
+
 	ch := make(chan error, 1)
 
+	if a.config.Worker.RunWithServer {
+		go a.worker.Run(ctx)
+		go a.videoWorker.Run(ctx)
+		go a.renewer.Run(ctx)
+		go a.expirer.Run(ctx)
+		go a.purgeIdempotencyKeys(ctx)
+	}
+
 	go func() {
-		fmt.Println("Starting bot...")
+		a.logger.Info("Starting bot", "mode", a.config.Bot.Mode)
 		a.bot.Start()
 	}()
 
@@ -74,8 +172,10 @@ func (a *App) Start(ctx context.Context) error {
 	case err := <-ch:
 		return err
 	case <-ctx.Done():
-		timeout, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		timeout, cancel := context.WithTimeout(context.Background(), a.config.Server.ShutdownTimeout)
 		defer cancel()
+		// The server stops first, so the bot handles every webhook update
+		// already acknowledged before it stops
 		if err := server.Shutdown(timeout); err != nil {
 			return fmt.Errorf("server shutdown failed: %w", err)
 		}
@@ -0,0 +1,46 @@
+package application
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+
+	"github.com/Leul-Michael/image-generation/auth"
+	"github.com/Leul-Michael/image-generation/config"
+	"github.com/Leul-Michael/image-generation/mail"
+)
+
+// connectToAuth sets up session signing and the mailer for account emails.
+func (a *App) connectToAuth() error {
+	secret := []byte(a.config.Auth.SessionSecret)
+	if len(secret) == 0 {
+		sum := sha256.Sum256([]byte("session:" + a.config.Bot.Token))
+		secret = sum[:]
+	}
+	a.sessions = auth.NewSessions(secret, a.config.Auth.SessionTTL)
+
+	cfg := a.config.Mail
+	switch cfg.Driver {
+	case config.MailDriverSMTP:
+		a.mailer = &mail.SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.From,
+		}
+	default:
+		out := os.Stdout
+		if cfg.LogFile != "" {
+			f, err := os.OpenFile(cfg.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+			if err != nil {
+				return fmt.Errorf("failed to open mail log: %w", err)
+			}
+			out = f
+		}
+		a.logger.Warn("Mail driver is log, account emails are written to the log instead of sent")
+		a.mailer = &mail.LogMailer{From: cfg.From, W: out}
+	}
+
+	return nil
+}
@@ -0,0 +1,22 @@
+package application
+
+import (
+	"github.com/Leul-Michael/image-generation/billing"
+)
+
+func (a *App) connectToBilling() {
+	// No payment provider is integrated yet
+	a.renewer = billing.NewRenewer(a.repos.Subscriptions, billing.PlaceholderCharger{}, a.botHandler, billing.RenewerOptions{
+		CheckInterval: a.config.Billing.CheckInterval,
+		RetryInterval: a.config.Billing.RetryInterval,
+		GracePeriod:   a.config.Billing.GracePeriod,
+		Logger:        a.logger,
+	})
+
+	a.expirer = billing.NewExpirer(a.repos.Credits, a.botHandler, billing.ExpirerOptions{
+		Hour:           a.config.Credits.ExpiryHour,
+		Location:       a.config.FreeTier.Location(),
+		ReminderBefore: a.config.Credits.ReminderBefore,
+		Logger:         a.logger,
+	})
+}
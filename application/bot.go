@@ -1,23 +1,33 @@
 package application
 
 import (
+	"crypto/sha256"
 	"fmt"
-	"os"
-	"time"
 
+	"github.com/Leul-Michael/image-generation/config"
+	"github.com/Leul-Michael/image-generation/handler"
+	"github.com/Leul-Michael/image-generation/logging"
 	tele "gopkg.in/telebot.v3"
 )
 
 func (a *App) connectToBot() error {
-	botToken := os.Getenv("BOT_TOKEN")
-	if botToken == "" {
-		return fmt.Errorf("BOT_TOKEN environment variable is required")
+	var poller tele.Poller = &tele.LongPoller{Timeout: a.config.Bot.PollTimeout}
+	if a.config.Bot.Mode == config.BotModeWebhook {
+		a.webhook = handler.NewWebhookPoller(a.config.Bot.WebhookSecret)
+		poller = a.webhook
 	}
 
 	// Initialize Telegram bot
 	pref := tele.Settings{
-		Token:  botToken,
-		Poller: &tele.LongPoller{Timeout: 10 * time.Second},
+		Token:  a.config.Bot.Token,
+		Poller: poller,
+		OnError: func(err error, c tele.Context) {
+			// Handler errors are logged with their update by the bot
+			// handler; the rest, e.g. from polling, have no update
+			if c == nil {
+				a.logger.Error("Telegram bot error", logging.Err(err))
+			}
+		},
 	}
 
 	bot, err := tele.NewBot(pref)
@@ -29,3 +39,39 @@ func (a *App) connectToBot() error {
 
 	return nil
 }
+
+// callbackSecret is the key that signs inline button data.
+func (a *App) callbackSecret() []byte {
+	if a.config.Bot.CallbackSecret != "" {
+		return []byte(a.config.Bot.CallbackSecret)
+	}
+	sum := sha256.Sum256([]byte("callback:" + a.config.Bot.Token))
+	return sum[:]
+}
+
+// syncWebhook makes Telegram's webhook registration match the configured
+// mode. Polling needs the webhook removed or getUpdates is rejected.
+func (a *App) syncWebhook() error {
+	if a.config.Bot.Mode != config.BotModeWebhook {
+		if err := a.bot.RemoveWebhook(); err != nil {
+			return fmt.Errorf("failed to delete webhook: %w", err)
+		}
+		return nil
+	}
+
+	if !a.config.Bot.RegisterWebhook {
+		return nil
+	}
+
+	webhook := &tele.Webhook{
+		SecretToken:    a.config.Bot.WebhookSecret,
+		AllowedUpdates: []string{"message", "callback_query"},
+		Endpoint:       &tele.WebhookEndpoint{PublicURL: a.config.Bot.WebhookEndpoint()},
+	}
+	if err := a.bot.SetWebhook(webhook); err != nil {
+		return fmt.Errorf("failed to set webhook: %w", err)
+	}
+
+	a.logger.Info("Registered webhook", "url", a.config.Bot.WebhookEndpoint())
+	return nil
+}
@@ -1,31 +1,92 @@
 package application
 
 import (
+	"context"
 	"fmt"
-	"os"
 
+	"github.com/Leul-Michael/image-generation/config"
+	"github.com/Leul-Michael/image-generation/handler"
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/Leul-Michael/image-generation/migrations"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
 )
 
-func (a *App) connectToDB() error {
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		return fmt.Errorf("env variable not provided")
-	}
-
+func openDB(cfg config.DatabaseConfig, logger gormlogger.Interface) (*gorm.DB, error) {
 	db, err := gorm.Open(postgres.New(postgres.Config{
-		DSN:                  dsn,
+		DSN:                  cfg.URL,
 		PreferSimpleProtocol: true, // disables implicit prepared statement usage
-	}), &gorm.Config{})
+	}), &gorm.Config{Logger: logger})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to db: %w", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get db pool: %w", err)
+	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	return db, nil
+}
 
+func (a *App) connectToDB() error {
+	db, err := openDB(a.config.Database, logging.Gorm(a.logger, a.config.Log.SlowQuery))
 	if err != nil {
-		return fmt.Errorf("failed to connect to db: %w", err)
+		return err
 	}
 
 	a.DB = db
+	a.repos = handler.NewPostgresRepos(db, a.config.FreeTier, a.config.Credits)
+
+	a.logger.Info("Connected to database")
+
+	return nil
+}
 
-	fmt.Println("Connected to db...")
+// checkSchema refuses to start the app until every migration is applied.
+func (a *App) checkSchema(ctx context.Context) error {
+	sqlDB, err := a.DB.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get db pool: %w", err)
+	}
+
+	migrator, err := migrations.New(sqlDB)
+	if err != nil {
+		return err
+	}
 
+	if err := migrator.EnsureCurrent(ctx); err != nil {
+		return fmt.Errorf("%w (run the migrate up command first)", err)
+	}
 	return nil
 }
+
+// openApp connects only to the database, for one-off commands that don't
+// need the bot or LLM.
+func openApp(ctx context.Context, cfg *config.Config) (*App, error) {
+	if err := cfg.Database.Validate(); err != nil {
+		return nil, err
+	}
+
+	app := &App{config: cfg, logger: newLogger(cfg.Log)}
+	if err := app.connectToDB(); err != nil {
+		return nil, err
+	}
+
+	if err := app.checkSchema(ctx); err != nil {
+		app.close()
+		return nil, err
+	}
+	return app, nil
+}
+
+func (a *App) close() {
+	if sqlDB, err := a.DB.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
@@ -0,0 +1,27 @@
+package application
+
+import (
+	"github.com/Leul-Michael/image-generation/generation"
+	"github.com/Leul-Michael/image-generation/llm"
+)
+
+// connectToLLM configures the chat model used for prompt translation and
+// enhancement. The LLM is optional; without an API key prompts are used as
+// typed and the enhance option is hidden.
+func (a *App) connectToLLM() {
+	a.translator = generation.NoopTranslator{}
+
+	if !a.config.LLMEnabled() {
+		a.logger.Warn("LLM_API_KEY not set, prompt translation and enhancement are disabled")
+		return
+	}
+
+	a.llm = llm.NewClient(a.config.LLM.APIURL, a.config.LLM.APIKey, a.config.LLM.Model)
+
+	if a.config.Features.PromptTranslation {
+		a.translator = generation.NewLLMTranslator(a.llm)
+	}
+	if a.config.Features.PromptEnhancement {
+		a.enhancer = generation.NewLLMEnhancer(a.llm)
+	}
+}
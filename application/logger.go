@@ -0,0 +1,20 @@
+package application
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/Leul-Michael/image-generation/config"
+	"github.com/Leul-Michael/image-generation/logging"
+)
+
+// newLogger returns the logger cfg describes, writing to stdout. It is also
+// made the default, so anything still using the log package goes through it.
+func newLogger(cfg config.LogConfig) *slog.Logger {
+	logger := logging.New(os.Stdout, logging.Options{
+		Level: cfg.SlogLevel(),
+		JSON:  cfg.Format == config.LogFormatJSON,
+	})
+	slog.SetDefault(logger)
+	return logger
+}
@@ -0,0 +1,56 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Leul-Michael/image-generation/handler"
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/Leul-Michael/image-generation/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// connectToMetrics sets up a.metrics, with the database pool stats and the
+// generation queue depths, unless metrics are disabled.
+func (a *App) connectToMetrics() error {
+	if !a.config.Metrics.Enabled {
+		return nil
+	}
+
+	sqlDB, err := a.DB.DB()
+	if err != nil {
+		return err
+	}
+
+	a.metrics = metrics.New()
+	a.metrics.RegisterDB(sqlDB, "postgres")
+	a.metrics.RegisterQueues(map[string]metrics.QueueCounter{
+		metrics.TypeImage: a.repos.Requests,
+		metrics.TypeVideo: a.repos.VideoRequests,
+	}, a.logger)
+	return nil
+}
+
+// serveWorkerMetrics serves metrics on Metrics.WorkerAddr until ctx is
+// cancelled, for workers that run without the HTTP server.
+func (a *App) serveWorkerMetrics(ctx context.Context) {
+	if a.metrics == nil || a.config.Metrics.WorkerAddr == "" {
+		return
+	}
+
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.GET(a.config.Metrics.Path, handler.MetricsHandler(a.metrics, a.config.Metrics.Token))
+	server := &http.Server{Addr: a.config.Metrics.WorkerAddr, Handler: router}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	a.logger.Info("Serving worker metrics", "addr", a.config.Metrics.WorkerAddr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		a.logger.Error("Failed to serve worker metrics", logging.Err(err))
+	}
+}
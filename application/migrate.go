@@ -0,0 +1,91 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/Leul-Michael/image-generation/config"
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/Leul-Michael/image-generation/migrations"
+)
+
+// Migrate runs a migration command against the configured database:
+//
+//	up          apply all pending migrations
+//	down [n]    revert the last n migrations (default 1)
+//	status      list migrations and when they were applied
+func Migrate(ctx context.Context, cfg *config.Config, args []string, out io.Writer) error {
+	if err := cfg.Database.Validate(); err != nil {
+		return err
+	}
+
+	db, err := openDB(cfg.Database, logging.Gorm(newLogger(cfg.Log), cfg.Log.SlowQuery))
+	if err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get db pool: %w", err)
+	}
+	defer sqlDB.Close()
+
+	migrator, err := migrations.New(sqlDB)
+	if err != nil {
+		return err
+	}
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		done, err := migrator.Up(ctx)
+		for _, m := range done {
+			fmt.Fprintf(out, "applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			fmt.Fprintln(out, "schema is up to date")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid step count %q", args[1])
+			}
+		}
+		done, err := migrator.Down(ctx, steps)
+		for _, m := range done {
+			fmt.Fprintf(out, "reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(out, "%04d_%-30s %s\n", s.Version, s.Name, applied)
+		}
+
+	default:
+		return fmt.Errorf("unknown migrate command %q (want up, down or status)", command)
+	}
+
+	return nil
+}
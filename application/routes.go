@@ -1,22 +1,39 @@
 package application
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/Leul-Michael/image-generation/handler"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
-func (a *App) loadRoutes() {
-	router := gin.Default()
+func (a *App) loadRoutes() error {
+	router := gin.New()
+	// Only proxies we run may say who the client is; ByIP limits by it
+	if err := router.SetTrustedProxies(a.config.Server.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+
+	// Registered ahead of the middleware so scrapes are neither logged,
+	// measured nor traced.
+	if a.metrics != nil {
+		router.GET(a.config.Metrics.Path, gin.Recovery(), handler.MetricsHandler(a.metrics, a.config.Metrics.Token))
+	}
+
+	if a.config.Tracing.Enabled {
+		router.Use(otelgin.Middleware(a.config.Tracing.ServiceName))
+	}
+	router.Use(handler.RequestLogger(a.logger), handler.RequestMetrics(a.metrics), gin.Recovery())
 
 	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"*"},
+		AllowOrigins:     a.config.Server.CORSOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"*"},
 		ExposeHeaders:    []string{"*"},
-		AllowCredentials: true,
+		AllowCredentials: !a.config.Server.AllowsAnyOrigin(),
 	}))
 
 	router.GET("/health", func(c *gin.Context) {
@@ -26,20 +43,44 @@ func (a *App) loadRoutes() {
 		})
 	})
 
-	userHandler := handler.NewUserHandler(a.DB, a.bot)
+	if a.webhook != nil {
+		router.POST(a.config.Bot.WebhookPath, a.webhook.HandleUpdate)
+	}
+
+	userHandler := handler.NewUserHandler(a.repos, a.bot, a.i18n, a.sessions, a.config.Auth.TelegramMaxAge, a.logger)
+	authHandler := handler.NewAuthHandler(a.repos, a.i18n, a.mailer, a.sessions, a.config.Auth, a.logger)
 
-	v1Router := router.Group("/api/v1")
+	requireSession := handler.WithSession(a.sessions, a.repos, true)
+	limiter := handler.NewAPILimiter(a.repos, a.config.RateLimit, a.logger)
+	idempotent := handler.Idempotent(a.repos, a.config.Idempotency.KeyTTL, a.logger)
+
+	v1Router := router.Group("/api/v1", limiter.ByIP())
 	{
+		// Auth responses carry session tokens, which must not be stored for
+		// replays, so these routes don't take an Idempotency-Key.
 		authRouter := v1Router.Group("/auth")
 		{
 			authRouter.GET("/telegram", userHandler.HandleTelegramAuth)
+			authRouter.GET("/telegram/widget", userHandler.HandleTelegramWidgetAuth)
+			authRouter.POST("/telegram/widget", userHandler.HandleTelegramWidgetAuth)
+
+			authRouter.POST("/register", authHandler.Register)
+			authRouter.POST("/login", authHandler.Login)
+			authRouter.POST("/verify-email", authHandler.VerifyEmail)
+			authRouter.POST("/verify-email/resend", requireSession, authHandler.ResendVerification)
+			authRouter.POST("/password/forgot", authHandler.ForgotPassword)
+			authRouter.POST("/password/reset", authHandler.ResetPassword)
+			authRouter.POST("/link-email", requireSession, authHandler.LinkEmail)
 		}
 
-		userRouter := v1Router.Group("/users")
+		// Mini App clients trade their initData for a session at
+		// /auth/telegram first.
+		userRouter := v1Router.Group("/users", requireSession, limiter.ByUser(), idempotent)
 		{
 			userRouter.GET("/me", userHandler.GetCurrentUser)
 			userRouter.PUT("/me", userHandler.UpdateCurrentUser)
 			userRouter.GET("/me/credits", userHandler.GetUserCredits)
+			userRouter.POST("/me/promo-codes", userHandler.RedeemPromoCode)
 		}
 
 		v1Router.GET("/categories", userHandler.GetCategories)
@@ -47,4 +88,5 @@ func (a *App) loadRoutes() {
 	}
 
 	a.router = router
+	return nil
 }
@@ -0,0 +1,48 @@
+package application
+
+import (
+	"context"
+
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/Leul-Michael/image-generation/tracing"
+)
+
+// connectToTracing exports spans to the configured collector and traces
+// database queries, unless tracing is disabled.
+func (a *App) connectToTracing() error {
+	cfg := a.config.Tracing
+	if !cfg.Enabled {
+		return nil
+	}
+
+	shutdown, err := tracing.Setup(context.Background(), tracing.Options{
+		ServiceName: cfg.ServiceName,
+		Endpoint:    cfg.Endpoint,
+		Insecure:    cfg.Insecure,
+		SampleRatio: cfg.SampleRatio,
+	})
+	if err != nil {
+		return err
+	}
+	a.shutdownTracing = shutdown
+
+	if err := a.DB.Use(tracing.Gorm()); err != nil {
+		return err
+	}
+
+	a.logger.Info("Exporting traces", "endpoint", cfg.Endpoint, "sample_ratio", cfg.SampleRatio)
+	return nil
+}
+
+// flushTracing exports the spans still buffered, before the app exits.
+func (a *App) flushTracing() {
+	if a.shutdownTracing == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.config.Server.ShutdownTimeout)
+	defer cancel()
+	if err := a.shutdownTracing(ctx); err != nil {
+		a.logger.Error("Failed to flush traces", logging.Err(err))
+	}
+}
@@ -0,0 +1,90 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/config"
+	"github.com/Leul-Michael/image-generation/generation"
+	"github.com/Leul-Michael/image-generation/logging"
+)
+
+// idempotencyPurgeInterval is how often expired idempotency keys are
+// deleted.
+const idempotencyPurgeInterval = time.Hour
+
+func (a *App) connectToWorker() {
+	// No image model is integrated yet
+	provider := generation.PlaceholderProvider{Delay: 2 * time.Second}
+
+	a.worker = generation.NewWorker(a.repos.Requests, provider, a.botHandler, generation.WorkerOptions{
+		Concurrency:     a.config.Worker.Concurrency,
+		PollInterval:    a.config.Worker.PollInterval,
+		StaleAfter:      a.config.Worker.StaleAfter,
+		GenerateTimeout: a.config.Worker.GenerateTimeout,
+		MaxProcessing:   a.config.RateLimit.ProviderConcurrency,
+		Metrics:         a.metrics,
+		Logger:          a.logger,
+	})
+
+	// No video model is integrated yet either
+	a.videoWorker = generation.NewVideoWorker(a.repos.VideoRequests, &generation.PlaceholderVideoProvider{Steps: 4}, a.botHandler, a.botHandler, generation.VideoWorkerOptions{
+		Concurrency:     a.config.Worker.VideoConcurrency,
+		PollInterval:    a.config.Worker.PollInterval,
+		JobPollInterval: a.config.Worker.VideoPollInterval,
+		Timeout:         a.config.Worker.VideoTimeout,
+		MaxRunning:      a.config.RateLimit.VideoProviderConcurrency,
+		Metrics:         a.metrics,
+		Logger:          a.logger,
+	})
+}
+
+// RunWorker processes image and video generation requests, subscription
+// renewals, credit expiry and idempotency key cleanup without serving HTTP or
+// bot updates, so workers can be scaled separately from the bot. Results are
+// still delivered through the bot API. Metrics are served on their own
+// address.
+func RunWorker(ctx context.Context, cfg *config.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	app, err := newApp(cfg)
+	if err != nil {
+		return err
+	}
+	defer app.flushTracing()
+
+	go app.renewer.Run(ctx)
+	go app.expirer.Run(ctx)
+	go app.videoWorker.Run(ctx)
+	go app.purgeIdempotencyKeys(ctx)
+	go app.serveWorkerMetrics(ctx)
+
+	if err := app.worker.Run(ctx); err != nil {
+		return fmt.Errorf("worker stopped: %w", err)
+	}
+	return nil
+}
+
+// purgeIdempotencyKeys deletes expired idempotency keys every
+// idempotencyPurgeInterval until ctx is cancelled.
+func (a *App) purgeIdempotencyKeys(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(idempotencyPurgeInterval):
+		}
+
+		deleted, err := a.repos.Idempotency.DeleteExpired(ctx, time.Now())
+		if err != nil {
+			a.logger.ErrorContext(ctx, "Failed to delete expired idempotency keys", logging.Err(err))
+			continue
+		}
+		if deleted > 0 {
+			a.logger.InfoContext(ctx, "Deleted expired idempotency keys", "count", deleted)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSessionsVerify(t *testing.T) {
+	sessions := NewSessions([]byte("secret"), time.Hour)
+	userID := uuid.New()
+
+	token, _ := sessions.Issue(userID, 3)
+	gotID, version, err := sessions.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if gotID != userID || version != 3 {
+		t.Errorf("Verify = %s, %d, want %s, 3", gotID, version, userID)
+	}
+
+	other := NewSessions([]byte("other secret"), time.Hour)
+	if _, _, err := other.Verify(token); err != ErrInvalidSession {
+		t.Errorf("Verify with another secret: err = %v, want %v", err, ErrInvalidSession)
+	}
+
+	expired := NewSessions([]byte("secret"), -time.Minute)
+	token, _ = expired.Issue(userID, 0)
+	if _, _, err := sessions.Verify(token); err != ErrInvalidSession {
+		t.Errorf("Verify expired: err = %v, want %v", err, ErrInvalidSession)
+	}
+}
@@ -0,0 +1,30 @@
+// Package billing renews subscriptions: it charges each period, grants the
+// plan's credits and ends subscriptions that are canceled or go unpaid. It
+// also expires bonus credits and reminds users before they do.
+package billing
+
+import (
+	"context"
+
+	"github.com/Leul-Michael/image-generation/model"
+)
+
+// Charger collects the price of a subscription's next period. Charge must
+// bill a period, identified by sub.ID and sub.CurrentPeriodEnd, at most once:
+// it is called again if storing a paid renewal fails.
+type Charger interface {
+	Name() string
+	Charge(ctx context.Context, sub *model.Subscription) error
+}
+
+// PlaceholderCharger stands in for a payment provider. Like deposits, which
+// are credited without a payment yet, every charge succeeds.
+type PlaceholderCharger struct{}
+
+func (PlaceholderCharger) Name() string {
+	return "placeholder"
+}
+
+func (PlaceholderCharger) Charge(ctx context.Context, sub *model.Subscription) error {
+	return nil
+}
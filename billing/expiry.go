@@ -0,0 +1,101 @@
+package billing
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/logging"
+	creditrepo "github.com/Leul-Michael/image-generation/repository/credit"
+)
+
+// ExpiryNotifier reminds users of credits about to expire.
+type ExpiryNotifier interface {
+	NotifyExpiringCredits(ctx context.Context, expiring creditrepo.Expiring) error
+}
+
+type ExpirerOptions struct {
+	// Hour is the hour of the day, in Location, the job runs at.
+	Hour     int
+	Location *time.Location
+	// ReminderBefore is how long before credits expire users are reminded.
+	ReminderBefore time.Duration
+	// Logger defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+// Expirer sweeps expired bonus credits and sends expiry reminders once a
+// day. Several expirers can run at once: each balance is expired in one
+// database transaction and reminders are claimed.
+type Expirer struct {
+	credits  creditrepo.UserCreditRepo
+	notifier ExpiryNotifier
+	opts     ExpirerOptions
+}
+
+func NewExpirer(credits creditrepo.UserCreditRepo, notifier ExpiryNotifier, opts ExpirerOptions) *Expirer {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	return &Expirer{
+		credits:  credits,
+		notifier: notifier,
+		opts:     opts,
+	}
+}
+
+// Run runs the job daily until ctx is cancelled.
+func (e *Expirer) Run(ctx context.Context) error {
+	for {
+		next := e.NextRun(time.Now())
+		e.opts.Logger.Info("Scheduled credit expiry", "next_run", next)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Until(next)):
+		}
+
+		runCtx := logging.WithCorrelationID(ctx, logging.NewCorrelationID())
+		if err := e.RunOnce(runCtx, time.Now()); err != nil {
+			e.opts.Logger.ErrorContext(runCtx, "Failed to expire credits", logging.Err(err))
+		}
+	}
+}
+
+// NextRun is the first time after now at the configured hour.
+func (e *Expirer) NextRun(now time.Time) time.Time {
+	local := now.In(e.opts.Location)
+	next := time.Date(local.Year(), local.Month(), local.Day(), e.opts.Hour, 0, 0, 0, e.opts.Location)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// RunOnce expires the bonus credits due at now, then reminds users of those
+// expiring within ReminderBefore. A failed reminder is not retried.
+func (e *Expirer) RunOnce(ctx context.Context, now time.Time) error {
+	expired, err := e.credits.ExpireDue(ctx, now)
+	if len(expired) > 0 {
+		e.opts.Logger.InfoContext(ctx, "Expired unused bonus credits", "balances", len(expired))
+	}
+	if err != nil {
+		return err
+	}
+
+	if e.opts.ReminderBefore <= 0 {
+		return nil
+	}
+
+	expiring, err := e.credits.ClaimReminders(ctx, now, now.Add(e.opts.ReminderBefore))
+	if err != nil {
+		return err
+	}
+	for _, credits := range expiring {
+		if err := e.notifier.NotifyExpiringCredits(ctx, credits); err != nil {
+			e.opts.Logger.WarnContext(ctx, "Failed to remind user of expiring credits", "user_id", credits.UserID, logging.Err(err))
+		}
+	}
+	return nil
+}
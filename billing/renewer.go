@@ -0,0 +1,165 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/Leul-Michael/image-generation/model"
+	subscriptionrepo "github.com/Leul-Michael/image-generation/repository/subscription"
+)
+
+// Event is what happened to a subscription at renewal.
+type Event string
+
+const (
+	EventRenewed Event = "renewed"
+	// EventPastDue is the first failed charge of a period.
+	EventPastDue Event = "past_due"
+	// EventEnded is a subscription canceled or expired; sub.Status says
+	// which.
+	EventEnded Event = "ended"
+)
+
+// Notifier tells the user about renewals. grant is the credits granted on
+// EventRenewed and nil otherwise.
+type Notifier interface {
+	NotifySubscription(ctx context.Context, sub *model.Subscription, event Event, grant *model.Transaction) error
+}
+
+type RenewerOptions struct {
+	// CheckInterval is how often due subscriptions are looked for.
+	CheckInterval time.Duration
+	// RetryInterval is how long a failed charge waits for another attempt.
+	// It is also the lease on a claimed subscription.
+	RetryInterval time.Duration
+	// GracePeriod is how long after the end of an unpaid period the
+	// subscription keeps its perks before it expires.
+	GracePeriod time.Duration
+	// Logger defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+// Renewer renews due subscriptions. Several renewers can run at once:
+// claiming a subscription is atomic.
+type Renewer struct {
+	subscriptions subscriptionrepo.SubscriptionRepo
+	charger       Charger
+	notifier      Notifier
+	opts          RenewerOptions
+}
+
+func NewRenewer(subscriptions subscriptionrepo.SubscriptionRepo, charger Charger, notifier Notifier, opts RenewerOptions) *Renewer {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	return &Renewer{
+		subscriptions: subscriptions,
+		charger:       charger,
+		notifier:      notifier,
+		opts:          opts,
+	}
+}
+
+// Run renews subscriptions until ctx is cancelled.
+func (r *Renewer) Run(ctx context.Context) error {
+	r.opts.Logger.Info("Starting subscription renewals", "charger", r.charger.Name())
+
+	for {
+		processed, err := r.RunOnce(ctx, time.Now())
+		if err != nil {
+			r.opts.Logger.ErrorContext(ctx, "Failed to claim subscription", logging.Err(err))
+		}
+
+		if processed {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(r.opts.CheckInterval):
+		}
+	}
+}
+
+// RunOnce claims and processes a single subscription due at now. It reports
+// whether there was one to process.
+func (r *Renewer) RunOnce(ctx context.Context, now time.Time) (bool, error) {
+	sub, err := r.subscriptions.ClaimDue(ctx, now, now.Add(r.opts.RetryInterval))
+	if errors.Is(err, subscriptionrepo.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Each renewal is logged under its own correlation ID
+	r.process(logging.WithCorrelationID(ctx, logging.NewCorrelationID()), sub, now)
+	return true, nil
+}
+
+func (r *Renewer) process(ctx context.Context, sub *model.Subscription, now time.Time) {
+	if sub.CancelAtPeriodEnd || !sub.Plan.IsActive {
+		r.end(ctx, sub, model.SubscriptionStatusCanceled, now)
+		return
+	}
+
+	if err := r.charger.Charge(ctx, sub); err != nil {
+		r.chargeFailed(ctx, sub, err, now)
+		return
+	}
+
+	grant, err := r.subscriptions.Renew(ctx, sub)
+	if err != nil {
+		// Retried after the lease, when Charge sees the same period again
+		r.opts.Logger.ErrorContext(ctx, "Failed to renew subscription after charging it", "subscription_id", sub.ID, logging.Err(err))
+		return
+	}
+	r.opts.Logger.InfoContext(ctx, "Renewed subscription", "subscription_id", sub.ID, "user_id", sub.UserID, "plan", sub.Plan.Code)
+
+	r.notify(ctx, sub, EventRenewed, grant)
+}
+
+// chargeFailed keeps sub past due until its grace period is over, then
+// expires it.
+func (r *Renewer) chargeFailed(ctx context.Context, sub *model.Subscription, reason error, now time.Time) {
+	r.opts.Logger.WarnContext(ctx, "Charging subscription failed", "subscription_id", sub.ID, "reason", reason)
+
+	graceUntil := sub.CurrentPeriodEnd.Add(r.opts.GracePeriod)
+	if !now.Before(graceUntil) {
+		r.end(ctx, sub, model.SubscriptionStatusExpired, now)
+		return
+	}
+
+	firstFailure := sub.Status == model.SubscriptionStatusActive
+	retryAt := now.Add(r.opts.RetryInterval)
+	if retryAt.After(graceUntil) {
+		retryAt = graceUntil
+	}
+	if err := r.subscriptions.MarkPastDue(ctx, sub, retryAt, graceUntil); err != nil {
+		r.opts.Logger.ErrorContext(ctx, "Failed to mark subscription past due", "subscription_id", sub.ID, logging.Err(err))
+		return
+	}
+
+	if firstFailure {
+		r.notify(ctx, sub, EventPastDue, nil)
+	}
+}
+
+func (r *Renewer) end(ctx context.Context, sub *model.Subscription, status model.SubscriptionStatus, now time.Time) {
+	if err := r.subscriptions.End(ctx, sub, status, now); err != nil {
+		r.opts.Logger.ErrorContext(ctx, "Failed to end subscription", "subscription_id", sub.ID, logging.Err(err))
+		return
+	}
+	r.opts.Logger.InfoContext(ctx, "Ended subscription", "subscription_id", sub.ID, "user_id", sub.UserID, "status", status)
+	r.notify(ctx, sub, EventEnded, nil)
+}
+
+func (r *Renewer) notify(ctx context.Context, sub *model.Subscription, event Event, grant *model.Transaction) {
+	if err := r.notifier.NotifySubscription(ctx, sub, event, grant); err != nil {
+		r.opts.Logger.ErrorContext(ctx, "Failed to notify about subscription", "subscription_id", sub.ID, "event", event, logging.Err(err))
+	}
+}
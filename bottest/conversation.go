@@ -0,0 +1,338 @@
+package bottest
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/telebot.v3"
+)
+
+// Chat is a private conversation between one user and the bot. Expect reads
+// the bot's replies in order, so every reply has to be expected before the
+// next one can be checked.
+type Chat struct {
+	h        *Harness
+	user     telebot.User
+	seen     int // number of messages already returned by Expect
+	answered int // number of callback answers already checked by ExpectAnswer
+}
+
+// Reply is what Expect compares a bot message against. Keyboard must match
+// exactly: nil means the message has no inline keyboard. Button data is
+// compared decoded, e.g. "deposit_video_100".
+type Reply struct {
+	Text     string
+	Keyboard [][]Button
+	// Edit means the bot edited its previous message instead of sending a
+	// new one, as it does when answering a button press.
+	Edit bool
+	// Photo is the photo URL of a sendPhoto message. Text is then the
+	// caption.
+	Photo string
+	// Video is the video URL of a sendVideo message. Text is then the
+	// caption.
+	Video string
+}
+
+// Send sends text as the user, e.g. a command or a prompt.
+func (c *Chat) Send(text string) {
+	message := &telebot.Message{
+		Sender:   &c.user,
+		Unixtime: time.Now().Unix(),
+		Chat:     c.chat(),
+		Text:     text,
+	}
+	if strings.HasPrefix(text, "/") {
+		command, _, _ := strings.Cut(text, " ")
+		message.Entities = telebot.Entities{{Type: telebot.EntityCommand, Length: len(command)}}
+	}
+
+	c.h.Server.Push(telebot.Update{Message: message})
+}
+
+// SendPhoto sends a photo with a caption as the user. The photo is stored on
+// the server, so the bot can download it.
+func (c *Chat) SendPhoto(caption string) {
+	fileID := c.h.Server.AddFile([]byte("fake photo"))
+
+	c.h.Server.Push(telebot.Update{Message: &telebot.Message{
+		Sender:   &c.user,
+		Unixtime: time.Now().Unix(),
+		Chat:     c.chat(),
+		Photo:    &telebot.Photo{File: telebot.File{FileID: fileID}, Width: 512, Height: 512},
+		Caption:  caption,
+	}})
+}
+
+// Click presses the button with the given decoded callback data or text on
+// the latest bot message that has one. Keyboards removed by an edit can't be
+// pressed.
+func (c *Chat) Click(button string) {
+	c.h.t.Helper()
+	c.click(button, 1)
+}
+
+// DoubleTap presses the button twice in a row, before the bot has answered
+// the first tap.
+func (c *Chat) DoubleTap(button string) {
+	c.h.t.Helper()
+	c.click(button, 2)
+}
+
+func (c *Chat) click(button string, taps int) {
+	c.h.t.Helper()
+
+	messages := c.h.Server.Messages(c.user.ID)
+	current := make(map[int]bool)
+	for i := len(messages) - 1; i >= 0; i-- {
+		message := messages[i]
+		if current[message.MessageID] {
+			continue // superseded by a later edit
+		}
+		current[message.MessageID] = true
+
+		for _, row := range message.Keyboard {
+			for _, b := range row {
+				if c.h.decodeData(b.Data) != button && b.Text != button {
+					continue
+				}
+
+				for range taps {
+					c.h.Server.Push(telebot.Update{Callback: &telebot.Callback{
+						Sender:  &c.user,
+						Message: message.wire(),
+						Data:    b.Data,
+					}})
+				}
+				return
+			}
+		}
+	}
+
+	c.h.t.Fatalf("no button %q on any message in chat %d", button, c.user.ID)
+}
+
+// Press sends a callback query with raw data from the latest bot message, as
+// if one of its buttons carried it, e.g. a forged button or one from an
+// older version of the bot.
+func (c *Chat) Press(data string) {
+	c.h.t.Helper()
+
+	messages := c.h.Server.Messages(c.user.ID)
+	if len(messages) == 0 {
+		c.h.t.Fatalf("no message to press a button on in chat %d", c.user.ID)
+		return
+	}
+	c.h.Server.Push(telebot.Update{Callback: &telebot.Callback{
+		Sender:  &c.user,
+		Message: messages[len(messages)-1].wire(),
+		Data:    data,
+	}})
+}
+
+// ExpectAnswer waits for the bot's next answer to a button press in this
+// chat that shows text, and fails unless it is want. Answers without text,
+// which only stop the button's spinner, are skipped.
+func (c *Chat) ExpectAnswer(want string) {
+	c.h.t.Helper()
+
+	deadline := time.Now().Add(c.h.timeout)
+	for {
+		answers := c.h.Server.Answers(c.user.ID)
+		for c.answered < len(answers) {
+			got := answers[c.answered]
+			c.answered++
+			if got == "" {
+				continue
+			}
+			if got != want {
+				c.h.t.Errorf("callback answer in chat %d:\n  got:  %q\n  want: %q%s", c.user.ID, got, want, c.h.errorSuffix())
+			}
+			return
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			c.h.t.Fatalf("expected a callback answer in chat %d within %s, got none%s", c.user.ID, c.h.timeout, c.h.errorSuffix())
+			return
+		}
+		c.h.Server.wait(remaining)
+	}
+}
+
+// Expect waits for the bot's next message in this chat and fails unless it
+// matches want. It returns the message for further checks.
+func (c *Chat) Expect(want Reply) *Message {
+	c.h.t.Helper()
+
+	got := c.next()
+	if got == nil {
+		c.h.t.Fatalf("expected a reply in chat %d within %s, got none%s", c.user.ID, c.h.timeout, c.h.errorSuffix())
+		return nil
+	}
+	got.Keyboard = c.h.decodeKeyboard(got.Keyboard)
+
+	var problems []string
+	if got.Text != want.Text {
+		problems = append(problems, fmt.Sprintf("text:\n  got:  %q\n  want: %q", got.Text, want.Text))
+	}
+	if !equalKeyboards(got.Keyboard, want.Keyboard) {
+		problems = append(problems, fmt.Sprintf("keyboard:\n  got:  %v\n  want: %v", got.Keyboard, want.Keyboard))
+	}
+	if got.Edited() != want.Edit {
+		problems = append(problems, fmt.Sprintf("edit: got %s, want edit=%t", got.Method, want.Edit))
+	}
+	if got.Photo != want.Photo {
+		problems = append(problems, fmt.Sprintf("photo: got %q, want %q", got.Photo, want.Photo))
+	}
+	if got.Video != want.Video {
+		problems = append(problems, fmt.Sprintf("video: got %q, want %q", got.Video, want.Video))
+	}
+	if len(problems) > 0 {
+		c.h.t.Fatalf("unexpected reply in chat %d:\n%s%s", c.user.ID, strings.Join(problems, "\n"), c.h.errorSuffix())
+	}
+
+	return got
+}
+
+// ExpectNone fails if the bot sends anything in this chat within wait.
+func (c *Chat) ExpectNone(wait time.Duration) {
+	c.h.t.Helper()
+
+	deadline := time.Now().Add(wait)
+	for time.Now().Before(deadline) {
+		if messages := c.h.Server.Messages(c.user.ID); len(messages) > c.seen {
+			c.h.t.Fatalf("expected no reply in chat %d, got %q", c.user.ID, messages[c.seen].Text)
+		}
+		c.h.Server.wait(time.Until(deadline))
+	}
+}
+
+// Step is one line of a scripted conversation.
+type Step func(c *Chat)
+
+// Run plays steps in order.
+func (c *Chat) Run(steps ...Step) {
+	c.h.t.Helper()
+
+	for _, step := range steps {
+		step(c)
+	}
+}
+
+func Send(text string) Step {
+	return func(c *Chat) { c.Send(text) }
+}
+
+func SendPhoto(caption string) Step {
+	return func(c *Chat) { c.SendPhoto(caption) }
+}
+
+func Click(button string) Step {
+	return func(c *Chat) { c.Click(button) }
+}
+
+func DoubleTap(button string) Step {
+	return func(c *Chat) { c.DoubleTap(button) }
+}
+
+func Press(data string) Step {
+	return func(c *Chat) { c.Press(data) }
+}
+
+func ExpectAnswer(want string) Step {
+	return func(c *Chat) { c.ExpectAnswer(want) }
+}
+
+// Redeliver sends the latest update of any chat again.
+func Redeliver() Step {
+	return func(c *Chat) { c.h.Server.Redeliver() }
+}
+
+func Expect(want Reply) Step {
+	return func(c *Chat) { c.Expect(want) }
+}
+
+func (c *Chat) chat() *telebot.Chat {
+	return &telebot.Chat{
+		ID:        c.user.ID,
+		Type:      telebot.ChatPrivate,
+		FirstName: c.user.FirstName,
+		LastName:  c.user.LastName,
+		Username:  c.user.Username,
+	}
+}
+
+// next waits for the first message Expect has not returned yet.
+func (c *Chat) next() *Message {
+	deadline := time.Now().Add(c.h.timeout)
+	for {
+		if messages := c.h.Server.Messages(c.user.ID); len(messages) > c.seen {
+			message := messages[c.seen]
+			c.seen++
+			return &message
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil
+		}
+		c.h.Server.wait(remaining)
+	}
+}
+
+func (h *Harness) errorSuffix() string {
+	errs := h.Errors()
+	if len(errs) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("\nhandler errors:")
+	for _, err := range errs {
+		fmt.Fprintf(&b, "\n  %v", err)
+	}
+	return b.String()
+}
+
+// decodeData returns button data as "action_arg...", or as sent if it
+// doesn't decode.
+func (h *Harness) decodeData(data string) string {
+	d, err := h.callbacks.Decode(data)
+	if err != nil {
+		return data
+	}
+	return d.String()
+}
+
+// decodeKeyboard returns a copy of keyboard with its data decoded.
+func (h *Harness) decodeKeyboard(keyboard [][]Button) [][]Button {
+	if keyboard == nil {
+		return nil
+	}
+	decoded := make([][]Button, len(keyboard))
+	for i, row := range keyboard {
+		for _, b := range row {
+			decoded[i] = append(decoded[i], Button{Text: b.Text, Data: h.decodeData(b.Data)})
+		}
+	}
+	return decoded
+}
+
+func equalKeyboards(a, b [][]Button) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j := range a[i] {
+			if a[i][j] != b[i][j] {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,372 @@
+// Package bottest runs the bot against a fake Telegram Bot API so
+// conversations can be scripted and checked without Telegram or Postgres.
+//
+//	h := bottest.New(t, bottest.Options{})
+//	chat := h.Chat(telebot.User{ID: 42, FirstName: "Abebe"})
+//	chat.Send("/start")
+//	chat.Expect(bottest.Reply{Text: "...", Keyboard: [][]bottest.Button{...}})
+//	chat.Click("generate_image")
+package bottest
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/billing"
+	"github.com/Leul-Michael/image-generation/callback"
+	"github.com/Leul-Michael/image-generation/config"
+	"github.com/Leul-Michael/image-generation/generation"
+	"github.com/Leul-Michael/image-generation/handler"
+	"github.com/Leul-Michael/image-generation/i18n"
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/Leul-Michael/image-generation/metrics"
+	"github.com/Leul-Michael/image-generation/model"
+	"gopkg.in/telebot.v3"
+)
+
+type Options struct {
+	// Pricing defaults to config.Default().Pricing.
+	Pricing *config.PricingConfig
+	// Referral defaults to config.Default().Referral.
+	Referral *config.ReferralConfig
+	// FreeTier defaults to config.Default().FreeTier.
+	FreeTier *config.FreeTierConfig
+	// Credits defaults to config.Default().Credits.
+	Credits *config.CreditsConfig
+	// RateLimit defaults to config.Default().RateLimit.
+	RateLimit *config.RateLimitConfig
+	// Idempotency defaults to config.Default().Idempotency.
+	Idempotency *config.IdempotencyConfig
+	// CallbackSecret signs button data. Defaults to a fixed test secret.
+	CallbackSecret []byte
+	// Translator defaults to generation.NoopTranslator.
+	Translator generation.Translator
+	// Enhancer may be nil, which turns prompt enhancement off as in
+	// production.
+	Enhancer generation.Enhancer
+	// Provider defaults to a PlaceholderProvider without delay.
+	Provider generation.ImageProvider
+	// VideoProvider defaults to a PlaceholderVideoProvider that takes three
+	// polls per job.
+	VideoProvider generation.VideoProvider
+	// Charger defaults to billing.PlaceholderCharger.
+	Charger billing.Charger
+	// Logger defaults to one that discards everything.
+	Logger *slog.Logger
+	// Metrics defaults to fresh metrics that count the in-memory queues.
+	Metrics *metrics.Metrics
+	// Timeout is how long Expect waits for a reply. Defaults to 5s.
+	Timeout time.Duration
+}
+
+// Harness is a bot wired to in-memory repositories and a fake Bot API, with
+// image and video generation workers running in the background. It is stopped by t's
+// Cleanup.
+type Harness struct {
+	Server  *Server
+	Bot     *telebot.Bot
+	Repos   handler.Repos
+	I18n    *i18n.Bundle
+	Metrics *metrics.Metrics
+
+	t         testing.TB
+	timeout   time.Duration
+	callbacks *callback.Codec
+	renewer   *billing.Renewer
+	expirer   *billing.Expirer
+
+	mu     sync.Mutex
+	errors []error
+}
+
+func New(t testing.TB, opts Options) *Harness {
+	t.Helper()
+
+	if opts.Pricing == nil {
+		opts.Pricing = &config.Default().Pricing
+	}
+	if opts.Referral == nil {
+		opts.Referral = &config.Default().Referral
+	}
+	if opts.FreeTier == nil {
+		opts.FreeTier = &config.Default().FreeTier
+	}
+	if opts.Credits == nil {
+		opts.Credits = &config.Default().Credits
+	}
+	if opts.RateLimit == nil {
+		opts.RateLimit = &config.Default().RateLimit
+	}
+	if opts.Idempotency == nil {
+		opts.Idempotency = &config.Default().Idempotency
+	}
+	if opts.CallbackSecret == nil {
+		opts.CallbackSecret = []byte("bottest callback secret")
+	}
+	if opts.Translator == nil {
+		opts.Translator = generation.NoopTranslator{}
+	}
+	if opts.Provider == nil {
+		opts.Provider = generation.PlaceholderProvider{}
+	}
+	if opts.VideoProvider == nil {
+		opts.VideoProvider = &generation.PlaceholderVideoProvider{Steps: 3}
+	}
+	if opts.Charger == nil {
+		opts.Charger = billing.PlaceholderCharger{}
+	}
+	if opts.Logger == nil {
+		opts.Logger = logging.Discard()
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 5 * time.Second
+	}
+
+	h := &Harness{
+		Server:    NewServer(t, "123456:test"),
+		Repos:     handler.NewMemoryRepos(*opts.FreeTier, *opts.Credits),
+		t:         t,
+		timeout:   opts.Timeout,
+		callbacks: handler.NewCallbackCodec(opts.CallbackSecret),
+	}
+
+	bot, err := telebot.NewBot(telebot.Settings{
+		URL:         h.Server.URL,
+		Token:       h.Server.Token,
+		Poller:      &telebot.LongPoller{Timeout: time.Second},
+		Synchronous: true,
+		OnError: func(err error, c telebot.Context) {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			h.errors = append(h.errors, err)
+		},
+	})
+	if err != nil {
+		h.Server.Close()
+		t.Fatalf("failed to create bot: %v", err)
+	}
+	h.Bot = bot
+
+	h.I18n, err = i18n.NewBundle()
+	if err != nil {
+		h.Server.Close()
+		t.Fatalf("failed to load translations: %v", err)
+	}
+
+	if opts.Metrics == nil {
+		opts.Metrics = metrics.New()
+		opts.Metrics.RegisterQueues(map[string]metrics.QueueCounter{
+			metrics.TypeImage: h.Repos.Requests,
+			metrics.TypeVideo: h.Repos.VideoRequests,
+		}, opts.Logger)
+	}
+	h.Metrics = opts.Metrics
+
+	botHandler := handler.NewBotHandler(bot, h.Repos, handler.BotHandlerOptions{
+		I18n:           h.I18n,
+		Translator:     opts.Translator,
+		Enhancer:       opts.Enhancer,
+		Pricing:        *opts.Pricing,
+		Referral:       *opts.Referral,
+		FreeTier:       *opts.FreeTier,
+		RateLimit:      *opts.RateLimit,
+		Idempotency:    *opts.Idempotency,
+		CallbackSecret: opts.CallbackSecret,
+		Metrics:        opts.Metrics,
+		Logger:         opts.Logger,
+	})
+	botHandler.RegisterHandlers()
+
+	billingConfig := config.Default().Billing
+	h.renewer = billing.NewRenewer(h.Repos.Subscriptions, opts.Charger, botHandler, billing.RenewerOptions{
+		CheckInterval: billingConfig.CheckInterval,
+		RetryInterval: billingConfig.RetryInterval,
+		GracePeriod:   billingConfig.GracePeriod,
+		Logger:        opts.Logger,
+	})
+	h.expirer = billing.NewExpirer(h.Repos.Credits, botHandler, billing.ExpirerOptions{
+		Hour:           opts.Credits.ExpiryHour,
+		Location:       opts.FreeTier.Location(),
+		ReminderBefore: opts.Credits.ReminderBefore,
+		Logger:         opts.Logger,
+	})
+
+	worker := generation.NewWorker(h.Repos.Requests, opts.Provider, botHandler, generation.WorkerOptions{
+		Concurrency:     1,
+		PollInterval:    10 * time.Millisecond,
+		StaleAfter:      time.Minute,
+		GenerateTimeout: 30 * time.Second,
+		MaxProcessing:   opts.RateLimit.ProviderConcurrency,
+		Metrics:         opts.Metrics,
+		Logger:          opts.Logger,
+	})
+
+	videoWorker := generation.NewVideoWorker(h.Repos.VideoRequests, opts.VideoProvider, botHandler, botHandler, generation.VideoWorkerOptions{
+		Concurrency:     1,
+		PollInterval:    10 * time.Millisecond,
+		JobPollInterval: 10 * time.Millisecond,
+		Timeout:         time.Minute,
+		MaxRunning:      opts.RateLimit.VideoProviderConcurrency,
+		Metrics:         opts.Metrics,
+		Logger:          opts.Logger,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		bot.Start()
+	}()
+	go func() {
+		defer wg.Done()
+		worker.Run(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		videoWorker.Run(ctx)
+	}()
+
+	t.Cleanup(func() {
+		// Stopping cancels requests still in flight, so only errors from
+		// before the stop are reported.
+		errs := h.Errors()
+
+		cancel()
+		h.Server.Release()
+		bot.Stop()
+		wg.Wait()
+		h.Server.Close()
+
+		for _, err := range errs {
+			t.Errorf("bot handler error: %v", err)
+		}
+	})
+
+	return h
+}
+
+// Errors returns the errors handlers returned so far.
+func (h *Harness) Errors() []error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]error(nil), h.errors...)
+}
+
+// Chat starts a private conversation with the bot as user.
+func (h *Harness) Chat(user telebot.User) *Chat {
+	return &Chat{h: h, user: user}
+}
+
+// AddCategory stores an active category, as the seed command would.
+func (h *Harness) AddCategory(category model.Category) *model.Category {
+	h.t.Helper()
+
+	category.IsActive = true
+	if err := h.Repos.Categories.Create(context.Background(), &category); err != nil {
+		h.t.Fatalf("failed to create category %s: %v", category.Name, err)
+	}
+	return &category
+}
+
+// GrantCredits adds image credits to the user with telegramID, who must
+// have sent /start already.
+func (h *Harness) GrantCredits(telegramID int64, credits int) {
+	h.t.Helper()
+
+	h.grant(telegramID, model.CreditTypeImage, credits)
+}
+
+// GrantVideoCredits adds video credits to the user with telegramID, who
+// must have sent /start already.
+func (h *Harness) GrantVideoCredits(telegramID int64, credits int) {
+	h.t.Helper()
+
+	h.grant(telegramID, model.CreditTypeVideo, credits)
+}
+
+func (h *Harness) grant(telegramID int64, creditType model.CreditType, credits int) {
+	h.t.Helper()
+
+	user, err := h.Repos.Users.GetByTelegramID(context.Background(), uint(telegramID))
+	if err != nil {
+		h.t.Fatalf("failed to load user %d: %v", telegramID, err)
+	}
+
+	_, err = h.Repos.Credits.Apply(context.Background(), &model.Transaction{
+		UserID:      user.ID,
+		CreditType:  creditType,
+		Amount:      credits,
+		Type:        model.TransactionTypeAdjustment,
+		Description: "Granted by test harness",
+	})
+	if err != nil {
+		h.t.Fatalf("failed to grant credits to %d: %v", telegramID, err)
+	}
+}
+
+// AssignReferralCode gives the user with telegramID a known referral code, so
+// invite links can be checked word for word.
+func (h *Harness) AssignReferralCode(telegramID int64, code string) {
+	h.t.Helper()
+
+	user, err := h.Repos.Users.GetByTelegramID(context.Background(), uint(telegramID))
+	if err != nil {
+		h.t.Fatalf("failed to load user %d: %v", telegramID, err)
+	}
+	if _, err := h.Repos.Users.AssignReferralCode(context.Background(), user.ID, code); err != nil {
+		h.t.Fatalf("failed to assign referral code to %d: %v", telegramID, err)
+	}
+}
+
+// AddPromoCode stores an active promo code, as admin create-promo would.
+func (h *Harness) AddPromoCode(promo model.PromoCode) *model.PromoCode {
+	h.t.Helper()
+
+	promo.IsActive = true
+	if err := h.Repos.PromoCodes.Create(context.Background(), &promo); err != nil {
+		h.t.Fatalf("failed to create promo code %s: %v", promo.Code, err)
+	}
+	return &promo
+}
+
+// AddPlan stores an active subscription plan, as admin create-plan would.
+func (h *Harness) AddPlan(plan model.Plan) *model.Plan {
+	h.t.Helper()
+
+	plan.IsActive = true
+	if err := h.Repos.Subscriptions.CreatePlan(context.Background(), &plan); err != nil {
+		h.t.Fatalf("failed to create plan %s: %v", plan.Code, err)
+	}
+	return &plan
+}
+
+// RunRenewals processes every subscription due at now, which may be in the
+// future. The renewal job does not run on its own in the harness.
+func (h *Harness) RunRenewals(now time.Time) {
+	h.t.Helper()
+
+	for {
+		processed, err := h.renewer.RunOnce(context.Background(), now)
+		if err != nil {
+			h.t.Fatalf("failed to run renewals: %v", err)
+		}
+		if !processed {
+			return
+		}
+	}
+}
+
+// RunExpiry runs the daily credit expiry job as of now, which may be in the
+// future. The job does not run on its own in the harness.
+func (h *Harness) RunExpiry(now time.Time) {
+	h.t.Helper()
+
+	if err := h.expirer.RunOnce(context.Background(), now); err != nil {
+		h.t.Fatalf("failed to run credit expiry: %v", err)
+	}
+}
@@ -0,0 +1,489 @@
+package bottest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/telebot.v3"
+)
+
+// BotUser is the account the fake server reports from getMe.
+var BotUser = telebot.User{ID: 1, IsBot: true, FirstName: "Test Bot", Username: "test_bot"}
+
+// Button is an inline keyboard button as the bot sent it.
+type Button struct {
+	Text string
+	Data string
+}
+
+// Message is a message the bot sent or edited, as seen by the server.
+type Message struct {
+	ChatID    int64
+	MessageID int
+	// Method is the Bot API method that produced this version of the
+	// message, e.g. "sendMessage" or "editMessageText".
+	Method   string
+	Text     string
+	Photo    string
+	Video    string
+	Keyboard [][]Button
+}
+
+// Edited reports whether the message is an edit of an earlier one.
+func (m *Message) Edited() bool {
+	return strings.HasPrefix(m.Method, "edit")
+}
+
+// Call is a Bot API request the bot made.
+type Call struct {
+	Method string
+	Params map[string]string
+}
+
+// Server is a fake Telegram Bot API. It queues updates for getUpdates and
+// records what the bot sends back. Only the methods the bot uses are
+// implemented; anything else gets a 404 like the real API returns for
+// unknown methods.
+type Server struct {
+	*httptest.Server
+	Token string
+
+	t testing.TB
+
+	mu       sync.Mutex
+	updates  []telebot.Update
+	nextID   int
+	messages map[int64][]*Message
+	calls    []Call
+	answers  map[int64][]string // callback answer texts by chat
+	queries  map[string]int64   // chat of each callback query ID
+	files    map[string][]byte
+	changed  chan struct{} // closed and replaced whenever anything is added
+	closing  chan struct{}
+}
+
+func NewServer(t testing.TB, token string) *Server {
+	s := &Server{
+		Token:    token,
+		t:        t,
+		messages: make(map[int64][]*Message),
+		answers:  make(map[int64][]string),
+		queries:  make(map[string]int64),
+		files:    make(map[string][]byte),
+		changed:  make(chan struct{}),
+		closing:  make(chan struct{}),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Release ends pending and future getUpdates long polls, so the bot can be
+// stopped without waiting for the poll timeout.
+func (s *Server) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.closing:
+	default:
+		close(s.closing)
+	}
+}
+
+// Push queues an update for the next getUpdates call and assigns its ID.
+func (s *Server) Push(update telebot.Update) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	update.ID = s.nextID
+	if update.Callback != nil && update.Callback.ID == "" {
+		update.Callback.ID = strconv.Itoa(update.ID)
+	}
+	if update.Callback != nil && update.Callback.Sender != nil {
+		s.queries[update.Callback.ID] = update.Callback.Sender.ID
+	}
+	s.updates = append(s.updates, update)
+	s.notify()
+}
+
+// Redeliver sends the latest update again, as Telegram does when it can't
+// tell whether a webhook received it. The copy gets a new update ID, since
+// the poller has moved past the old one, but keeps its callback query ID.
+func (s *Server) Redeliver() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.updates) == 0 {
+		return
+	}
+	update := s.updates[len(s.updates)-1]
+	s.nextID++
+	update.ID = s.nextID
+	s.updates = append(s.updates, update)
+	s.notify()
+}
+
+// AddFile stores data as a file users sent, e.g. a photo, and returns its
+// file ID. The bot can fetch it with getFile and download it.
+func (s *Server) AddFile(data []byte) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fileID := fmt.Sprintf("file-%d", len(s.files)+1)
+	s.files[fileID] = data
+	return fileID
+}
+
+// Messages returns the messages sent to chatID so far, oldest first. Edits
+// are separate entries.
+func (s *Server) Messages(chatID int64) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := make([]Message, len(s.messages[chatID]))
+	for i, m := range s.messages[chatID] {
+		messages[i] = *m
+	}
+	return messages
+}
+
+// Answers returns the texts the bot answered callback queries from chatID
+// with so far, oldest first. Answers without text are "".
+func (s *Server) Answers(chatID int64) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.answers[chatID]...)
+}
+
+// Calls returns every Bot API request made so far.
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Call(nil), s.calls...)
+}
+
+// wait blocks until something is recorded or pushed, or until timeout.
+func (s *Server) wait(timeout time.Duration) {
+	s.mu.Lock()
+	changed := s.changed
+	s.mu.Unlock()
+
+	select {
+	case <-changed:
+	case <-s.closing:
+	case <-time.After(timeout):
+	}
+}
+
+// notify wakes up everything in wait. mu must be held.
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if path, ok := strings.CutPrefix(r.URL.Path, "/file/bot"+s.Token+"/"); ok {
+		s.download(w, r, path)
+		return
+	}
+
+	token, method, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/bot"), "/")
+	if !ok || token != s.Token {
+		s.reply(w, http.StatusUnauthorized, nil, "Unauthorized")
+		return
+	}
+
+	params, err := decodeParams(r)
+	if err != nil {
+		s.reply(w, http.StatusBadRequest, nil, "Bad Request: "+err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	s.calls = append(s.calls, Call{Method: method, Params: params})
+	s.mu.Unlock()
+
+	switch method {
+	case "getMe":
+		s.reply(w, http.StatusOK, BotUser, "")
+	case "getUpdates":
+		s.getUpdates(w, params)
+	case "deleteWebhook", "setWebhook", "setMyCommands":
+		s.reply(w, http.StatusOK, true, "")
+	case "answerCallbackQuery":
+		s.answer(w, params)
+	case "getFile":
+		s.getFile(w, params)
+	case "sendMessage", "sendPhoto", "sendVideo":
+		s.send(w, method, params)
+	case "editMessageText", "editMessageCaption", "editMessageReplyMarkup":
+		s.edit(w, method, params)
+	default:
+		s.reply(w, http.StatusNotFound, nil, "Not Found: method "+method)
+	}
+}
+
+func (s *Server) answer(w http.ResponseWriter, params map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chatID, ok := s.queries[params["callback_query_id"]]
+	if !ok {
+		s.reply(w, http.StatusBadRequest, nil, "Bad Request: query is too old and response timeout expired or query ID is invalid")
+		return
+	}
+	s.answers[chatID] = append(s.answers[chatID], params["text"])
+	s.notify()
+	s.reply(w, http.StatusOK, true, "")
+}
+
+func (s *Server) getUpdates(w http.ResponseWriter, params map[string]string) {
+	offset, _ := strconv.Atoi(params["offset"])
+	timeout, _ := strconv.Atoi(params["timeout"])
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+
+	for {
+		s.mu.Lock()
+		var pending []telebot.Update
+		for _, update := range s.updates {
+			if update.ID >= offset {
+				pending = append(pending, update)
+			}
+		}
+		s.mu.Unlock()
+
+		remaining := time.Until(deadline)
+		if len(pending) > 0 || remaining <= 0 || s.released() {
+			s.reply(w, http.StatusOK, pending, "")
+			return
+		}
+		s.wait(remaining)
+	}
+}
+
+func (s *Server) released() bool {
+	select {
+	case <-s.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Server) send(w http.ResponseWriter, method string, params map[string]string) {
+	chatID, err := strconv.ParseInt(params["chat_id"], 10, 64)
+	if err != nil {
+		s.reply(w, http.StatusBadRequest, nil, "Bad Request: chat not found")
+		return
+	}
+
+	keyboard, err := decodeKeyboard(params["reply_markup"])
+	if err != nil {
+		s.reply(w, http.StatusBadRequest, nil, "Bad Request: can't parse reply keyboard markup")
+		return
+	}
+
+	message := &Message{
+		ChatID:   chatID,
+		Method:   method,
+		Text:     params["text"],
+		Keyboard: keyboard,
+	}
+	switch method {
+	case "sendPhoto":
+		message.Text, message.Photo = params["caption"], params["photo"]
+	case "sendVideo":
+		message.Text, message.Video = params["caption"], params["video"]
+	}
+
+	s.mu.Lock()
+	var count int
+	for _, messages := range s.messages {
+		count += len(messages)
+	}
+	message.MessageID = count + 1
+	s.messages[chatID] = append(s.messages[chatID], message)
+	s.notify()
+	s.mu.Unlock()
+
+	s.reply(w, http.StatusOK, message.wire(), "")
+}
+
+func (s *Server) getFile(w http.ResponseWriter, params map[string]string) {
+	fileID := params["file_id"]
+
+	s.mu.Lock()
+	data, ok := s.files[fileID]
+	s.mu.Unlock()
+
+	if !ok {
+		s.reply(w, http.StatusBadRequest, nil, "Bad Request: invalid file_id")
+		return
+	}
+	s.reply(w, http.StatusOK, telebot.File{FileID: fileID, FileSize: int64(len(data)), FilePath: "files/" + fileID}, "")
+}
+
+// download serves file contents the way api.telegram.org/file does, by the
+// path getFile returned.
+func (s *Server) download(w http.ResponseWriter, r *http.Request, path string) {
+	s.mu.Lock()
+	data, ok := s.files[strings.TrimPrefix(path, "files/")]
+	s.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write(data)
+}
+
+func (s *Server) edit(w http.ResponseWriter, method string, params map[string]string) {
+	chatID, _ := strconv.ParseInt(params["chat_id"], 10, 64)
+	messageID, _ := strconv.Atoi(params["message_id"])
+
+	keyboard, err := decodeKeyboard(params["reply_markup"])
+	if err != nil {
+		s.reply(w, http.StatusBadRequest, nil, "Bad Request: can't parse reply keyboard markup")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var original *Message
+	for _, m := range s.messages[chatID] {
+		if m.MessageID == messageID {
+			original = m
+		}
+	}
+	if original == nil {
+		s.reply(w, http.StatusBadRequest, nil, "Bad Request: message to edit not found")
+		return
+	}
+
+	edited := *original
+	edited.Method = method
+	switch method {
+	case "editMessageText":
+		edited.Text = params["text"]
+	case "editMessageCaption":
+		edited.Text = params["caption"]
+	}
+	// Like the real API, an edit without reply_markup removes the keyboard.
+	edited.Keyboard = keyboard
+
+	s.messages[chatID] = append(s.messages[chatID], &edited)
+	s.notify()
+
+	s.reply(w, http.StatusOK, edited.wire(), "")
+}
+
+// wire is the message in Bot API form.
+func (m *Message) wire() *telebot.Message {
+	message := &telebot.Message{
+		ID:       m.MessageID,
+		Sender:   &BotUser,
+		Unixtime: time.Now().Unix(),
+		Chat:     &telebot.Chat{ID: m.ChatID, Type: telebot.ChatPrivate},
+	}
+	switch {
+	case m.Photo != "":
+		message.Photo = &telebot.Photo{File: telebot.File{FileID: m.Photo}}
+		message.Caption = m.Text
+	case m.Video != "":
+		message.Video = &telebot.Video{File: telebot.File{FileID: m.Video}}
+		message.Caption = m.Text
+	default:
+		message.Text = m.Text
+	}
+	if m.Keyboard != nil {
+		markup := &telebot.ReplyMarkup{}
+		for _, row := range m.Keyboard {
+			var buttons []telebot.InlineButton
+			for _, b := range row {
+				buttons = append(buttons, telebot.InlineButton{Text: b.Text, Data: b.Data})
+			}
+			markup.InlineKeyboard = append(markup.InlineKeyboard, buttons)
+		}
+		message.ReplyMarkup = markup
+	}
+	return message
+}
+
+// decodeParams reads a request body the way telebot sends it: a JSON object
+// whose values are strings, with nested objects such as reply_markup encoded
+// as JSON strings.
+func decodeParams(r *http.Request) (map[string]string, error) {
+	params := make(map[string]string)
+	if r.ContentLength == 0 {
+		return params, nil
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+	for key, value := range raw {
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			s = string(value)
+		}
+		params[key] = s
+	}
+	return params, nil
+}
+
+func decodeKeyboard(markup string) ([][]Button, error) {
+	if markup == "" {
+		return nil, nil
+	}
+
+	var decoded struct {
+		InlineKeyboard [][]struct {
+			Text string `json:"text"`
+			Data string `json:"callback_data"`
+		} `json:"inline_keyboard"`
+	}
+	if err := json.Unmarshal([]byte(markup), &decoded); err != nil {
+		return nil, err
+	}
+	if decoded.InlineKeyboard == nil {
+		return nil, nil
+	}
+
+	keyboard := make([][]Button, len(decoded.InlineKeyboard))
+	for i, row := range decoded.InlineKeyboard {
+		for _, b := range row {
+			keyboard[i] = append(keyboard[i], Button{Text: b.Text, Data: b.Data})
+		}
+	}
+	return keyboard, nil
+}
+
+func (s *Server) reply(w http.ResponseWriter, status int, result any, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if status != http.StatusOK {
+		json.NewEncoder(w).Encode(map[string]any{
+			"ok":          false,
+			"error_code":  status,
+			"description": description,
+		})
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": result}); err != nil {
+		s.t.Errorf("failed to encode fake Bot API response: %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package callback_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Leul-Michael/image-generation/callback"
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/google/uuid"
+)
+
+var secret = []byte("callback test secret")
+
+// TestRoundTrip checks that Decode returns what Encode was given, signed or
+// not.
+func TestRoundTrip(t *testing.T) {
+	id := uuid.MustParse("3f6c2f0e-8a4b-4c1e-9d2a-7b5e1f0c9a84")
+	tests := []struct {
+		name string
+		data callback.Data
+	}{
+		{name: "no arguments", data: callback.Data{Action: "my_credits"}},
+		{name: "arguments", data: callback.Data{Action: "deposit", Args: []string{"video", "100"}}},
+		{name: "uuid", data: callback.Data{Action: "category", Args: []string{id.String()}}},
+		{name: "uuid and text", data: callback.Data{Action: "enhance", Args: []string{id.String(), "accept"}}},
+	}
+
+	for _, secret := range [][]byte{secret, nil} {
+		codec := callback.NewCodec(secret, 1)
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				encoded, err := codec.Encode(tt.data)
+				if err != nil {
+					t.Fatalf("Encode(%v): %v", tt.data, err)
+				}
+				decoded, err := codec.Decode(encoded)
+				if err != nil {
+					t.Fatalf("Decode(%q): %v", encoded, err)
+				}
+				if !reflect.DeepEqual(decoded, tt.data) {
+					t.Errorf("Decode(Encode(%v)) = %v", tt.data, decoded)
+				}
+			})
+		}
+	}
+}
+
+// TestShortUUID checks that a UUID argument is sent in 22 characters
+// rather than 36.
+func TestShortUUID(t *testing.T) {
+	codec := callback.NewCodec(secret, 1)
+	id := uuid.New()
+
+	encoded, err := codec.Encode(callback.Data{Action: "category", Args: []string{id.String()}})
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if strings.Contains(encoded, id.String()) {
+		t.Errorf("encoded %q holds the full UUID", encoded)
+	}
+	body, _, _ := strings.Cut(encoded, ".")
+	if arg := body[strings.LastIndex(body, ":")+1:]; len(arg) != 1+22 {
+		t.Errorf("UUID argument %q is %d bytes, want a tag and 22 characters", arg, len(arg))
+	}
+}
+
+// TestMaxLen checks that data over Telegram's 64 bytes is refused rather
+// than sent, and that data up to it is not. A Router gives such a button
+// data that is answered as expired.
+func TestMaxLen(t *testing.T) {
+	codec := callback.NewCodec(secret, 1)
+	// "a:1:" and the 12 byte signature leave 48 bytes of argument
+	fits := callback.Data{Action: "a", Args: []string{strings.Repeat("x", 48)}}
+	encoded, err := codec.Encode(fits)
+	if err != nil {
+		t.Fatalf("Encode(%d bytes): %v", len(fits.Args[0]), err)
+	}
+	if len(encoded) != callback.MaxLen {
+		t.Fatalf("encoded %d bytes, want exactly %d", len(encoded), callback.MaxLen)
+	}
+
+	over := callback.Data{Action: "a", Args: []string{strings.Repeat("x", 49)}}
+	if encoded, err := codec.Encode(over); err == nil {
+		t.Errorf("Encode = %q (%d bytes), want an error", encoded, len(encoded))
+	}
+
+	router := callback.NewRouter(codec, nil, logging.Discard())
+	data := router.Data(over.Action, over.Args...)
+	if len(data) > callback.MaxLen {
+		t.Errorf("Router.Data is %d bytes, over the limit", len(data))
+	}
+	if d, err := router.Decode(data); err == nil {
+		t.Errorf("Router.Data for data over the limit decodes as %v", d)
+	}
+}
+
+// TestEncodeInvalid checks that separators can't be smuggled into data.
+func TestEncodeInvalid(t *testing.T) {
+	codec := callback.NewCodec(secret, 1)
+	for _, data := range []callback.Data{
+		{},
+		{Action: "a:b"},
+		{Action: "a.b"},
+		{Action: "a~b"},
+		{Action: "deposit", Args: []string{"10:20"}},
+		{Action: "deposit", Args: []string{"10.20"}},
+		{Action: "deposit", Args: []string{"~10"}},
+	} {
+		if encoded, err := codec.Encode(data); err == nil {
+			t.Errorf("Encode(%#v) = %q, want an error", data, encoded)
+		}
+	}
+}
+
+// TestDecodeRejects checks that data the codec didn't make, or made for
+// another version, doesn't decode.
+func TestDecodeRejects(t *testing.T) {
+	codec := callback.NewCodec(secret, 2)
+	valid, err := codec.Encode(callback.Data{Action: "deposit", Args: []string{"100"}})
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	forged, _ := callback.NewCodec([]byte("another secret"), 2).Encode(callback.Data{Action: "deposit", Args: []string{"100"}})
+	old, _ := callback.NewCodec(secret, 1).Encode(callback.Data{Action: "deposit", Args: []string{"100"}})
+	body, mac, _ := strings.Cut(valid, ".")
+
+	tests := []struct {
+		name string
+		data string
+		want error
+	}{
+		{name: "other secret", data: forged, want: callback.ErrSignature},
+		{name: "unsigned", data: body, want: callback.ErrSignature},
+		{name: "tampered argument", data: strings.Replace(body, "100", "900", 1) + "." + mac, want: callback.ErrSignature},
+		{name: "truncated signature", data: valid[:len(valid)-1], want: callback.ErrSignature},
+		{name: "legacy data", data: "deposit_100", want: callback.ErrSignature},
+		{name: "old version", data: old, want: callback.ErrVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if d, err := codec.Decode(tt.data); !errors.Is(err, tt.want) {
+				t.Errorf("Decode(%q) = %v, %v, want %v", tt.data, d, err, tt.want)
+			}
+		})
+	}
+
+	unsigned := callback.NewCodec(nil, 2)
+	for _, data := range []string{"", "deposit", ":2", "category:2:~not base64!"} {
+		if d, err := unsigned.Decode(data); !errors.Is(err, callback.ErrMalformed) {
+			t.Errorf("Decode(%q) = %v, %v, want %v", data, d, err, callback.ErrMalformed)
+		}
+	}
+}
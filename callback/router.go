@@ -0,0 +1,89 @@
+package callback
+
+import (
+	"log/slog"
+	"strconv"
+
+	"github.com/google/uuid"
+	"gopkg.in/telebot.v3"
+)
+
+type route struct {
+	action string
+	argc   int
+}
+
+// Router dispatches callback queries to the handler registered for their
+// action and number of arguments. Data that doesn't decode, or has no
+// handler, goes to the expired handler: it is a forged button or one from a
+// menu this build no longer makes.
+type Router struct {
+	codec    *Codec
+	handlers map[route]func(c telebot.Context, args []string) error
+	expired  telebot.HandlerFunc
+	logger   *slog.Logger
+}
+
+func NewRouter(codec *Codec, expired telebot.HandlerFunc, logger *slog.Logger) *Router {
+	return &Router{
+		codec:    codec,
+		handlers: make(map[route]func(telebot.Context, []string) error),
+		expired:  expired,
+		logger:   logger,
+	}
+}
+
+// Handle registers h for action without arguments.
+func (r *Router) Handle(action string, h telebot.HandlerFunc) {
+	r.handlers[route{action, 0}] = func(c telebot.Context, args []string) error {
+		return h(c)
+	}
+}
+
+// HandleArg registers h for action with one argument, which parse turns
+// into a T. Data whose argument doesn't parse is treated as expired.
+func HandleArg[T any](r *Router, action string, parse func(string) (T, error), h func(telebot.Context, T) error) {
+	r.handlers[route{action, 1}] = func(c telebot.Context, args []string) error {
+		arg, err := parse(args[0])
+		if err != nil {
+			return r.expired(c)
+		}
+		return h(c, arg)
+	}
+}
+
+// String, Int and UUID parse arguments for HandleArg.
+func String(s string) (string, error)  { return s, nil }
+func Int(s string) (int, error)        { return strconv.Atoi(s) }
+func UUID(s string) (uuid.UUID, error) { return uuid.Parse(s) }
+
+// Data returns the button data for action with args. Actions and arguments
+// come from code, so a failure is a bug; it is logged and the button gets
+// data that will be answered as expired.
+func (r *Router) Data(action string, args ...string) string {
+	data, err := r.codec.Encode(Data{Action: action, Args: args})
+	if err != nil {
+		r.logger.Error("Failed to encode callback data", "action", action, "error", err)
+		return action
+	}
+	return data
+}
+
+// Decode returns the action and arguments of callback data.
+func (r *Router) Decode(data string) (Data, error) {
+	return r.codec.Decode(data)
+}
+
+// Dispatch runs the handler for the callback query of c.
+func (r *Router) Dispatch(c telebot.Context) error {
+	d, err := r.codec.Decode(c.Callback().Data)
+	if err != nil {
+		return r.expired(c)
+	}
+
+	h, ok := r.handlers[route{d.Action, len(d.Args)}]
+	if !ok {
+		return r.expired(c)
+	}
+	return h(c, d.Args)
+}
@@ -0,0 +1,977 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // the production image has no zoneinfo for free_tier.timezone
+
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Server      ServerConfig      `yaml:"server"`
+	Log         LogConfig         `yaml:"log"`
+	Metrics     MetricsConfig     `yaml:"metrics"`
+	Tracing     TracingConfig     `yaml:"tracing"`
+	Database    DatabaseConfig    `yaml:"database"`
+	Bot         BotConfig         `yaml:"bot"`
+	LLM         LLMConfig         `yaml:"llm"`
+	Pricing     PricingConfig     `yaml:"pricing"`
+	Worker      WorkerConfig      `yaml:"worker"`
+	Auth        AuthConfig        `yaml:"auth"`
+	Mail        MailConfig        `yaml:"mail"`
+	Referral    ReferralConfig    `yaml:"referral"`
+	FreeTier    FreeTierConfig    `yaml:"free_tier"`
+	Billing     BillingConfig     `yaml:"billing"`
+	Credits     CreditsConfig     `yaml:"credits"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit"`
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	Features    FeatureFlags      `yaml:"features"`
+}
+
+type ServerConfig struct {
+	Addr            string        `yaml:"addr"`
+	CORSOrigins     []string      `yaml:"cors_origins"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// TrustedProxies are the addresses or CIDR ranges of reverse proxies
+	// whose X-Forwarded-For header gives the client address. When empty,
+	// the client address is the peer's, so clients can't choose the
+	// address they are rate limited by.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+type LogFormat string
+
+const (
+	LogFormatJSON LogFormat = "json"
+	LogFormatText LogFormat = "text"
+)
+
+type LogConfig struct {
+	// Level is the least severe level logged: debug, info, warn or error.
+	Level  string    `yaml:"level"`
+	Format LogFormat `yaml:"format"`
+	// SlowQuery is how long a database query may take before it is logged
+	// as a warning. 0 turns the warning off.
+	SlowQuery time.Duration `yaml:"slow_query"`
+}
+
+type MetricsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Path is where the HTTP server serves Prometheus metrics.
+	Path string `yaml:"path"`
+	// Token, when set, must be sent by scrapers as a bearer token.
+	Token string `yaml:"token"`
+	// WorkerAddr is where a standalone worker serves its metrics. Empty
+	// means it serves none.
+	WorkerAddr string `yaml:"worker_addr"`
+}
+
+type TracingConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Endpoint is the host:port of an OTLP/HTTP collector.
+	Endpoint string `yaml:"endpoint"`
+	// Insecure sends spans without TLS, e.g. to a collector on localhost.
+	Insecure    bool   `yaml:"insecure"`
+	ServiceName string `yaml:"service_name"`
+	// SampleRatio is the share of new traces kept, from 0 to 1.
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+type DatabaseConfig struct {
+	URL             string        `yaml:"url"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+type BotMode string
+
+const (
+	BotModePolling BotMode = "polling"
+	BotModeWebhook BotMode = "webhook"
+)
+
+type BotConfig struct {
+	Token       string        `yaml:"token"`
+	Mode        BotMode       `yaml:"mode"`
+	PollTimeout time.Duration `yaml:"poll_timeout"`
+
+	// Webhook mode only. Telegram POSTs updates to WebhookURL + WebhookPath
+	// with WebhookSecret in the X-Telegram-Bot-Api-Secret-Token header.
+	WebhookURL      string `yaml:"webhook_url"`
+	WebhookPath     string `yaml:"webhook_path"`
+	WebhookSecret   string `yaml:"webhook_secret"`
+	RegisterWebhook bool   `yaml:"register_webhook"`
+
+	// CallbackSecret signs the data of inline buttons. When empty it is
+	// derived from the bot token.
+	CallbackSecret string `yaml:"callback_secret"`
+}
+
+type LLMConfig struct {
+	APIURL string `yaml:"api_url"`
+	APIKey string `yaml:"api_key"`
+	Model  string `yaml:"model"`
+}
+
+type PricingConfig struct {
+	EtbPerImageCredit   int     `yaml:"etb_per_image_credit"`
+	ImageGenerationCost int     `yaml:"image_generation_cost"`
+	PromptEnhanceCost   float64 `yaml:"prompt_enhance_cost"` // may be fractional, e.g. 0.25
+	DepositPresets      []int   `yaml:"deposit_presets"`
+
+	EtbPerVideoCredit   int   `yaml:"etb_per_video_credit"`
+	VideoGenerationCost int   `yaml:"video_generation_cost"`
+	VideoDepositPresets []int `yaml:"video_deposit_presets"`
+}
+
+type WorkerConfig struct {
+	Concurrency  int           `yaml:"concurrency"`
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// StaleAfter is how long a request may stay in processing before another
+	// worker picks it up again.
+	StaleAfter time.Duration `yaml:"stale_after"`
+	// GenerateTimeout bounds one call to the image provider. It must be
+	// shorter than StaleAfter.
+	GenerateTimeout time.Duration `yaml:"generate_timeout"`
+	// VideoConcurrency is the number of video jobs handled at once. Jobs
+	// wait on the provider between polls, so a few workers can follow many.
+	VideoConcurrency int `yaml:"video_concurrency"`
+	// VideoPollInterval is how often a running video job is checked with the
+	// provider. A worker that dies mid-check loses the job for that long.
+	VideoPollInterval time.Duration `yaml:"video_poll_interval"`
+	// VideoTimeout fails video requests that have not finished by then.
+	VideoTimeout time.Duration `yaml:"video_timeout"`
+	// RunWithServer starts workers, subscription renewals and credit expiry
+	// inside the serve command. Disable it when they run as a separate
+	// worker process.
+	RunWithServer bool `yaml:"run_with_server"`
+}
+
+type AuthConfig struct {
+	// SessionSecret signs session tokens. When empty it is derived from the
+	// bot token, so rotating the bot token also logs everyone out.
+	SessionSecret string        `yaml:"session_secret"`
+	SessionTTL    time.Duration `yaml:"session_ttl"`
+	// PublicURL is the website the verification and reset links in emails
+	// point to, e.g. https://example.com/verify-email?token=...
+	PublicURL        string        `yaml:"public_url"`
+	VerifyEmailTTL   time.Duration `yaml:"verify_email_ttl"`
+	ResetPasswordTTL time.Duration `yaml:"reset_password_ttl"`
+	// TelegramMaxAge is how old Mini App initData and Login Widget data may
+	// be, measured from the auth_date Telegram signed.
+	TelegramMaxAge time.Duration `yaml:"telegram_max_age"`
+}
+
+type MailDriver string
+
+const (
+	MailDriverLog  MailDriver = "log"
+	MailDriverSMTP MailDriver = "smtp"
+)
+
+type MailConfig struct {
+	Driver MailDriver `yaml:"driver"`
+	From   string     `yaml:"from"`
+	// LogFile is where the log driver appends messages. Empty means stdout.
+	LogFile string `yaml:"log_file"`
+
+	SMTPHost     string `yaml:"smtp_host"`
+	SMTPPort     int    `yaml:"smtp_port"`
+	SMTPUsername string `yaml:"smtp_username"`
+	SMTPPassword string `yaml:"smtp_password"`
+}
+
+// ReferralConfig sets the image credits paid out once a referred user buys
+// credits or generates an image for the first time. Zero turns a bonus off.
+type ReferralConfig struct {
+	ReferrerBonus int `yaml:"referrer_bonus"`
+	RefereeBonus  int `yaml:"referee_bonus"`
+}
+
+// FreeTierConfig is what users get without paying: SignupGrant image
+// credits once, and DailyGenerations free images a day, which are used before
+// credits and reset at midnight in Timezone. Zero turns either off.
+type FreeTierConfig struct {
+	SignupGrant      int    `yaml:"signup_grant"`
+	DailyGenerations int    `yaml:"daily_generations"`
+	Timezone         string `yaml:"timezone"`
+}
+
+// BillingConfig drives subscription renewals. A renewal that can't be
+// charged is retried every RetryInterval; the plan's perks are kept until
+// GracePeriod after the end of the unpaid period, when it expires.
+type BillingConfig struct {
+	CheckInterval time.Duration `yaml:"check_interval"`
+	RetryInterval time.Duration `yaml:"retry_interval"`
+	GracePeriod   time.Duration `yaml:"grace_period"`
+}
+
+// CreditsConfig controls credit expiry. Bonus credits (signup grants,
+// referral bonuses and promo codes) expire BonusExpiry after they are
+// granted, or never when it is zero; purchased credits never expire and
+// subscription credits expire with their period. Expired credits are swept
+// daily at ExpiryHour in the free tier's timezone, and users are reminded
+// ReminderBefore their credits expire.
+type CreditsConfig struct {
+	BonusExpiry    time.Duration `yaml:"bonus_expiry"`
+	ReminderBefore time.Duration `yaml:"reminder_before"`
+	ExpiryHour     int           `yaml:"expiry_hour"`
+}
+
+// Rate is a token bucket: Burst requests at once, then one more every Every.
+// A zero Burst means no limit.
+type Rate struct {
+	Burst int           `yaml:"burst"`
+	Every time.Duration `yaml:"every"`
+}
+
+// RateLimitTier is what a group of users may do.
+type RateLimitTier struct {
+	// Prompts limits generation requests from the bot.
+	Prompts Rate `yaml:"prompts"`
+	// API limits a signed-in user's REST API requests.
+	API Rate `yaml:"api"`
+	// InFlight caps a user's pending and processing image and video
+	// requests together. 0 means no cap.
+	InFlight int `yaml:"in_flight"`
+}
+
+type RateLimitConfig struct {
+	// Tiers are keyed by role ("user", "admin", "super_admin"), plan code
+	// (e.g. "pro") or "subscriber" for any plan. See Tier.
+	Tiers map[string]RateLimitTier `yaml:"tiers"`
+	// IP limits REST API requests per client address, signed in or not.
+	IP Rate `yaml:"ip"`
+	// ProviderConcurrency caps image requests being generated at once
+	// across all workers, and VideoProviderConcurrency video jobs running
+	// at the provider. 0 means no cap.
+	ProviderConcurrency      int `yaml:"provider_concurrency"`
+	VideoProviderConcurrency int `yaml:"video_provider_concurrency"`
+}
+
+type IdempotencyConfig struct {
+	// CallbackWindow is how long a bot callback query is remembered, so a
+	// redelivered update is not handled twice.
+	CallbackWindow time.Duration `yaml:"callback_window"`
+	// ActionWindow is how long further taps on a button that spends or
+	// grants credits are ignored, e.g. a double tap on a deposit.
+	ActionWindow time.Duration `yaml:"action_window"`
+	// KeyTTL is how long the response to a REST request with an
+	// Idempotency-Key header is kept for replays.
+	KeyTTL time.Duration `yaml:"key_ttl"`
+}
+
+type FeatureFlags struct {
+	PromptTranslation bool `yaml:"prompt_translation"`
+	PromptEnhancement bool `yaml:"prompt_enhancement"`
+	// SeedOnStart creates the rows of the built-in catalog that are missing
+	// when the app starts. Existing rows are only changed by the seed
+	// command.
+	SeedOnStart bool `yaml:"seed_on_start"`
+}
+
+// Default returns a configuration with every optional value filled in.
+// Secrets such as the database URL and bot token are left empty.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:            ":5000",
+			CORSOrigins:     []string{"*"},
+			ShutdownTimeout: 10 * time.Second,
+		},
+		Log: LogConfig{
+			Level:     "info",
+			Format:    LogFormatJSON,
+			SlowQuery: 200 * time.Millisecond,
+		},
+		Metrics: MetricsConfig{
+			Enabled:    true,
+			Path:       "/metrics",
+			WorkerAddr: ":9091",
+		},
+		Tracing: TracingConfig{
+			Endpoint:    "localhost:4318",
+			Insecure:    true,
+			ServiceName: "image-generation",
+			SampleRatio: 1,
+		},
+		Database: DatabaseConfig{
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+		},
+		Bot: BotConfig{
+			Mode:            BotModePolling,
+			PollTimeout:     10 * time.Second,
+			WebhookPath:     "/telegram/webhook",
+			RegisterWebhook: true,
+		},
+		LLM: LLMConfig{
+			APIURL: "https://api.openai.com/v1",
+			Model:  "gpt-4o-mini",
+		},
+		Pricing: PricingConfig{
+			EtbPerImageCredit:   10,
+			ImageGenerationCost: 1,
+			PromptEnhanceCost:   0,
+			DepositPresets:      []int{10, 50, 100, 200},
+			EtbPerVideoCredit:   50,
+			VideoGenerationCost: 1,
+			VideoDepositPresets: []int{50, 100, 250, 500},
+		},
+		Worker: WorkerConfig{
+			Concurrency:       2,
+			PollInterval:      2 * time.Second,
+			StaleAfter:        10 * time.Minute,
+			GenerateTimeout:   5 * time.Minute,
+			VideoConcurrency:  1,
+			VideoPollInterval: 5 * time.Second,
+			VideoTimeout:      30 * time.Minute,
+			RunWithServer:     true,
+		},
+		Auth: AuthConfig{
+			SessionTTL:       30 * 24 * time.Hour,
+			PublicURL:        "http://localhost:3000",
+			VerifyEmailTTL:   48 * time.Hour,
+			ResetPasswordTTL: time.Hour,
+			TelegramMaxAge:   24 * time.Hour,
+		},
+		Mail: MailConfig{
+			Driver:   MailDriverLog,
+			From:     "Image Generation <no-reply@localhost>",
+			SMTPPort: 587,
+		},
+		Referral: ReferralConfig{
+			ReferrerBonus: 2,
+			RefereeBonus:  1,
+		},
+		FreeTier: FreeTierConfig{
+			SignupGrant:      2,
+			DailyGenerations: 0,
+			Timezone:         "Africa/Addis_Ababa",
+		},
+		Billing: BillingConfig{
+			CheckInterval: 5 * time.Minute,
+			RetryInterval: 12 * time.Hour,
+			GracePeriod:   3 * 24 * time.Hour,
+		},
+		Credits: CreditsConfig{
+			BonusExpiry:    30 * 24 * time.Hour,
+			ReminderBefore: 3 * 24 * time.Hour,
+			ExpiryHour:     3,
+		},
+		RateLimit: RateLimitConfig{
+			Tiers: map[string]RateLimitTier{
+				"user": {
+					Prompts:  Rate{Burst: 5, Every: 20 * time.Second},
+					API:      Rate{Burst: 30, Every: 2 * time.Second},
+					InFlight: 2,
+				},
+				"subscriber": {
+					Prompts:  Rate{Burst: 10, Every: 10 * time.Second},
+					API:      Rate{Burst: 60, Every: time.Second},
+					InFlight: 4,
+				},
+				"admin":       {},
+				"super_admin": {},
+			},
+			IP:                       Rate{Burst: 60, Every: time.Second},
+			ProviderConcurrency:      8,
+			VideoProviderConcurrency: 4,
+		},
+		Idempotency: IdempotencyConfig{
+			CallbackWindow: 10 * time.Minute,
+			ActionWindow:   3 * time.Second,
+			KeyTTL:         24 * time.Hour,
+		},
+		Features: FeatureFlags{
+			PromptTranslation: true,
+			PromptEnhancement: true,
+		},
+	}
+}
+
+// Load builds the configuration from defaults, then the YAML file at path
+// (skipped when path is empty), then environment variables. Callers validate
+// the parts they need, since one-off commands such as migrate only need the
+// database settings.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", err)
+		}
+	}
+
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	var errs []error
+
+	str := func(key string, dst *string) {
+		if v, ok := lookup(key); ok && v != "" {
+			*dst = v
+		}
+	}
+	list := func(key string, dst *[]string) {
+		if v, ok := lookup(key); ok && v != "" {
+			var items []string
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			*dst = items
+		}
+	}
+	integer := func(key string, dst *int) {
+		if v, ok := lookup(key); ok && v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = n
+		}
+	}
+	float := func(key string, dst *float64) {
+		if v, ok := lookup(key); ok && v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = f
+		}
+	}
+	duration := func(key string, dst *time.Duration) {
+		if v, ok := lookup(key); ok && v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = d
+		}
+	}
+	boolean := func(key string, dst *bool) {
+		if v, ok := lookup(key); ok && v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = b
+		}
+	}
+
+	str("HTTP_ADDR", &c.Server.Addr)
+	list("CORS_ORIGINS", &c.Server.CORSOrigins)
+	duration("SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout)
+	list("TRUSTED_PROXIES", &c.Server.TrustedProxies)
+
+	str("LOG_LEVEL", &c.Log.Level)
+	str("LOG_FORMAT", (*string)(&c.Log.Format))
+	duration("LOG_SLOW_QUERY", &c.Log.SlowQuery)
+
+	boolean("METRICS_ENABLED", &c.Metrics.Enabled)
+	str("METRICS_PATH", &c.Metrics.Path)
+	str("METRICS_TOKEN", &c.Metrics.Token)
+	str("METRICS_WORKER_ADDR", &c.Metrics.WorkerAddr)
+
+	boolean("TRACING_ENABLED", &c.Tracing.Enabled)
+	str("TRACING_ENDPOINT", &c.Tracing.Endpoint)
+	boolean("TRACING_INSECURE", &c.Tracing.Insecure)
+	str("TRACING_SERVICE_NAME", &c.Tracing.ServiceName)
+	float("TRACING_SAMPLE_RATIO", &c.Tracing.SampleRatio)
+
+	str("DATABASE_URL", &c.Database.URL)
+	integer("DB_MAX_OPEN_CONNS", &c.Database.MaxOpenConns)
+	integer("DB_MAX_IDLE_CONNS", &c.Database.MaxIdleConns)
+	duration("DB_CONN_MAX_LIFETIME", &c.Database.ConnMaxLifetime)
+
+	str("BOT_TOKEN", &c.Bot.Token)
+	str("BOT_MODE", (*string)(&c.Bot.Mode))
+	duration("BOT_POLL_TIMEOUT", &c.Bot.PollTimeout)
+	str("BOT_WEBHOOK_URL", &c.Bot.WebhookURL)
+	str("BOT_WEBHOOK_PATH", &c.Bot.WebhookPath)
+	str("BOT_WEBHOOK_SECRET", &c.Bot.WebhookSecret)
+	boolean("BOT_REGISTER_WEBHOOK", &c.Bot.RegisterWebhook)
+	str("BOT_CALLBACK_SECRET", &c.Bot.CallbackSecret)
+
+	str("LLM_API_URL", &c.LLM.APIURL)
+	str("LLM_API_KEY", &c.LLM.APIKey)
+	str("LLM_MODEL", &c.LLM.Model)
+
+	integer("ETB_PER_IMAGE_CREDIT", &c.Pricing.EtbPerImageCredit)
+	integer("IMAGE_GENERATION_COST", &c.Pricing.ImageGenerationCost)
+	float("PROMPT_ENHANCE_COST", &c.Pricing.PromptEnhanceCost)
+	integer("ETB_PER_VIDEO_CREDIT", &c.Pricing.EtbPerVideoCredit)
+	integer("VIDEO_GENERATION_COST", &c.Pricing.VideoGenerationCost)
+
+	integer("WORKER_CONCURRENCY", &c.Worker.Concurrency)
+	duration("WORKER_POLL_INTERVAL", &c.Worker.PollInterval)
+	duration("WORKER_STALE_AFTER", &c.Worker.StaleAfter)
+	duration("WORKER_GENERATE_TIMEOUT", &c.Worker.GenerateTimeout)
+	integer("WORKER_VIDEO_CONCURRENCY", &c.Worker.VideoConcurrency)
+	duration("WORKER_VIDEO_POLL_INTERVAL", &c.Worker.VideoPollInterval)
+	duration("WORKER_VIDEO_TIMEOUT", &c.Worker.VideoTimeout)
+	boolean("WORKER_RUN_WITH_SERVER", &c.Worker.RunWithServer)
+
+	str("AUTH_SESSION_SECRET", &c.Auth.SessionSecret)
+	duration("AUTH_SESSION_TTL", &c.Auth.SessionTTL)
+	str("AUTH_PUBLIC_URL", &c.Auth.PublicURL)
+	duration("AUTH_VERIFY_EMAIL_TTL", &c.Auth.VerifyEmailTTL)
+	duration("AUTH_RESET_PASSWORD_TTL", &c.Auth.ResetPasswordTTL)
+	duration("AUTH_TELEGRAM_MAX_AGE", &c.Auth.TelegramMaxAge)
+
+	str("MAIL_DRIVER", (*string)(&c.Mail.Driver))
+	str("MAIL_FROM", &c.Mail.From)
+	str("MAIL_LOG_FILE", &c.Mail.LogFile)
+	str("SMTP_HOST", &c.Mail.SMTPHost)
+	integer("SMTP_PORT", &c.Mail.SMTPPort)
+	str("SMTP_USERNAME", &c.Mail.SMTPUsername)
+	str("SMTP_PASSWORD", &c.Mail.SMTPPassword)
+
+	integer("REFERRAL_REFERRER_BONUS", &c.Referral.ReferrerBonus)
+	integer("REFERRAL_REFEREE_BONUS", &c.Referral.RefereeBonus)
+
+	integer("FREE_SIGNUP_GRANT", &c.FreeTier.SignupGrant)
+	integer("FREE_DAILY_GENERATIONS", &c.FreeTier.DailyGenerations)
+	str("FREE_TIMEZONE", &c.FreeTier.Timezone)
+
+	duration("BILLING_CHECK_INTERVAL", &c.Billing.CheckInterval)
+	duration("BILLING_RETRY_INTERVAL", &c.Billing.RetryInterval)
+	duration("BILLING_GRACE_PERIOD", &c.Billing.GracePeriod)
+
+	duration("CREDITS_BONUS_EXPIRY", &c.Credits.BonusExpiry)
+	duration("CREDITS_REMINDER_BEFORE", &c.Credits.ReminderBefore)
+	integer("CREDITS_EXPIRY_HOUR", &c.Credits.ExpiryHour)
+
+	integer("RATE_LIMIT_PROVIDER_CONCURRENCY", &c.RateLimit.ProviderConcurrency)
+	integer("RATE_LIMIT_VIDEO_PROVIDER_CONCURRENCY", &c.RateLimit.VideoProviderConcurrency)
+
+	duration("IDEMPOTENCY_CALLBACK_WINDOW", &c.Idempotency.CallbackWindow)
+	duration("IDEMPOTENCY_ACTION_WINDOW", &c.Idempotency.ActionWindow)
+	duration("IDEMPOTENCY_KEY_TTL", &c.Idempotency.KeyTTL)
+
+	boolean("FEATURE_PROMPT_TRANSLATION", &c.Features.PromptTranslation)
+	boolean("FEATURE_PROMPT_ENHANCEMENT", &c.Features.PromptEnhancement)
+	boolean("SEED_ON_START", &c.Features.SeedOnStart)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid environment: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Validate reports every missing or out-of-range setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr is required"))
+	}
+	if len(c.Server.CORSOrigins) == 0 {
+		errs = append(errs, errors.New("server.cors_origins must not be empty"))
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, err := netip.ParsePrefix(proxy); err != nil {
+			if _, err := netip.ParseAddr(proxy); err != nil {
+				errs = append(errs, fmt.Errorf("server.trusted_proxies: %q is not an IP address or CIDR range", proxy))
+			}
+		}
+	}
+	if err := c.Log.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Metrics.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Tracing.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Database.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Bot.Token == "" {
+		errs = append(errs, errors.New("bot.token (BOT_TOKEN) is required"))
+	}
+	switch c.Bot.Mode {
+	case BotModePolling:
+	case BotModeWebhook:
+		if !strings.HasPrefix(c.Bot.WebhookURL, "https://") {
+			errs = append(errs, errors.New("bot.webhook_url must be an https URL in webhook mode"))
+		}
+		if !strings.HasPrefix(c.Bot.WebhookPath, "/") {
+			errs = append(errs, errors.New("bot.webhook_path must start with /"))
+		}
+		if !validWebhookSecret(c.Bot.WebhookSecret) {
+			errs = append(errs, errors.New("bot.webhook_secret must be 1-256 characters of A-Z, a-z, 0-9, _ or -"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("bot.mode must be %q or %q", BotModePolling, BotModeWebhook))
+	}
+	if c.Bot.CallbackSecret != "" && len(c.Bot.CallbackSecret) < 16 {
+		errs = append(errs, errors.New("bot.callback_secret must be at least 16 characters"))
+	}
+	if c.Pricing.EtbPerImageCredit <= 0 {
+		errs = append(errs, errors.New("pricing.etb_per_image_credit must be positive"))
+	}
+	if c.Pricing.ImageGenerationCost < 0 {
+		errs = append(errs, errors.New("pricing.image_generation_cost must not be negative"))
+	}
+	if c.Pricing.PromptEnhanceCost < 0 {
+		errs = append(errs, errors.New("pricing.prompt_enhance_cost must not be negative"))
+	}
+	for _, preset := range c.Pricing.DepositPresets {
+		if preset < c.Pricing.EtbPerImageCredit {
+			errs = append(errs, fmt.Errorf("pricing.deposit_presets: %d is below the price of one credit", preset))
+		}
+	}
+	if c.Pricing.EtbPerVideoCredit <= 0 {
+		errs = append(errs, errors.New("pricing.etb_per_video_credit must be positive"))
+	}
+	if c.Pricing.VideoGenerationCost < 0 {
+		errs = append(errs, errors.New("pricing.video_generation_cost must not be negative"))
+	}
+	for _, preset := range c.Pricing.VideoDepositPresets {
+		if preset < c.Pricing.EtbPerVideoCredit {
+			errs = append(errs, fmt.Errorf("pricing.video_deposit_presets: %d is below the price of one video credit", preset))
+		}
+	}
+
+	if err := c.Worker.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Auth.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Mail.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Referral.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.FreeTier.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Billing.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Credits.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.RateLimit.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Idempotency.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func (l LogConfig) Validate() error {
+	var errs []error
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+		errs = append(errs, errors.New("log.level must be debug, info, warn or error"))
+	}
+	if l.Format != LogFormatJSON && l.Format != LogFormatText {
+		errs = append(errs, fmt.Errorf("log.format must be %q or %q", LogFormatJSON, LogFormatText))
+	}
+	if l.SlowQuery < 0 {
+		errs = append(errs, errors.New("log.slow_query must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// SlogLevel returns Level as a slog.Level, or info if it is invalid.
+func (l LogConfig) SlogLevel() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+func (m MetricsConfig) Validate() error {
+	if m.Enabled && !strings.HasPrefix(m.Path, "/") {
+		return errors.New("metrics.path must start with /")
+	}
+	return nil
+}
+
+func (t TracingConfig) Validate() error {
+	if !t.Enabled {
+		return nil
+	}
+
+	var errs []error
+
+	if t.Endpoint == "" || t.ServiceName == "" {
+		errs = append(errs, errors.New("tracing.endpoint and service_name are required when tracing is enabled"))
+	}
+	if t.SampleRatio < 0 || t.SampleRatio > 1 {
+		errs = append(errs, errors.New("tracing.sample_ratio must be between 0 and 1"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (d DatabaseConfig) Validate() error {
+	var errs []error
+
+	if d.URL == "" {
+		errs = append(errs, errors.New("database.url (DATABASE_URL) is required"))
+	}
+	if d.MaxOpenConns < 0 || d.MaxIdleConns < 0 {
+		errs = append(errs, errors.New("database pool sizes must not be negative"))
+	}
+	if d.MaxOpenConns > 0 && d.MaxIdleConns > d.MaxOpenConns {
+		errs = append(errs, errors.New("database.max_idle_conns must not exceed max_open_conns"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (w WorkerConfig) Validate() error {
+	var errs []error
+
+	if w.Concurrency < 1 {
+		errs = append(errs, errors.New("worker.concurrency must be at least 1"))
+	}
+	if w.PollInterval <= 0 {
+		errs = append(errs, errors.New("worker.poll_interval must be positive"))
+	}
+	if w.StaleAfter <= 0 {
+		errs = append(errs, errors.New("worker.stale_after must be positive"))
+	}
+	if w.GenerateTimeout <= 0 || w.GenerateTimeout >= w.StaleAfter {
+		errs = append(errs, errors.New("worker.generate_timeout must be positive and shorter than stale_after"))
+	}
+	if w.VideoConcurrency < 1 {
+		errs = append(errs, errors.New("worker.video_concurrency must be at least 1"))
+	}
+	if w.VideoPollInterval <= 0 || w.VideoTimeout <= 0 {
+		errs = append(errs, errors.New("worker.video_poll_interval and video_timeout must be positive"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (a AuthConfig) Validate() error {
+	var errs []error
+
+	if a.SessionSecret != "" && len(a.SessionSecret) < 32 {
+		errs = append(errs, errors.New("auth.session_secret must be at least 32 characters"))
+	}
+	if a.SessionTTL <= 0 || a.VerifyEmailTTL <= 0 || a.ResetPasswordTTL <= 0 || a.TelegramMaxAge <= 0 {
+		errs = append(errs, errors.New("auth token lifetimes must be positive"))
+	}
+	if !strings.HasPrefix(a.PublicURL, "http://") && !strings.HasPrefix(a.PublicURL, "https://") {
+		errs = append(errs, errors.New("auth.public_url must be an http(s) URL"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (m MailConfig) Validate() error {
+	var errs []error
+
+	if m.From == "" {
+		errs = append(errs, errors.New("mail.from is required"))
+	}
+	switch m.Driver {
+	case MailDriverLog:
+	case MailDriverSMTP:
+		if m.SMTPHost == "" {
+			errs = append(errs, errors.New("mail.smtp_host (SMTP_HOST) is required for the smtp driver"))
+		}
+		if m.SMTPPort <= 0 || m.SMTPPort > 65535 {
+			errs = append(errs, errors.New("mail.smtp_port must be a valid port"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("mail.driver must be %q or %q", MailDriverLog, MailDriverSMTP))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (r ReferralConfig) Validate() error {
+	if r.ReferrerBonus < 0 || r.RefereeBonus < 0 {
+		return errors.New("referral bonuses must not be negative")
+	}
+	return nil
+}
+
+func (f FreeTierConfig) Validate() error {
+	var errs []error
+
+	if f.SignupGrant < 0 || f.DailyGenerations < 0 {
+		errs = append(errs, errors.New("free_tier amounts must not be negative"))
+	}
+	if _, err := time.LoadLocation(f.Timezone); err != nil {
+		errs = append(errs, fmt.Errorf("free_tier.timezone: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Location is the timezone the daily allowance resets in, or UTC if Timezone
+// is invalid (which Validate reports).
+func (f FreeTierConfig) Location() *time.Location {
+	loc, err := time.LoadLocation(f.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func (b BillingConfig) Validate() error {
+	var errs []error
+
+	if b.CheckInterval <= 0 || b.RetryInterval <= 0 {
+		errs = append(errs, errors.New("billing.check_interval and retry_interval must be positive"))
+	}
+	if b.GracePeriod < 0 {
+		errs = append(errs, errors.New("billing.grace_period must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c CreditsConfig) Validate() error {
+	var errs []error
+
+	if c.BonusExpiry < 0 || c.ReminderBefore < 0 {
+		errs = append(errs, errors.New("credits.bonus_expiry and reminder_before must not be negative"))
+	}
+	if c.ExpiryHour < 0 || c.ExpiryHour > 23 {
+		errs = append(errs, errors.New("credits.expiry_hour must be between 0 and 23"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (r RateLimitConfig) Validate() error {
+	var errs []error
+
+	if _, ok := r.Tiers["user"]; !ok {
+		errs = append(errs, errors.New("rate_limit.tiers must include \"user\""))
+	}
+	for _, name := range slices.Sorted(maps.Keys(r.Tiers)) {
+		tier := r.Tiers[name]
+		if err := tier.Prompts.validate("rate_limit.tiers." + name + ".prompts"); err != nil {
+			errs = append(errs, err)
+		}
+		if err := tier.API.validate("rate_limit.tiers." + name + ".api"); err != nil {
+			errs = append(errs, err)
+		}
+		if tier.InFlight < 0 {
+			errs = append(errs, fmt.Errorf("rate_limit.tiers.%s.in_flight must not be negative", name))
+		}
+	}
+	if err := r.IP.validate("rate_limit.ip"); err != nil {
+		errs = append(errs, err)
+	}
+	if r.ProviderConcurrency < 0 || r.VideoProviderConcurrency < 0 {
+		errs = append(errs, errors.New("rate_limit.provider_concurrency and video_provider_concurrency must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (i IdempotencyConfig) Validate() error {
+	if i.CallbackWindow <= 0 || i.KeyTTL <= 0 {
+		return errors.New("idempotency.callback_window and key_ttl must be positive")
+	}
+	if i.ActionWindow < 0 {
+		return errors.New("idempotency.action_window must not be negative")
+	}
+	return nil
+}
+
+func (r Rate) validate(name string) error {
+	if r.Burst < 0 {
+		return fmt.Errorf("%s.burst must not be negative", name)
+	}
+	if r.Burst > 0 && r.Every <= 0 {
+		return fmt.Errorf("%s.every must be positive", name)
+	}
+	return nil
+}
+
+// Tier returns the limits for a user with role and, when subscribed, the
+// plan with planCode. A tier for the role wins, so admins can be exempt;
+// then the plan's own tier, then "subscriber" for any plan, then "user".
+func (r RateLimitConfig) Tier(role, planCode string) RateLimitTier {
+	if tier, ok := r.Tiers[role]; ok && role != "user" {
+		return tier
+	}
+	if planCode != "" {
+		if tier, ok := r.Tiers[planCode]; ok {
+			return tier
+		}
+		if tier, ok := r.Tiers["subscriber"]; ok {
+			return tier
+		}
+	}
+	return r.Tiers["user"]
+}
+
+// AllowsAnyOrigin reports whether CORS is open to every origin. Browsers
+// reject credentialed requests to a wildcard origin, so credentials are only
+// allowed when explicit origins are configured.
+func (s ServerConfig) AllowsAnyOrigin() bool {
+	return slices.Contains(s.CORSOrigins, "*")
+}
+
+// WebhookEndpoint is the public URL Telegram delivers updates to.
+func (b BotConfig) WebhookEndpoint() string {
+	return strings.TrimRight(b.WebhookURL, "/") + b.WebhookPath
+}
+
+// validWebhookSecret applies Telegram's rules for secret_token.
+func validWebhookSecret(secret string) bool {
+	if len(secret) == 0 || len(secret) > 256 {
+		return false
+	}
+	for _, r := range secret {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// LLMEnabled reports whether an LLM backend is configured.
+func (c *Config) LLMEnabled() bool {
+	return c.LLM.APIKey != ""
+}
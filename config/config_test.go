@@ -0,0 +1,209 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/config"
+)
+
+// writeConfig writes a YAML config file and returns its path.
+func writeConfig(t *testing.T, yaml string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	return path
+}
+
+// valid returns the defaults with the settings they leave empty filled in.
+func valid() *config.Config {
+	cfg := config.Default()
+	cfg.Bot.Token = "123456:test"
+	cfg.Database.URL = "postgres://localhost/image_generation"
+	return cfg
+}
+
+// TestLoadPrecedence checks that the YAML file overrides the defaults and
+// environment variables override both.
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfig(t, `
+server:
+  addr: ":9000"
+  shutdown_timeout: 30s
+database:
+  max_open_conns: 5
+bot:
+  mode: webhook
+`)
+	t.Setenv("HTTP_ADDR", ":9100")
+	t.Setenv("DB_MAX_OPEN_CONNS", "")
+	t.Setenv("SHUTDOWN_TIMEOUT", "")
+	t.Setenv("BOT_MODE", "polling")
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	defaults := config.Default()
+	tests := []struct {
+		name      string
+		got, want any
+	}{
+		{name: "env over YAML", got: cfg.Server.Addr, want: ":9100"},
+		{name: "env over YAML mode", got: cfg.Bot.Mode, want: config.BotModePolling},
+		{name: "YAML over default", got: cfg.Database.MaxOpenConns, want: 5},
+		{name: "YAML duration, empty env ignored", got: cfg.Server.ShutdownTimeout, want: 30 * time.Second},
+		{name: "default", got: cfg.Pricing.EtbPerImageCredit, want: defaults.Pricing.EtbPerImageCredit},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+// TestLoadInvalid checks that values that don't parse fail Load, naming the
+// setting, instead of falling back to a default.
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		env  map[string]string
+		want []string
+	}{
+		{
+			name: "env integer",
+			env:  map[string]string{"DB_MAX_OPEN_CONNS": "ten"},
+			want: []string{"DB_MAX_OPEN_CONNS"},
+		},
+		{
+			name: "env duration without unit",
+			env:  map[string]string{"SHUTDOWN_TIMEOUT": "30"},
+			want: []string{"SHUTDOWN_TIMEOUT"},
+		},
+		{
+			name: "every env error at once",
+			env:  map[string]string{"DB_MAX_OPEN_CONNS": "ten", "LOG_SLOW_QUERY": "slow"},
+			want: []string{"DB_MAX_OPEN_CONNS", "LOG_SLOW_QUERY"},
+		},
+		{
+			name: "YAML duration",
+			yaml: "server:\n  shutdown_timeout: soon\n",
+			want: []string{"config file"},
+		},
+		{
+			name: "YAML integer",
+			yaml: "database:\n  max_open_conns: many\n",
+			want: []string{"config file"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			var path string
+			if tt.yaml != "" {
+				path = writeConfig(t, tt.yaml)
+			}
+
+			_, err := config.Load(path)
+			if err == nil {
+				t.Fatal("Load succeeded, want an error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Load error %q doesn't mention %s", err, want)
+				}
+			}
+		})
+	}
+}
+
+// TestValidateWebhook checks the settings webhook mode requires, including
+// Telegram's rules for the secret token.
+func TestValidateWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  string
+		wantErr bool
+	}{
+		{name: "valid", secret: "Abc_123-xyz"},
+		{name: "longest", secret: strings.Repeat("a", 256)},
+		{name: "missing", secret: "", wantErr: true},
+		{name: "too long", secret: strings.Repeat("a", 257), wantErr: true},
+		{name: "invalid character", secret: "abc:123", wantErr: true},
+		{name: "space", secret: "abc 123", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid()
+			cfg.Bot.Mode = config.BotModeWebhook
+			cfg.Bot.WebhookURL = "https://bot.example.com"
+			cfg.Bot.WebhookSecret = tt.secret
+
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "bot.webhook_secret") {
+				t.Errorf("Validate() = %v, want it to name bot.webhook_secret", err)
+			}
+		})
+	}
+
+	// Polling doesn't need a secret
+	cfg := valid()
+	cfg.Bot.Mode = config.BotModePolling
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() in polling mode = %v", err)
+	}
+
+	cfg = valid()
+	cfg.Bot.Mode = config.BotModeWebhook
+	cfg.Bot.WebhookURL = "http://bot.example.com"
+	cfg.Bot.WebhookSecret = "secret"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "bot.webhook_url") {
+		t.Errorf("Validate() with an http webhook URL = %v, want a bot.webhook_url error", err)
+	}
+}
+
+// TestAllowsAnyOrigin checks when CORS is open to every origin, which is
+// when credentialed requests are turned off.
+func TestAllowsAnyOrigin(t *testing.T) {
+	tests := []struct {
+		origins []string
+		want    bool
+	}{
+		{origins: []string{"*"}, want: true},
+		{origins: []string{"https://app.example.com", "*"}, want: true},
+		{origins: []string{"https://app.example.com"}, want: false},
+		{origins: []string{"https://app.example.com", "https://admin.example.com"}, want: false},
+	}
+	for _, tt := range tests {
+		server := config.ServerConfig{CORSOrigins: tt.origins}
+		if got := server.AllowsAnyOrigin(); got != tt.want {
+			t.Errorf("AllowsAnyOrigin(%q) = %v, want %v", tt.origins, got, tt.want)
+		}
+	}
+
+	t.Setenv("CORS_ORIGINS", "https://app.example.com, https://admin.example.com")
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Server.AllowsAnyOrigin() {
+		t.Errorf("CORS_ORIGINS %q allows any origin", cfg.Server.CORSOrigins)
+	}
+	if !config.Default().Server.AllowsAnyOrigin() {
+		t.Error("the default origins don't allow any origin")
+	}
+}
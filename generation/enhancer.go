@@ -0,0 +1,86 @@
+package generation
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Leul-Michael/image-generation/llm"
+	"github.com/Leul-Michael/image-generation/model"
+)
+
+type Enhancement struct {
+	Prompt string
+	Model  string
+	Usage  llm.Usage
+}
+
+// Enhancer rewrites a prompt with more descriptive detail for a category.
+type Enhancer interface {
+	Enhance(ctx context.Context, prompt string, category model.Category) (*Enhancement, error)
+}
+
+const enhancePrompt = "You are a prompt engineer for an AI image generator. " +
+	"Rewrite the user's prompt with richer visual detail: subject, composition, lighting, colors and style. " +
+	"Keep the user's intent and make it fit the %q category (%s). " +
+	"Reply in English with the rewritten prompt only, under 400 characters, without quotes or commentary."
+
+// LLMEnhancer enhances prompts through an OpenAI-compatible chat model.
+type LLMEnhancer struct {
+	Client *llm.Client
+}
+
+func NewLLMEnhancer(client *llm.Client) *LLMEnhancer {
+	return &LLMEnhancer{Client: client}
+}
+
+func (e *LLMEnhancer) Enhance(ctx context.Context, prompt string, category model.Category) (*Enhancement, error) {
+	completion, err := e.Client.Complete(ctx, []llm.Message{
+		{Role: "system", Content: fmt.Sprintf(enhancePrompt, category.Name, category.Description)},
+		{Role: "user", Content: prompt},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to enhance prompt: %w", err)
+	}
+
+	return &Enhancement{
+		Prompt: truncatePrompt(strings.Trim(completion.Content, "\"'")),
+		Model:  completion.Model,
+		Usage:  completion.Usage,
+	}, nil
+}
+
+// StaticEnhancer appends a fixed suffix to the prompt. It is meant for tests
+// and local development where no LLM is available.
+type StaticEnhancer struct {
+	Suffix string
+}
+
+func (e StaticEnhancer) Enhance(ctx context.Context, prompt string, category model.Category) (*Enhancement, error) {
+	return &Enhancement{
+		Prompt: strings.TrimSpace(prompt + " " + e.Suffix),
+		Model:  "static",
+	}, nil
+}
+
+// CreditCost is a price in thousandths of a credit, so features can cost a
+// fraction of a credit while balances stay whole numbers.
+type CreditCost int
+
+// NewCreditCost converts a decimal credit amount such as 0.25 to a CreditCost.
+func NewCreditCost(credits float64) CreditCost {
+	return CreditCost(math.Round(credits * 1000))
+}
+
+// ChargeFor returns the whole credits to charge for a use when the user has
+// already made previous uses. Fractional costs accumulate across uses, e.g.
+// a cost of 0.25 charges one credit on every fourth use.
+func (c CreditCost) ChargeFor(previous int) int {
+	return ((previous+1)*int(c))/1000 - (previous*int(c))/1000
+}
+
+func (c CreditCost) String() string {
+	return strconv.FormatFloat(float64(c)/1000, 'f', -1, 64)
+}
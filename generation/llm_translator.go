@@ -0,0 +1,31 @@
+package generation
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Leul-Michael/image-generation/llm"
+)
+
+const translatePrompt = "You translate prompts for an AI image generator into English. " +
+	"Keep every visual detail, style and mood. Reply with the English prompt only, without quotes or commentary."
+
+// LLMTranslator translates prompts through an OpenAI-compatible chat model.
+type LLMTranslator struct {
+	Client *llm.Client
+}
+
+func NewLLMTranslator(client *llm.Client) *LLMTranslator {
+	return &LLMTranslator{Client: client}
+}
+
+func (t *LLMTranslator) Translate(ctx context.Context, text, sourceLang string) (string, error) {
+	completion, err := t.Client.Complete(ctx, []llm.Message{
+		{Role: "system", Content: translatePrompt},
+		{Role: "user", Content: fmt.Sprintf("Source language: %s\n\n%s", sourceLang, text)},
+	})
+	if err != nil {
+		return "", err
+	}
+	return completion.Content, nil
+}
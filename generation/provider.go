@@ -0,0 +1,46 @@
+package generation
+
+import (
+	"context"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/llm"
+	"github.com/Leul-Michael/image-generation/model"
+)
+
+type ImageResult struct {
+	ImageURL     string
+	ThumbnailURL string
+	Model        string
+	Usage        llm.Usage
+	// Placeholder marks a result from a stand-in provider, which isn't
+	// charged.
+	Placeholder bool
+}
+
+// ImageProvider turns a generation request into an image.
+type ImageProvider interface {
+	Name() string
+	GenerateImage(ctx context.Context, request *model.ImageGenerationRequest) (*ImageResult, error)
+}
+
+// PlaceholderProvider stands in for a real image model. It waits for Delay
+// and returns a placeholder result without an image URL, which the bot
+// renders as the placeholder message.
+type PlaceholderProvider struct {
+	Delay time.Duration
+}
+
+func (p PlaceholderProvider) Name() string {
+	return "placeholder"
+}
+
+func (p PlaceholderProvider) GenerateImage(ctx context.Context, request *model.ImageGenerationRequest) (*ImageResult, error) {
+	select {
+	case <-time.After(p.Delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return &ImageResult{Model: p.Name(), Placeholder: true}, nil
+}
@@ -0,0 +1,113 @@
+package generation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Translator turns a prompt written in sourceLang into English.
+type Translator interface {
+	Translate(ctx context.Context, text, sourceLang string) (string, error)
+}
+
+type Translation struct {
+	Original   string
+	Text       string
+	SourceLang string
+}
+
+// Translated reports whether the English text differs from what the user typed.
+func (t Translation) Translated() bool {
+	return t.Text != t.Original
+}
+
+// DetectLanguage makes a script-based guess at the language of text. It
+// returns "am" for prompts written mostly in Ethiopic, "en" for Latin-only
+// prompts and "und" for anything else.
+func DetectLanguage(text string) string {
+	var letters, ethiopic, latin int
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Ethiopic, r):
+			ethiopic++
+			letters++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+			letters++
+		case unicode.IsLetter(r):
+			letters++
+		}
+	}
+
+	switch {
+	case letters == 0 || latin == letters:
+		return "en"
+	case ethiopic*2 >= letters:
+		return "am"
+	default:
+		return "und"
+	}
+}
+
+// ToEnglish detects the language of text and translates it when it isn't
+// English. English prompts are returned untouched without calling tr. A
+// translation is cut to maxPromptLength characters, like a typed prompt.
+func ToEnglish(ctx context.Context, tr Translator, text string) (Translation, error) {
+	result := Translation{
+		Original:   text,
+		Text:       text,
+		SourceLang: DetectLanguage(text),
+	}
+
+	if result.SourceLang == "en" {
+		return result, nil
+	}
+
+	translated, err := tr.Translate(ctx, text, result.SourceLang)
+	if err != nil {
+		return result, fmt.Errorf("failed to translate prompt: %w", err)
+	}
+
+	if translated = strings.TrimSpace(translated); translated != "" {
+		result.Text = truncatePrompt(translated)
+	}
+
+	return result, nil
+}
+
+// maxPromptLength is the most characters a prompt sent to a provider has.
+const maxPromptLength = 500
+
+// truncatePrompt cuts prompt to maxPromptLength characters.
+func truncatePrompt(prompt string) string {
+	if runes := []rune(prompt); len(runes) > maxPromptLength {
+		return string(runes[:maxPromptLength])
+	}
+	return prompt
+}
+
+// NoopTranslator returns prompts unchanged. It is used when no translation
+// backend is configured.
+type NoopTranslator struct{}
+
+func (NoopTranslator) Translate(ctx context.Context, text, sourceLang string) (string, error) {
+	return text, nil
+}
+
+// DictionaryTranslator replaces whole words using a fixed dictionary. It is
+// meant for tests and local development where no LLM is available.
+type DictionaryTranslator struct {
+	Words map[string]string
+}
+
+func (d DictionaryTranslator) Translate(ctx context.Context, text, sourceLang string) (string, error) {
+	fields := strings.Fields(text)
+	for i, word := range fields {
+		if translated, ok := d.Words[word]; ok {
+			fields[i] = translated
+		}
+	}
+	return strings.Join(fields, " "), nil
+}
@@ -0,0 +1,36 @@
+package generation_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/Leul-Michael/image-generation/generation"
+)
+
+// translatorFunc is a Translator calling itself.
+type translatorFunc func(ctx context.Context, text, sourceLang string) (string, error)
+
+func (f translatorFunc) Translate(ctx context.Context, text, sourceLang string) (string, error) {
+	return f(ctx, text, sourceLang)
+}
+
+// TestToEnglishTruncates checks that a translation longer than a prompt may
+// be is cut, counting characters rather than bytes.
+func TestToEnglishTruncates(t *testing.T) {
+	translator := translatorFunc(func(ctx context.Context, text, sourceLang string) (string, error) {
+		return strings.Repeat("é", 600), nil
+	})
+
+	translation, err := generation.ToEnglish(context.Background(), translator, "ፏፏቴ በስሜን ተራሮች")
+	if err != nil {
+		t.Fatalf("ToEnglish: %v", err)
+	}
+	if n := utf8.RuneCountInString(translation.Text); n != 500 {
+		t.Errorf("translation has %d characters, want 500", n)
+	}
+	if !utf8.ValidString(translation.Text) {
+		t.Error("translation was cut inside a character")
+	}
+}
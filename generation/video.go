@@ -0,0 +1,104 @@
+package generation
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/Leul-Michael/image-generation/model"
+	"github.com/google/uuid"
+)
+
+type VideoResult struct {
+	VideoURL        string
+	ThumbnailURL    string
+	DurationSeconds int
+	Model           string
+	// Placeholder marks a result from a stand-in provider, which isn't
+	// charged.
+	Placeholder bool
+}
+
+// VideoJob is the state of a provider job. Exactly one of Result and Failure
+// is set once the job has ended.
+type VideoJob struct {
+	Progress int // percent
+	Result   *VideoResult
+	Failure  string
+}
+
+// VideoProvider turns a request into a video. Videos take minutes, so the
+// provider starts a job and the worker polls it until it ends.
+type VideoProvider interface {
+	Name() string
+	// StartVideo starts a job for request and returns its ID. source is
+	// the photo to animate, nil for text-to-video.
+	StartVideo(ctx context.Context, request *model.VideoGenerationRequest, source io.Reader) (string, error)
+	// PollVideo reports the state of a started job. An error means the
+	// state could not be fetched this time, not that the job failed.
+	PollVideo(ctx context.Context, jobID string) (*VideoJob, error)
+}
+
+// FileSource opens files users sent to the bot, such as photos to animate.
+type FileSource interface {
+	OpenFile(ctx context.Context, fileID string) (io.ReadCloser, error)
+}
+
+// PlaceholderVideoProvider stands in for a real video model. Each poll
+// advances a job by one of Steps steps; the last one returns a placeholder
+// result with VideoURL, which is empty unless set, so the bot renders the
+// placeholder message. Jobs are kept in memory and can only be polled by the process
+// that started them.
+type PlaceholderVideoProvider struct {
+	Steps    int
+	VideoURL string
+
+	mu   sync.Mutex
+	jobs map[string]int // steps done
+}
+
+func (p *PlaceholderVideoProvider) Name() string {
+	return "placeholder"
+}
+
+func (p *PlaceholderVideoProvider) StartVideo(ctx context.Context, request *model.VideoGenerationRequest, source io.Reader) (string, error) {
+	if source != nil {
+		if _, err := io.Copy(io.Discard, source); err != nil {
+			return "", fmt.Errorf("failed to read source image: %w", err)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.jobs == nil {
+		p.jobs = make(map[string]int)
+	}
+	jobID := uuid.NewString()
+	p.jobs[jobID] = 0
+	return jobID, nil
+}
+
+func (p *PlaceholderVideoProvider) PollVideo(ctx context.Context, jobID string) (*VideoJob, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	done, ok := p.jobs[jobID]
+	if !ok {
+		return &VideoJob{Failure: "unknown job " + jobID}, nil
+	}
+
+	done++
+	steps := max(p.Steps, 1)
+	if done < steps {
+		p.jobs[jobID] = done
+		return &VideoJob{Progress: done * 100 / steps}, nil
+	}
+
+	delete(p.jobs, jobID)
+	return &VideoJob{
+		Progress: 100,
+		Result:   &VideoResult{VideoURL: p.VideoURL, DurationSeconds: 5, Model: p.Name(), Placeholder: true},
+	}, nil
+}
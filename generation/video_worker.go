@@ -0,0 +1,231 @@
+package generation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/Leul-Michael/image-generation/metrics"
+	"github.com/Leul-Michael/image-generation/model"
+	requestrepo "github.com/Leul-Michael/image-generation/repository/request"
+	videorepo "github.com/Leul-Michael/image-generation/repository/video"
+)
+
+// VideoNotifier keeps the user up to date on a video request.
+type VideoNotifier interface {
+	NotifyVideoProgress(ctx context.Context, request *model.VideoGenerationRequest) error
+	NotifyVideoCompleted(ctx context.Context, request *model.VideoGenerationRequest) error
+	NotifyVideoFailed(ctx context.Context, request *model.VideoGenerationRequest, reason error) error
+}
+
+type VideoWorkerOptions struct {
+	Concurrency int
+	// PollInterval is how often an idle worker checks the queue.
+	PollInterval time.Duration
+	// JobPollInterval is how often a running job is checked with the
+	// provider. It is also how long a claimed request is kept from other
+	// workers.
+	JobPollInterval time.Duration
+	// Timeout fails requests that have not finished this long after they
+	// were made.
+	Timeout time.Duration
+	// MaxRunning caps the jobs running at the provider for all workers
+	// sharing the queue. 0 means no cap.
+	MaxRunning int
+	// Metrics may be nil.
+	Metrics *metrics.Metrics
+	// Logger defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+// VideoWorker starts video jobs for pending VideoGenerationRequests and
+// follows them until they end. A worker only holds a request while starting
+// or polling its job, so a few workers can follow many jobs, in one process
+// or many.
+type VideoWorker struct {
+	requests videorepo.VideoGenerationRequestRepo
+	provider VideoProvider
+	files    FileSource
+	notifier VideoNotifier
+	opts     VideoWorkerOptions
+}
+
+func NewVideoWorker(requests videorepo.VideoGenerationRequestRepo, provider VideoProvider, files FileSource, notifier VideoNotifier, opts VideoWorkerOptions) *VideoWorker {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	return &VideoWorker{
+		requests: requests,
+		provider: provider,
+		files:    files,
+		notifier: notifier,
+		opts:     opts,
+	}
+}
+
+// Run processes requests until ctx is cancelled.
+func (w *VideoWorker) Run(ctx context.Context) error {
+	w.opts.Logger.Info("Starting video workers", "concurrency", w.opts.Concurrency, "provider", w.provider.Name())
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx)
+		}()
+	}
+	wg.Wait()
+
+	return nil
+}
+
+func (w *VideoWorker) loop(ctx context.Context) {
+	for {
+		processed, err := w.RunOnce(ctx)
+		if err != nil {
+			w.opts.Logger.ErrorContext(ctx, "Failed to claim video generation request", logging.Err(err))
+		}
+
+		if processed {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.opts.PollInterval):
+		}
+	}
+}
+
+// RunOnce claims a request that is due and starts or polls its job. It
+// reports whether there was one.
+func (w *VideoWorker) RunOnce(ctx context.Context) (bool, error) {
+	now := time.Now()
+	request, err := w.requests.ClaimNext(ctx, now, now.Add(w.opts.JobPollInterval), w.opts.MaxRunning)
+	if errors.Is(err, videorepo.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	ctx = requestContext(ctx, request.CorrelationID)
+	switch {
+	case now.Sub(request.CreatedAt) > w.opts.Timeout:
+		w.fail(ctx, request, fmt.Errorf("timed out after %s", w.opts.Timeout))
+	case request.ProviderJobID == nil:
+		w.start(ctx, request)
+	default:
+		w.poll(ctx, request)
+	}
+	return true, nil
+}
+
+func (w *VideoWorker) start(ctx context.Context, request *model.VideoGenerationRequest) {
+	var source io.Reader
+	if request.SourceImageFileID != nil {
+		file, err := w.files.OpenFile(ctx, *request.SourceImageFileID)
+		if err != nil {
+			w.fail(ctx, request, fmt.Errorf("failed to download source image: %w", err))
+			return
+		}
+		defer file.Close()
+		source = file
+	}
+
+	jobID, err := w.provider.StartVideo(ctx, request, source)
+	if err != nil {
+		w.opts.Metrics.ProviderError(metrics.TypeVideo, w.provider.Name())
+		w.fail(ctx, request, fmt.Errorf("provider %s failed to start: %w", w.provider.Name(), err))
+		return
+	}
+
+	// Without the job ID the request is started again once the claim runs
+	// out, and the first job is abandoned.
+	if err := w.requests.Start(ctx, request, jobID); err != nil {
+		w.opts.Logger.ErrorContext(ctx, "Failed to record video job", "request_id", request.ID, "job_id", jobID, logging.Err(err))
+		return
+	}
+	w.opts.Logger.InfoContext(ctx, "Started video job", "request_id", request.ID, "job_id", jobID, "provider", w.provider.Name())
+}
+
+// poll checks the job once. Until the job ends, the claim keeps the
+// request from being polled again for JobPollInterval.
+func (w *VideoWorker) poll(ctx context.Context, request *model.VideoGenerationRequest) {
+	job, err := w.provider.PollVideo(ctx, *request.ProviderJobID)
+	if err != nil {
+		w.opts.Metrics.ProviderError(metrics.TypeVideo, w.provider.Name())
+		w.opts.Logger.WarnContext(ctx, "Failed to poll video job", "request_id", request.ID, "job_id", *request.ProviderJobID, logging.Err(err))
+		return
+	}
+
+	switch {
+	case job.Failure != "":
+		w.opts.Metrics.ProviderError(metrics.TypeVideo, w.provider.Name())
+		w.fail(ctx, request, fmt.Errorf("provider %s failed: %s", w.provider.Name(), job.Failure))
+	case job.Result != nil:
+		w.complete(ctx, request, job.Result)
+	case job.Progress != request.Progress:
+		if err := w.requests.UpdateProgress(ctx, request, job.Progress); err != nil {
+			w.opts.Logger.ErrorContext(ctx, "Failed to update video progress", "request_id", request.ID, logging.Err(err))
+			return
+		}
+		if err := w.notifier.NotifyVideoProgress(ctx, request); err != nil {
+			w.opts.Logger.WarnContext(ctx, "Failed to report video progress", "request_id", request.ID, logging.Err(err))
+		}
+	}
+}
+
+// complete stores the result. The credits were reserved when the request
+// was created and are refunded for a placeholder.
+func (w *VideoWorker) complete(ctx context.Context, request *model.VideoGenerationRequest, result *VideoResult) {
+	request.VideoURL = result.VideoURL
+	request.ThumbnailURL = result.ThumbnailURL
+	request.DurationSeconds = result.DurationSeconds
+	request.ModelUsed = result.Model
+	request.GenerationTime = int(time.Since(request.CreatedAt).Seconds())
+
+	creditsUsed := request.CreditsRequired
+	if result.Placeholder {
+		creditsUsed = 0
+	}
+	if err := w.requests.Complete(ctx, request, creditsUsed); err != nil {
+		w.fail(ctx, request, err)
+		return
+	}
+
+	w.opts.Logger.InfoContext(ctx, "Generated video", "request_id", request.ID, "provider", w.provider.Name(), "duration", time.Since(request.CreatedAt))
+	w.opts.Metrics.GenerationCompleted(metrics.TypeVideo, w.provider.Name(), "", time.Since(request.CreatedAt), model.CreditTypeVideo, creditsUsed)
+
+	if err := w.notifier.NotifyVideoCompleted(ctx, request); err != nil {
+		w.opts.Logger.ErrorContext(ctx, "Failed to deliver video", "request_id", request.ID, logging.Err(err))
+	}
+}
+
+func (w *VideoWorker) fail(ctx context.Context, request *model.VideoGenerationRequest, reason error) {
+	w.opts.Logger.WarnContext(ctx, "Video generation failed", "request_id", request.ID, "reason", reason)
+	w.opts.Metrics.GenerationFailed(metrics.TypeVideo, w.provider.Name())
+
+	message := reason.Error()
+	if len(message) > 500 {
+		message = message[:500]
+	}
+
+	if err := w.requests.Fail(ctx, request, message); errors.Is(err, requestrepo.ErrNotProcessing) {
+		w.opts.Logger.WarnContext(ctx, "Video generation finished elsewhere", "request_id", request.ID)
+		return
+	} else if err != nil {
+		w.opts.Logger.ErrorContext(ctx, "Failed to mark video generation as failed", "request_id", request.ID, logging.Err(err))
+	}
+
+	if err := w.notifier.NotifyVideoFailed(ctx, request, reason); err != nil {
+		w.opts.Logger.ErrorContext(ctx, "Failed to notify about failed video generation", "request_id", request.ID, logging.Err(err))
+	}
+}
@@ -0,0 +1,235 @@
+package generation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/Leul-Michael/image-generation/metrics"
+	"github.com/Leul-Michael/image-generation/model"
+	requestrepo "github.com/Leul-Michael/image-generation/repository/request"
+	"github.com/Leul-Michael/image-generation/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Notifier tells the user how their generation request ended.
+type Notifier interface {
+	NotifyCompleted(ctx context.Context, request *model.ImageGenerationRequest, image *model.GeneratedImage) error
+	NotifyFailed(ctx context.Context, request *model.ImageGenerationRequest, reason error) error
+}
+
+type WorkerOptions struct {
+	Concurrency  int
+	PollInterval time.Duration
+	// StaleAfter requeues requests stuck in processing, e.g. after a crash.
+	StaleAfter time.Duration
+	// GenerateTimeout bounds a provider call. It must be shorter than
+	// StaleAfter, so a request is never requeued while a worker is still
+	// generating it. 0 means no timeout.
+	GenerateTimeout time.Duration
+	// MaxProcessing caps the requests being generated at once by all
+	// workers sharing the queue, to stay within the provider's limits.
+	// 0 means no cap.
+	MaxProcessing int
+	// Metrics may be nil.
+	Metrics *metrics.Metrics
+	// Logger defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+// Worker processes pending ImageGenerationRequests. Several workers, in one
+// process or many, can share the queue: claiming a request is atomic.
+type Worker struct {
+	requests requestrepo.ImageGenerationRequestRepo
+	provider ImageProvider
+	notifier Notifier
+	opts     WorkerOptions
+}
+
+func NewWorker(requests requestrepo.ImageGenerationRequestRepo, provider ImageProvider, notifier Notifier, opts WorkerOptions) *Worker {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	return &Worker{
+		requests: requests,
+		provider: provider,
+		notifier: notifier,
+		opts:     opts,
+	}
+}
+
+// Run processes requests until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context) error {
+	w.opts.Logger.Info("Starting generation workers", "concurrency", w.opts.Concurrency, "provider", w.provider.Name())
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx)
+		}()
+	}
+	wg.Wait()
+
+	return nil
+}
+
+func (w *Worker) loop(ctx context.Context) {
+	for {
+		processed, err := w.RunOnce(ctx)
+		if err != nil {
+			w.opts.Logger.ErrorContext(ctx, "Failed to claim generation request", logging.Err(err))
+		}
+
+		if processed {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.opts.PollInterval):
+		}
+	}
+}
+
+// RunOnce claims and processes a single request. It reports whether there
+// was one to process.
+func (w *Worker) RunOnce(ctx context.Context) (bool, error) {
+	request, err := w.requests.ClaimNext(ctx, time.Now().Add(-w.opts.StaleAfter), w.opts.MaxProcessing)
+	if errors.Is(err, requestrepo.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// The request continues the trace of the update that made it
+	ctx = tracing.Extract(requestContext(ctx, request.CorrelationID), request.TraceParent)
+	tracing.Record(ctx, "generation.queue", request.CreatedAt, time.Now(), attribute.Int("priority", request.Priority))
+
+	ctx, span := tracing.Start(ctx, "generation.process",
+		attribute.String("request_id", request.ID.String()),
+		attribute.String("provider", w.provider.Name()),
+		attribute.String("category", request.Category.Slug),
+	)
+	err = w.process(ctx, request)
+	tracing.End(span, err)
+	return true, nil
+}
+
+// process generates the image and delivers it. The credits were reserved
+// when the request was queued and are refunded if it fails or the provider
+// only returns a placeholder. The error
+// returned is the reason it failed, already recorded.
+func (w *Worker) process(ctx context.Context, request *model.ImageGenerationRequest) error {
+	started := time.Now()
+
+	result, err := w.generate(ctx, request)
+	if err != nil {
+		w.opts.Metrics.ProviderError(metrics.TypeImage, w.provider.Name())
+		err = fmt.Errorf("provider %s failed: %w", w.provider.Name(), err)
+		w.fail(ctx, request, err)
+		return err
+	}
+	w.opts.Logger.InfoContext(ctx, "Generated image", "request_id", request.ID, "provider", w.provider.Name(), "duration", time.Since(started))
+
+	image, err := w.complete(ctx, request, result, time.Since(started))
+	if errors.Is(err, requestrepo.ErrNotProcessing) {
+		// Another worker took it over and has told the user
+		w.opts.Logger.WarnContext(ctx, "Generation finished elsewhere", "request_id", request.ID)
+		return err
+	}
+	if err != nil {
+		w.fail(ctx, request, err)
+		return err
+	}
+	w.opts.Metrics.GenerationCompleted(metrics.TypeImage, w.provider.Name(), request.Category.Slug, time.Since(request.CreatedAt), model.CreditTypeImage, image.CreditsUsed)
+
+	sendCtx, span := tracing.Start(ctx, "telegram.send")
+	err = w.notifier.NotifyCompleted(sendCtx, request, image)
+	tracing.End(span, err)
+	if err != nil {
+		w.opts.Logger.ErrorContext(ctx, "Failed to deliver generation", "request_id", request.ID, logging.Err(err))
+	}
+	return nil
+}
+
+func (w *Worker) generate(ctx context.Context, request *model.ImageGenerationRequest) (result *ImageResult, err error) {
+	ctx, span := tracing.Start(ctx, "generation.provider", attribute.String("provider", w.provider.Name()))
+	defer func() { tracing.End(span, err) }()
+
+	if w.opts.GenerateTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.opts.GenerateTimeout)
+		defer cancel()
+	}
+
+	return w.provider.GenerateImage(ctx, request)
+}
+
+// complete stores the generated image and marks the request completed in
+// one transaction.
+func (w *Worker) complete(ctx context.Context, request *model.ImageGenerationRequest, result *ImageResult, took time.Duration) (_ *model.GeneratedImage, err error) {
+	ctx, span := tracing.Start(ctx, "generation.complete", attribute.Int("credits", request.CreditsRequired))
+	defer func() { tracing.End(span, err) }()
+
+	image := model.GeneratedImage{
+		UserID:            request.UserID,
+		CategoryID:        request.CategoryID,
+		Prompt:            request.Prompt,
+		ImageURL:          result.ImageURL,
+		ThumbnailURL:      result.ThumbnailURL,
+		ReferenceImageURL: request.ReferenceImageURL,
+		Status:            string(model.RequestStatusCompleted),
+		GenerationTime:    int(took.Seconds()),
+		CreditsUsed:       request.CreditsRequired,
+		ModelUsed:         result.Model,
+		PromptTokens:      result.Usage.PromptTokens,
+		CompletionTokens:  result.Usage.CompletionTokens,
+		TotalTokens:       result.Usage.TotalTokens,
+	}
+	if result.Placeholder {
+		image.CreditsUsed = 0
+	}
+
+	if err := w.requests.Complete(ctx, request, &image); err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
+
+func (w *Worker) fail(ctx context.Context, request *model.ImageGenerationRequest, reason error) {
+	w.opts.Logger.WarnContext(ctx, "Generation failed", "request_id", request.ID, "reason", reason)
+	w.opts.Metrics.GenerationFailed(metrics.TypeImage, w.provider.Name())
+
+	message := reason.Error()
+	if len(message) > 500 {
+		message = message[:500]
+	}
+
+	if err := w.requests.Fail(ctx, request, message); errors.Is(err, requestrepo.ErrNotProcessing) {
+		w.opts.Logger.WarnContext(ctx, "Generation finished elsewhere", "request_id", request.ID)
+		return
+	} else if err != nil {
+		w.opts.Logger.ErrorContext(ctx, "Failed to mark generation as failed", "request_id", request.ID, logging.Err(err))
+	}
+
+	if err := w.notifier.NotifyFailed(ctx, request, reason); err != nil {
+		w.opts.Logger.ErrorContext(ctx, "Failed to notify about failed generation", "request_id", request.ID, logging.Err(err))
+	}
+}
+
+// requestContext returns ctx carrying the correlation ID of the update that
+// made a request, or a new one for requests made before IDs were kept.
+func requestContext(ctx context.Context, correlationID string) context.Context {
+	if correlationID == "" {
+		correlationID = logging.NewCorrelationID()
+	}
+	return logging.WithCorrelationID(ctx, correlationID)
+}
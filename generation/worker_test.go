@@ -0,0 +1,218 @@
+package generation_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/config"
+	"github.com/Leul-Michael/image-generation/generation"
+	"github.com/Leul-Michael/image-generation/handler"
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/Leul-Michael/image-generation/model"
+	"github.com/google/uuid"
+)
+
+// providerFunc is an ImageProvider calling itself.
+type providerFunc func(ctx context.Context, request *model.ImageGenerationRequest) (*generation.ImageResult, error)
+
+func (f providerFunc) Name() string { return "test" }
+
+func (f providerFunc) GenerateImage(ctx context.Context, request *model.ImageGenerationRequest) (*generation.ImageResult, error) {
+	return f(ctx, request)
+}
+
+// notifications records what the worker tells users.
+type notifications struct {
+	mu        sync.Mutex
+	completed int
+	failed    []error
+}
+
+func (n *notifications) NotifyCompleted(ctx context.Context, request *model.ImageGenerationRequest, image *model.GeneratedImage) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.completed++
+	return nil
+}
+
+func (n *notifications) NotifyFailed(ctx context.Context, request *model.ImageGenerationRequest, reason error) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.failed = append(n.failed, reason)
+	return nil
+}
+
+// queue returns memory repos with one pending request from a new user,
+// costing one of the credits they signed up with.
+func queue(t *testing.T) (handler.Repos, *model.ImageGenerationRequest) {
+	t.Helper()
+	ctx := context.Background()
+	defaults := config.Default()
+	repos := handler.NewMemoryRepos(defaults.FreeTier, defaults.Credits)
+
+	user := model.User{FirstName: "Abebe"}
+	if err := repos.Users.Register(ctx, &user); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	request := model.ImageGenerationRequest{UserID: user.ID, Prompt: "A waterfall", Status: model.RequestStatusPending, CreditsRequired: 1}
+	if err := repos.Requests.Create(ctx, &request, 0); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return repos, &request
+}
+
+// balance is the user's image credits.
+func balance(t *testing.T, repos handler.Repos, request *model.ImageGenerationRequest) int {
+	t.Helper()
+	userCredit, err := repos.Credits.Get(context.Background(), request.UserID, model.CreditTypeImage)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	return userCredit.Credits
+}
+
+// TestWorkerGenerateTimeout gives up on a provider that doesn't answer in
+// time and refunds the credit taken when the request was queued to the lot
+// it came from.
+func TestWorkerGenerateTimeout(t *testing.T) {
+	repos, request := queue(t)
+	reserved := balance(t, repos, request)
+	provider := providerFunc(func(ctx context.Context, request *model.ImageGenerationRequest) (*generation.ImageResult, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	notifier := &notifications{}
+	worker := generation.NewWorker(repos.Requests, provider, notifier, generation.WorkerOptions{
+		StaleAfter:      time.Minute,
+		GenerateTimeout: 10 * time.Millisecond,
+		Logger:          logging.Discard(),
+	})
+
+	if processed, err := worker.RunOnce(context.Background()); !processed || err != nil {
+		t.Fatalf("RunOnce = %v, %v, want a processed request", processed, err)
+	}
+
+	stored, err := repos.Requests.GetByID(context.Background(), request.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if stored.Status != model.RequestStatusFailed {
+		t.Errorf("status %q, want %q", stored.Status, model.RequestStatusFailed)
+	}
+	if len(notifier.failed) != 1 || !errors.Is(notifier.failed[0], context.DeadlineExceeded) {
+		t.Errorf("failure notifications %v, want one for the deadline", notifier.failed)
+	}
+	if credits := balance(t, repos, request); credits != reserved+1 {
+		t.Errorf("balance %d after failing, want %d with the credit refunded", credits, reserved+1)
+	}
+
+	// The credit goes back to the signup grant, expiring with it
+	lots, err := repos.Credits.Lots(context.Background(), request.UserID, model.CreditTypeImage)
+	if err != nil {
+		t.Fatalf("Lots: %v", err)
+	}
+	for _, lot := range lots {
+		if lot.Source != model.TransactionTypeSignupGrant || lot.ExpiresAt == nil {
+			t.Errorf("lot from %q expiring at %v, want only the expiring signup grant", lot.Source, lot.ExpiresAt)
+		}
+	}
+}
+
+// TestWorkerFinishedElsewhere has the request failed by someone else while
+// the provider works on it, as when another worker took it over as stale.
+// The late result is dropped and the user hears about the request once.
+func TestWorkerFinishedElsewhere(t *testing.T) {
+	repos, request := queue(t)
+	reserved := balance(t, repos, request)
+	provider := providerFunc(func(ctx context.Context, claimed *model.ImageGenerationRequest) (*generation.ImageResult, error) {
+		if err := repos.Requests.Fail(ctx, claimed, "taken over"); err != nil {
+			t.Errorf("Fail: %v", err)
+		}
+		return &generation.ImageResult{}, nil
+	})
+	notifier := &notifications{}
+	worker := generation.NewWorker(repos.Requests, provider, notifier, generation.WorkerOptions{
+		StaleAfter:      time.Minute,
+		GenerateTimeout: time.Second,
+		Logger:          logging.Discard(),
+	})
+
+	if processed, _ := worker.RunOnce(context.Background()); !processed {
+		t.Fatal("RunOnce found nothing to process")
+	}
+
+	stored, err := repos.Requests.GetByID(context.Background(), request.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if stored.Status != model.RequestStatusFailed || stored.GeneratedImageID != nil {
+		t.Errorf("request is %q with image %v, want failed without one", stored.Status, stored.GeneratedImageID)
+	}
+	if notifier.completed != 0 || len(notifier.failed) != 0 {
+		t.Errorf("worker sent %d completed and %d failed notifications, want none", notifier.completed, len(notifier.failed))
+	}
+	if credits := balance(t, repos, request); credits != reserved+1 {
+		t.Errorf("balance %d, want %d with the credit refunded once", credits, reserved+1)
+	}
+}
+
+// TestWorkerPlaceholder completes requests with the PlaceholderProvider and
+// checks that the credits taken when they were queued are refunded, as there
+// is no image to pay for, so that bought credits spent on one no longer
+// count as paid.
+func TestWorkerPlaceholder(t *testing.T) {
+	ctx := context.Background()
+	repos, request := queue(t)
+	if _, err := repos.Credits.Apply(ctx, &model.Transaction{
+		UserID:      request.UserID,
+		CreditType:  model.CreditTypeImage,
+		Amount:      1,
+		Type:        model.TransactionTypePurchase,
+		Description: "Bought in test",
+	}); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	// The rest of the signup grant and the bought credit
+	reserved := balance(t, repos, request)
+	bought := model.ImageGenerationRequest{UserID: request.UserID, Prompt: "A market", Status: model.RequestStatusPending, CreditsRequired: reserved}
+	if err := repos.Requests.Create(ctx, &bought, 0); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if paid, err := repos.Credits.Paid(ctx, bought.ID.String()); !paid || err != nil {
+		t.Fatalf("Paid = %v, %v before generating, want true", paid, err)
+	}
+
+	notifier := &notifications{}
+	worker := generation.NewWorker(repos.Requests, generation.PlaceholderProvider{}, notifier, generation.WorkerOptions{
+		StaleAfter:      time.Minute,
+		GenerateTimeout: time.Second,
+		Logger:          logging.Discard(),
+	})
+	for range 2 {
+		if processed, err := worker.RunOnce(ctx); !processed || err != nil {
+			t.Fatalf("RunOnce = %v, %v, want a processed request", processed, err)
+		}
+	}
+
+	for _, id := range []uuid.UUID{request.ID, bought.ID} {
+		stored, err := repos.Requests.GetByID(ctx, id)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		if stored.Status != model.RequestStatusCompleted {
+			t.Errorf("status %q, want %q", stored.Status, model.RequestStatusCompleted)
+		}
+	}
+	if notifier.completed != 2 {
+		t.Errorf("%d completion notifications, want 2", notifier.completed)
+	}
+	if credits := balance(t, repos, request); credits != reserved+1 {
+		t.Errorf("balance %d after placeholders, want %d with the credits refunded", credits, reserved+1)
+	}
+	if paid, err := repos.Credits.Paid(ctx, bought.ID.String()); paid || err != nil {
+		t.Errorf("Paid = %v, %v after a placeholder, want false", paid, err)
+	}
+}
@@ -0,0 +1,433 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	netmail "net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/auth"
+	"github.com/Leul-Michael/image-generation/config"
+	"github.com/Leul-Michael/image-generation/i18n"
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/Leul-Michael/image-generation/mail"
+	"github.com/Leul-Michael/image-generation/model"
+	authtokenrepo "github.com/Leul-Michael/image-generation/repository/authtoken"
+	userrepo "github.com/Leul-Michael/image-generation/repository/user"
+	"github.com/gin-gonic/gin"
+)
+
+// AuthHandler serves email and password accounts. Every way of signing in
+// ends with the same session token, see respondWithSession.
+type AuthHandler struct {
+	repos    Repos
+	i18n     *i18n.Bundle
+	mailer   mail.Mailer
+	sessions *auth.Sessions
+	config   config.AuthConfig
+	logger   *slog.Logger
+}
+
+func NewAuthHandler(repos Repos, bundle *i18n.Bundle, mailer mail.Mailer, sessions *auth.Sessions, cfg config.AuthConfig, logger *slog.Logger) *AuthHandler {
+	return &AuthHandler{
+		repos:    repos,
+		i18n:     bundle,
+		mailer:   mailer,
+		sessions: sessions,
+		config:   cfg,
+		logger:   logger,
+	}
+}
+
+// normalizeEmail accepts a bare address such as "Abebe@Example.com" and
+// returns it lowercased.
+func normalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	address, err := netmail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return "", errors.New("invalid email address")
+	}
+	return strings.ToLower(email), nil
+}
+
+func (h *AuthHandler) Register(c *gin.Context) {
+	var body struct {
+		Email     string `json:"email" binding:"required"`
+		Password  string `json:"password" binding:"required"`
+		FirstName string `json:"first_name" binding:"required"`
+		LastName  string `json:"last_name"`
+		Lang      string `json:"lang"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	email, err := normalizeEmail(body.Email)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hash, err := auth.HashPassword(body.Password)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	lang := i18n.DefaultLang
+	if h.i18n.Supports(body.Lang) {
+		lang = body.Lang
+	}
+
+	user := model.User{
+		FirstName: strings.TrimSpace(body.FirstName),
+		LastName:  strings.TrimSpace(body.LastName),
+		Email:     &email,
+		Password:  &hash,
+		Role:      model.RoleUser,
+		Lang:      lang,
+	}
+	if err := h.repos.Users.Register(c.Request.Context(), &user); err != nil {
+		if errors.Is(err, userrepo.ErrEmailTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email is already registered"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create account"})
+		return
+	}
+
+	h.sendVerification(c.Request.Context(), &user, email)
+
+	registered, err := h.repos.Users.GetById(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load account"})
+		return
+	}
+	respondWithSession(c, h.sessions, http.StatusCreated, "Account created", registered)
+}
+
+func (h *AuthHandler) Login(c *gin.Context) {
+	var body struct {
+		Email    string `json:"email" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	// Unknown emails and wrong passwords get the same answer, so the
+	// endpoint cannot be used to find out who has an account.
+	email, _ := normalizeEmail(body.Email)
+	sub, err := h.repos.Users.ComparePassword(c.Request.Context(), email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check credentials"})
+		return
+	}
+	if err := auth.CheckPassword(sub.Password, body.Password); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		return
+	}
+	if sub.IsDeactivated {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is deactivated"})
+		return
+	}
+	// Anyone can register an address; until its owner follows the link,
+	// it doesn't sign in. Registering returned a session already.
+	if sub.EmailVerifiedAt == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email is not verified"})
+		return
+	}
+
+	if err := h.repos.Users.UpdateField(c.Request.Context(), sub.Id, "last_login", time.Now()); err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "Failed to record login", "user_id", sub.Id, logging.Err(err))
+	}
+
+	user, err := h.repos.Users.GetById(c.Request.Context(), sub.Id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load account"})
+		return
+	}
+	respondWithSession(c, h.sessions, http.StatusOK, "Authentication successful", user)
+}
+
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var body struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	token, err := h.repos.AuthTokens.Consume(c.Request.Context(), model.AuthTokenVerifyEmail, auth.HashToken(body.Token))
+	if err != nil {
+		if errors.Is(err, authtokenrepo.ErrNotExist) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	// Tokens from before addresses were carried on them verify whatever
+	// the account holds
+	if token.Email != nil {
+		err = h.repos.Users.ClaimEmail(c.Request.Context(), token.UserID, *token.Email)
+	} else {
+		err = h.repos.Users.VerifyEmail(c.Request.Context(), token.UserID)
+	}
+	if err != nil {
+		if errors.Is(err, userrepo.ErrEmailTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email is already registered"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	user, err := h.repos.Users.GetById(c.Request.Context(), token.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email verified",
+		"user":    user,
+	})
+}
+
+// ResendVerification sends a new verification link to the signed-in user.
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	user := sessionUser(c)
+
+	switch {
+	case user.Email == nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Account has no email address"})
+		return
+	case user.EmailVerifiedAt != nil:
+		c.JSON(http.StatusOK, gin.H{"message": "Email is already verified"})
+		return
+	}
+
+	h.sendVerification(c.Request.Context(), user, *user.Email)
+	c.JSON(http.StatusAccepted, gin.H{"message": "Verification email sent"})
+}
+
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var body struct {
+		Email string `json:"email" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	// The reply is the same whether or not the account exists.
+	if email, err := normalizeEmail(body.Email); err == nil {
+		user, err := h.repos.Users.GetByEmail(c.Request.Context(), email)
+		if err == nil && !user.IsDeactivated {
+			h.sendPasswordReset(c.Request.Context(), user)
+		} else if err != nil && !errors.Is(err, userrepo.ErrNotExist) {
+			h.logger.ErrorContext(c.Request.Context(), "Failed to look up user for password reset", "email", email, logging.Err(err))
+		}
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the email is registered, a reset link has been sent"})
+}
+
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var body struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	// Check the new password before using up the token
+	hash, err := auth.HashPassword(body.Password)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	token, err := h.repos.AuthTokens.Consume(ctx, model.AuthTokenResetPassword, auth.HashToken(body.Token))
+	if err != nil {
+		if errors.Is(err, authtokenrepo.ErrNotExist) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	user, err := h.repos.Users.GetById(ctx, token.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load account"})
+		return
+	}
+	if user.IsDeactivated {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is deactivated"})
+		return
+	}
+
+	// Signs out every session, including any an attacker holds
+	if err := h.repos.Users.ChangePassword(ctx, user.ID, hash); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+	if err := h.repos.AuthTokens.RevokeAll(ctx, user.ID, model.AuthTokenResetPassword); err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "Failed to revoke reset tokens", "user_id", user.ID, logging.Err(err))
+	}
+
+	// Following the link proves the user owns the address
+	if user.EmailVerifiedAt == nil {
+		if err := h.repos.Users.VerifyEmail(ctx, user.ID); err != nil {
+			h.logger.ErrorContext(c.Request.Context(), "Failed to mark email verified", "user_id", user.ID, logging.Err(err))
+		}
+	}
+
+	user, err = h.repos.Users.GetById(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load account"})
+		return
+	}
+	respondWithSession(c, h.sessions, http.StatusOK, "Password updated", user)
+}
+
+// LinkEmail adds an email and password to the signed-in account, typically
+// one created through Telegram, so it can also sign in on the website. The
+// address is only stored once its owner follows the verification link, so
+// it can't be taken from them by linking it first.
+func (h *AuthHandler) LinkEmail(c *gin.Context) {
+	user := sessionUser(c)
+
+	var body struct {
+		Email    string `json:"email" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	if user.Email != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Account already has an email address"})
+		return
+	}
+
+	email, err := normalizeEmail(body.Email)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	hash, err := auth.HashPassword(body.Password)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	holder, err := h.repos.Users.GetByEmail(ctx, email)
+	switch {
+	case err == nil && holder.EmailVerifiedAt != nil:
+		c.JSON(http.StatusConflict, gin.H{"error": "Email is already registered"})
+		return
+	case err != nil && !errors.Is(err, userrepo.ErrNotExist):
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link email"})
+		return
+	}
+
+	// A password without an email cannot be used, so it can be set now
+	if err := h.repos.Users.UpdateField(ctx, user.ID, "password", hash); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link email"})
+		return
+	}
+	h.sendVerification(ctx, user, email)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Check your inbox to verify the email and finish linking it",
+		"user":    user,
+	})
+}
+
+// sendVerification mails email a link that verifies it for user.
+func (h *AuthHandler) sendVerification(ctx context.Context, user *model.User, email string) {
+	t := h.i18n.For(user.Lang)
+
+	link, err := h.issueToken(ctx, &model.AuthToken{UserID: user.ID, Purpose: model.AuthTokenVerifyEmail, Email: &email}, h.config.VerifyEmailTTL, "/verify-email")
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to create verification token", "user_id", user.ID, logging.Err(err))
+		return
+	}
+
+	h.send(ctx, mail.Message{
+		To:      email,
+		Subject: t.T("email.verify_subject"),
+		Body: t.T("email.verify_body", i18n.Params{
+			"name":  user.FirstName,
+			"link":  link,
+			"hours": int(h.config.VerifyEmailTTL.Hours()),
+		}),
+	})
+}
+
+func (h *AuthHandler) sendPasswordReset(ctx context.Context, user *model.User) {
+	t := h.i18n.For(user.Lang)
+
+	link, err := h.issueToken(ctx, &model.AuthToken{UserID: user.ID, Purpose: model.AuthTokenResetPassword}, h.config.ResetPasswordTTL, "/reset-password")
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to create reset token", "user_id", user.ID, logging.Err(err))
+		return
+	}
+
+	h.send(ctx, mail.Message{
+		To:      *user.Email,
+		Subject: t.T("email.reset_subject"),
+		Body: t.T("email.reset_body", i18n.Params{
+			"name":    user.FirstName,
+			"link":    link,
+			"minutes": int(h.config.ResetPasswordTTL.Minutes()),
+		}),
+	})
+}
+
+// issueToken stores record as a new token valid for ttl and returns the
+// website link carrying it.
+func (h *AuthHandler) issueToken(ctx context.Context, record *model.AuthToken, ttl time.Duration, path string) (string, error) {
+	token, hash, err := auth.NewToken()
+	if err != nil {
+		return "", err
+	}
+
+	record.TokenHash = hash
+	record.ExpiresAt = time.Now().Add(ttl)
+	if err := h.repos.AuthTokens.Create(ctx, record); err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(h.config.PublicURL, "/") + path + "?token=" + url.QueryEscape(token), nil
+}
+
+// send delivers message in the background, so slow mail servers do not hold
+// up requests and response times do not reveal which emails are registered.
+// It keeps the correlation ID of ctx, but not its cancellation.
+func (h *AuthHandler) send(ctx context.Context, message mail.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		defer cancel()
+
+		if err := h.mailer.Send(ctx, message); err != nil {
+			h.logger.ErrorContext(ctx, "Failed to send email", "subject", message.Subject, logging.Err(err))
+		}
+	}()
+}
@@ -0,0 +1,252 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/auth"
+	"github.com/Leul-Michael/image-generation/config"
+	"github.com/Leul-Michael/image-generation/handler"
+	"github.com/Leul-Michael/image-generation/i18n"
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/Leul-Michael/image-generation/mail"
+	"github.com/Leul-Michael/image-generation/model"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// inbox is a Mailer that hands every message to the test.
+type inbox chan mail.Message
+
+func (i inbox) Send(ctx context.Context, message mail.Message) error {
+	i <- message
+	return nil
+}
+
+var linkToken = regexp.MustCompile(`token=(\S+)`)
+
+// token waits for a message to to and returns the token in its link.
+func (i inbox) token(t *testing.T, to string) string {
+	t.Helper()
+	select {
+	case message := <-i:
+		if message.To != to {
+			t.Fatalf("email went to %q, want %q", message.To, to)
+		}
+		match := linkToken.FindStringSubmatch(message.Body)
+		if match == nil {
+			t.Fatalf("no link in email to %s:\n%s", to, message.Body)
+		}
+		token, _ := url.QueryUnescape(match[1])
+		return token
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no email to %s", to)
+		return ""
+	}
+}
+
+type authServer struct {
+	t        *testing.T
+	router   *gin.Engine
+	repos    handler.Repos
+	sessions *auth.Sessions
+	inbox    inbox
+}
+
+func newAuthServer(t *testing.T) *authServer {
+	gin.SetMode(gin.TestMode)
+	bundle, err := i18n.NewBundle()
+	if err != nil {
+		t.Fatalf("i18n: %v", err)
+	}
+	defaults := config.Default()
+	s := &authServer{
+		t:        t,
+		router:   gin.New(),
+		repos:    handler.NewMemoryRepos(defaults.FreeTier, defaults.Credits),
+		sessions: auth.NewSessions([]byte("secret"), time.Hour),
+		inbox:    make(inbox, 10),
+	}
+
+	authHandler := handler.NewAuthHandler(s.repos, bundle, s.inbox, s.sessions, defaults.Auth, logging.Discard())
+	requireSession := handler.WithSession(s.sessions, s.repos, true)
+	s.router.POST("/register", authHandler.Register)
+	s.router.POST("/login", authHandler.Login)
+	s.router.POST("/verify-email", authHandler.VerifyEmail)
+	s.router.POST("/link-email", requireSession, authHandler.LinkEmail)
+	return s
+}
+
+// post sends body as JSON, signed in as user unless it is nil, and returns
+// the status and decoded response.
+func (s *authServer) post(path string, user *model.User, body any) (int, map[string]any) {
+	s.t.Helper()
+	data, _ := json.Marshal(body)
+	request := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+	request.Header.Set("Content-Type", "application/json")
+	if user != nil {
+		token, _ := s.sessions.Issue(user.ID, user.SessionVersion)
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	s.router.ServeHTTP(recorder, request)
+
+	var response map[string]any
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder.Code, response
+}
+
+// telegramUser creates an account without an email, as signing in through
+// Telegram does.
+func (s *authServer) telegramUser(name string) *model.User {
+	s.t.Helper()
+	user := model.User{FirstName: name}
+	if err := s.repos.Users.Register(context.Background(), &user); err != nil {
+		s.t.Fatalf("Register: %v", err)
+	}
+	return &user
+}
+
+// TestLoginUnverified checks that a registered email signs in only once it
+// is verified.
+func TestLoginUnverified(t *testing.T) {
+	s := newAuthServer(t)
+	credentials := map[string]string{"email": "abebe@example.com", "password": "correct horse"}
+
+	code, _ := s.post("/register", nil, map[string]string{"email": "abebe@example.com", "password": "correct horse", "first_name": "Abebe"})
+	if code != http.StatusCreated {
+		t.Fatalf("register: status %d, want %d", code, http.StatusCreated)
+	}
+	token := s.inbox.token(t, "abebe@example.com")
+
+	if code, _ := s.post("/login", nil, credentials); code != http.StatusForbidden {
+		t.Errorf("login before verifying: status %d, want %d", code, http.StatusForbidden)
+	}
+	if code, _ := s.post("/verify-email", nil, map[string]string{"token": token}); code != http.StatusOK {
+		t.Fatalf("verify: status %d, want %d", code, http.StatusOK)
+	}
+	if code, _ := s.post("/login", nil, credentials); code != http.StatusOK {
+		t.Errorf("login after verifying: status %d, want %d", code, http.StatusOK)
+	}
+}
+
+// TestLinkEmailOwnerWins links someone else's address to a Telegram
+// account, which neither stores it nor keeps its owner from registering.
+// An address registered but never verified goes to whoever verifies it.
+func TestLinkEmailOwnerWins(t *testing.T) {
+	ctx := context.Background()
+	s := newAuthServer(t)
+	squatter := s.telegramUser("Squatter")
+
+	code, _ := s.post("/link-email", squatter, map[string]string{"email": "abebe@example.com", "password": "squatter pass"})
+	if code != http.StatusAccepted {
+		t.Fatalf("link: status %d, want %d", code, http.StatusAccepted)
+	}
+	s.inbox.token(t, "abebe@example.com") // never seen by the squatter
+	if linked, _ := s.repos.Users.GetById(ctx, squatter.ID); linked.Email != nil {
+		t.Errorf("unverified link stored email %q", *linked.Email)
+	}
+
+	// The owner can still register the address
+	code, _ = s.post("/register", nil, map[string]string{"email": "abebe@example.com", "password": "correct horse", "first_name": "Abebe"})
+	if code != http.StatusCreated {
+		t.Fatalf("register: status %d, want %d", code, http.StatusCreated)
+	}
+	s.inbox.token(t, "abebe@example.com")
+
+	// And can take it from that unverified account by linking it to their
+	// Telegram account
+	owner := s.telegramUser("Abebe")
+	code, _ = s.post("/link-email", owner, map[string]string{"email": "abebe@example.com", "password": "correct horse"})
+	if code != http.StatusAccepted {
+		t.Fatalf("owner link: status %d, want %d", code, http.StatusAccepted)
+	}
+	token := s.inbox.token(t, "abebe@example.com")
+	if code, _ := s.post("/verify-email", nil, map[string]string{"token": token}); code != http.StatusOK {
+		t.Fatalf("verify: status %d, want %d", code, http.StatusOK)
+	}
+
+	code, response := s.post("/login", nil, map[string]string{"email": "abebe@example.com", "password": "correct horse"})
+	if code != http.StatusOK {
+		t.Fatalf("login: status %d, want %d", code, http.StatusOK)
+	}
+	if id := response["user"].(map[string]any)["id"]; id != owner.ID.String() {
+		t.Errorf("login signed in as %v, want the owner %s", id, owner.ID)
+	}
+
+	// Once verified, the address can't be linked elsewhere
+	code, _ = s.post("/link-email", squatter, map[string]string{"email": "abebe@example.com", "password": "squatter pass"})
+	if code != http.StatusConflict {
+		t.Errorf("link a verified address: status %d, want %d", code, http.StatusConflict)
+	}
+}
+
+// credits returns the image credits of the account with id.
+func (s *authServer) credits(id any) int {
+	s.t.Helper()
+	userID, err := uuid.Parse(fmt.Sprint(id))
+	if err != nil {
+		s.t.Fatalf("user id %v: %v", id, err)
+	}
+	userCredit, err := s.repos.Credits.Get(context.Background(), userID, model.CreditTypeImage)
+	if err != nil {
+		s.t.Fatalf("Get: %v", err)
+	}
+	return userCredit.Credits
+}
+
+// TestRegisterOwnerWins registers an address twice without verifying it.
+// The second registration is not refused, and whoever verifies first gets
+// the address and, only then, the signup grant.
+func TestRegisterOwnerWins(t *testing.T) {
+	s := newAuthServer(t)
+	grant := config.Default().FreeTier.SignupGrant
+
+	code, squatter := s.post("/register", nil, map[string]string{"email": "abebe@example.com", "password": "squatter pass", "first_name": "Squatter"})
+	if code != http.StatusCreated {
+		t.Fatalf("register: status %d, want %d", code, http.StatusCreated)
+	}
+	squatterToken := s.inbox.token(t, "abebe@example.com") // never seen by the squatter
+	squatterID := squatter["user"].(map[string]any)["id"]
+	if credits := s.credits(squatterID); credits != 0 {
+		t.Errorf("unverified account has %d credits, want none before verifying", credits)
+	}
+
+	code, owner := s.post("/register", nil, map[string]string{"email": "abebe@example.com", "password": "correct horse", "first_name": "Abebe"})
+	if code != http.StatusCreated {
+		t.Fatalf("owner register: status %d, want %d", code, http.StatusCreated)
+	}
+	ownerID := owner["user"].(map[string]any)["id"]
+	token := s.inbox.token(t, "abebe@example.com")
+	if code, _ := s.post("/verify-email", nil, map[string]string{"token": token}); code != http.StatusOK {
+		t.Fatalf("verify: status %d, want %d", code, http.StatusOK)
+	}
+	if credits := s.credits(ownerID); credits != grant {
+		t.Errorf("verified account has %d credits, want the signup grant of %d", credits, grant)
+	}
+
+	code, response := s.post("/login", nil, map[string]string{"email": "abebe@example.com", "password": "correct horse"})
+	if code != http.StatusOK {
+		t.Fatalf("login: status %d, want %d", code, http.StatusOK)
+	}
+	if id := response["user"].(map[string]any)["id"]; id != ownerID {
+		t.Errorf("login signed in as %v, want the owner %v", id, ownerID)
+	}
+
+	// The first registration can no longer verify the address, or earn
+	// the grant
+	if code, _ := s.post("/verify-email", nil, map[string]string{"token": squatterToken}); code != http.StatusConflict {
+		t.Errorf("verify a taken address: status %d, want %d", code, http.StatusConflict)
+	}
+	if credits := s.credits(squatterID); credits != 0 {
+		t.Errorf("squatter has %d credits, want none", credits)
+	}
+}
@@ -2,53 +2,238 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
-
+	"unicode/utf8"
+
+	"github.com/Leul-Michael/image-generation/callback"
+	"github.com/Leul-Michael/image-generation/config"
+	"github.com/Leul-Michael/image-generation/generation"
+	"github.com/Leul-Michael/image-generation/i18n"
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/Leul-Michael/image-generation/metrics"
 	"github.com/Leul-Michael/image-generation/model"
-	repository "github.com/Leul-Michael/image-generation/repository/user"
+	"github.com/Leul-Michael/image-generation/ratelimit"
+	creditrepo "github.com/Leul-Michael/image-generation/repository/credit"
+	promorepo "github.com/Leul-Michael/image-generation/repository/promo"
+	requestrepo "github.com/Leul-Michael/image-generation/repository/request"
+	"github.com/Leul-Michael/image-generation/tracing"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 	"gopkg.in/telebot.v3"
-	"gorm.io/gorm"
 )
 
 type BotHandler struct {
-	bot *telebot.Bot
-	db  *gorm.DB
+	bot         *telebot.Bot
+	repos       Repos
+	i18n        *i18n.Bundle
+	translator  generation.Translator
+	enhancer    generation.Enhancer
+	pricing     config.PricingConfig
+	referral    config.ReferralConfig
+	freeTier    config.FreeTierConfig
+	rateLimit   config.RateLimitConfig
+	idempotency config.IdempotencyConfig
+	enhanceCost generation.CreditCost
+
+	freeLocation *time.Location
+	limiter      *ratelimit.Limiter
+	callbacks    *callback.Router
+	metrics      *metrics.Metrics
+	logger       *slog.Logger
 }
 
-// User states for different flows
-type UserState struct {
-	State      string
-	CategoryID string
-	PromptText string
+// callbackVersion is the version of the data on inline buttons. Bump it
+// when a button's action or arguments change, so menus sent before are
+// answered as expired rather than misread.
+const callbackVersion = 1
+
+// NewCallbackCodec returns the codec for the bot's button data, signed with
+// secret.
+func NewCallbackCodec(secret []byte) *callback.Codec {
+	return callback.NewCodec(secret, callbackVersion)
 }
 
-var userStates = make(map[int64]*UserState)
+type BotHandlerOptions struct {
+	I18n       *i18n.Bundle
+	Translator generation.Translator
+	// Enhancer may be nil, in which case the "Enhance prompt" option is not
+	// offered.
+	Enhancer    generation.Enhancer
+	Pricing     config.PricingConfig
+	Referral    config.ReferralConfig
+	FreeTier    config.FreeTierConfig
+	RateLimit   config.RateLimitConfig
+	Idempotency config.IdempotencyConfig
+	// CallbackSecret signs button data.
+	CallbackSecret []byte
+	// Metrics may be nil.
+	Metrics *metrics.Metrics
+	// Logger defaults to slog.Default().
+	Logger *slog.Logger
+}
 
-func NewBotHandler(bot *telebot.Bot, db *gorm.DB) *BotHandler {
-	return &BotHandler{
-		bot: bot,
-		db:  db,
+// NewBotHandler wires the bot flows.
+func NewBotHandler(bot *telebot.Bot, repos Repos, opts BotHandlerOptions) *BotHandler {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
 	}
+	h := &BotHandler{
+		bot:         bot,
+		repos:       repos,
+		i18n:        opts.I18n,
+		translator:  opts.Translator,
+		enhancer:    opts.Enhancer,
+		pricing:     opts.Pricing,
+		referral:    opts.Referral,
+		freeTier:    opts.FreeTier,
+		rateLimit:   opts.RateLimit,
+		idempotency: opts.Idempotency,
+		enhanceCost: generation.NewCreditCost(opts.Pricing.PromptEnhanceCost),
+
+		freeLocation: opts.FreeTier.Location(),
+		limiter:      ratelimit.New(),
+		metrics:      opts.Metrics,
+		logger:       opts.Logger,
+	}
+	h.callbacks = callback.NewRouter(NewCallbackCodec(opts.CallbackSecret), h.handleExpiredCallback, opts.Logger)
+	return h
 }
 
 func (h *BotHandler) RegisterHandlers() {
+	h.bot.Use(h.withCorrelationID)
+	h.bot.Use(h.withIdempotency)
+	h.bot.Use(h.withLocalizer)
+
 	h.bot.Handle("/start", h.handleStart)
 	h.bot.Handle("/cancel", h.handleCancel)
+	h.bot.Handle("/language", h.handleLanguage)
+	h.bot.Handle("/redeem", h.handleRedeem)
 	h.bot.Handle("generate_image", h.handleGenerateImage)
+	h.bot.Handle("generate_video", h.handleGenerateVideo)
 	h.bot.Handle("my_credits", h.handleMyCredits)
 	h.bot.Handle("trending_prompts", h.handleTrendingPrompts)
 	h.bot.Handle("help", h.handleHelp)
 	h.bot.Handle("back_to_main", h.handleBackToMain)
 	h.bot.Handle("deposit_credits", h.handleDepositCredits)
+	h.bot.Handle("language", h.handleLanguage)
+	h.bot.Handle("invite_friends", h.handleInviteFriends)
+	h.bot.Handle("plans", h.handlePlans)
 
 	// Handle text messages for various inputs
 	h.bot.Handle(telebot.OnText, h.handleTextMessage)
 
+	// Photos with a caption are image-to-video prompts
+	h.bot.Handle(telebot.OnPhoto, h.handlePhotoMessage)
+
 	// Handle all callback queries
-	h.bot.Handle(telebot.OnCallback, h.handleCallback)
+	h.registerCallbacks()
+	h.bot.Handle(telebot.OnCallback, h.callbacks.Dispatch)
+}
+
+// withCorrelationID gives each update a correlation ID and a span, carried
+// by the context h.ctx returns, and logs and measures how handling it went.
+func (h *BotHandler) withCorrelationID(next telebot.HandlerFunc) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		id := logging.NewCorrelationID()
+		kind, name := h.updateHandler(c)
+		ctx, span := tracing.Start(logging.WithCorrelationID(context.Background(), id), "bot."+kind,
+			attribute.String("bot.handler", name),
+			attribute.Int("bot.update_id", c.Update().ID),
+			attribute.String(logging.CorrelationKey, id),
+		)
+		c.Set("context", ctx)
+
+		started := time.Now()
+		err := next(c)
+		took := time.Since(started)
+		tracing.End(span, err)
+
+		attrs := []any{"update_id", c.Update().ID, "duration", took}
+		if sender := c.Sender(); sender != nil {
+			attrs = append(attrs, "telegram_id", sender.ID)
+		}
+		switch kind {
+		case "callback":
+			attrs = append(attrs, "callback", name)
+		case "command":
+			attrs = append(attrs, "command", name)
+		}
+		h.metrics.BotUpdate(kind, name, err, took)
+
+		if err != nil {
+			h.logger.ErrorContext(ctx, "Failed to handle update", append(attrs, logging.Err(err))...)
+			return err
+		}
+		h.logger.InfoContext(ctx, "Handled update", attrs...)
+		return nil
+	}
+}
+
+// commands are the commands metrics are labelled with; anything else a
+// user types after "/" counts as "other".
+var commands = map[string]bool{"/start": true, "/cancel": true, "/language": true, "/redeem": true}
+
+// updateHandler names the kind of update c is and what handles it: the
+// callback action, the command, or the reply keyboard button.
+func (h *BotHandler) updateHandler(c telebot.Context) (kind, name string) {
+	switch {
+	case c.Callback() != nil:
+		if d, err := h.callbacks.Decode(c.Callback().Data); err == nil {
+			return "callback", d.Action
+		}
+		return "callback", "invalid"
+	case c.Message() == nil:
+		return "other", "other"
+	case strings.HasPrefix(c.Text(), "/"):
+		command, _, _ := strings.Cut(c.Text(), " ")
+		if !commands[command] {
+			command = "other"
+		}
+		return "command", command
+	case c.Message().Photo != nil:
+		return "message", "photo"
+	default:
+		return "message", "text"
+	}
+}
+
+// ctx returns the context of the update c is handling, which carries its
+// correlation ID.
+func (h *BotHandler) ctx(c telebot.Context) context.Context {
+	if ctx, ok := c.Get("context").(context.Context); ok {
+		return ctx
+	}
+	return context.Background()
+}
+
+// withLocalizer resolves the sender's language once per update so every
+// handler can render replies with h.t(c).
+func (h *BotHandler) withLocalizer(next telebot.HandlerFunc) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		lang := i18n.DefaultLang
+		if sender := c.Sender(); sender != nil {
+			if user, err := h.repos.Users.GetByTelegramID(h.ctx(c), uint(sender.ID)); err == nil {
+				lang = user.Lang
+			} else if h.i18n.Supports(sender.LanguageCode) {
+				lang = sender.LanguageCode
+			}
+		}
+		c.Set("localizer", h.i18n.For(lang))
+		return next(c)
+	}
+}
+
+func (h *BotHandler) t(c telebot.Context) *i18n.Localizer {
+	if l, ok := c.Get("localizer").(*i18n.Localizer); ok {
+		return l
+	}
+	return h.i18n.For(i18n.DefaultLang)
 }
 
 func (h *BotHandler) handleStart(c telebot.Context) error {
@@ -58,32 +243,53 @@ func (h *BotHandler) handleStart(c telebot.Context) error {
 		return fmt.Errorf("failed to get sender information")
 	}
 
-	userRepo := &repository.PostgresUserRepo{DB: h.db}
-	user, err := userRepo.CreateOrUpdateUser(
-		context.Background(),
+	// Usernames are unique and optional, so an empty one is stored as NULL.
+	var username *string
+	if sender.Username != "" {
+		username = &sender.Username
+	}
+
+	user, err := h.repos.Users.CreateOrUpdateUser(
+		h.ctx(c),
 		uint(sender.ID),
 		sender.FirstName,
 		sender.LastName,
-		&sender.Username,
+		username,
 		nil,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to process user data")
 	}
 
+	// Only users who just signed up can be attributed to an invite
+	if code := referralCodeFrom(c.Message().Payload); code != "" && user.CreatedAt.Equal(user.UpdatedAt) {
+		h.attributeReferral(h.ctx(c), user, code)
+	}
+
+	c.Set("localizer", h.i18n.For(user.Lang))
+
 	return h.sendMainMenu(c, user)
 }
 
 func (h *BotHandler) sendMainMenu(c telebot.Context, user *model.User) error {
+	t := h.t(c)
+
 	menu := &telebot.ReplyMarkup{
 		InlineKeyboard: [][]telebot.InlineButton{
 			{
-				{Text: "🎨 Generate Image", Data: "generate_image"},
-				{Text: "💳 My Credits", Data: "my_credits"},
+				{Text: t.T("button.generate_image"), Data: h.callbacks.Data("generate_image")},
+				{Text: t.T("button.generate_video"), Data: h.callbacks.Data("generate_video")},
 			},
 			{
-				{Text: "📊 Trending Prompts", Data: "trending_prompts"},
-				{Text: "❓ Help", Data: "help"},
+				{Text: t.T("button.my_credits"), Data: h.callbacks.Data("my_credits")},
+				{Text: t.T("button.trending_prompts"), Data: h.callbacks.Data("trending_prompts")},
+			},
+			{
+				{Text: t.T("button.invite_friends"), Data: h.callbacks.Data("invite_friends")},
+				{Text: t.T("button.help"), Data: h.callbacks.Data("help")},
+			},
+			{
+				{Text: t.T("button.language"), Data: h.callbacks.Data("language")},
 			},
 		},
 	}
@@ -97,13 +303,10 @@ func (h *BotHandler) sendMainMenu(c telebot.Context, user *model.User) error {
 		}
 	}
 
-	welcomeMsg := fmt.Sprintf(
-		"Hello %s! Welcome to Image Generation Bot! 🎨\n\n"+
-			"I can help you generate amazing images using AI. What would you like to do?\n\n"+
-			"Your current image credits: %d",
-		user.FirstName,
-		imageCredits,
-	)
+	welcomeMsg := t.N("main_menu.welcome", imageCredits, i18n.Params{"name": user.FirstName})
+	if h.freeTier.DailyGenerations > 0 {
+		welcomeMsg += t.N("main_menu.free_left", h.freeGenerationsLeft(h.ctx(c), user.ID))
+	}
 
 	// Check if this is from a callback (has a callback query)
 	if c.Callback() != nil {
@@ -115,14 +318,23 @@ func (h *BotHandler) sendMainMenu(c telebot.Context, user *model.User) error {
 }
 
 func (h *BotHandler) handleGenerateImage(c telebot.Context) error {
+	t := h.t(c)
+
 	// Get all active categories from database
-	var categories []model.Category
-	if err := h.db.Where("is_active = ?", true).Order("name ASC").Find(&categories).Error; err != nil {
-		return c.Send("❌ Sorry, I couldn't load the categories. Please try again later.")
+	categories, err := h.repos.Categories.ListActive(h.ctx(c), t.Lang())
+	if err != nil {
+		return c.Send(t.T("error.load_categories"))
 	}
 
 	if len(categories) == 0 {
-		return c.Send("❌ No categories available at the moment. Please try again later.")
+		return c.Send(t.T("error.no_categories"))
+	}
+
+	for i := range categories {
+		categories[i] = categories[i].Localized(t.Lang())
+		if categories[i].IsPremium {
+			categories[i].Name = t.T("generate.premium_category", i18n.Params{"name": categories[i].Name})
+		}
 	}
 
 	// Create inline keyboard with categories (2 categories per row)
@@ -137,7 +349,7 @@ func (h *BotHandler) handleGenerateImage(c telebot.Context) error {
 		}
 		row = append(row, telebot.InlineButton{
 			Text: fmt.Sprintf("%s %s", emoji, categories[i].Name),
-			Data: fmt.Sprintf("category_%s", categories[i].ID.String()),
+			Data: h.callbacks.Data("category", categories[i].ID.String()),
 		})
 
 		// Second category in the row (if exists)
@@ -148,7 +360,7 @@ func (h *BotHandler) handleGenerateImage(c telebot.Context) error {
 			}
 			row = append(row, telebot.InlineButton{
 				Text: fmt.Sprintf("%s %s", emoji2, categories[i+1].Name),
-				Data: fmt.Sprintf("category_%s", categories[i+1].ID.String()),
+				Data: h.callbacks.Data("category", categories[i+1].ID.String()),
 			})
 		}
 
@@ -157,62 +369,61 @@ func (h *BotHandler) handleGenerateImage(c telebot.Context) error {
 
 	// Add back button
 	rows = append(rows, []telebot.InlineButton{
-		{Text: "🔙 Back to Main Menu", Data: "back_to_main"},
+		{Text: t.T("button.back_to_main"), Data: h.callbacks.Data("back_to_main")},
 	})
 
 	menu := &telebot.ReplyMarkup{
 		InlineKeyboard: rows,
 	}
 
-	message := "🎨 Choose a category for your image generation:\n\n" +
-		"Select the type of image you'd like to create!"
+	message := t.T("generate.choose_category")
 
 	return c.Edit(message, menu)
 }
 
 func (h *BotHandler) handleMyCredits(c telebot.Context) error {
+	t := h.t(c)
+
 	sender := c.Sender()
 	if sender == nil {
 		return fmt.Errorf("failed to get sender information")
 	}
 
-	userRepo := &repository.PostgresUserRepo{DB: h.db}
-	user, err := userRepo.GetByTelegramID(context.TODO(), uint(sender.ID))
+	user, err := h.repos.Users.GetByTelegramID(h.ctx(c), uint(sender.ID))
 	if err != nil {
-		return c.Send("❌ Could not retrieve your credit information.")
+		return c.Send(t.T("error.load_credits"))
 	}
 
 	// Get credit balances
-	var imageCredits int
+	var imageCredits, videoCredits int
 	for _, credit := range user.UserCredits {
 		switch credit.CreditType {
 		case model.CreditTypeImage:
 			imageCredits = credit.Credits
+		case model.CreditTypeVideo:
+			videoCredits = credit.Credits
 		}
 	}
 
 	menu := &telebot.ReplyMarkup{
 		InlineKeyboard: [][]telebot.InlineButton{
 			{
-				{Text: "💰 Deposit Credits", Data: "deposit_credits"},
+				{Text: t.T("button.deposit_credits"), Data: h.callbacks.Data("deposit_credits")},
+				{Text: t.T("button.plans"), Data: h.callbacks.Data("plans")},
+			},
+			{
+				{Text: t.T("button.deposit_video"), Data: h.callbacks.Data("deposit_video")},
 			},
 			{
-				{Text: "🔙 Back to Main Menu", Data: "back_to_main"},
+				{Text: t.T("button.back_to_main"), Data: h.callbacks.Data("back_to_main")},
 			},
 		},
 	}
 
-	message := fmt.Sprintf(
-		"💳 Your Credit Balance:\n\n"+
-			"🎨 Image Credits: %d\n\n"+
-			"💡 Credit Pricing:\n"+
-			"• 10 etb = 1 Image Credit\n"+
-			"• 20 etb = 2 Image Credits\n"+
-			"• 30 etb = 3 Image Credits\n"+
-			"• And so on...\n\n"+
-			"Credits are used to generate amazing AI images!",
-		imageCredits,
-	)
+	params := h.priceParams()
+	params["image_credits"] = imageCredits
+	params["video_credits"] = videoCredits
+	message := t.T("credits.balance", params) + h.expiringCredits(h.ctx(c), t, user.ID)
 
 	if c.Callback() != nil {
 		return c.Edit(message, menu)
@@ -221,36 +432,59 @@ func (h *BotHandler) handleMyCredits(c telebot.Context) error {
 }
 
 func (h *BotHandler) handleDepositCredits(c telebot.Context) error {
+	return h.sendDepositAmounts(c, model.CreditTypeImage)
+}
+
+func (h *BotHandler) handleDepositVideo(c telebot.Context) error {
+	return h.sendDepositAmounts(c, model.CreditTypeVideo)
+}
+
+// depositActions are the callback actions that deposit an amount of each
+// credit type. With "_custom" appended they ask for the amount instead.
+var depositActions = map[model.CreditType]string{
+	model.CreditTypeImage: "deposit",
+	model.CreditTypeVideo: "deposit_video",
+}
+
+func (h *BotHandler) sendDepositAmounts(c telebot.Context, creditType model.CreditType) error {
+	t := h.t(c)
+
 	sender := c.Sender()
 	if sender == nil {
 		return fmt.Errorf("failed to get sender information")
 	}
 
-	// Create preset amount buttons
+	// Create preset amount buttons (2 presets per row)
+	var rows [][]telebot.InlineButton
+	presets := h.depositPresets(creditType)
+	action := depositActions[creditType]
+	for i := 0; i < len(presets); i += 2 {
+		var row []telebot.InlineButton
+		for _, preset := range presets[i:min(i+2, len(presets))] {
+			text := t.N("button.deposit_preset", preset)
+			if creditType == model.CreditTypeVideo {
+				text = t.N("button.deposit_video_preset", preset/h.pricing.EtbPerVideoCredit, i18n.Params{"amount": preset})
+			}
+			row = append(row, telebot.InlineButton{
+				Text: text,
+				Data: h.callbacks.Data(action, strconv.Itoa(preset)),
+			})
+		}
+		rows = append(rows, row)
+	}
+	rows = append(rows,
+		[]telebot.InlineButton{{Text: t.T("button.deposit_custom"), Data: h.callbacks.Data(action + "_custom")}},
+		[]telebot.InlineButton{{Text: t.T("button.back_to_credits"), Data: h.callbacks.Data("my_credits")}},
+	)
+
 	menu := &telebot.ReplyMarkup{
-		InlineKeyboard: [][]telebot.InlineButton{
-			{
-				{Text: "10 credits", Data: "deposit_10"},
-				{Text: "50 credits", Data: "deposit_50"},
-			},
-			{
-				{Text: "100 credits", Data: "deposit_100"},
-				{Text: "200 credits", Data: "deposit_200"},
-			},
-			{
-				{Text: "✏️ Custom Amount", Data: "deposit_custom"},
-			},
-			{
-				{Text: "🔙 Back to Credits", Data: "my_credits"},
-			},
-		},
+		InlineKeyboard: rows,
 	}
 
-	message := "💰 Choose Deposit Amount\n\n" +
-		"Select how much you want to deposit:\n\n" +
-		"💡 Credit Conversion Rate:\n" +
-		"• 10 etb = 1 Image Credit\n\n" +
-		"Choose a preset amount or enter a custom amount:"
+	message := t.T("deposit.choose_amount", h.priceParams())
+	if creditType == model.CreditTypeVideo {
+		message = t.T("deposit.video_choose_amount", h.videoPriceParams())
+	}
 
 	if c.Callback() != nil {
 		return c.Edit(message, menu)
@@ -258,47 +492,81 @@ func (h *BotHandler) handleDepositCredits(c telebot.Context) error {
 	return c.Send(message, menu)
 }
 
-func (h *BotHandler) handleDepositCustom(c telebot.Context) error {
+func (h *BotHandler) handleDepositCustom(c telebot.Context, creditType model.CreditType) error {
 	sender := c.Sender()
 	if sender == nil {
 		return fmt.Errorf("failed to get sender information")
 	}
 
 	// Set user state to waiting for deposit amount
-	userStates[sender.ID] = &UserState{State: "waiting_deposit_amount"}
-
-	message := "💰 Custom Deposit Amount\n\n" +
-		"Please enter the amount you want to deposit:\n\n" +
-		"💡 Credit Conversion:\n" +
-		"• 10 etb = 1 Image Credit\n" +
-		"• 20 etb = 2 Image Credits\n" +
-		"• 30 etb = 3 Image Credits\n\n" +
-		"⚠️ Note: Only multiples of 10 are converted to credits.\n" +
-		"For example: If you deposit 15, only 10 will be used (1 credit).\n\n" +
-		"💬 Type your deposit amount or use /cancel to cancel:"
+	if err := h.setState(c, &model.ConversationState{State: "waiting_deposit_amount", CreditType: creditType}); err != nil {
+		return err
+	}
 
-	return c.Edit(message)
+	if creditType == model.CreditTypeVideo {
+		return c.Edit(h.t(c).T("deposit.video_custom_prompt", h.videoPriceParams()))
+	}
+	return c.Edit(h.t(c).T("deposit.custom_prompt", h.priceParams()))
 }
 
-func (h *BotHandler) handlePresetDeposit(c telebot.Context, amount int) error {
-	// Calculate credits (only multiples of 10)
-	creditsToAdd := amount / 10
-	unusedAmount := amount % 10
+// priceParams exposes the configured credit prices to catalog messages,
+// with the image credit price as the rate.
+func (h *BotHandler) priceParams() i18n.Params {
+	params := rateParams(h.pricing.EtbPerImageCredit)
+	params["video_rate"] = h.pricing.EtbPerVideoCredit
+	return params
+}
+
+// videoPriceParams is priceParams with the video credit price as the rate.
+func (h *BotHandler) videoPriceParams() i18n.Params {
+	return rateParams(h.pricing.EtbPerVideoCredit)
+}
+
+func rateParams(rate int) i18n.Params {
+	return i18n.Params{
+		"rate":    rate,
+		"rate2":   rate * 2,
+		"rate3":   rate * 3,
+		"example": rate + rate/2,
+	}
+}
+
+// depositRate is the price of one credit of creditType in etb.
+func (h *BotHandler) depositRate(creditType model.CreditType) int {
+	if creditType == model.CreditTypeVideo {
+		return h.pricing.EtbPerVideoCredit
+	}
+	return h.pricing.EtbPerImageCredit
+}
+
+func (h *BotHandler) depositPresets(creditType model.CreditType) []int {
+	if creditType == model.CreditTypeVideo {
+		return h.pricing.VideoDepositPresets
+	}
+	return h.pricing.DepositPresets
+}
+
+func (h *BotHandler) handlePresetDeposit(c telebot.Context, creditType model.CreditType, amount int) error {
+	if !slices.Contains(h.depositPresets(creditType), amount) {
+		return nil
+	}
+
+	// Calculate credits (only multiples of the credit price)
+	rate := h.depositRate(creditType)
+	creditsToAdd := amount / rate
+	unusedAmount := amount % rate
 
 	// Process the deposit directly
-	return h.processDeposit(c, amount, creditsToAdd, unusedAmount)
+	return h.processDeposit(c, creditType, amount, creditsToAdd, unusedAmount)
 }
 
 func (h *BotHandler) handleTrendingPrompts(c telebot.Context) error {
-	// Get trending prompts from database
-	var trendingPrompts []model.TrendingPrompt
-	if err := h.db.Where("is_active = ?", true).
-		Preload("Category").
-		Order("use_count DESC").
-		Limit(10).
-		Find(&trendingPrompts).Error; err != nil {
+	t := h.t(c)
 
-		return c.Send("❌ Could not load trending prompts. Please try again later.")
+	// Get trending prompts from database
+	trendingPrompts, err := h.repos.TrendingPrompts.ListActive(h.ctx(c), t.Lang(), 10)
+	if err != nil {
+		return c.Send(t.T("error.load_trending"))
 	}
 
 	if len(trendingPrompts) == 0 {
@@ -306,14 +574,12 @@ func (h *BotHandler) handleTrendingPrompts(c telebot.Context) error {
 		menu := &telebot.ReplyMarkup{
 			InlineKeyboard: [][]telebot.InlineButton{
 				{
-					{Text: "🔙 Back to Main Menu", Data: "back_to_main"},
+					{Text: t.T("button.back_to_main"), Data: h.callbacks.Data("back_to_main")},
 				},
 			},
 		}
 
-		message := "📊 Trending Prompts\n\n" +
-			"🤷‍♂️ Nothing trending at the moment.\n\n" +
-			"Be the first to create some amazing images and start new trends!"
+		message := t.T("trending.empty")
 
 		if c.Callback() != nil {
 			return c.Edit(message, menu)
@@ -323,31 +589,27 @@ func (h *BotHandler) handleTrendingPrompts(c telebot.Context) error {
 
 	var rows [][]telebot.InlineButton
 	for _, prompt := range trendingPrompts {
-		displayText := prompt.Prompt
+		displayText := truncate(prompt.DisplayPrompt(t.Lang()), 35)
 		emojiText := prompt.Category.Emoji
-		if len(displayText) > 35 {
-			displayText = displayText[:32] + "..."
-		}
 
 		rows = append(rows, []telebot.InlineButton{
 			{
 				Text: fmt.Sprintf("%s %s", emojiText, displayText),
-				Data: fmt.Sprintf("trending_%s", prompt.ID.String()),
+				Data: h.callbacks.Data("trending", prompt.ID.String()),
 			},
 		})
 	}
 
 	// Add back button
 	rows = append(rows, []telebot.InlineButton{
-		{Text: "🔙 Back to Main Menu", Data: "back_to_main"},
+		{Text: t.T("button.back_to_main"), Data: h.callbacks.Data("back_to_main")},
 	})
 
 	menu := &telebot.ReplyMarkup{
 		InlineKeyboard: rows,
 	}
 
-	message := "📊 Trending Prompts\n\n" +
-		"Choose a popular prompt to use for image generation:\n\n"
+	message := t.T("trending.choose")
 
 	if c.Callback() != nil {
 		return c.Edit(message, menu)
@@ -356,26 +618,64 @@ func (h *BotHandler) handleTrendingPrompts(c telebot.Context) error {
 }
 
 func (h *BotHandler) handleHelp(c telebot.Context) error {
+	t := h.t(c)
+
 	menu := &telebot.ReplyMarkup{
 		InlineKeyboard: [][]telebot.InlineButton{
 			{
-				{Text: "🔙 Back to Main Menu", Data: "back_to_main"},
+				{Text: t.T("button.back_to_main"), Data: h.callbacks.Data("back_to_main")},
 			},
 		},
 	}
 
-	message := "❓ How to use the Image Generation Bot:\n\n" +
-		"1️⃣ Click 'Generate Image' to start\n" +
-		"2️⃣ Choose a category that interests you\n" +
-		"3️⃣ Describe what you want to create\n" +
-		"4️⃣ Wait for your AI-generated image!\n\n" +
-		"💡 Tips:\n" +
-		"• Be specific in your descriptions\n" +
-		"• Use descriptive adjectives\n" +
-		"• Mention colors, styles, or moods\n\n" +
-		"Need help? Contact support!"
+	return c.Edit(t.T("help.text"), menu)
+}
 
-	return c.Edit(message, menu)
+func (h *BotHandler) handleLanguage(c telebot.Context) error {
+	t := h.t(c)
+
+	var rows [][]telebot.InlineButton
+	for _, lang := range h.i18n.Languages() {
+		rows = append(rows, []telebot.InlineButton{
+			{Text: h.i18n.For(lang).T("language.name"), Data: h.callbacks.Data("lang", lang)},
+		})
+	}
+	rows = append(rows, []telebot.InlineButton{
+		{Text: t.T("button.back_to_main"), Data: h.callbacks.Data("back_to_main")},
+	})
+
+	menu := &telebot.ReplyMarkup{
+		InlineKeyboard: rows,
+	}
+
+	if c.Callback() != nil {
+		return c.Edit(t.T("language.choose"), menu)
+	}
+	return c.Send(t.T("language.choose"), menu)
+}
+
+func (h *BotHandler) handleLanguageSelected(c telebot.Context, lang string) error {
+	sender := c.Sender()
+	if sender == nil {
+		return fmt.Errorf("failed to get sender information")
+	}
+
+	if !h.i18n.Supports(lang) {
+		return c.Send(h.t(c).T("error.invalid_language"))
+	}
+
+	user, err := h.repos.Users.GetByTelegramID(h.ctx(c), uint(sender.ID))
+	if err != nil {
+		return c.Send(h.t(c).T("error.load_user"))
+	}
+
+	if err := h.repos.Users.UpdateField(h.ctx(c), user.ID, "lang", lang); err != nil {
+		return c.Send(h.t(c).T("error.update_language"))
+	}
+	user.Lang = lang
+
+	c.Set("localizer", h.i18n.For(lang))
+	return h.sendMainMenu(c, user)
 }
 
 func (h *BotHandler) handleBackToMain(c telebot.Context) error {
@@ -384,94 +684,121 @@ func (h *BotHandler) handleBackToMain(c telebot.Context) error {
 		return fmt.Errorf("failed to get sender information")
 	}
 
-	userRepo := &repository.PostgresUserRepo{DB: h.db}
-	user, err := userRepo.GetByTelegramID(context.TODO(), uint(sender.ID))
+	user, err := h.repos.Users.GetByTelegramID(h.ctx(c), uint(sender.ID))
 	if err != nil {
-		return c.Send("❌ Could not retrieve your information.")
+		return c.Send(h.t(c).T("error.load_user"))
 	}
 
 	return h.sendMainMenu(c, user)
 }
 
-func (h *BotHandler) handleCallback(c telebot.Context) error {
-	data := c.Callback().Data
-
-	switch data {
-	case "generate_image":
-		return h.handleGenerateImage(c)
-	case "my_credits":
-		return h.handleMyCredits(c)
-	case "trending_prompts":
-		return h.handleTrendingPrompts(c)
-	case "help":
-		return h.handleHelp(c)
-	case "back_to_main":
-		return h.handleBackToMain(c)
-	case "deposit_credits":
-		return h.handleDepositCredits(c)
-	case "deposit_custom":
-		return h.handleDepositCustom(c)
-	case "deposit_10":
-		return h.handlePresetDeposit(c, 10)
-	case "deposit_50":
-		return h.handlePresetDeposit(c, 50)
-	case "deposit_100":
-		return h.handlePresetDeposit(c, 100)
-	case "deposit_200":
-		return h.handlePresetDeposit(c, 200)
-	}
-
-	// Handle category selection
-	if len(data) > 9 && data[:9] == "category_" {
-		categoryID := data[9:]
-		return h.handleCategorySelected(c, categoryID)
-	}
-
-	// Handle trending prompt selection
-	if len(data) > 9 && data[:9] == "trending_" {
-		promptID := data[9:]
-		return h.handleTrendingPromptSelected(c, promptID)
+// registerCallbacks routes each button's action to its handler. Actions
+// with an argument can share a name with one without, e.g. "deposit_video"
+// opens the video deposit screen and "deposit_video" with an amount deposits
+// it.
+func (h *BotHandler) registerCallbacks() {
+	r := h.callbacks
+
+	r.Handle("generate_image", h.handleGenerateImage)
+	r.Handle("generate_video", h.handleGenerateVideo)
+	r.Handle("my_credits", h.handleMyCredits)
+	r.Handle("trending_prompts", h.handleTrendingPrompts)
+	r.Handle("help", h.handleHelp)
+	r.Handle("back_to_main", h.handleBackToMain)
+	r.Handle("deposit_credits", h.handleDepositCredits)
+	r.Handle("deposit_video", h.handleDepositVideo)
+	r.Handle("language", h.handleLanguage)
+	r.Handle("invite_friends", h.handleInviteFriends)
+	r.Handle("plans", h.handlePlans)
+	r.Handle("plans_cancel", h.handleCancelPlan)
+	r.Handle("prompt_confirm", h.handlePromptConfirm)
+	r.Handle("prompt_edit", h.handlePromptEdit)
+	r.Handle("prompt_enhance", h.handlePromptEnhance)
+	r.Handle("enhance_accept", h.handleEnhanceAccept)
+	r.Handle("enhance_edit", h.handleEnhanceEdit)
+	r.Handle("enhance_reject", h.handleEnhanceReject)
+
+	for creditType, action := range depositActions {
+		r.Handle(action+"_custom", func(c telebot.Context) error {
+			return h.handleDepositCustom(c, creditType)
+		})
+		callback.HandleArg(r, action, callback.Int, func(c telebot.Context, amount int) error {
+			return h.handlePresetDeposit(c, creditType, amount)
+		})
 	}
 
-	return nil
+	callback.HandleArg(r, "plan", callback.String, h.handleSubscribe)
+	callback.HandleArg(r, "category", callback.UUID, func(c telebot.Context, id uuid.UUID) error {
+		return h.handleCategorySelected(c, id.String())
+	})
+	callback.HandleArg(r, "trending", callback.UUID, func(c telebot.Context, id uuid.UUID) error {
+		return h.handleTrendingPromptSelected(c, id.String())
+	})
+	callback.HandleArg(r, "lang", callback.String, h.handleLanguageSelected)
+}
+
+// handleExpiredCallback answers buttons whose data is forged or from a menu
+// an older version of the bot sent.
+func (h *BotHandler) handleExpiredCallback(c telebot.Context) error {
+	return c.Respond(&telebot.CallbackResponse{
+		Text:      h.t(c).T("callback.expired"),
+		ShowAlert: true,
+	})
+}
+
+// category loads a category by its ID as sent in callback data, with its
+// translations in lang.
+func (h *BotHandler) category(ctx context.Context, id string, lang string) (*model.Category, error) {
+	categoryID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	return h.repos.Categories.GetByID(ctx, categoryID, lang)
 }
 
 func (h *BotHandler) handleCategorySelected(c telebot.Context, categoryID string) error {
+	t := h.t(c)
+
 	// Get the category details
-	var category model.Category
-	if err := h.db.Where("id = ?", categoryID).First(&category).Error; err != nil {
-		return c.Send("❌ Invalid category selected. Please try again.")
+	category, err := h.category(h.ctx(c), categoryID, t.Lang())
+	if err != nil {
+		return c.Send(t.T("error.invalid_category"))
 	}
+	localized := category.Localized(t.Lang())
 
 	sender := c.Sender()
 	if sender == nil {
 		return fmt.Errorf("failed to get sender information")
 	}
 
+	if category.IsPremium {
+		user, err := h.repos.Users.GetByTelegramID(h.ctx(c), uint(sender.ID))
+		if err != nil {
+			return c.Send(t.T("error.load_user"))
+		}
+		if premiumLocked(category, h.subscription(h.ctx(c), user.ID)) {
+			return h.sendPremiumRequired(c)
+		}
+	}
+
 	// Set user state to waiting for prompt input
-	userStates[sender.ID] = &UserState{
+	if err := h.setState(c, &model.ConversationState{
 		State:      "waiting_prompt",
 		CategoryID: categoryID,
+	}); err != nil {
+		return err
 	}
 
 	emoji := "🎨"
-	if category.Emoji != "" {
-		emoji = category.Emoji
-	}
-
-	message := fmt.Sprintf(
-		"%s %s Category Selected!\n\n"+
-			"%s\n\n"+
-			"✍️ Now, please describe the image you want to generate:\n\n"+
-			"💡 Examples:\n"+
-			"• A cute golden retriever puppy playing in a sunny meadow\n"+
-			"• A futuristic city with flying cars at night\n"+
-			"• A cozy cottage by a lake with mountains in the background\n\n"+
-			"💬 Type your prompt or use /cancel to go back:",
-		emoji,
-		category.Name,
-		category.Description,
-	)
+	if localized.Emoji != "" {
+		emoji = localized.Emoji
+	}
+
+	message := t.T("generate.category_selected", i18n.Params{
+		"emoji":       emoji,
+		"name":        localized.Name,
+		"description": localized.Description,
+	})
 
 	return c.Edit(message)
 }
@@ -483,18 +810,27 @@ func (h *BotHandler) handleTrendingPromptSelected(c telebot.Context, promptID st
 	}
 
 	// Get from database
-	var trendingPrompt model.TrendingPrompt
-	if err := h.db.Where("id = ?", promptID).First(&trendingPrompt).Error; err != nil {
-		return c.Send("❌ Invalid prompt selected. Please try again.")
+	id, err := uuid.Parse(promptID)
+	if err != nil {
+		return c.Send(h.t(c).T("error.invalid_prompt"))
+	}
+	trendingPrompt, err := h.repos.TrendingPrompts.GetByID(h.ctx(c), id)
+	if err != nil {
+		return c.Send(h.t(c).T("error.invalid_prompt"))
 	}
 
 	// Update use count
-	trendingPrompt.UseCount++
-	trendingPrompt.LastUsedAt = time.Now()
-	h.db.Save(&trendingPrompt)
+	if err := h.repos.TrendingPrompts.RecordUse(h.ctx(c), trendingPrompt.ID); err != nil {
+		h.logger.WarnContext(h.ctx(c), "Failed to record trending prompt use", logging.Err(err))
+	}
 
-	// Generate image with the selected prompt
-	return h.generateImageWithPrompt(c, trendingPrompt.Prompt, "trending")
+	// Generate image with the canonical English prompt regardless of the
+	// language the button was shown in
+	return h.submitPrompt(c, trendingPrompt.CategoryID.String(), generation.Translation{
+		Original:   trendingPrompt.Prompt,
+		Text:       trendingPrompt.Prompt,
+		SourceLang: i18n.DefaultLang,
+	})
 }
 
 func (h *BotHandler) handleTextMessage(c telebot.Context) error {
@@ -504,8 +840,8 @@ func (h *BotHandler) handleTextMessage(c telebot.Context) error {
 	}
 
 	// Check if user is in any flow
-	state, exists := userStates[sender.ID]
-	if !exists {
+	state := h.state(c)
+	if state == nil {
 		return nil // Ignore text messages if not in any flow
 	}
 
@@ -513,243 +849,572 @@ func (h *BotHandler) handleTextMessage(c telebot.Context) error {
 
 	switch state.State {
 	case "waiting_deposit_amount":
-		return h.handleDepositAmountInput(c, text)
+		return h.handleDepositAmountInput(c, text, state.CreditType)
 	case "waiting_prompt":
 		return h.handlePromptInput(c, text, state.CategoryID)
+	case "waiting_prompt_edit":
+		return h.handlePromptEditInput(c, text, state)
+	case "waiting_promo_code":
+		return h.redeemPromoCode(c, text)
+	case "waiting_video_prompt":
+		return h.handleVideoPromptInput(c, text, nil)
 	}
 
 	return nil
 }
 
-func (h *BotHandler) handleDepositAmountInput(c telebot.Context, text string) error {
-	sender := c.Sender()
+func (h *BotHandler) handleDepositAmountInput(c telebot.Context, text string, creditType model.CreditType) error {
+	t := h.t(c)
 
 	// Validate input
 	amount, err := strconv.Atoi(text)
 	if err != nil {
-		return c.Send("❌ Invalid input! Please enter a valid number.\n\n💬 Try again or use /cancel:")
+		return c.Send(t.T("deposit.invalid_number"))
 	}
 
 	if amount <= 0 {
-		return c.Send("❌ Amount must be positive! Please enter a positive number.\n\n💬 Try again or use /cancel:")
+		return c.Send(t.T("deposit.not_positive"))
 	}
 
-	if amount < 10 {
-		return c.Send("❌ Minimum deposit is 10 etb to get 1 credit!\n\n💬 Please enter at least 10 or use /cancel:")
+	rate := h.depositRate(creditType)
+	if amount < rate {
+		return c.Send(t.T("deposit.below_minimum", rateParams(rate)))
 	}
 
-	// Calculate credits (only multiples of 10)
-	creditsToAdd := amount / 10
-	unusedAmount := amount % 10
+	// Calculate credits (only multiples of the credit price)
+	creditsToAdd := amount / rate
+	unusedAmount := amount % rate
 
 	// Clear user state
-	delete(userStates, sender.ID)
+	h.clearState(c)
 
 	// Process the deposit
-	return h.processDeposit(c, amount, creditsToAdd, unusedAmount)
+	return h.processDeposit(c, creditType, amount, creditsToAdd, unusedAmount)
+}
+
+// validatePrompt returns the catalog key of the problem with text, or "" when
+// the prompt is acceptable. Lengths are counted in characters, not bytes, so
+// Amharic prompts get the same limit as English ones.
+func validatePrompt(text string) string {
+	switch n := utf8.RuneCountInString(text); {
+	case n < 5:
+		return "generate.prompt_too_short"
+	case n > 500:
+		return "generate.prompt_too_long"
+	}
+	return ""
 }
 
 func (h *BotHandler) handlePromptInput(c telebot.Context, text string, categoryID string) error {
-	sender := c.Sender()
+	t := h.t(c)
+
+	if problem := validatePrompt(text); problem != "" {
+		return c.Send(t.T(problem))
+	}
+
+	translation, err := generation.ToEnglish(h.ctx(c), h.translator, text)
+	if err != nil {
+		h.logger.WarnContext(h.ctx(c), "Failed to translate prompt, using original", logging.Err(err))
+	}
+
+	if !translation.Translated() && h.enhancer == nil {
+		// Clear user state
+		h.clearState(c)
 
-	if len(text) < 5 {
-		return c.Send("❌ Please provide a more detailed description (at least 5 characters).\n\n💬 Try again or use /cancel:")
+		// Generate image with the prompt
+		return h.submitPrompt(c, categoryID, translation)
 	}
 
-	if len(text) > 500 {
-		return c.Send("❌ Description is too long! Please keep it under 500 characters.\n\n💬 Try again or use /cancel:")
+	// Let the user review (and optionally enhance) the prompt before it is used
+	state := &model.ConversationState{
+		State:          "confirm_prompt",
+		CategoryID:     categoryID,
+		PromptText:     translation.Text,
+		OriginalPrompt: translation.Original,
+		PromptLang:     translation.SourceLang,
+	}
+	if err := h.setState(c, state); err != nil {
+		return err
+	}
+
+	return h.sendPromptConfirmation(c, state)
+}
+
+func (h *BotHandler) sendPromptConfirmation(c telebot.Context, state *model.ConversationState) error {
+	t := h.t(c)
+
+	rows := [][]telebot.InlineButton{
+		{
+			{Text: t.T("button.prompt_confirm"), Data: h.callbacks.Data("prompt_confirm")},
+			{Text: t.T("button.prompt_edit"), Data: h.callbacks.Data("prompt_edit")},
+		},
+	}
+	if h.enhancer != nil {
+		rows = append(rows, []telebot.InlineButton{
+			{Text: t.T("button.prompt_enhance"), Data: h.callbacks.Data("prompt_enhance")},
+		})
+	}
+	rows = append(rows, []telebot.InlineButton{
+		{Text: t.T("button.main_menu"), Data: h.callbacks.Data("back_to_main")},
+	})
+
+	menu := &telebot.ReplyMarkup{
+		InlineKeyboard: rows,
+	}
+
+	var message string
+	if state.PromptText != state.OriginalPrompt {
+		message = t.T("generate.translation_review", i18n.Params{
+			"original":   state.OriginalPrompt,
+			"translated": state.PromptText,
+		})
+	} else {
+		message = t.T("generate.prompt_review", i18n.Params{"prompt": state.PromptText})
+	}
+
+	if c.Callback() != nil {
+		return c.Edit(message, menu)
+	}
+	return c.Send(message, menu)
+}
+
+func (h *BotHandler) handlePromptConfirm(c telebot.Context) error {
+	sender := c.Sender()
+	if sender == nil {
+		return fmt.Errorf("failed to get sender information")
+	}
+
+	state := h.state(c)
+	if state == nil || state.State != "confirm_prompt" {
+		return c.Send(h.t(c).T("generate.prompt_expired"))
 	}
 
 	// Clear user state
-	delete(userStates, sender.ID)
+	h.clearState(c)
 
-	// Generate image with the prompt
-	return h.generateImageWithPrompt(c, text, categoryID)
+	return h.submitPrompt(c, state.CategoryID, generation.Translation{
+		Original:   state.OriginalPrompt,
+		Text:       state.PromptText,
+		SourceLang: state.PromptLang,
+	})
 }
 
-func (h *BotHandler) generateImageWithPrompt(c telebot.Context, prompt string, categoryID string) error {
+func (h *BotHandler) handlePromptEdit(c telebot.Context) error {
 	sender := c.Sender()
 	if sender == nil {
 		return fmt.Errorf("failed to get sender information")
 	}
 
-	// Simulate processing time
-	time.Sleep(2 * time.Second)
+	state := h.state(c)
+	if state == nil || state.State != "confirm_prompt" {
+		return c.Send(h.t(c).T("generate.prompt_expired"))
+	}
 
-	// Get category name for display
-	var categoryName string
-	if categoryID == "trending" {
-		categoryName = "Trending"
-	} else {
-		var category model.Category
-		if err := h.db.Where("id = ?", categoryID).First(&category).Error; err == nil {
-			categoryName = category.Name
-		} else {
-			categoryName = "Unknown"
+	state.State = "waiting_prompt_edit"
+	if err := h.setState(c, state); err != nil {
+		return err
+	}
+
+	return c.Edit(h.t(c).T("generate.edit_prompt", i18n.Params{"prompt": state.PromptText}))
+}
+
+func (h *BotHandler) handlePromptEnhance(c telebot.Context) error {
+	t := h.t(c)
+	sender := c.Sender()
+	if sender == nil {
+		return fmt.Errorf("failed to get sender information")
+	}
+
+	state := h.state(c)
+	if state == nil || state.State != "confirm_prompt" || h.enhancer == nil {
+		return c.Send(t.T("generate.prompt_expired"))
+	}
+
+	user, err := h.repos.Users.GetByTelegramID(h.ctx(c), uint(sender.ID))
+	if err != nil {
+		return c.Send(t.T("error.load_user"))
+	}
+
+	category, err := h.category(h.ctx(c), state.CategoryID, i18n.DefaultLang)
+	if err != nil {
+		return c.Send(t.T("error.invalid_category"))
+	}
+
+	// Enhancing calls the LLM, so it is limited like generating
+	tier := rateTier(h.rateLimit, user, h.subscription(h.ctx(c), user.ID))
+	if message := h.throttled(h.ctx(c), t, user, tier); message != "" {
+		return c.Send(message)
+	}
+
+	previous, err := h.repos.Enhancements.CountByUser(h.ctx(c), user.ID)
+	if err != nil {
+		return c.Send(t.T("error.database"))
+	}
+	charge := h.enhanceCost.ChargeFor(int(previous))
+
+	if charge > 0 && !h.hasCredits(h.ctx(c), user.ID, model.CreditTypeImage, charge) {
+		return c.Send(t.N("generate.enhance_no_credits", charge))
+	}
+	if message := h.takePrompt(t, user, tier); message != "" {
+		return c.Send(message)
+	}
+
+	enhancement, err := h.enhancer.Enhance(h.ctx(c), state.PromptText, *category)
+	if err != nil {
+		h.logger.WarnContext(h.ctx(c), "Failed to enhance prompt", logging.Err(err))
+		return c.Send(t.T("generate.enhance_failed"))
+	}
+
+	record := model.PromptEnhancement{
+		UserID:           user.ID,
+		CategoryID:       category.ID,
+		OriginalPrompt:   state.PromptText,
+		EnhancedPrompt:   enhancement.Prompt,
+		CreditsCharged:   charge,
+		ModelUsed:        enhancement.Model,
+		PromptTokens:     enhancement.Usage.PromptTokens,
+		CompletionTokens: enhancement.Usage.CompletionTokens,
+		TotalTokens:      enhancement.Usage.TotalTokens,
+	}
+	if err := h.repos.Enhancements.Create(h.ctx(c), &record); err != nil {
+		// The credits were spent since they were checked above
+		if errors.Is(err, creditrepo.ErrInsufficientCredits) {
+			return c.Send(t.N("generate.enhance_no_credits", charge))
 		}
+		h.logger.WarnContext(h.ctx(c), "Failed to record prompt enhancement", logging.Err(err))
+		return c.Send(t.T("generate.enhance_failed"))
+	}
+
+	state.State = "review_enhanced"
+	state.EnhancedPrompt = enhancement.Prompt
+	state.EnhancementID = record.ID
+	if err := h.setState(c, state); err != nil {
+		return err
 	}
 
-	// Create placeholder response (since AI is not integrated yet)
 	menu := &telebot.ReplyMarkup{
 		InlineKeyboard: [][]telebot.InlineButton{
 			{
-				{Text: "🔄 Generate Another", Data: "generate_image"},
-				{Text: "📊 Use Trending", Data: "trending_prompts"},
+				{Text: t.T("button.enhance_accept"), Data: h.callbacks.Data("enhance_accept")},
+				{Text: t.T("button.prompt_edit"), Data: h.callbacks.Data("enhance_edit")},
 			},
 			{
-				{Text: "💳 My Credits", Data: "my_credits"},
-				{Text: "🏠 Main Menu", Data: "back_to_main"},
+				{Text: t.T("button.enhance_reject"), Data: h.callbacks.Data("enhance_reject")},
 			},
 		},
 	}
 
-	// Placeholder response
-	message := fmt.Sprintf(
-		"✅ Image Generated Successfully!\n\n"+
-			"📝 Prompt: %s\n"+
-			"📂 Category: %s\n"+
-			"🎨 Style: AI Generated\n"+
-			"⏱️ Generation Time: 2.3 seconds\n\n"+
-			"🖼️ [Placeholder: Your amazing AI-generated image would appear here]\n\n"+
-			"💡 This is a placeholder response. Once AI integration is complete, you'll see your actual generated image here!\n\n"+
-			"What would you like to do next?",
-		prompt,
-		categoryName,
-	)
+	message := t.T("generate.enhance_review", i18n.Params{
+		"prompt":   state.PromptText,
+		"enhanced": enhancement.Prompt,
+	})
+	if charge > 0 {
+		message += t.N("generate.enhance_charged", charge)
+	}
 
 	return c.Edit(message, menu)
 }
 
-func (h *BotHandler) handleCancel(c telebot.Context) error {
+// hasCredits reports whether the user can pay amount credits of creditType.
+func (h *BotHandler) hasCredits(ctx context.Context, userID uuid.UUID, creditType model.CreditType, amount int) bool {
+	userCredit, err := h.repos.Credits.Get(ctx, userID, creditType)
+	if err != nil {
+		return false
+	}
+	return userCredit.HasEnoughCredits(amount)
+}
+
+// reviewedEnhancement returns the pending enhancement review for the sender
+// and records the user's decision on it.
+func (h *BotHandler) reviewedEnhancement(c telebot.Context, accepted bool) (*model.ConversationState, bool) {
+	if c.Sender() == nil {
+		return nil, false
+	}
+
+	state := h.state(c)
+	if state == nil || state.State != "review_enhanced" {
+		return nil, false
+	}
+
+	if err := h.repos.Enhancements.SetAccepted(h.ctx(c), state.EnhancementID, accepted); err != nil {
+		h.logger.WarnContext(h.ctx(c), "Failed to record enhancement decision", logging.Err(err))
+	}
+
+	return state, true
+}
+
+func (h *BotHandler) handleEnhanceAccept(c telebot.Context) error {
+	state, ok := h.reviewedEnhancement(c, true)
+	if !ok {
+		return c.Send(h.t(c).T("generate.prompt_expired"))
+	}
+
+	// Clear user state
+	h.clearState(c)
+
+	return h.submitPrompt(c, state.CategoryID, generation.Translation{
+		Original:   state.OriginalPrompt,
+		Text:       state.EnhancedPrompt,
+		SourceLang: state.PromptLang,
+	})
+}
+
+func (h *BotHandler) handleEnhanceEdit(c telebot.Context) error {
+	state, ok := h.reviewedEnhancement(c, true)
+	if !ok {
+		return c.Send(h.t(c).T("generate.prompt_expired"))
+	}
+
+	state.PromptText = state.EnhancedPrompt
+	state.State = "waiting_prompt_edit"
+	if err := h.setState(c, state); err != nil {
+		return err
+	}
+
+	return c.Edit(h.t(c).T("generate.edit_prompt", i18n.Params{"prompt": state.PromptText}))
+}
+
+func (h *BotHandler) handleEnhanceReject(c telebot.Context) error {
+	state, ok := h.reviewedEnhancement(c, false)
+	if !ok {
+		return c.Send(h.t(c).T("generate.prompt_expired"))
+	}
+
+	state.State = "confirm_prompt"
+	state.EnhancedPrompt = ""
+	if err := h.setState(c, state); err != nil {
+		return err
+	}
+
+	return h.sendPromptConfirmation(c, state)
+}
+
+func (h *BotHandler) handlePromptEditInput(c telebot.Context, text string, state *model.ConversationState) error {
+	if problem := validatePrompt(text); problem != "" {
+		return c.Send(h.t(c).T(problem))
+	}
+
+	// The edit may be written in any language, like the first prompt
+	translation, err := generation.ToEnglish(h.ctx(c), h.translator, text)
+	if err != nil {
+		h.logger.WarnContext(h.ctx(c), "Failed to translate edited prompt, using original", logging.Err(err))
+	}
+
+	state.PromptText = translation.Text
+	state.OriginalPrompt = translation.Original
+	state.PromptLang = translation.SourceLang
+	state.State = "confirm_prompt"
+	if err := h.setState(c, state); err != nil {
+		return err
+	}
+
+	return h.sendPromptConfirmation(c, state)
+}
+
+// submitPrompt records the generation request with both the user's prompt
+// and the English prompt that goes to the provider. A generation worker picks
+// the request up and delivers the result through NotifyCompleted.
+func (h *BotHandler) submitPrompt(c telebot.Context, categoryID string, translation generation.Translation) error {
+	ctx, span := tracing.Start(h.ctx(c), "generation.submit", attribute.String("category_id", categoryID))
+	defer span.End()
+
+	t := h.t(c)
 	sender := c.Sender()
 	if sender == nil {
 		return fmt.Errorf("failed to get sender information")
 	}
 
-	// Clear user state
-	delete(userStates, sender.ID)
+	category, err := h.category(ctx, categoryID, t.Lang())
+	if err != nil {
+		return c.Send(t.T("error.invalid_category"))
+	}
+
+	user, err := h.repos.Users.GetByTelegramID(ctx, uint(sender.ID))
+	if err != nil {
+		return c.Send(t.T("error.load_user"))
+	}
+
+	// Trending prompts can lead here without choosing the category first
+	sub := h.subscription(ctx, user.ID)
+	if premiumLocked(category, sub) {
+		return h.sendPremiumRequired(c)
+	}
+
+	tier := rateTier(h.rateLimit, user, sub)
+	if message := h.throttled(ctx, t, user, tier); message != "" {
+		return c.Send(message)
+	}
+
+	// The daily free allowance is used up before purchased credits. Both
+	// are checked again when the request is created, which reserves the
+	// credits.
+	cost := h.pricing.ImageGenerationCost
+	free := h.freeGenerationsLeft(ctx, user.ID) > 0
+	if !free && cost > 0 && !h.hasCredits(ctx, user.ID, model.CreditTypeImage, cost) {
+		return h.sendNoCredits(c, cost)
+	}
+	if message := h.takePrompt(t, user, tier); message != "" {
+		return c.Send(message)
+	}
+
+	request := model.ImageGenerationRequest{
+		UserID:         user.ID,
+		CategoryID:     category.ID,
+		Category:       *category,
+		Prompt:         translation.Text,
+		OriginalPrompt: translation.Original,
+		PromptLang:     translation.SourceLang,
+		Status:         model.RequestStatusPending,
+		CorrelationID:  logging.CorrelationID(ctx),
+		TraceParent:    tracing.Inject(ctx),
+	}
+	if sub != nil {
+		request.Priority = sub.Plan.Priority
+	}
+
+	if free {
+		free, err = h.createFreeRequest(ctx, &request, tier.InFlight)
+	}
+	if err == nil && !free {
+		request.CreditsRequired = cost
+		err = h.repos.Requests.Create(ctx, &request, tier.InFlight)
+	}
+	if errors.Is(err, requestrepo.ErrTooManyInFlight) {
+		return c.Send(t.N("ratelimit.in_flight", tier.InFlight))
+	}
+	if errors.Is(err, creditrepo.ErrInsufficientCredits) {
+		return h.sendNoCredits(c, cost)
+	}
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to create generation request", "user_id", user.ID, "free", free, logging.Err(err))
+		return c.Send(t.T("error.database"))
+	}
+	span.SetAttributes(attribute.String("request_id", request.ID.String()), attribute.Bool("free", free))
 
-	return c.Send("❌ Operation cancelled.\n\nReturning to main menu...", &telebot.ReplyMarkup{
+	message := t.T("generate.queued", i18n.Params{
+		"prompt":   translation.Original,
+		"category": category.Localized(t.Lang()).Name,
+	})
+
+	if c.Callback() != nil {
+		return c.Edit(message)
+	}
+	return c.Send(message)
+}
+
+// sendNoCredits tells the user they need cost image credits and offers a
+// deposit.
+func (h *BotHandler) sendNoCredits(c telebot.Context, cost int) error {
+	t := h.t(c)
+	return c.Send(t.N("generate.no_credits", cost), &telebot.ReplyMarkup{
 		InlineKeyboard: [][]telebot.InlineButton{
 			{
-				{Text: "🏠 Main Menu", Data: "back_to_main"},
+				{Text: t.T("button.deposit_credits"), Data: h.callbacks.Data("deposit_credits")},
+				{Text: t.T("button.main_menu"), Data: h.callbacks.Data("back_to_main")},
 			},
 		},
 	})
 }
 
-func (h *BotHandler) processDeposit(c telebot.Context, amount, creditsToAdd, unusedAmount int) error {
+func (h *BotHandler) handleCancel(c telebot.Context) error {
 	sender := c.Sender()
 	if sender == nil {
 		return fmt.Errorf("failed to get sender information")
 	}
 
-	userRepo := &repository.PostgresUserRepo{DB: h.db}
-	user, err := userRepo.GetByTelegramID(context.TODO(), uint(sender.ID))
-	if err != nil {
-		return c.Send("❌ Could not process your deposit. Please try again.")
-	}
+	// Clear user state
+	h.clearState(c)
 
-	// Debug logging
-	fmt.Printf("Processing deposit for user ID: %s, amount: %d, credits: %d\n", user.ID, amount, creditsToAdd)
+	t := h.t(c)
+	return c.Send(t.T("cancel.done"), &telebot.ReplyMarkup{
+		InlineKeyboard: [][]telebot.InlineButton{
+			{
+				{Text: t.T("button.main_menu"), Data: h.callbacks.Data("back_to_main")},
+			},
+		},
+	})
+}
 
-	// Update user credits in database with proper transaction handling
-	tx := h.db.Begin()
-	if tx.Error != nil {
-		fmt.Printf("Failed to begin transaction: %v\n", tx.Error)
-		return c.Send("❌ Database error. Please try again.")
+func (h *BotHandler) processDeposit(c telebot.Context, creditType model.CreditType, amount, creditsToAdd, unusedAmount int) error {
+	t := h.t(c)
+	sender := c.Sender()
+	if sender == nil {
+		return fmt.Errorf("failed to get sender information")
 	}
 
-	// Find existing user credit record
-	var userCredit model.UserCredit
-	result := tx.Where("user_id = ? AND credit_type = ?", user.ID, model.CreditTypeImage).First(&userCredit)
-
-	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			// Create new credit record
-			fmt.Printf("Creating new credit record for user: %s\n", user.ID)
-			userCredit = model.UserCredit{
-				UserID:     user.ID,
-				CreditType: model.CreditTypeImage,
-				Credits:    creditsToAdd,
-			}
-			if err := tx.Create(&userCredit).Error; err != nil {
-				tx.Rollback()
-				fmt.Printf("Failed to create credit record: %v\n", err)
-				return c.Send("❌ Failed to process deposit. Please try again.")
-			}
-			fmt.Printf("Created new credit record with ID: %s\n", userCredit.ID)
-		} else {
-			tx.Rollback()
-			fmt.Printf("Database error finding credit record: %v\n", result.Error)
-			return c.Send("❌ Database error. Please try again.")
-		}
-	} else {
-		// Update existing credit record
-		fmt.Printf("Updating existing credit record. Current credits: %d, adding: %d\n", userCredit.Credits, creditsToAdd)
-		userCredit.Credits += creditsToAdd
-		if err := tx.Save(&userCredit).Error; err != nil {
-			tx.Rollback()
-			fmt.Printf("Failed to update credit record: %v\n", err)
-			return c.Send("❌ Failed to process deposit. Please try again.")
-		}
-		fmt.Printf("Updated credit record. New balance: %d\n", userCredit.Credits)
+	user, err := h.repos.Users.GetByTelegramID(h.ctx(c), uint(sender.ID))
+	if err != nil {
+		return c.Send(t.T("deposit.error_user"))
 	}
 
-	// Create transaction record
 	transaction := model.Transaction{
-		UserID:       user.ID,
-		CreditType:   model.CreditTypeImage,
-		Amount:       creditsToAdd,
-		Type:         model.TransactionTypePurchase,
-		Description:  fmt.Sprintf("Deposit: %d etb converted to %d credits", amount-unusedAmount, creditsToAdd),
-		BalanceAfter: userCredit.Credits,
+		UserID:      user.ID,
+		CreditType:  creditType,
+		Amount:      creditsToAdd,
+		Type:        model.TransactionTypePurchase,
+		Description: fmt.Sprintf("Deposit: %d etb converted to %d %s credits", amount-unusedAmount, creditsToAdd, creditType),
 	}
-	if err := tx.Create(&transaction).Error; err != nil {
-		tx.Rollback()
-		fmt.Printf("Failed to create transaction record: %v\n", err)
-		return c.Send("❌ Failed to record transaction. Please try again.")
+	userCredit, err := h.repos.Credits.Apply(h.ctx(c), &transaction)
+	if err != nil {
+		h.logger.ErrorContext(h.ctx(c), "Failed to apply deposit", "user_id", user.ID, "credit_type", creditType, "credits", creditsToAdd, logging.Err(err))
+		return c.Send(t.T("deposit.error_failed"))
 	}
-	fmt.Printf("Created transaction record with ID: %s\n", transaction.ID)
-
-	// Commit the transaction
-	if err := tx.Commit().Error; err != nil {
-		fmt.Printf("Failed to commit transaction: %v\n", err)
-		return c.Send("❌ Failed to complete deposit. Please try again.")
+	h.logger.InfoContext(h.ctx(c), "Deposited credits", "user_id", user.ID, "credit_type", creditType, "amount_etb", amount-unusedAmount, "credits", creditsToAdd)
+	h.metrics.CreditsPurchased(creditType, creditsToAdd)
+	// A first purchase qualifies a referred user for the referral bonus,
+	// announced after the deposit itself.
+	defer h.rewardReferral(h.ctx(c), user)
+
+	// A deposit bonus from a redeemed promo code is paid on top, in image
+	// credits, so it only applies to image deposits
+	var redemption *model.PromoRedemption
+	var bonus *model.Transaction
+	if creditType == model.CreditTypeImage {
+		redemption, bonus, err = h.repos.PromoCodes.ApplyDepositBonus(h.ctx(c), user.ID, creditsToAdd)
+		if err != nil && !errors.Is(err, promorepo.ErrNotExist) {
+			h.logger.ErrorContext(h.ctx(c), "Failed to apply promo bonus", "user_id", user.ID, logging.Err(err))
+		}
+	}
+	if bonus != nil {
+		userCredit.Credits = bonus.BalanceAfter
 	}
-
-	fmt.Printf("Deposit completed successfully. Final balance: %d\n", userCredit.Credits)
 
 	// Create success message
 	menu := &telebot.ReplyMarkup{
 		InlineKeyboard: [][]telebot.InlineButton{
 			{
-				{Text: "💳 View Credits", Data: "my_credits"},
-				{Text: "🏠 Main Menu", Data: "back_to_main"},
+				{Text: t.T("button.view_credits"), Data: h.callbacks.Data("my_credits")},
+				{Text: t.T("button.main_menu"), Data: h.callbacks.Data("back_to_main")},
 			},
 		},
 	}
 
-	var message string
+	successKey := "deposit.success"
+	if creditType == model.CreditTypeVideo {
+		successKey = "deposit.video_success"
+	}
+	message := t.N(successKey, userCredit.Credits, i18n.Params{
+		"amount":  amount,
+		"credits": creditsToAdd,
+	})
 	if unusedAmount > 0 {
-		message = fmt.Sprintf(
-			"✅ Deposit Successful!\n\n"+
-				"💰 Amount Deposited: %d etb\n"+
-				"🎨 Credits Added: %d\n"+
-				"💔 Unused Amount: %d etb\n\n"+
-				"💳 Your New Balance: %d credits\n\n"+
-				"⚠️ Note: %d etb were not converted because you need multiples of 10 for credits.",
-			amount, creditsToAdd, unusedAmount, userCredit.Credits, unusedAmount,
-		)
-	} else {
-		message = fmt.Sprintf(
-			"✅ Deposit Successful!\n\n"+
-				"💰 Amount Deposited: %d etb\n"+
-				"🎨 Credits Added: %d\n\n"+
-				"💳 Your New Balance: %d credits",
-			amount, creditsToAdd, userCredit.Credits,
-		)
+		params := rateParams(h.depositRate(creditType))
+		params["unused"] = unusedAmount
+		message += t.T("deposit.success_unused", params)
+	}
+	if bonus != nil {
+		message += t.N("deposit.promo_bonus", bonus.Amount, i18n.Params{"percent": redemption.BonusPercent})
 	}
 
 	return c.Send(message, menu)
 }
+
+// truncate shortens s to at most n runes, marking the cut with an ellipsis.
+// Slicing by runes keeps multi-byte scripts like Ge'ez intact.
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-3]) + "..."
+}
@@ -0,0 +1,263 @@
+package handler_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/bottest"
+	"github.com/Leul-Michael/image-generation/callback"
+	"github.com/Leul-Michael/image-generation/config"
+	"github.com/Leul-Michael/image-generation/generation"
+	"github.com/Leul-Michael/image-generation/handler"
+	"github.com/Leul-Michael/image-generation/model"
+	"gopkg.in/telebot.v3"
+)
+
+// TestExpiredMenu has a user press buttons the bot can't have sent: one with
+// data in the format of an older version and a deposit signed with another
+// secret. Both are answered as expired and nothing is deposited.
+func TestExpiredMenu(t *testing.T) {
+	h := bottest.New(t, bottest.Options{})
+	user := telebot.User{ID: 9201, FirstName: "Abebe", LanguageCode: "en"}
+	chat := h.Chat(user)
+	expires := time.Now().Add(config.Default().Credits.BonusExpiry).Format("2006-01-02")
+
+	forged, err := handler.NewCallbackCodec([]byte("not the bot's secret")).Encode(callback.Data{Action: "deposit", Args: []string{"100"}})
+	if err != nil {
+		t.Fatalf("failed to encode forged callback data: %v", err)
+	}
+	expired := "⌛ This menu has expired. Send /start to open a new one."
+
+	chat.Run(
+		bottest.Send("/start"),
+		bottest.Expect(bottest.Reply{
+			Text: "Hello Abebe! Welcome to Image Generation Bot! 🎨\n\nI can help you generate amazing images using AI. What would you like to do?\n\nYour current image credits: 2",
+			Keyboard: [][]bottest.Button{
+				{{Text: "🎨 Generate Image", Data: "generate_image"}, {Text: "🎬 Generate Video", Data: "generate_video"}},
+				{{Text: "💳 My Credits", Data: "my_credits"}, {Text: "📊 Trending Prompts", Data: "trending_prompts"}},
+				{{Text: "👥 Invite friends", Data: "invite_friends"}, {Text: "❓ Help", Data: "help"}},
+				{{Text: "🌐 Language", Data: "language"}},
+			},
+		}),
+
+		bottest.Press("generate_image"),
+		bottest.ExpectAnswer(expired),
+		func(c *bottest.Chat) { c.ExpectNone(200 * time.Millisecond) },
+
+		bottest.Press(forged),
+		bottest.ExpectAnswer(expired),
+		func(c *bottest.Chat) { c.ExpectNone(200 * time.Millisecond) },
+
+		bottest.Click("my_credits"),
+		bottest.Expect(bottest.Reply{
+			Text: fmt.Sprintf("💳 Your Credit Balance:\n\n🎨 Image Credits: 2\n🎬 Video Credits: 0\n\n💡 Credit Pricing:\n• 10 etb = 1 Image Credit\n• 20 etb = 2 Image Credits\n• 30 etb = 3 Image Credits\n• And so on...\n• 50 etb = 1 Video Credit\n\nCredits are used to generate amazing AI images and videos!\n\n⏳ Expiring credits:\n• 2 credits on %s", expires),
+			Keyboard: [][]bottest.Button{
+				{{Text: "💰 Deposit Credits", Data: "deposit_credits"}, {Text: "⭐ Plans", Data: "plans"}},
+				{{Text: "🎬 Buy Video Credits", Data: "deposit_video"}},
+				{{Text: "🔙 Back to Main Menu", Data: "back_to_main"}},
+			},
+			Edit: true,
+		}),
+	)
+}
+
+// TestEditTranslatedPrompt has a user rewrite an Amharic prompt after
+// seeing its translation. The rewrite is translated too, so the provider
+// gets English.
+func TestEditTranslatedPrompt(t *testing.T) {
+	h := bottest.New(t, bottest.Options{Translator: generation.DictionaryTranslator{Words: map[string]string{
+		"ፏፏቴ":   "waterfall",
+		"ገበያ":   "market",
+		"በሐረር":  "in Harar",
+		"በተራሮች": "in the mountains",
+	}}})
+	landscape := h.AddCategory(model.Category{Name: "Landscape", Description: "Scenery and nature", Emoji: "🏞️"})
+	user := telebot.User{ID: 9202, FirstName: "Abebe", LanguageCode: "en"}
+	chat := h.Chat(user)
+
+	review := func(original, translated string, edit bool) bottest.Reply {
+		return bottest.Reply{
+			Text: "🌐 I translated your prompt to English for better results:\n\n📝 Your prompt: " + original + "\n🇬🇧 English: " + translated + "\n\nGenerate with the English prompt, or edit it first?",
+			Keyboard: [][]bottest.Button{
+				{{Text: "✅ Generate", Data: "prompt_confirm"}, {Text: "✏️ Edit", Data: "prompt_edit"}},
+				{{Text: "🏠 Main Menu", Data: "back_to_main"}},
+			},
+			Edit: edit,
+		}
+	}
+
+	chat.Run(
+		bottest.Send("/start"),
+		bottest.Expect(bottest.Reply{
+			Text: "Hello Abebe! Welcome to Image Generation Bot! 🎨\n\nI can help you generate amazing images using AI. What would you like to do?\n\nYour current image credits: 2",
+			Keyboard: [][]bottest.Button{
+				{{Text: "🎨 Generate Image", Data: "generate_image"}, {Text: "🎬 Generate Video", Data: "generate_video"}},
+				{{Text: "💳 My Credits", Data: "my_credits"}, {Text: "📊 Trending Prompts", Data: "trending_prompts"}},
+				{{Text: "👥 Invite friends", Data: "invite_friends"}, {Text: "❓ Help", Data: "help"}},
+				{{Text: "🌐 Language", Data: "language"}},
+			},
+		}),
+		bottest.Click("generate_image"),
+		bottest.Expect(bottest.Reply{
+			Text: "🎨 Choose a category for your image generation:\n\nSelect the type of image you'd like to create!",
+			Keyboard: [][]bottest.Button{
+				{{Text: "🏞️ Landscape", Data: "category_" + landscape.ID.String()}},
+				{{Text: "🔙 Back to Main Menu", Data: "back_to_main"}},
+			},
+			Edit: true,
+		}),
+		bottest.Click("🏞️ Landscape"),
+		bottest.Expect(bottest.Reply{
+			Text: "🏞️ Landscape Category Selected!\n\nScenery and nature\n\n✍️ Now, please describe the image you want to generate:\n\n💡 Examples:\n• A cute golden retriever puppy playing in a sunny meadow\n• A futuristic city with flying cars at night\n• A cozy cottage by a lake with mountains in the background\n\n💬 Type your prompt or use /cancel to go back:",
+			Edit: true,
+		}),
+
+		bottest.Send("ፏፏቴ በተራሮች"),
+		bottest.Expect(review("ፏፏቴ በተራሮች", "waterfall in the mountains", false)),
+		bottest.Click("✏️ Edit"),
+		bottest.Expect(bottest.Reply{
+			Text: "✏️ Send the prompt you want to use. English works best.\n\nCurrent prompt:\nwaterfall in the mountains\n\n💬 Type your prompt or use /cancel to go back:",
+			Edit: true,
+		}),
+		bottest.Send("ገበያ በሐረር"),
+		bottest.Expect(review("ገበያ በሐረር", "market in Harar", false)),
+		bottest.Click("✅ Generate"),
+		bottest.Expect(bottest.Reply{
+			Text: "⏳ Your image is being generated...\n\n📝 Prompt: ገበያ በሐረር\n📂 Category: Landscape\n\nI will send it here as soon as it is ready.",
+			Edit: true,
+		}),
+	)
+
+	stored, err := h.Repos.Users.GetByTelegramID(context.Background(), uint(user.ID))
+	if err != nil {
+		t.Fatalf("GetByTelegramID: %v", err)
+	}
+	requests, err := h.Repos.Requests.ListByUser(context.Background(), stored.ID, 1)
+	if err != nil {
+		t.Fatalf("ListByUser: %v", err)
+	}
+	if len(requests) != 1 || requests[0].Prompt != "market in Harar" {
+		t.Errorf("requests %+v, want one for %q", requests, "market in Harar")
+	}
+}
+
+// TestStartKeepsProfile has a user who signed in on the website, with a
+// photo, send /start. The photo stays, and the username they don't have is
+// stored as NULL rather than as an empty string other users would clash
+// with.
+func TestStartKeepsProfile(t *testing.T) {
+	h := bottest.New(t, bottest.Options{})
+	user := telebot.User{ID: 9203, FirstName: "Abebe", LanguageCode: "en"}
+	chat := h.Chat(user)
+
+	photo := "https://t.me/i/userpic/abebe.jpg"
+	if _, err := h.Repos.Users.CreateOrUpdateUser(context.Background(), uint(user.ID), "Abebe", "", nil, &photo); err != nil {
+		t.Fatalf("CreateOrUpdateUser: %v", err)
+	}
+
+	chat.Run(
+		bottest.Send("/start"),
+		bottest.Expect(bottest.Reply{
+			Text: "Hello Abebe! Welcome to Image Generation Bot! 🎨\n\nI can help you generate amazing images using AI. What would you like to do?\n\nYour current image credits: 2",
+			Keyboard: [][]bottest.Button{
+				{{Text: "🎨 Generate Image", Data: "generate_image"}, {Text: "🎬 Generate Video", Data: "generate_video"}},
+				{{Text: "💳 My Credits", Data: "my_credits"}, {Text: "📊 Trending Prompts", Data: "trending_prompts"}},
+				{{Text: "👥 Invite friends", Data: "invite_friends"}, {Text: "❓ Help", Data: "help"}},
+				{{Text: "🌐 Language", Data: "language"}},
+			},
+		}),
+	)
+
+	stored, err := h.Repos.Users.GetByTelegramID(context.Background(), uint(user.ID))
+	if err != nil {
+		t.Fatalf("GetByTelegramID: %v", err)
+	}
+	if stored.Image == nil || *stored.Image != photo {
+		t.Errorf("image %v, want %q", stored.Image, photo)
+	}
+	if stored.TelegramUsername != nil {
+		t.Errorf("username %q, want NULL", *stored.TelegramUsername)
+	}
+}
+
+// enhancerFunc is a generation.Enhancer calling itself.
+type enhancerFunc func(ctx context.Context, prompt string, category model.Category) (*generation.Enhancement, error)
+
+func (f enhancerFunc) Enhance(ctx context.Context, prompt string, category model.Category) (*generation.Enhancement, error) {
+	return f(ctx, prompt, category)
+}
+
+// TestEnhanceCreditsSpent has a user's credits spent elsewhere while their
+// prompt is being enhanced. They are told they need credits, as when they
+// had none to begin with.
+func TestEnhanceCreditsSpent(t *testing.T) {
+	pricing := config.Default().Pricing
+	pricing.PromptEnhanceCost = 1
+	user := telebot.User{ID: 9204, FirstName: "Abebe", LanguageCode: "en"}
+
+	var h *bottest.Harness
+	enhancer := enhancerFunc(func(ctx context.Context, prompt string, category model.Category) (*generation.Enhancement, error) {
+		stored, err := h.Repos.Users.GetByTelegramID(ctx, uint(user.ID))
+		if err != nil {
+			return nil, err
+		}
+		balance, err := h.Repos.Credits.Get(ctx, stored.ID, model.CreditTypeImage)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := h.Repos.Credits.Apply(ctx, &model.Transaction{
+			UserID:     stored.ID,
+			CreditType: model.CreditTypeImage,
+			Amount:     -balance.Credits,
+			Type:       model.TransactionTypeUsage,
+		}); err != nil {
+			return nil, err
+		}
+		return &generation.Enhancement{Prompt: prompt + ", golden hour"}, nil
+	})
+	h = bottest.New(t, bottest.Options{Pricing: &pricing, Enhancer: enhancer})
+	landscape := h.AddCategory(model.Category{Name: "Landscape", Description: "Scenery and nature", Emoji: "🏞️"})
+	chat := h.Chat(user)
+
+	chat.Run(
+		bottest.Send("/start"),
+		bottest.Expect(bottest.Reply{
+			Text: "Hello Abebe! Welcome to Image Generation Bot! 🎨\n\nI can help you generate amazing images using AI. What would you like to do?\n\nYour current image credits: 2",
+			Keyboard: [][]bottest.Button{
+				{{Text: "🎨 Generate Image", Data: "generate_image"}, {Text: "🎬 Generate Video", Data: "generate_video"}},
+				{{Text: "💳 My Credits", Data: "my_credits"}, {Text: "📊 Trending Prompts", Data: "trending_prompts"}},
+				{{Text: "👥 Invite friends", Data: "invite_friends"}, {Text: "❓ Help", Data: "help"}},
+				{{Text: "🌐 Language", Data: "language"}},
+			},
+		}),
+		bottest.Click("generate_image"),
+		bottest.Expect(bottest.Reply{
+			Text: "🎨 Choose a category for your image generation:\n\nSelect the type of image you'd like to create!",
+			Keyboard: [][]bottest.Button{
+				{{Text: "🏞️ Landscape", Data: "category_" + landscape.ID.String()}},
+				{{Text: "🔙 Back to Main Menu", Data: "back_to_main"}},
+			},
+			Edit: true,
+		}),
+		bottest.Click("🏞️ Landscape"),
+		bottest.Expect(bottest.Reply{
+			Text: "🏞️ Landscape Category Selected!\n\nScenery and nature\n\n✍️ Now, please describe the image you want to generate:\n\n💡 Examples:\n• A cute golden retriever puppy playing in a sunny meadow\n• A futuristic city with flying cars at night\n• A cozy cottage by a lake with mountains in the background\n\n💬 Type your prompt or use /cancel to go back:",
+			Edit: true,
+		}),
+		bottest.Send("A waterfall in the Simien mountains"),
+		bottest.Expect(bottest.Reply{
+			Text: "📝 Your prompt:\nA waterfall in the Simien mountains\n\nGenerate with this prompt, edit it, or let AI enhance it?",
+			Keyboard: [][]bottest.Button{
+				{{Text: "✅ Generate", Data: "prompt_confirm"}, {Text: "✏️ Edit", Data: "prompt_edit"}},
+				{{Text: "✨ Enhance prompt", Data: "prompt_enhance"}},
+				{{Text: "🏠 Main Menu", Data: "back_to_main"}},
+			},
+		}),
+		bottest.Click("✨ Enhance prompt"),
+		bottest.Expect(bottest.Reply{
+			Text: "❌ Enhancing this prompt costs 1 credit. Please deposit credits first.",
+		}),
+	)
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Leul-Michael/image-generation/i18n"
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/Leul-Michael/image-generation/model"
+	creditrepo "github.com/Leul-Michael/image-generation/repository/credit"
+	"github.com/google/uuid"
+)
+
+// maxExpiryDates is how many expiry dates the credits screen lists.
+const maxExpiryDates = 3
+
+// expiringCredits lists the user's image credits that expire, soonest date
+// first, for the credits screen. It is empty when none do.
+func (h *BotHandler) expiringCredits(ctx context.Context, t *i18n.Localizer, userID uuid.UUID) string {
+	lots, err := h.repos.Credits.Lots(ctx, userID, model.CreditTypeImage)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to load credit lots", "user_id", userID, logging.Err(err))
+		return ""
+	}
+
+	// Lots come soonest expiry first, those that never expire last.
+	var dates []string
+	credits := make(map[string]int)
+	for _, lot := range lots {
+		if lot.ExpiresAt == nil {
+			break
+		}
+		date := lot.ExpiresAt.Format(dateFormat)
+		if _, ok := credits[date]; !ok {
+			if len(dates) == maxExpiryDates {
+				break
+			}
+			dates = append(dates, date)
+		}
+		credits[date] += lot.Remaining
+	}
+	if len(dates) == 0 {
+		return ""
+	}
+
+	message := t.T("credits.expiring")
+	for _, date := range dates {
+		message += "\n" + t.N("credits.expiring_item", credits[date], i18n.Params{"date": date})
+	}
+	return message
+}
+
+// NotifyExpiringCredits reminds the user that credits expire soon. It is
+// the billing.ExpiryNotifier the expiry job reports to.
+func (h *BotHandler) NotifyExpiringCredits(ctx context.Context, expiring creditrepo.Expiring) error {
+	user, err := h.repos.Users.GetById(ctx, expiring.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to load user: %w", err)
+	}
+
+	recipient, err := telegramRecipient(*user)
+	if err != nil {
+		return err
+	}
+	t := h.i18n.For(user.Lang)
+
+	_, err = h.bot.Send(recipient, t.N("credits.expiry_reminder", expiring.Credits, i18n.Params{
+		"date": expiring.ExpiresAt.Format(dateFormat),
+	}))
+	return err
+}
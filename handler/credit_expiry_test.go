@@ -0,0 +1,128 @@
+package handler_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/bottest"
+	"github.com/Leul-Michael/image-generation/config"
+	"github.com/Leul-Michael/image-generation/model"
+	"gopkg.in/telebot.v3"
+)
+
+// TestCreditExpiry has a user spend part of the signup grant, which goes
+// before purchased credits because it expires, get reminded of the rest and
+// then lose it when the expiry job runs.
+func TestCreditExpiry(t *testing.T) {
+	h := bottest.New(t, bottest.Options{Provider: chargedProvider{}})
+	landscape := h.AddCategory(model.Category{
+		Name:        "Landscape",
+		Description: "Scenery and nature",
+		Emoji:       "🏞️",
+	})
+
+	user := telebot.User{ID: 9001, FirstName: "Abebe", LanguageCode: "en"}
+	chat := h.Chat(user)
+
+	started := time.Now()
+	expiresAt := started.Add(config.Default().Credits.BonusExpiry)
+	expires := expiresAt.Format("2006-01-02")
+
+	mainMenu := func(credits int) bottest.Reply {
+		return bottest.Reply{
+			Text: fmt.Sprintf("Hello Abebe! Welcome to Image Generation Bot! 🎨\n\nI can help you generate amazing images using AI. What would you like to do?\n\nYour current image credits: %d", credits),
+			Keyboard: [][]bottest.Button{
+				{{Text: "🎨 Generate Image", Data: "generate_image"}, {Text: "🎬 Generate Video", Data: "generate_video"}},
+				{{Text: "💳 My Credits", Data: "my_credits"}, {Text: "📊 Trending Prompts", Data: "trending_prompts"}},
+				{{Text: "👥 Invite friends", Data: "invite_friends"}, {Text: "❓ Help", Data: "help"}},
+				{{Text: "🌐 Language", Data: "language"}},
+			},
+		}
+	}
+	creditsScreen := func(credits int, expiring string) bottest.Reply {
+		return bottest.Reply{
+			Text: fmt.Sprintf("💳 Your Credit Balance:\n\n🎨 Image Credits: %d\n🎬 Video Credits: 0\n\n💡 Credit Pricing:\n• 10 etb = 1 Image Credit\n• 20 etb = 2 Image Credits\n• 30 etb = 3 Image Credits\n• And so on...\n• 50 etb = 1 Video Credit\n\nCredits are used to generate amazing AI images and videos!", credits) + expiring,
+			Keyboard: [][]bottest.Button{
+				{{Text: "💰 Deposit Credits", Data: "deposit_credits"}, {Text: "⭐ Plans", Data: "plans"}},
+				{{Text: "🎬 Buy Video Credits", Data: "deposit_video"}},
+				{{Text: "🔙 Back to Main Menu", Data: "back_to_main"}},
+			},
+			Edit: true,
+		}
+	}
+
+	chat.Run(
+		bottest.Send("/start"),
+		bottest.Expect(mainMenu(2)),
+		bottest.Click("my_credits"),
+		bottest.Expect(creditsScreen(2, "\n\n⏳ Expiring credits:\n• 2 credits on "+expires)),
+
+		bottest.Click("deposit_credits"),
+		bottest.Expect(bottest.Reply{
+			Text: "💰 Choose Deposit Amount\n\nSelect how much you want to deposit:\n\n💡 Credit Conversion Rate:\n• 10 etb = 1 Image Credit\n\nChoose a preset amount or enter a custom amount:",
+			Keyboard: [][]bottest.Button{
+				{{Text: "10 credits", Data: "deposit_10"}, {Text: "50 credits", Data: "deposit_50"}},
+				{{Text: "100 credits", Data: "deposit_100"}, {Text: "200 credits", Data: "deposit_200"}},
+				{{Text: "✏️ Custom Amount", Data: "deposit_custom"}},
+				{{Text: "🔙 Back to Credits", Data: "my_credits"}},
+			},
+			Edit: true,
+		}),
+		bottest.Click("deposit_10"),
+		bottest.Expect(bottest.Reply{
+			Text: "✅ Deposit Successful!\n\n💰 Amount Deposited: 10 etb\n🎨 Credits Added: 1\n\n💳 Your New Balance: 3 credits",
+			Keyboard: [][]bottest.Button{
+				{{Text: "💳 View Credits", Data: "my_credits"}, {Text: "🏠 Main Menu", Data: "back_to_main"}},
+			},
+		}),
+
+		// The generation is paid from the grant
+		bottest.Click("🏠 Main Menu"),
+		bottest.Expect(bottest.Reply{Text: mainMenu(3).Text, Keyboard: mainMenu(3).Keyboard, Edit: true}),
+		bottest.Click("generate_image"),
+		bottest.Expect(bottest.Reply{
+			Text: "🎨 Choose a category for your image generation:\n\nSelect the type of image you'd like to create!",
+			Keyboard: [][]bottest.Button{
+				{{Text: "🏞️ Landscape", Data: "category_" + landscape.ID.String()}},
+				{{Text: "🔙 Back to Main Menu", Data: "back_to_main"}},
+			},
+			Edit: true,
+		}),
+		bottest.Click("🏞️ Landscape"),
+		bottest.Expect(bottest.Reply{
+			Text: "🏞️ Landscape Category Selected!\n\nScenery and nature\n\n✍️ Now, please describe the image you want to generate:\n\n💡 Examples:\n• A cute golden retriever puppy playing in a sunny meadow\n• A futuristic city with flying cars at night\n• A cozy cottage by a lake with mountains in the background\n\n💬 Type your prompt or use /cancel to go back:",
+			Edit: true,
+		}),
+		bottest.Send("Lake Tana at dawn"),
+		bottest.Expect(bottest.Reply{
+			Text: "⏳ Your image is being generated...\n\n📝 Prompt: Lake Tana at dawn\n📂 Category: Landscape\n\nI will send it here as soon as it is ready.",
+		}),
+		bottest.Expect(bottest.Reply{
+			Text: "✅ Image Generated Successfully!\n\n📝 Prompt: Lake Tana at dawn\n📂 Category: Landscape\n🎨 Style: AI Generated\n⏱️ Generation Time: 0 seconds\n\n🖼️ [Placeholder: Your amazing AI-generated image would appear here]\n\n💡 This is a placeholder response. Once AI integration is complete, you'll see your actual generated image here!\n\nWhat would you like to do next?",
+			Keyboard: [][]bottest.Button{
+				{{Text: "🔄 Generate Another", Data: "generate_image"}, {Text: "📊 Use Trending", Data: "trending_prompts"}},
+				{{Text: "💳 My Credits", Data: "my_credits"}, {Text: "🏠 Main Menu", Data: "back_to_main"}},
+			},
+		}),
+		bottest.Click("💳 My Credits"),
+		bottest.Expect(creditsScreen(2, "\n\n⏳ Expiring credits:\n• 1 credit on "+expires)),
+	)
+
+	// Reminders are sent once, a few days ahead
+	reminded := expiresAt.Add(-2 * 24 * time.Hour)
+	h.RunExpiry(reminded)
+	chat.Run(
+		bottest.Expect(bottest.Reply{Text: fmt.Sprintf("⏳ 1 of your credits expires on %s. Use it to generate images before then!", expires)}),
+	)
+	h.RunExpiry(reminded.Add(time.Hour))
+
+	// Only the purchased credit is left
+	h.RunExpiry(expiresAt.Add(time.Hour))
+	chat.Run(
+		bottest.Send("/start"),
+		bottest.Expect(mainMenu(1)),
+		bottest.Click("my_credits"),
+		bottest.Expect(creditsScreen(1, "")),
+	)
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/Leul-Michael/image-generation/model"
+	requestrepo "github.com/Leul-Michael/image-generation/repository/request"
+	"github.com/google/uuid"
+)
+
+// freeDayStart is the start of the current free allowance day, midnight in
+// the configured timezone.
+func (h *BotHandler) freeDayStart() time.Time {
+	now := time.Now().In(h.freeLocation)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, h.freeLocation)
+}
+
+// freeGenerationsLeft is what remains of the user's daily allowance. It is 0
+// when the allowance is turned off or can't be counted.
+func (h *BotHandler) freeGenerationsLeft(ctx context.Context, userID uuid.UUID) int {
+	if h.freeTier.DailyGenerations <= 0 {
+		return 0
+	}
+
+	used, err := h.repos.Requests.CountFreeSince(ctx, userID, h.freeDayStart())
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to count free generations", "user_id", userID, logging.Err(err))
+		return 0
+	}
+	return max(h.freeTier.DailyGenerations-int(used), 0)
+}
+
+// createFreeRequest queues request against the daily allowance, which is
+// used before purchased credits. It reports false, without an error, when
+// the allowance is off or used up and the request has to be paid for.
+// maxInFlight caps the user's requests as for Requests.Create.
+func (h *BotHandler) createFreeRequest(ctx context.Context, request *model.ImageGenerationRequest, maxInFlight int) (bool, error) {
+	if h.freeTier.DailyGenerations <= 0 {
+		return false, nil
+	}
+
+	err := h.repos.Requests.CreateFree(ctx, request, h.freeDayStart(), h.freeTier.DailyGenerations, maxInFlight)
+	if errors.Is(err, requestrepo.ErrAllowanceUsed) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,89 @@
+package handler_test
+
+import (
+	"testing"
+
+	"github.com/Leul-Michael/image-generation/bottest"
+	"github.com/Leul-Michael/image-generation/config"
+	"github.com/Leul-Michael/image-generation/model"
+	"gopkg.in/telebot.v3"
+)
+
+// TestFreeTier has a user use up the daily free generation, which is taken
+// before credits, and then get asked to pay for the next one.
+func TestFreeTier(t *testing.T) {
+	h := bottest.New(t, bottest.Options{FreeTier: &config.FreeTierConfig{DailyGenerations: 1, Timezone: "UTC"}})
+	landscape := h.AddCategory(model.Category{
+		Name:        "Landscape",
+		Description: "Scenery and nature",
+		Emoji:       "🏞️",
+	})
+
+	user := telebot.User{ID: 7001, FirstName: "Abebe", LanguageCode: "en"}
+	chat := h.Chat(user)
+
+	mainMenu := [][]bottest.Button{
+		{{Text: "🎨 Generate Image", Data: "generate_image"}, {Text: "🎬 Generate Video", Data: "generate_video"}},
+		{{Text: "💳 My Credits", Data: "my_credits"}, {Text: "📊 Trending Prompts", Data: "trending_prompts"}},
+		{{Text: "👥 Invite friends", Data: "invite_friends"}, {Text: "❓ Help", Data: "help"}},
+		{{Text: "🌐 Language", Data: "language"}},
+	}
+	categories := [][]bottest.Button{
+		{{Text: "🏞️ Landscape", Data: "category_" + landscape.ID.String()}},
+		{{Text: "🔙 Back to Main Menu", Data: "back_to_main"}},
+	}
+	categorySelected := "🏞️ Landscape Category Selected!\n\nScenery and nature\n\n✍️ Now, please describe the image you want to generate:\n\n💡 Examples:\n• A cute golden retriever puppy playing in a sunny meadow\n• A futuristic city with flying cars at night\n• A cozy cottage by a lake with mountains in the background\n\n💬 Type your prompt or use /cancel to go back:"
+
+	chat.Run(
+		bottest.Send("/start"),
+		bottest.Expect(bottest.Reply{
+			Text:     "Hello Abebe! Welcome to Image Generation Bot! 🎨\n\nI can help you generate amazing images using AI. What would you like to do?\n\nYour current image credits: 0\n🎁 Free generations left today: 1",
+			Keyboard: mainMenu,
+		}),
+
+		bottest.Click("generate_image"),
+		bottest.Expect(bottest.Reply{
+			Text:     "🎨 Choose a category for your image generation:\n\nSelect the type of image you'd like to create!",
+			Keyboard: categories,
+			Edit:     true,
+		}),
+		bottest.Click("🏞️ Landscape"),
+		bottest.Expect(bottest.Reply{Text: categorySelected, Edit: true}),
+
+		bottest.Send("A waterfall in the Simien mountains"),
+		bottest.Expect(bottest.Reply{
+			Text: "⏳ Your image is being generated...\n\n📝 Prompt: A waterfall in the Simien mountains\n📂 Category: Landscape\n\nI will send it here as soon as it is ready.",
+		}),
+		bottest.Expect(bottest.Reply{
+			Text: "✅ Image Generated Successfully!\n\n📝 Prompt: A waterfall in the Simien mountains\n📂 Category: Landscape\n🎨 Style: AI Generated\n⏱️ Generation Time: 0 seconds\n\n🖼️ [Placeholder: Your amazing AI-generated image would appear here]\n\n💡 This is a placeholder response. Once AI integration is complete, you'll see your actual generated image here!\n\nWhat would you like to do next?",
+			Keyboard: [][]bottest.Button{
+				{{Text: "🔄 Generate Another", Data: "generate_image"}, {Text: "📊 Use Trending", Data: "trending_prompts"}},
+				{{Text: "💳 My Credits", Data: "my_credits"}, {Text: "🏠 Main Menu", Data: "back_to_main"}},
+			},
+		}),
+
+		bottest.Click("🏠 Main Menu"),
+		bottest.Expect(bottest.Reply{
+			Text:     "Hello Abebe! Welcome to Image Generation Bot! 🎨\n\nI can help you generate amazing images using AI. What would you like to do?\n\nYour current image credits: 0\n🎁 Free generations left today: 0",
+			Keyboard: mainMenu,
+			Edit:     true,
+		}),
+
+		bottest.Click("generate_image"),
+		bottest.Expect(bottest.Reply{
+			Text:     "🎨 Choose a category for your image generation:\n\nSelect the type of image you'd like to create!",
+			Keyboard: categories,
+			Edit:     true,
+		}),
+		bottest.Click("🏞️ Landscape"),
+		bottest.Expect(bottest.Reply{Text: categorySelected, Edit: true}),
+
+		bottest.Send("A market in Harar"),
+		bottest.Expect(bottest.Reply{
+			Text: "❌ Generating an image costs 1 credit. Please deposit credits first.",
+			Keyboard: [][]bottest.Button{
+				{{Text: "💰 Deposit Credits", Data: "deposit_credits"}, {Text: "🏠 Main Menu", Data: "back_to_main"}},
+			},
+		}),
+	)
+}
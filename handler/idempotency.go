@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/callback"
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/Leul-Michael/image-generation/model"
+	idempotencyrepo "github.com/Leul-Michael/image-generation/repository/idempotency"
+	"github.com/gin-gonic/gin"
+	"gopkg.in/telebot.v3"
+)
+
+// IdempotencyKeyHeader lets REST clients retry a mutation safely: a repeat
+// of the same key gets the first response instead of running it again.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKey is the longest Idempotency-Key header accepted.
+const maxIdempotencyKey = 255
+
+// actionCallbacks are the buttons that spend or grant credits or start a
+// generation, which a double tap must not run twice. Menus can be pressed
+// again.
+var actionCallbacks = map[string]bool{
+	"prompt_confirm": true,
+	"prompt_enhance": true,
+	"enhance_accept": true,
+	"plans_cancel":   true,
+	"plan":           true,
+	"trending":       true,
+}
+
+func isAction(d callback.Data) bool {
+	if actionCallbacks[d.Action] {
+		return true
+	}
+	// Preset deposits, as opposed to the deposit screens
+	for _, action := range depositActions {
+		if d.Action == action && len(d.Args) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// withIdempotency handles each callback query once. Telegram can deliver a
+// callback again, which is ignored for CallbackWindow; a second tap on the
+// same action button of a message is ignored for ActionWindow. Ignored
+// callbacks are only acknowledged. If the handler fails, the callback can
+// be retried.
+func (h *BotHandler) withIdempotency(next telebot.HandlerFunc) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		query := c.Callback()
+		if query == nil {
+			return next(c)
+		}
+
+		now := time.Now()
+		keys := []*model.IdempotencyKey{{
+			Key:       "callback:" + query.ID,
+			ExpiresAt: now.Add(h.idempotency.CallbackWindow),
+		}}
+		if h.idempotency.ActionWindow > 0 && query.Message != nil {
+			if d, err := h.callbacks.Decode(query.Data); err == nil && isAction(d) {
+				keys = append(keys, &model.IdempotencyKey{
+					Key:       fmt.Sprintf("action:%d:%d:%s", query.Message.Chat.ID, query.Message.ID, d),
+					ExpiresAt: now.Add(h.idempotency.ActionWindow),
+				})
+			}
+		}
+
+		var claimed []*model.IdempotencyKey
+		for _, key := range keys {
+			_, err := h.repos.Idempotency.Claim(h.ctx(c), key)
+			if errors.Is(err, idempotencyrepo.ErrExists) {
+				return c.Respond()
+			}
+			if err != nil {
+				// Better to risk a repeat than to drop the tap
+				h.logger.ErrorContext(h.ctx(c), "Failed to claim callback", logging.Err(err))
+				continue
+			}
+			claimed = append(claimed, key)
+		}
+
+		err := next(c)
+		if err != nil {
+			for _, key := range claimed {
+				if err := h.repos.Idempotency.Release(h.ctx(c), key); err != nil {
+					h.logger.ErrorContext(h.ctx(c), "Failed to release callback", logging.Err(err))
+				}
+			}
+		}
+		return err
+	}
+}
+
+// Idempotent makes mutations with an Idempotency-Key header run once per key
+// and client: repeats get the stored response, marked with an
+// Idempotent-Replayed header. Keys are scoped to the signed-in user, or to
+// the client IP without a session, and can't be reused for a different
+// request. Server errors aren't stored, so the request can be retried.
+// Responses are stored as written, so routes that return secrets such as
+// session tokens must not use it.
+func Idempotent(repos Repos, ttl time.Duration, logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader(IdempotencyKeyHeader)
+		if header == "" || c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead || c.Request.Method == http.MethodOptions {
+			c.Next()
+			return
+		}
+		if len(header) > maxIdempotencyKey {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must be at most %d characters", IdempotencyKeyHeader, maxIdempotencyKey)})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		scope := "ip:" + c.ClientIP()
+		if user := sessionUser(c); user != nil {
+			scope = "user:" + user.ID.String()
+		}
+		key := &model.IdempotencyKey{
+			Key:         "api:" + scope + ":" + header,
+			RequestHash: requestHash(c.Request, body),
+			ExpiresAt:   time.Now().Add(ttl),
+		}
+
+		existing, err := repos.Idempotency.Claim(c.Request.Context(), key)
+		if errors.Is(err, idempotencyrepo.ErrExists) {
+			switch {
+			case existing.RequestHash != key.RequestHash:
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("%s was already used for a different request", IdempotencyKeyHeader)})
+			case existing.CompletedAt == nil:
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("A request with this %s is still in progress", IdempotencyKeyHeader)})
+			default:
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(existing.StatusCode, gin.MIMEJSON+"; charset=utf-8", existing.Response)
+				c.Abort()
+			}
+			return
+		}
+		if err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to claim idempotency key", logging.Err(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to process request"})
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// Use a fresh context: the client may be gone, but the key must
+		// still be settled
+		ctx := context.WithoutCancel(c.Request.Context())
+		if status := recorder.Status(); status >= http.StatusInternalServerError {
+			err = repos.Idempotency.Release(ctx, key)
+		} else {
+			err = repos.Idempotency.Complete(ctx, key, status, recorder.body.Bytes())
+		}
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to store idempotent response", logging.Err(err))
+		}
+	}
+}
+
+// requestHash identifies a request by its method, path, query and body.
+func requestHash(r *http.Request, body []byte) string {
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%s %s\n", r.Method, r.URL.RequestURI())
+	sum.Write(body)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// responseRecorder keeps a copy of the response body as it is written.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,74 @@
+package handler_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/bottest"
+	"github.com/Leul-Michael/image-generation/config"
+	"gopkg.in/telebot.v3"
+)
+
+// TestDoubleTap has a user tap a deposit button twice before the bot
+// answers, and then get the last callback redelivered. Only one deposit is
+// made.
+func TestDoubleTap(t *testing.T) {
+	h := bottest.New(t, bottest.Options{})
+	user := telebot.User{ID: 9101, FirstName: "Abebe", LanguageCode: "en"}
+	chat := h.Chat(user)
+	expires := time.Now().Add(config.Default().Credits.BonusExpiry).Format("2006-01-02")
+
+	creditsScreen := func(credits int) bottest.Reply {
+		return bottest.Reply{
+			Text: fmt.Sprintf("💳 Your Credit Balance:\n\n🎨 Image Credits: %d\n🎬 Video Credits: 0\n\n💡 Credit Pricing:\n• 10 etb = 1 Image Credit\n• 20 etb = 2 Image Credits\n• 30 etb = 3 Image Credits\n• And so on...\n• 50 etb = 1 Video Credit\n\nCredits are used to generate amazing AI images and videos!\n\n⏳ Expiring credits:\n• 2 credits on %s", credits, expires),
+			Keyboard: [][]bottest.Button{
+				{{Text: "💰 Deposit Credits", Data: "deposit_credits"}, {Text: "⭐ Plans", Data: "plans"}},
+				{{Text: "🎬 Buy Video Credits", Data: "deposit_video"}},
+				{{Text: "🔙 Back to Main Menu", Data: "back_to_main"}},
+			},
+			Edit: true,
+		}
+	}
+
+	chat.Run(
+		bottest.Send("/start"),
+		bottest.Expect(bottest.Reply{
+			Text: "Hello Abebe! Welcome to Image Generation Bot! 🎨\n\nI can help you generate amazing images using AI. What would you like to do?\n\nYour current image credits: 2",
+			Keyboard: [][]bottest.Button{
+				{{Text: "🎨 Generate Image", Data: "generate_image"}, {Text: "🎬 Generate Video", Data: "generate_video"}},
+				{{Text: "💳 My Credits", Data: "my_credits"}, {Text: "📊 Trending Prompts", Data: "trending_prompts"}},
+				{{Text: "👥 Invite friends", Data: "invite_friends"}, {Text: "❓ Help", Data: "help"}},
+				{{Text: "🌐 Language", Data: "language"}},
+			},
+		}),
+		bottest.Click("my_credits"),
+		bottest.Expect(creditsScreen(2)),
+		bottest.Click("deposit_credits"),
+		bottest.Expect(bottest.Reply{
+			Text: "💰 Choose Deposit Amount\n\nSelect how much you want to deposit:\n\n💡 Credit Conversion Rate:\n• 10 etb = 1 Image Credit\n\nChoose a preset amount or enter a custom amount:",
+			Keyboard: [][]bottest.Button{
+				{{Text: "10 credits", Data: "deposit_10"}, {Text: "50 credits", Data: "deposit_50"}},
+				{{Text: "100 credits", Data: "deposit_100"}, {Text: "200 credits", Data: "deposit_200"}},
+				{{Text: "✏️ Custom Amount", Data: "deposit_custom"}},
+				{{Text: "🔙 Back to Credits", Data: "my_credits"}},
+			},
+			Edit: true,
+		}),
+
+		bottest.DoubleTap("deposit_100"),
+		bottest.Expect(bottest.Reply{
+			Text: "✅ Deposit Successful!\n\n💰 Amount Deposited: 100 etb\n🎨 Credits Added: 10\n\n💳 Your New Balance: 12 credits",
+			Keyboard: [][]bottest.Button{
+				{{Text: "💳 View Credits", Data: "my_credits"}, {Text: "🏠 Main Menu", Data: "back_to_main"}},
+			},
+		}),
+		func(c *bottest.Chat) { c.ExpectNone(200 * time.Millisecond) },
+
+		bottest.Redeliver(),
+		func(c *bottest.Chat) { c.ExpectNone(200 * time.Millisecond) },
+
+		bottest.Click("💳 View Credits"),
+		bottest.Expect(creditsScreen(12)),
+	)
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the correlation ID of an HTTP request. A valid
+// ID sent by the client, e.g. a proxy, is kept; otherwise one is made up.
+// Either way it is echoed in the response.
+const RequestIDHeader = "X-Request-ID"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestLogger gives each request a correlation ID, carried by its
+// context and added to its span, and logs it once it is served. Only the
+// path is logged: query strings can hold tokens and Telegram initData.
+func RequestLogger(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = logging.NewCorrelationID()
+		}
+		ctx := logging.WithCorrelationID(c.Request.Context(), id)
+		c.Request = c.Request.WithContext(ctx)
+		c.Header(RequestIDHeader, id)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String(logging.CorrelationKey, id))
+
+		started := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		attrs := []any{
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"route", c.FullPath(),
+			"status", status,
+			"duration", time.Since(started),
+			"client_ip", c.ClientIP(),
+		}
+		if user := sessionUser(c); user != nil {
+			attrs = append(attrs, "user_id", user.ID)
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, "error", c.Errors.String())
+		}
+
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logger.Log(ctx, level, "HTTP request", attrs...)
+	}
+}
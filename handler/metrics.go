@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// RequestMetrics measures how long requests take, by route pattern.
+// Requests matching no route are counted together as "unmatched".
+func RequestMetrics(m *metrics.Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		started := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		m.HTTPRequest(c.Request.Method, route, c.Writer.Status(), time.Since(started))
+	}
+}
+
+// MetricsHandler serves m for Prometheus. With a token, scrapes must send it
+// as a bearer token.
+func MetricsHandler(m *metrics.Metrics, token string) gin.HandlerFunc {
+	serve := gin.WrapH(m.Handler())
+	return func(c *gin.Context) {
+		if token != "" {
+			got, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				c.AbortWithStatus(http.StatusUnauthorized)
+				return
+			}
+		}
+		serve(c)
+	}
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Leul-Michael/image-generation/i18n"
+	"github.com/Leul-Michael/image-generation/model"
+	"gopkg.in/telebot.v3"
+)
+
+// NotifyCompleted sends a finished image to the user who requested it. It
+// implements generation.Notifier, so the worker can run in a different
+// process from the bot's update loop.
+func (h *BotHandler) NotifyCompleted(ctx context.Context, request *model.ImageGenerationRequest, image *model.GeneratedImage) error {
+	// A first paid generation qualifies a referred user for the referral
+	// bonus, announced after the image itself.
+	if !request.IsFree && h.paidFor(ctx, request.ID) {
+		defer h.rewardReferral(ctx, &request.User)
+	}
+
+	recipient, err := telegramRecipient(request.User)
+	if err != nil {
+		return err
+	}
+	t := h.i18n.For(request.User.Lang)
+
+	categoryName := t.T("generate.category_unknown")
+	if category, err := h.repos.Categories.GetByID(ctx, request.CategoryID, t.Lang()); err == nil {
+		categoryName = category.Localized(t.Lang()).Name
+	}
+
+	prompt := request.OriginalPrompt
+	if prompt == "" {
+		prompt = request.Prompt
+	}
+
+	menu := &telebot.ReplyMarkup{
+		InlineKeyboard: [][]telebot.InlineButton{
+			{
+				{Text: t.T("button.generate_another"), Data: h.callbacks.Data("generate_image")},
+				{Text: t.T("button.use_trending"), Data: h.callbacks.Data("trending_prompts")},
+			},
+			{
+				{Text: t.T("button.my_credits"), Data: h.callbacks.Data("my_credits")},
+				{Text: t.T("button.main_menu"), Data: h.callbacks.Data("back_to_main")},
+			},
+		},
+	}
+
+	params := i18n.Params{
+		"prompt":   prompt,
+		"category": categoryName,
+		"seconds":  image.GenerationTime,
+	}
+
+	// Placeholder providers return no image, only the result text
+	if image.ImageURL == "" {
+		_, err := h.bot.Send(recipient, t.T("generate.placeholder_result", params), menu)
+		return err
+	}
+
+	photo := &telebot.Photo{
+		File:    telebot.FromURL(image.ImageURL),
+		Caption: t.T("generate.result", params),
+	}
+	if _, err := h.bot.Send(recipient, photo, menu); err != nil {
+		return fmt.Errorf("failed to send image: %w", err)
+	}
+	return nil
+}
+
+// NotifyFailed tells the user their request could not be completed. The
+// reason is logged by the worker and not shown to the user.
+func (h *BotHandler) NotifyFailed(ctx context.Context, request *model.ImageGenerationRequest, reason error) error {
+	recipient, err := telegramRecipient(request.User)
+	if err != nil {
+		return err
+	}
+	t := h.i18n.For(request.User.Lang)
+
+	prompt := request.OriginalPrompt
+	if prompt == "" {
+		prompt = request.Prompt
+	}
+
+	_, err = h.bot.Send(recipient, t.T("generate.failed", i18n.Params{"prompt": truncate(prompt, 100)}), &telebot.ReplyMarkup{
+		InlineKeyboard: [][]telebot.InlineButton{
+			{
+				{Text: t.T("button.generate_another"), Data: h.callbacks.Data("generate_image")},
+				{Text: t.T("button.main_menu"), Data: h.callbacks.Data("back_to_main")},
+			},
+		},
+	})
+	return err
+}
+
+// telegramRecipient is the chat to notify user in. Accounts registered by
+// email have none until they link Telegram.
+func telegramRecipient(user model.User) (*telebot.User, error) {
+	if user.TelegramID == nil {
+		return nil, fmt.Errorf("user %s has no Telegram account", user.ID)
+	}
+	return &telebot.User{ID: int64(*user.TelegramID)}, nil
+}
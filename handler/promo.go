@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Leul-Michael/image-generation/i18n"
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/Leul-Michael/image-generation/model"
+	promorepo "github.com/Leul-Michael/image-generation/repository/promo"
+	"github.com/gin-gonic/gin"
+	"gopkg.in/telebot.v3"
+)
+
+// promoErrors maps the reasons a redemption is refused to catalog keys and
+// HTTP statuses.
+var promoErrors = []struct {
+	err    error
+	key    string
+	status int
+}{
+	{promorepo.ErrNotExist, "promo.not_found", http.StatusNotFound},
+	{promorepo.ErrNotOpen, "promo.not_open", http.StatusConflict},
+	{promorepo.ErrExhausted, "promo.exhausted", http.StatusConflict},
+	{promorepo.ErrLimitReached, "promo.limit_reached", http.StatusConflict},
+	{promorepo.ErrNotEligible, "promo.not_eligible", http.StatusForbidden},
+}
+
+func (h *BotHandler) handleRedeem(c telebot.Context) error {
+	sender := c.Sender()
+	if sender == nil {
+		return fmt.Errorf("failed to get sender information")
+	}
+
+	// "/redeem LAUNCH50" redeems at once; a bare /redeem asks for the code
+	if code := c.Message().Payload; code != "" {
+		return h.redeemPromoCode(c, code)
+	}
+
+	if err := h.setState(c, &model.ConversationState{State: "waiting_promo_code"}); err != nil {
+		return err
+	}
+	return c.Send(h.t(c).T("promo.ask_code"))
+}
+
+func (h *BotHandler) redeemPromoCode(c telebot.Context, code string) error {
+	t := h.t(c)
+	sender := c.Sender()
+
+	h.clearState(c)
+
+	user, err := h.repos.Users.GetByTelegramID(h.ctx(c), uint(sender.ID))
+	if err != nil {
+		return c.Send(t.T("error.load_user"))
+	}
+
+	redemption, err := h.repos.PromoCodes.Redeem(h.ctx(c), model.NormalizePromoCode(code), user)
+	if err != nil {
+		for _, e := range promoErrors {
+			if errors.Is(err, e.err) {
+				return c.Send(t.T(e.key))
+			}
+		}
+		h.logger.ErrorContext(h.ctx(c), "Failed to redeem promo code", "user_id", user.ID, logging.Err(err))
+		return c.Send(t.T("error.database"))
+	}
+
+	menu := &telebot.ReplyMarkup{
+		InlineKeyboard: [][]telebot.InlineButton{
+			{
+				{Text: t.T("button.view_credits"), Data: h.callbacks.Data("my_credits")},
+				{Text: t.T("button.main_menu"), Data: h.callbacks.Data("back_to_main")},
+			},
+		},
+	}
+
+	var message string
+	if redemption.Credits > 0 {
+		var balance int
+		if userCredit, err := h.repos.Credits.Get(h.ctx(c), user.ID, model.CreditTypeImage); err == nil {
+			balance = userCredit.Credits
+		}
+		message = t.N("promo.redeemed_credits", balance, i18n.Params{
+			"code":    redemption.PromoCode.Code,
+			"credits": redemption.Credits,
+		})
+	}
+	if redemption.BonusPercent > 0 {
+		if message != "" {
+			message += "\n\n"
+		}
+		message += t.T("promo.redeemed_bonus", i18n.Params{
+			"code":    redemption.PromoCode.Code,
+			"percent": redemption.BonusPercent,
+		})
+	}
+
+	return c.Send(message, menu)
+}
+
+// RedeemPromoCode redeems a promo code for the signed-in user.
+func (h *UserHandler) RedeemPromoCode(c *gin.Context) {
+	user := sessionUser(c)
+
+	var body struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	redemption, err := h.repos.PromoCodes.Redeem(c.Request.Context(), model.NormalizePromoCode(body.Code), user)
+	if err != nil {
+		for _, e := range promoErrors {
+			if errors.Is(err, e.err) {
+				c.JSON(e.status, gin.H{"error": e.err.Error()})
+				return
+			}
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeem promo code"})
+		return
+	}
+
+	credits, err := h.repos.Credits.ListByUser(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load credits"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Promo code redeemed",
+		"redemption": redemption,
+		"credits":    credits,
+	})
+}
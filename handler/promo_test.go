@@ -0,0 +1,120 @@
+package handler_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/bottest"
+	"github.com/Leul-Michael/image-generation/config"
+	"github.com/Leul-Michael/image-generation/model"
+	"gopkg.in/telebot.v3"
+)
+
+// TestPromoCode has a user redeem a code for credits, get refused a second
+// use of it, then redeem a deposit bonus that is paid on the next deposit.
+func TestPromoCode(t *testing.T) {
+	// Without a signup grant, balances show only what the flow adds
+	h := bottest.New(t, bottest.Options{FreeTier: &config.FreeTierConfig{Timezone: "UTC"}})
+	h.AddPromoCode(model.PromoCode{Code: "LAUNCH50", Credits: 5, PerUserLimit: 1})
+	h.AddPromoCode(model.PromoCode{Code: "BONUS25", BonusPercent: 25, PerUserLimit: 1})
+
+	user := telebot.User{ID: 6001, FirstName: "Abebe", LanguageCode: "en"}
+	chat := h.Chat(user)
+	expires := time.Now().Add(config.Default().Credits.BonusExpiry).Format("2006-01-02")
+
+	afterRedeem := [][]bottest.Button{
+		{{Text: "💳 View Credits", Data: "my_credits"}, {Text: "🏠 Main Menu", Data: "back_to_main"}},
+	}
+
+	chat.Run(
+		bottest.Send("/start"),
+		bottest.Expect(bottest.Reply{
+			Text: "Hello Abebe! Welcome to Image Generation Bot! 🎨\n\nI can help you generate amazing images using AI. What would you like to do?\n\nYour current image credits: 0",
+			Keyboard: [][]bottest.Button{
+				{{Text: "🎨 Generate Image", Data: "generate_image"}, {Text: "🎬 Generate Video", Data: "generate_video"}},
+				{{Text: "💳 My Credits", Data: "my_credits"}, {Text: "📊 Trending Prompts", Data: "trending_prompts"}},
+				{{Text: "👥 Invite friends", Data: "invite_friends"}, {Text: "❓ Help", Data: "help"}},
+				{{Text: "🌐 Language", Data: "language"}},
+			},
+		}),
+
+		bottest.Send("/redeem launch50"),
+		bottest.Expect(bottest.Reply{
+			Text:     "✅ Promo code LAUNCH50 redeemed!\n\n🎁 Credits Added: 5\n\n💳 Your New Balance: 5 credits",
+			Keyboard: afterRedeem,
+		}),
+
+		bottest.Send("/redeem LAUNCH50"),
+		bottest.Expect(bottest.Reply{Text: "❌ You have already used this promo code."}),
+
+		bottest.Send("/redeem NOPE"),
+		bottest.Expect(bottest.Reply{Text: "❌ That promo code does not exist. Check it and send /redeem to try again."}),
+
+		bottest.Send("/redeem"),
+		bottest.Expect(bottest.Reply{Text: "🎟️ Redeem a promo code\n\n💬 Type your code or use /cancel to go back:"}),
+		bottest.Send("bonus25"),
+		bottest.Expect(bottest.Reply{
+			Text:     "✅ Promo code BONUS25 redeemed!\n\n🎁 Your next deposit gets 25% extra credits.",
+			Keyboard: afterRedeem,
+		}),
+
+		bottest.Click("my_credits"),
+		bottest.Expect(bottest.Reply{
+			Text: "💳 Your Credit Balance:\n\n🎨 Image Credits: 5\n🎬 Video Credits: 0\n\n💡 Credit Pricing:\n• 10 etb = 1 Image Credit\n• 20 etb = 2 Image Credits\n• 30 etb = 3 Image Credits\n• And so on...\n• 50 etb = 1 Video Credit\n\nCredits are used to generate amazing AI images and videos!\n\n⏳ Expiring credits:\n• 5 credits on " + expires,
+			Keyboard: [][]bottest.Button{
+				{{Text: "💰 Deposit Credits", Data: "deposit_credits"}, {Text: "⭐ Plans", Data: "plans"}},
+				{{Text: "🎬 Buy Video Credits", Data: "deposit_video"}},
+				{{Text: "🔙 Back to Main Menu", Data: "back_to_main"}},
+			},
+			Edit: true,
+		}),
+		bottest.Click("deposit_credits"),
+		bottest.Expect(bottest.Reply{
+			Text: "💰 Choose Deposit Amount\n\nSelect how much you want to deposit:\n\n💡 Credit Conversion Rate:\n• 10 etb = 1 Image Credit\n\nChoose a preset amount or enter a custom amount:",
+			Keyboard: [][]bottest.Button{
+				{{Text: "10 credits", Data: "deposit_10"}, {Text: "50 credits", Data: "deposit_50"}},
+				{{Text: "100 credits", Data: "deposit_100"}, {Text: "200 credits", Data: "deposit_200"}},
+				{{Text: "✏️ Custom Amount", Data: "deposit_custom"}},
+				{{Text: "🔙 Back to Credits", Data: "my_credits"}},
+			},
+			Edit: true,
+		}),
+
+		// 25% of 5 credits, rounded down
+		bottest.Click("deposit_50"),
+		bottest.Expect(bottest.Reply{
+			Text:     "✅ Deposit Successful!\n\n💰 Amount Deposited: 50 etb\n🎨 Credits Added: 5\n\n💳 Your New Balance: 11 credits\n\n🎁 Promo bonus (25%): +1 credit",
+			Keyboard: afterRedeem,
+		}),
+
+		// The bonus is used up. Tapping the same button again right away
+		// would count as a double tap, so this deposit starts over from the
+		// credits screen.
+		bottest.Click("my_credits"),
+		bottest.Expect(bottest.Reply{
+			Text: "💳 Your Credit Balance:\n\n🎨 Image Credits: 11\n🎬 Video Credits: 0\n\n💡 Credit Pricing:\n• 10 etb = 1 Image Credit\n• 20 etb = 2 Image Credits\n• 30 etb = 3 Image Credits\n• And so on...\n• 50 etb = 1 Video Credit\n\nCredits are used to generate amazing AI images and videos!\n\n⏳ Expiring credits:\n• 6 credits on " + expires,
+			Keyboard: [][]bottest.Button{
+				{{Text: "💰 Deposit Credits", Data: "deposit_credits"}, {Text: "⭐ Plans", Data: "plans"}},
+				{{Text: "🎬 Buy Video Credits", Data: "deposit_video"}},
+				{{Text: "🔙 Back to Main Menu", Data: "back_to_main"}},
+			},
+			Edit: true,
+		}),
+		bottest.Click("deposit_credits"),
+		bottest.Expect(bottest.Reply{
+			Text: "💰 Choose Deposit Amount\n\nSelect how much you want to deposit:\n\n💡 Credit Conversion Rate:\n• 10 etb = 1 Image Credit\n\nChoose a preset amount or enter a custom amount:",
+			Keyboard: [][]bottest.Button{
+				{{Text: "10 credits", Data: "deposit_10"}, {Text: "50 credits", Data: "deposit_50"}},
+				{{Text: "100 credits", Data: "deposit_100"}, {Text: "200 credits", Data: "deposit_200"}},
+				{{Text: "✏️ Custom Amount", Data: "deposit_custom"}},
+				{{Text: "🔙 Back to Credits", Data: "my_credits"}},
+			},
+			Edit: true,
+		}),
+		bottest.Click("deposit_50"),
+		bottest.Expect(bottest.Reply{
+			Text:     "✅ Deposit Successful!\n\n💰 Amount Deposited: 50 etb\n🎨 Credits Added: 5\n\n💳 Your New Balance: 16 credits",
+			Keyboard: afterRedeem,
+		}),
+	)
+}
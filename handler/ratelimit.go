@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/config"
+	"github.com/Leul-Michael/image-generation/i18n"
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/Leul-Michael/image-generation/model"
+	"github.com/Leul-Michael/image-generation/ratelimit"
+	subscriptionrepo "github.com/Leul-Michael/image-generation/repository/subscription"
+	"github.com/gin-gonic/gin"
+)
+
+// rateTier is the rate limit tier of user, whose subscription sub may be nil.
+func rateTier(limits config.RateLimitConfig, user *model.User, sub *model.Subscription) config.RateLimitTier {
+	var plan string
+	if sub != nil {
+		plan = sub.Plan.Code
+	}
+	return limits.Tier(string(user.Role), plan)
+}
+
+// retrySeconds rounds wait up to whole seconds, so a client that waits that
+// long gets through.
+func retrySeconds(wait time.Duration) int {
+	return int(math.Ceil(wait.Seconds()))
+}
+
+// rateKey is the bucket key for id at rate. The limiter needs a key per
+// rate, so a user whose tier changes starts a new bucket.
+func rateKey(kind string, rate config.Rate, id string) string {
+	return fmt.Sprintf("%s:%d/%s:%s", kind, rate.Burst, rate.Every, id)
+}
+
+// throttled checks whether user may ask for another generation with their
+// tier's in-flight cap. Creating the request enforces the cap again, since
+// this check races with other requests; doing it first spares the prompt
+// token. It returns the message to send instead, or "" if the request may
+// go on.
+func (h *BotHandler) throttled(ctx context.Context, t *i18n.Localizer, user *model.User, tier config.RateLimitTier) string {
+	if tier.InFlight > 0 {
+		images, err := h.repos.Requests.CountInFlight(ctx, user.ID)
+		if err != nil {
+			h.logger.ErrorContext(ctx, "Failed to count in-flight generation requests", "user_id", user.ID, logging.Err(err))
+			return t.T("error.database")
+		}
+		videos, err := h.repos.VideoRequests.CountInFlight(ctx, user.ID)
+		if err != nil {
+			h.logger.ErrorContext(ctx, "Failed to count in-flight video generation requests", "user_id", user.ID, logging.Err(err))
+			return t.T("error.database")
+		}
+		if images+videos >= int64(tier.InFlight) {
+			return t.N("ratelimit.in_flight", tier.InFlight)
+		}
+	}
+	return ""
+}
+
+// takePrompt takes one of user's prompt tokens. It goes after the credit
+// check, so prompts that can't be paid for don't use up the rate. It
+// returns the message to send instead, or "" if the request may go on.
+func (h *BotHandler) takePrompt(t *i18n.Localizer, user *model.User, tier config.RateLimitTier) string {
+	if ok, wait := h.limiter.Allow(rateKey("prompt", tier.Prompts, user.ID.String()), ratelimit.Rate(tier.Prompts), time.Now()); !ok {
+		return t.N("ratelimit.slow_down", retrySeconds(wait))
+	}
+	return ""
+}
+
+// APILimiter throttles REST API requests per client IP and per signed-in
+// user.
+type APILimiter struct {
+	repos   Repos
+	limits  config.RateLimitConfig
+	limiter *ratelimit.Limiter
+	logger  *slog.Logger
+}
+
+func NewAPILimiter(repos Repos, limits config.RateLimitConfig, logger *slog.Logger) *APILimiter {
+	return &APILimiter{
+		repos:   repos,
+		limits:  limits,
+		limiter: ratelimit.New(),
+		logger:  logger,
+	}
+}
+
+// ByIP limits requests per client address.
+func (l *APILimiter) ByIP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ok, wait := l.limiter.Allow("ip:"+c.ClientIP(), ratelimit.Rate(l.limits.IP), time.Now()); !ok {
+			abortTooManyRequests(c, wait)
+			return
+		}
+		c.Next()
+	}
+}
+
+// ByUser limits requests per user with their tier's API rate. It goes after
+// WithSession; requests without a session are only limited by ByIP.
+func (l *APILimiter) ByUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := sessionUser(c)
+		if user == nil {
+			c.Next()
+			return
+		}
+
+		sub, err := l.repos.Subscriptions.Current(c.Request.Context(), user.ID)
+		if err != nil {
+			if !errors.Is(err, subscriptionrepo.ErrNotExist) {
+				l.logger.ErrorContext(c.Request.Context(), "Failed to load subscription", "user_id", user.ID, logging.Err(err))
+			}
+			sub = nil
+		}
+
+		tier := rateTier(l.limits, user, sub)
+		if ok, wait := l.limiter.Allow(rateKey("api", tier.API, user.ID.String()), ratelimit.Rate(tier.API), time.Now()); !ok {
+			abortTooManyRequests(c, wait)
+			return
+		}
+		c.Next()
+	}
+}
+
+func abortTooManyRequests(c *gin.Context, wait time.Duration) {
+	seconds := retrySeconds(wait)
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many requests",
+		"retry_after": seconds,
+	})
+}
@@ -0,0 +1,181 @@
+package handler_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/bottest"
+	"github.com/Leul-Michael/image-generation/config"
+	"github.com/Leul-Michael/image-generation/generation"
+	"github.com/Leul-Michael/image-generation/model"
+	"gopkg.in/telebot.v3"
+)
+
+// TestRateLimit checks that a user is told to wait while an image is still
+// being generated, then runs out of prompts for the hour and is told how
+// long to wait. A prompt refused for lack of credits doesn't count.
+func TestRateLimit(t *testing.T) {
+	limits := config.Default().RateLimit
+	limits.Tiers = map[string]config.RateLimitTier{
+		"user": {Prompts: config.Rate{Burst: 3, Every: time.Hour}, InFlight: 1},
+	}
+	provider := &gatedProvider{release: make(chan struct{})}
+	h := bottest.New(t, bottest.Options{RateLimit: &limits, Provider: provider})
+	landscape := h.AddCategory(model.Category{
+		Name:        "Landscape",
+		Description: "Scenery and nature",
+		Emoji:       "🏞️",
+	})
+
+	user := telebot.User{ID: 9001, FirstName: "Abebe", LanguageCode: "en"}
+	chat := h.Chat(user)
+
+	categories := bottest.Reply{
+		Text: "🎨 Choose a category for your image generation:\n\nSelect the type of image you'd like to create!",
+		Keyboard: [][]bottest.Button{
+			{{Text: "🏞️ Landscape", Data: "category_" + landscape.ID.String()}},
+			{{Text: "🔙 Back to Main Menu", Data: "back_to_main"}},
+		},
+		Edit: true,
+	}
+	categorySelected := bottest.Reply{
+		Text: "🏞️ Landscape Category Selected!\n\nScenery and nature\n\n✍️ Now, please describe the image you want to generate:\n\n💡 Examples:\n• A cute golden retriever puppy playing in a sunny meadow\n• A futuristic city with flying cars at night\n• A cozy cottage by a lake with mountains in the background\n\n💬 Type your prompt or use /cancel to go back:",
+		Edit: true,
+	}
+	result := func(prompt string) bottest.Reply {
+		return bottest.Reply{
+			Text: "✅ Image Generated Successfully!\n\n📝 Prompt: " + prompt + "\n📂 Category: Landscape\n🎨 Style: AI Generated\n⏱️ Generation Time: 0 seconds\n\n🖼️ [Placeholder: Your amazing AI-generated image would appear here]\n\n💡 This is a placeholder response. Once AI integration is complete, you'll see your actual generated image here!\n\nWhat would you like to do next?",
+			Keyboard: [][]bottest.Button{
+				{{Text: "🔄 Generate Another", Data: "generate_image"}, {Text: "📊 Use Trending", Data: "trending_prompts"}},
+				{{Text: "💳 My Credits", Data: "my_credits"}, {Text: "🏠 Main Menu", Data: "back_to_main"}},
+			},
+		}
+	}
+
+	mainMenu := bottest.Reply{
+		Text: "Hello Abebe! Welcome to Image Generation Bot! 🎨\n\nI can help you generate amazing images using AI. What would you like to do?\n\nYour current image credits: 2",
+		Keyboard: [][]bottest.Button{
+			{{Text: "🎨 Generate Image", Data: "generate_image"}, {Text: "🎬 Generate Video", Data: "generate_video"}},
+			{{Text: "💳 My Credits", Data: "my_credits"}, {Text: "📊 Trending Prompts", Data: "trending_prompts"}},
+			{{Text: "👥 Invite friends", Data: "invite_friends"}, {Text: "❓ Help", Data: "help"}},
+			{{Text: "🌐 Language", Data: "language"}},
+		},
+	}
+
+	chat.Run(
+		bottest.Send("/start"),
+		bottest.Expect(mainMenu),
+
+		bottest.Click("generate_image"),
+		bottest.Expect(categories),
+		bottest.Click("🏞️ Landscape"),
+		bottest.Expect(categorySelected),
+		bottest.Send("A waterfall in the Simien mountains"),
+		bottest.Expect(bottest.Reply{
+			Text: "⏳ Your image is being generated...\n\n📝 Prompt: A waterfall in the Simien mountains\n📂 Category: Landscape\n\nI will send it here as soon as it is ready.",
+		}),
+
+		// The provider holds the first image, so it is still in flight. Its
+		// credit was taken when it was queued.
+		bottest.Send("/start"),
+		bottest.Expect(bottest.Reply{
+			Text:     strings.Replace(mainMenu.Text, "credits: 2", "credits: 1", 1),
+			Keyboard: mainMenu.Keyboard,
+		}),
+		bottest.Click("generate_image"),
+		bottest.Expect(categories),
+		bottest.Click("🏞️ Landscape"),
+		bottest.Expect(categorySelected),
+		bottest.Send("A market in Harar"),
+		bottest.Expect(bottest.Reply{
+			Text: "⏳ You already have 1 generation in progress. Please wait for it to finish before starting another.",
+		}),
+
+		func(*bottest.Chat) { close(provider.release) },
+		bottest.Expect(result("A waterfall in the Simien mountains")),
+
+		bottest.Click("🔄 Generate Another"),
+		bottest.Expect(categories),
+		bottest.Click("🏞️ Landscape"),
+		bottest.Expect(categorySelected),
+		bottest.Send("A market in Harar"),
+		bottest.Expect(bottest.Reply{
+			Text: "⏳ Your image is being generated...\n\n📝 Prompt: A market in Harar\n📂 Category: Landscape\n\nI will send it here as soon as it is ready.",
+		}),
+		bottest.Expect(result("A market in Harar")),
+
+		// The signup grant is spent, so the next prompt isn't taken
+		bottest.Click("🔄 Generate Another"),
+		bottest.Expect(categories),
+		bottest.Click("🏞️ Landscape"),
+		bottest.Expect(categorySelected),
+		bottest.Send("Lalibela at dawn"),
+		bottest.Expect(bottest.Reply{
+			Text: "❌ Generating an image costs 1 credit. Please deposit credits first.",
+			Keyboard: [][]bottest.Button{
+				{{Text: "💰 Deposit Credits", Data: "deposit_credits"}, {Text: "🏠 Main Menu", Data: "back_to_main"}},
+			},
+		}),
+
+		// With credits, it uses the last prompt of the burst
+		func(*bottest.Chat) { h.GrantCredits(user.ID, 5) },
+		bottest.Send("/start"),
+		bottest.Expect(bottest.Reply{
+			Text:     strings.Replace(mainMenu.Text, "credits: 2", "credits: 5", 1),
+			Keyboard: mainMenu.Keyboard,
+		}),
+		bottest.Click("generate_image"),
+		bottest.Expect(categories),
+		bottest.Click("🏞️ Landscape"),
+		bottest.Expect(categorySelected),
+		bottest.Send("Lalibela at dawn"),
+		bottest.Expect(bottest.Reply{
+			Text: "⏳ Your image is being generated...\n\n📝 Prompt: Lalibela at dawn\n📂 Category: Landscape\n\nI will send it here as soon as it is ready.",
+		}),
+		bottest.Expect(result("Lalibela at dawn")),
+
+		// All three prompts of the burst are used, and the next comes in an
+		// hour
+		bottest.Click("🔄 Generate Another"),
+		bottest.Expect(categories),
+		bottest.Click("🏞️ Landscape"),
+		bottest.Expect(categorySelected),
+		bottest.Send("The Blue Nile falls"),
+		bottest.Expect(bottest.Reply{
+			Text: "⏳ You are sending requests too quickly. Please try again in 3600 seconds.",
+		}),
+	)
+}
+
+// chargedProvider is a PlaceholderProvider whose results are charged like a
+// real model's.
+type chargedProvider struct {
+	generation.PlaceholderProvider
+}
+
+func (p chargedProvider) GenerateImage(ctx context.Context, request *model.ImageGenerationRequest) (*generation.ImageResult, error) {
+	result, err := p.PlaceholderProvider.GenerateImage(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	result.Placeholder = false
+	return result, nil
+}
+
+// gatedProvider is a chargedProvider that holds every image until release
+// is closed.
+type gatedProvider struct {
+	chargedProvider
+	release chan struct{}
+}
+
+func (p *gatedProvider) GenerateImage(ctx context.Context, request *model.ImageGenerationRequest) (*generation.ImageResult, error) {
+	select {
+	case <-p.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return p.chargedProvider.GenerateImage(ctx, request)
+}
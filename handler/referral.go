@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Leul-Michael/image-generation/i18n"
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/Leul-Michael/image-generation/model"
+	referralrepo "github.com/Leul-Michael/image-generation/repository/referral"
+	userrepo "github.com/Leul-Michael/image-generation/repository/user"
+	"github.com/google/uuid"
+	"gopkg.in/telebot.v3"
+)
+
+// referralPrefix marks a /start payload as a referral code, as in
+// t.me/<bot>?start=ref_<code>.
+const referralPrefix = "ref_"
+
+// newReferralCode returns 8 random characters that are valid in a /start
+// payload.
+func newReferralCode() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.EncodeToString(b), nil
+}
+
+// referralLink is the deep link that attributes new users to code.
+func (h *BotHandler) referralLink(code string) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s%s", h.bot.Me.Username, referralPrefix, code)
+}
+
+// attributeReferral records that a user who just signed up came through the
+// invite link with code. Bad codes and self-referrals are ignored, since the
+// user should still get the main menu.
+func (h *BotHandler) attributeReferral(ctx context.Context, user *model.User, code string) {
+	referrer, err := h.repos.Users.GetByReferralCode(ctx, code)
+	if err != nil {
+		if !errors.Is(err, userrepo.ErrNotExist) {
+			h.logger.ErrorContext(ctx, "Failed to look up referral code", logging.Err(err))
+		}
+		return
+	}
+	if referrer.ID == user.ID {
+		return
+	}
+
+	err = h.repos.Referrals.Create(ctx, &model.Referral{ReferrerID: referrer.ID, RefereeID: user.ID})
+	if err != nil && !errors.Is(err, referralrepo.ErrAlreadyReferred) {
+		h.logger.ErrorContext(ctx, "Failed to record referral", "user_id", user.ID, logging.Err(err))
+	}
+}
+
+// rewardReferral pays the referral bonuses if user was referred and has not
+// qualified before. It is called after every purchase and paid generation;
+// only the first one pays.
+func (h *BotHandler) rewardReferral(ctx context.Context, user *model.User) {
+	referral, err := h.repos.Referrals.Reward(ctx, user.ID, h.referral.ReferrerBonus, h.referral.RefereeBonus)
+	if err != nil {
+		if !errors.Is(err, referralrepo.ErrNotExist) {
+			h.logger.ErrorContext(ctx, "Failed to reward referral", "user_id", user.ID, logging.Err(err))
+		}
+		return
+	}
+
+	if bonus := h.referral.ReferrerBonus; bonus > 0 {
+		h.notifyReferral(ctx, referral.Referrer, "referral.referrer_rewarded", bonus, i18n.Params{"name": referral.Referee.FirstName})
+	}
+	if bonus := h.referral.RefereeBonus; bonus > 0 {
+		h.notifyReferral(ctx, referral.Referee, "referral.referee_rewarded", bonus, nil)
+	}
+}
+
+// paidFor reports whether the generation request was charged credits the
+// user paid for. Generations from the daily allowance, the signup grant or
+// bonuses don't qualify for the referral bonus, or inviting yourself would
+// earn credits.
+func (h *BotHandler) paidFor(ctx context.Context, requestID uuid.UUID) bool {
+	paid, err := h.repos.Credits.Paid(ctx, requestID.String())
+	if err != nil {
+		h.logger.ErrorContext(ctx, "Failed to check paid credits", "request_id", requestID, logging.Err(err))
+		return false
+	}
+	return paid
+}
+
+func (h *BotHandler) notifyReferral(ctx context.Context, user model.User, key string, bonus int, params i18n.Params) {
+	recipient, err := telegramRecipient(user)
+	if err != nil {
+		return
+	}
+
+	t := h.i18n.For(user.Lang)
+	if _, err := h.bot.Send(recipient, t.N(key, bonus, params)); err != nil {
+		h.logger.WarnContext(ctx, "Failed to send referral bonus message", "user_id", user.ID, logging.Err(err))
+	}
+}
+
+func (h *BotHandler) handleInviteFriends(c telebot.Context) error {
+	t := h.t(c)
+
+	sender := c.Sender()
+	if sender == nil {
+		return fmt.Errorf("failed to get sender information")
+	}
+
+	user, err := h.repos.Users.GetByTelegramID(h.ctx(c), uint(sender.ID))
+	if err != nil {
+		return c.Send(t.T("error.load_user"))
+	}
+
+	code, err := h.referralCode(h.ctx(c), user)
+	if err != nil {
+		h.logger.ErrorContext(h.ctx(c), "Failed to assign referral code", "user_id", user.ID, logging.Err(err))
+		return c.Send(t.T("error.database"))
+	}
+
+	stats, err := h.repos.Referrals.Stats(h.ctx(c), user.ID)
+	if err != nil {
+		h.logger.ErrorContext(h.ctx(c), "Failed to load referral stats", "user_id", user.ID, logging.Err(err))
+		return c.Send(t.T("error.database"))
+	}
+
+	link := h.referralLink(code)
+	share := "https://t.me/share/url?url=" + url.QueryEscape(link) + "&text=" + url.QueryEscape(t.T("referral.share_text"))
+
+	menu := &telebot.ReplyMarkup{
+		InlineKeyboard: [][]telebot.InlineButton{
+			{
+				{Text: t.T("button.share_link"), URL: share},
+			},
+			{
+				{Text: t.T("button.back_to_main"), Data: h.callbacks.Data("back_to_main")},
+			},
+		},
+	}
+
+	message := t.T("referral.screen", i18n.Params{
+		"link":           link,
+		"referrer_bonus": h.referral.ReferrerBonus,
+		"referee_bonus":  h.referral.RefereeBonus,
+		"joined":         stats.Joined,
+		"rewarded":       stats.Rewarded,
+	})
+
+	if c.Callback() != nil {
+		return c.Edit(message, menu, telebot.NoPreview)
+	}
+	return c.Send(message, menu, telebot.NoPreview)
+}
+
+// referralCode returns the user's referral code, creating one the first time.
+func (h *BotHandler) referralCode(ctx context.Context, user *model.User) (string, error) {
+	if user.ReferralCode != nil {
+		return *user.ReferralCode, nil
+	}
+
+	code, err := newReferralCode()
+	if err != nil {
+		return "", err
+	}
+	return h.repos.Users.AssignReferralCode(ctx, user.ID, code)
+}
+
+// referralCodeFrom extracts the code from a /start payload, or returns "".
+func referralCodeFrom(payload string) string {
+	code, ok := strings.CutPrefix(payload, referralPrefix)
+	if !ok {
+		return ""
+	}
+	return code
+}
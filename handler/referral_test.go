@@ -0,0 +1,239 @@
+package handler_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/bottest"
+	"github.com/Leul-Michael/image-generation/config"
+	"github.com/Leul-Michael/image-generation/generation"
+	"github.com/Leul-Michael/image-generation/model"
+	"gopkg.in/telebot.v3"
+)
+
+// TestReferral has a user invite a friend with a referral link. The bonuses
+// are paid when the friend makes a first deposit, and show up in the
+// inviter's stats.
+func TestReferral(t *testing.T) {
+	// Without a signup grant, balances show only what the flow adds
+	h := bottest.New(t, bottest.Options{FreeTier: &config.FreeTierConfig{Timezone: "UTC"}})
+
+	inviter := telebot.User{ID: 5001, FirstName: "Abebe", LanguageCode: "en"}
+	friend := telebot.User{ID: 5002, FirstName: "Kebede", LanguageCode: "en"}
+	inviterChat, friendChat := h.Chat(inviter), h.Chat(friend)
+
+	mainMenu := [][]bottest.Button{
+		{{Text: "🎨 Generate Image", Data: "generate_image"}, {Text: "🎬 Generate Video", Data: "generate_video"}},
+		{{Text: "💳 My Credits", Data: "my_credits"}, {Text: "📊 Trending Prompts", Data: "trending_prompts"}},
+		{{Text: "👥 Invite friends", Data: "invite_friends"}, {Text: "❓ Help", Data: "help"}},
+		{{Text: "🌐 Language", Data: "language"}},
+	}
+	inviteScreen := func(joined, rewarded int) bottest.Reply {
+		return bottest.Reply{
+			Text:     fmt.Sprintf("👥 Invite friends\n\nShare your personal link. When a friend joins through it and then buys credits or generates their first image with paid credits, you both get bonus image credits:\n• You: 2\n• Your friend: 1\n\n🔗 Your link:\nhttps://t.me/test_bot?start=ref_FRIENDS1\n\n👤 Friends joined: %d\n🎁 Bonuses earned: %d", joined, rewarded),
+			Keyboard: [][]bottest.Button{{{Text: "📤 Share link", Data: ""}}, {{Text: "🔙 Back to Main Menu", Data: "back_to_main"}}},
+			Edit:     true,
+		}
+	}
+
+	inviterChat.Run(
+		bottest.Send("/start"),
+		bottest.Expect(bottest.Reply{
+			Text:     "Hello Abebe! Welcome to Image Generation Bot! 🎨\n\nI can help you generate amazing images using AI. What would you like to do?\n\nYour current image credits: 0",
+			Keyboard: mainMenu,
+		}),
+	)
+	h.AssignReferralCode(inviter.ID, "FRIENDS1")
+	inviterChat.Run(
+		bottest.Click("invite_friends"),
+		bottest.Expect(inviteScreen(0, 0)),
+	)
+
+	friendChat.Run(
+		bottest.Send("/start ref_FRIENDS1"),
+		bottest.Expect(bottest.Reply{
+			Text:     "Hello Kebede! Welcome to Image Generation Bot! 🎨\n\nI can help you generate amazing images using AI. What would you like to do?\n\nYour current image credits: 0",
+			Keyboard: mainMenu,
+		}),
+		bottest.Click("my_credits"),
+		bottest.Expect(bottest.Reply{
+			Text: "💳 Your Credit Balance:\n\n🎨 Image Credits: 0\n🎬 Video Credits: 0\n\n💡 Credit Pricing:\n• 10 etb = 1 Image Credit\n• 20 etb = 2 Image Credits\n• 30 etb = 3 Image Credits\n• And so on...\n• 50 etb = 1 Video Credit\n\nCredits are used to generate amazing AI images and videos!",
+			Keyboard: [][]bottest.Button{
+				{{Text: "💰 Deposit Credits", Data: "deposit_credits"}, {Text: "⭐ Plans", Data: "plans"}},
+				{{Text: "🎬 Buy Video Credits", Data: "deposit_video"}},
+				{{Text: "🔙 Back to Main Menu", Data: "back_to_main"}},
+			},
+			Edit: true,
+		}),
+		bottest.Click("deposit_credits"),
+		bottest.Expect(bottest.Reply{
+			Text: "💰 Choose Deposit Amount\n\nSelect how much you want to deposit:\n\n💡 Credit Conversion Rate:\n• 10 etb = 1 Image Credit\n\nChoose a preset amount or enter a custom amount:",
+			Keyboard: [][]bottest.Button{
+				{{Text: "10 credits", Data: "deposit_10"}, {Text: "50 credits", Data: "deposit_50"}},
+				{{Text: "100 credits", Data: "deposit_100"}, {Text: "200 credits", Data: "deposit_200"}},
+				{{Text: "✏️ Custom Amount", Data: "deposit_custom"}},
+				{{Text: "🔙 Back to Credits", Data: "my_credits"}},
+			},
+			Edit: true,
+		}),
+		bottest.Click("deposit_10"),
+		bottest.Expect(bottest.Reply{
+			Text: "✅ Deposit Successful!\n\n💰 Amount Deposited: 10 etb\n🎨 Credits Added: 1\n\n💳 Your New Balance: 1 credit",
+			Keyboard: [][]bottest.Button{
+				{{Text: "💳 View Credits", Data: "my_credits"}, {Text: "🏠 Main Menu", Data: "back_to_main"}},
+			},
+		}),
+		bottest.Expect(bottest.Reply{Text: "🎁 Thanks for joining through an invite! You received 1 bonus credit."}),
+	)
+
+	inviterChat.Run(
+		bottest.Expect(bottest.Reply{Text: "🎉 Kebede joined through your invite and got started. You received 2 bonus credits!"}),
+		bottest.Click("back_to_main"),
+		bottest.Expect(bottest.Reply{
+			Text:     "Hello Abebe! Welcome to Image Generation Bot! 🎨\n\nI can help you generate amazing images using AI. What would you like to do?\n\nYour current image credits: 2",
+			Keyboard: mainMenu,
+			Edit:     true,
+		}),
+		bottest.Click("invite_friends"),
+		bottest.Expect(inviteScreen(1, 1)),
+	)
+
+	// A second deposit does not pay the bonus again
+	friendChat.Run(
+		bottest.Click("my_credits"),
+		bottest.Expect(bottest.Reply{
+			Text: "💳 Your Credit Balance:\n\n🎨 Image Credits: 2\n🎬 Video Credits: 0\n\n💡 Credit Pricing:\n• 10 etb = 1 Image Credit\n• 20 etb = 2 Image Credits\n• 30 etb = 3 Image Credits\n• And so on...\n• 50 etb = 1 Video Credit\n\nCredits are used to generate amazing AI images and videos!\n\n⏳ Expiring credits:\n• 1 credit on " + time.Now().Add(config.Default().Credits.BonusExpiry).Format("2006-01-02"),
+			Keyboard: [][]bottest.Button{
+				{{Text: "💰 Deposit Credits", Data: "deposit_credits"}, {Text: "⭐ Plans", Data: "plans"}},
+				{{Text: "🎬 Buy Video Credits", Data: "deposit_video"}},
+				{{Text: "🔙 Back to Main Menu", Data: "back_to_main"}},
+			},
+			Edit: true,
+		}),
+		bottest.Click("deposit_credits"),
+		bottest.Expect(bottest.Reply{
+			Text: "💰 Choose Deposit Amount\n\nSelect how much you want to deposit:\n\n💡 Credit Conversion Rate:\n• 10 etb = 1 Image Credit\n\nChoose a preset amount or enter a custom amount:",
+			Keyboard: [][]bottest.Button{
+				{{Text: "10 credits", Data: "deposit_10"}, {Text: "50 credits", Data: "deposit_50"}},
+				{{Text: "100 credits", Data: "deposit_100"}, {Text: "200 credits", Data: "deposit_200"}},
+				{{Text: "✏️ Custom Amount", Data: "deposit_custom"}},
+				{{Text: "🔙 Back to Credits", Data: "my_credits"}},
+			},
+			Edit: true,
+		}),
+		bottest.Click("deposit_10"),
+		bottest.Expect(bottest.Reply{
+			Text: "✅ Deposit Successful!\n\n💰 Amount Deposited: 10 etb\n🎨 Credits Added: 1\n\n💳 Your New Balance: 3 credits",
+			Keyboard: [][]bottest.Button{
+				{{Text: "💳 View Credits", Data: "my_credits"}, {Text: "🏠 Main Menu", Data: "back_to_main"}},
+			},
+		}),
+	)
+	friendChat.ExpectNone(100 * time.Millisecond)
+	inviterChat.ExpectNone(0)
+}
+
+// photoProvider returns the same image for every request.
+type photoProvider struct{}
+
+func (photoProvider) Name() string { return "test" }
+
+func (photoProvider) GenerateImage(ctx context.Context, request *model.ImageGenerationRequest) (*generation.ImageResult, error) {
+	return &generation.ImageResult{ImageURL: "https://example.com/image.png", Model: "test"}, nil
+}
+
+// TestReferralPaidGeneration has a referred friend generate from the daily
+// allowance and then with the signup grant, neither of which pays the
+// referral bonuses, and then with credits they bought, which does.
+func TestReferralPaidGeneration(t *testing.T) {
+	h := bottest.New(t, bottest.Options{
+		FreeTier: &config.FreeTierConfig{SignupGrant: 1, DailyGenerations: 1, Timezone: "UTC"},
+		Provider: photoProvider{},
+	})
+	landscape := h.AddCategory(model.Category{Name: "Landscape", Description: "Scenery and nature", Emoji: "🏞️"})
+
+	inviter := telebot.User{ID: 5101, FirstName: "Abebe", LanguageCode: "en"}
+	friend := telebot.User{ID: 5102, FirstName: "Kebede", LanguageCode: "en"}
+	inviterChat, friendChat := h.Chat(inviter), h.Chat(friend)
+
+	mainMenu := [][]bottest.Button{
+		{{Text: "🎨 Generate Image", Data: "generate_image"}, {Text: "🎬 Generate Video", Data: "generate_video"}},
+		{{Text: "💳 My Credits", Data: "my_credits"}, {Text: "📊 Trending Prompts", Data: "trending_prompts"}},
+		{{Text: "👥 Invite friends", Data: "invite_friends"}, {Text: "❓ Help", Data: "help"}},
+		{{Text: "🌐 Language", Data: "language"}},
+	}
+	welcome := func(name string, credits, free int) bottest.Reply {
+		return bottest.Reply{
+			Text:     fmt.Sprintf("Hello %s! Welcome to Image Generation Bot! 🎨\n\nI can help you generate amazing images using AI. What would you like to do?\n\nYour current image credits: %d\n🎁 Free generations left today: %d", name, credits, free),
+			Keyboard: mainMenu,
+		}
+	}
+	generate := func(credits, free int, prompt string) []bottest.Step {
+		return []bottest.Step{
+			bottest.Send("/start"),
+			bottest.Expect(welcome("Kebede", credits, free)),
+			bottest.Click("generate_image"),
+			bottest.Expect(bottest.Reply{
+				Text:     "🎨 Choose a category for your image generation:\n\nSelect the type of image you'd like to create!",
+				Keyboard: [][]bottest.Button{{{Text: "🏞️ Landscape", Data: "category_" + landscape.ID.String()}}, {{Text: "🔙 Back to Main Menu", Data: "back_to_main"}}},
+				Edit:     true,
+			}),
+			bottest.Click("🏞️ Landscape"),
+			bottest.Expect(bottest.Reply{
+				Text: "🏞️ Landscape Category Selected!\n\nScenery and nature\n\n✍️ Now, please describe the image you want to generate:\n\n💡 Examples:\n• A cute golden retriever puppy playing in a sunny meadow\n• A futuristic city with flying cars at night\n• A cozy cottage by a lake with mountains in the background\n\n💬 Type your prompt or use /cancel to go back:",
+				Edit: true,
+			}),
+			bottest.Send(prompt),
+			bottest.Expect(bottest.Reply{
+				Text: fmt.Sprintf("⏳ Your image is being generated...\n\n📝 Prompt: %s\n📂 Category: Landscape\n\nI will send it here as soon as it is ready.", prompt),
+			}),
+			bottest.Expect(bottest.Reply{
+				Text:  fmt.Sprintf("✅ Image Generated Successfully!\n\n📝 Prompt: %s\n📂 Category: Landscape\n⏱️ Generation Time: 0 seconds", prompt),
+				Photo: "https://example.com/image.png",
+				Keyboard: [][]bottest.Button{
+					{{Text: "🔄 Generate Another", Data: "generate_image"}, {Text: "📊 Use Trending", Data: "trending_prompts"}},
+					{{Text: "💳 My Credits", Data: "my_credits"}, {Text: "🏠 Main Menu", Data: "back_to_main"}},
+				},
+			}),
+		}
+	}
+
+	inviterChat.Run(
+		bottest.Send("/start"),
+		bottest.Expect(welcome("Abebe", 1, 1)),
+	)
+	h.AssignReferralCode(inviter.ID, "FRIENDS1")
+
+	friendChat.Run(
+		bottest.Send("/start ref_FRIENDS1"),
+		bottest.Expect(welcome("Kebede", 1, 1)),
+	)
+	friendChat.Run(generate(1, 1, "A waterfall in the Simien mountains")...)
+	friendChat.Run(generate(1, 0, "A market in Harar")...)
+	friendChat.ExpectNone(100 * time.Millisecond)
+	inviterChat.ExpectNone(0)
+
+	friendUser, err := h.Repos.Users.GetByTelegramID(context.Background(), uint(friend.ID))
+	if err != nil {
+		t.Fatalf("GetByTelegramID: %v", err)
+	}
+	if _, err := h.Repos.Credits.Apply(context.Background(), &model.Transaction{
+		UserID:      friendUser.ID,
+		CreditType:  model.CreditTypeImage,
+		Amount:      1,
+		Type:        model.TransactionTypePurchase,
+		Description: "Bought in test",
+	}); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	friendChat.Run(generate(1, 0, "Lalibela at dawn")...)
+	friendChat.Run(
+		bottest.Expect(bottest.Reply{Text: "🎁 Thanks for joining through an invite! You received 1 bonus credit."}),
+	)
+	inviterChat.Run(
+		bottest.Expect(bottest.Reply{Text: "🎉 Kebede joined through your invite and got started. You received 2 bonus credits!"}),
+	)
+}
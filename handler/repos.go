@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"github.com/Leul-Michael/image-generation/config"
+	authtokenrepo "github.com/Leul-Michael/image-generation/repository/authtoken"
+	categoryrepo "github.com/Leul-Michael/image-generation/repository/category"
+	creditrepo "github.com/Leul-Michael/image-generation/repository/credit"
+	enhancementrepo "github.com/Leul-Michael/image-generation/repository/enhancement"
+	idempotencyrepo "github.com/Leul-Michael/image-generation/repository/idempotency"
+	imagerepo "github.com/Leul-Michael/image-generation/repository/image"
+	promorepo "github.com/Leul-Michael/image-generation/repository/promo"
+	referralrepo "github.com/Leul-Michael/image-generation/repository/referral"
+	requestrepo "github.com/Leul-Michael/image-generation/repository/request"
+	staterepo "github.com/Leul-Michael/image-generation/repository/state"
+	subscriptionrepo "github.com/Leul-Michael/image-generation/repository/subscription"
+	txrepo "github.com/Leul-Michael/image-generation/repository/transaction"
+	trendingrepo "github.com/Leul-Michael/image-generation/repository/trending"
+	userrepo "github.com/Leul-Michael/image-generation/repository/user"
+	videorepo "github.com/Leul-Michael/image-generation/repository/video"
+	"gorm.io/gorm"
+)
+
+// Repos are the stores the handlers read and write through. Tests can use
+// NewMemoryRepos instead of a database.
+type Repos struct {
+	Users           userrepo.UserRepo
+	Categories      categoryrepo.CategoryRepo
+	TrendingPrompts trendingrepo.TrendingPromptRepo
+	Images          imagerepo.GeneratedImageRepo
+	Requests        requestrepo.ImageGenerationRequestRepo
+	Transactions    txrepo.TransactionRepo
+	Credits         creditrepo.UserCreditRepo
+	Enhancements    enhancementrepo.PromptEnhancementRepo
+	AuthTokens      authtokenrepo.AuthTokenRepo
+	Referrals       referralrepo.ReferralRepo
+	PromoCodes      promorepo.PromoCodeRepo
+	Subscriptions   subscriptionrepo.SubscriptionRepo
+	VideoRequests   videorepo.VideoGenerationRequestRepo
+	Idempotency     idempotencyrepo.IdempotencyKeyRepo
+	States          staterepo.ConversationStateRepo
+}
+
+// NewPostgresRepos returns the database-backed stores. New users get the
+// signup grant of freeTier, and bonus credits expire as credits says.
+func NewPostgresRepos(db *gorm.DB, freeTier config.FreeTierConfig, credits config.CreditsConfig) Repos {
+	return Repos{
+		Users:           &userrepo.PostgresUserRepo{DB: db, SignupGrant: freeTier.SignupGrant, BonusExpiry: credits.BonusExpiry},
+		Categories:      &categoryrepo.PostgresCategoryRepo{DB: db},
+		TrendingPrompts: &trendingrepo.PostgresTrendingPromptRepo{DB: db},
+		Images:          &imagerepo.PostgresGeneratedImageRepo{DB: db},
+		Requests:        &requestrepo.PostgresImageGenerationRequestRepo{DB: db},
+		Transactions:    &txrepo.PostgresTransactionRepo{DB: db},
+		Credits:         &creditrepo.PostgresUserCreditRepo{DB: db},
+		Enhancements:    &enhancementrepo.PostgresPromptEnhancementRepo{DB: db},
+		AuthTokens:      &authtokenrepo.PostgresAuthTokenRepo{DB: db},
+		Referrals:       &referralrepo.PostgresReferralRepo{DB: db, BonusExpiry: credits.BonusExpiry},
+		PromoCodes:      &promorepo.PostgresPromoCodeRepo{DB: db, BonusExpiry: credits.BonusExpiry},
+		Subscriptions:   &subscriptionrepo.PostgresSubscriptionRepo{DB: db},
+		VideoRequests:   &videorepo.PostgresVideoGenerationRequestRepo{DB: db},
+		Idempotency:     &idempotencyrepo.PostgresIdempotencyKeyRepo{DB: db},
+		States:          &staterepo.PostgresConversationStateRepo{DB: db},
+	}
+}
+
+// NewMemoryRepos returns in-memory fakes that share state the way the
+// Postgres tables do: credit changes show up in Transactions and in each
+// user's UserCredits.
+func NewMemoryRepos(freeTier config.FreeTierConfig, creditsConfig config.CreditsConfig) Repos {
+	transactions := txrepo.NewMemoryTransactionRepo()
+	credits := creditrepo.NewMemoryUserCreditRepo(transactions)
+	categories := categoryrepo.NewMemoryCategoryRepo()
+	users := userrepo.NewMemoryUserRepo(credits)
+	users.SignupGrant, users.BonusExpiry = freeTier.SignupGrant, creditsConfig.BonusExpiry
+	images := imagerepo.NewMemoryGeneratedImageRepo()
+	referrals := referralrepo.NewMemoryReferralRepo(users, credits)
+	referrals.BonusExpiry = creditsConfig.BonusExpiry
+	promoCodes := promorepo.NewMemoryPromoCodeRepo(credits)
+	promoCodes.BonusExpiry = creditsConfig.BonusExpiry
+	requests := requestrepo.NewMemoryImageGenerationRequestRepo(users, categories, images, credits)
+	videoRequests := videorepo.NewMemoryVideoGenerationRequestRepo(users, credits)
+	requests.Videos, videoRequests.Images = videoRequests, requests
+
+	return Repos{
+		Users:           users,
+		Categories:      categories,
+		TrendingPrompts: trendingrepo.NewMemoryTrendingPromptRepo(categories),
+		Images:          images,
+		Requests:        requests,
+		Transactions:    transactions,
+		Credits:         credits,
+		Enhancements:    enhancementrepo.NewMemoryPromptEnhancementRepo(credits),
+		AuthTokens:      authtokenrepo.NewMemoryAuthTokenRepo(),
+		Referrals:       referrals,
+		PromoCodes:      promoCodes,
+		Subscriptions:   subscriptionrepo.NewMemorySubscriptionRepo(users, credits),
+		VideoRequests:   videoRequests,
+		Idempotency:     idempotencyrepo.NewMemoryIdempotencyKeyRepo(),
+		States:          staterepo.NewMemoryConversationStateRepo(),
+	}
+}
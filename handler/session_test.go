@@ -0,0 +1,64 @@
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/auth"
+	"github.com/Leul-Michael/image-generation/config"
+	"github.com/Leul-Michael/image-generation/handler"
+	"github.com/Leul-Michael/image-generation/model"
+	"github.com/gin-gonic/gin"
+)
+
+// TestWithSessionRevoked checks that a password change signs out sessions
+// issued before it.
+func TestWithSessionRevoked(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	defaults := config.Default()
+	repos := handler.NewMemoryRepos(defaults.FreeTier, defaults.Credits)
+	sessions := auth.NewSessions([]byte("secret"), time.Hour)
+
+	email := "abebe@example.com"
+	user := model.User{FirstName: "Abebe", Email: &email}
+	if err := repos.Users.Register(ctx, &user); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	router := gin.New()
+	router.GET("/me", handler.WithSession(sessions, repos, true), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	get := func(token string) int {
+		request := httptest.NewRequest(http.MethodGet, "/me", nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	old, _ := sessions.Issue(user.ID, user.SessionVersion)
+	if code := get(old); code != http.StatusNoContent {
+		t.Fatalf("before the password change: status %d, want %d", code, http.StatusNoContent)
+	}
+
+	if err := repos.Users.ChangePassword(ctx, user.ID, "new hash"); err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+	if code := get(old); code != http.StatusUnauthorized {
+		t.Errorf("old session after the password change: status %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	changed, err := repos.Users.GetById(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetById: %v", err)
+	}
+	current, _ := sessions.Issue(changed.ID, changed.SessionVersion)
+	if code := get(current); code != http.StatusNoContent {
+		t.Errorf("new session: status %d, want %d", code, http.StatusNoContent)
+	}
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/Leul-Michael/image-generation/model"
+	staterepo "github.com/Leul-Michael/image-generation/repository/state"
+	"gopkg.in/telebot.v3"
+)
+
+// state returns where the sender is in a bot flow, or nil if they are in
+// none. Changes to it are kept only once passed to setState.
+func (h *BotHandler) state(c telebot.Context) *model.ConversationState {
+	state, err := h.repos.States.Get(h.ctx(c), c.Sender().ID)
+	if err != nil {
+		if !errors.Is(err, staterepo.ErrNotExist) {
+			h.logger.ErrorContext(h.ctx(c), "Failed to load conversation state", "telegram_id", c.Sender().ID, logging.Err(err))
+		}
+		return nil
+	}
+	return state
+}
+
+// setState stores state as where the sender is in a bot flow.
+func (h *BotHandler) setState(c telebot.Context, state *model.ConversationState) error {
+	state.TelegramID = c.Sender().ID
+	return h.repos.States.Save(h.ctx(c), state)
+}
+
+// clearState takes the sender out of any bot flow.
+func (h *BotHandler) clearState(c telebot.Context) {
+	if err := h.repos.States.Delete(h.ctx(c), c.Sender().ID); err != nil {
+		h.logger.ErrorContext(h.ctx(c), "Failed to clear conversation state", "telegram_id", c.Sender().ID, logging.Err(err))
+	}
+}
@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/billing"
+	"github.com/Leul-Michael/image-generation/i18n"
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/Leul-Michael/image-generation/model"
+	subscriptionrepo "github.com/Leul-Michael/image-generation/repository/subscription"
+	"github.com/google/uuid"
+	"gopkg.in/telebot.v3"
+)
+
+// dateFormat is how period dates are shown to users.
+const dateFormat = "2006-01-02"
+
+// subscription returns the user's live subscription, or nil if they have
+// none or it can't be loaded.
+func (h *BotHandler) subscription(ctx context.Context, userID uuid.UUID) *model.Subscription {
+	sub, err := h.repos.Subscriptions.Current(ctx, userID)
+	if err != nil {
+		if !errors.Is(err, subscriptionrepo.ErrNotExist) {
+			h.logger.ErrorContext(ctx, "Failed to load subscription", "user_id", userID, logging.Err(err))
+		}
+		return nil
+	}
+	return sub
+}
+
+// premiumLocked reports whether category is premium and sub, which may be
+// nil, doesn't include premium categories.
+func premiumLocked(category *model.Category, sub *model.Subscription) bool {
+	return category.IsPremium && (sub == nil || !sub.Plan.PremiumCategories)
+}
+
+// sendPremiumRequired tells the user a category needs a plan, offering the
+// plans screen.
+func (h *BotHandler) sendPremiumRequired(c telebot.Context) error {
+	t := h.t(c)
+	menu := &telebot.ReplyMarkup{
+		InlineKeyboard: [][]telebot.InlineButton{
+			{
+				{Text: t.T("button.plans"), Data: h.callbacks.Data("plans")},
+				{Text: t.T("button.main_menu"), Data: h.callbacks.Data("back_to_main")},
+			},
+		},
+	}
+
+	if c.Callback() != nil {
+		return c.Edit(t.T("plans.premium_required"), menu)
+	}
+	return c.Send(t.T("plans.premium_required"), menu)
+}
+
+func (h *BotHandler) handlePlans(c telebot.Context) error {
+	t := h.t(c)
+	sender := c.Sender()
+	if sender == nil {
+		return fmt.Errorf("failed to get sender information")
+	}
+
+	user, err := h.repos.Users.GetByTelegramID(h.ctx(c), uint(sender.ID))
+	if err != nil {
+		return c.Send(t.T("error.load_user"))
+	}
+
+	plans, err := h.repos.Subscriptions.ListPlans(h.ctx(c))
+	if err != nil {
+		h.logger.ErrorContext(h.ctx(c), "Failed to list plans", logging.Err(err))
+		return c.Send(t.T("error.database"))
+	}
+	sub := h.subscription(h.ctx(c), user.ID)
+
+	var b strings.Builder
+	b.WriteString(t.T("plans.screen"))
+	if len(plans) == 0 {
+		b.WriteString(t.T("plans.none"))
+	}
+	for _, plan := range plans {
+		b.WriteString(planDescription(t, &plan))
+	}
+	if sub != nil {
+		b.WriteString(subscriptionStatus(t, sub))
+	}
+
+	var rows [][]telebot.InlineButton
+	if sub == nil {
+		for _, plan := range plans {
+			rows = append(rows, []telebot.InlineButton{{
+				Text: t.T("button.subscribe", i18n.Params{"name": plan.Name, "price": plan.PriceEtb}),
+				Data: h.callbacks.Data("plan", plan.Code),
+			}})
+		}
+	} else if !sub.CancelAtPeriodEnd {
+		rows = append(rows, []telebot.InlineButton{{Text: t.T("button.cancel_plan"), Data: h.callbacks.Data("plans_cancel")}})
+	}
+	rows = append(rows, []telebot.InlineButton{{Text: t.T("button.back_to_credits"), Data: h.callbacks.Data("my_credits")}})
+
+	menu := &telebot.ReplyMarkup{InlineKeyboard: rows}
+	if c.Callback() != nil {
+		return c.Edit(b.String(), menu)
+	}
+	return c.Send(b.String(), menu)
+}
+
+func planDescription(t *i18n.Localizer, plan *model.Plan) string {
+	description := t.N("plans.item", plan.MonthlyCredits, i18n.Params{
+		"name":  plan.Name,
+		"price": plan.PriceEtb,
+	})
+	if plan.MaxRollover > 0 {
+		description += t.N("plans.item_rollover", plan.MaxRollover)
+	}
+	if plan.Priority > 0 {
+		description += t.T("plans.item_priority")
+	}
+	if plan.PremiumCategories {
+		description += t.T("plans.item_premium")
+	}
+	return description
+}
+
+func subscriptionStatus(t *i18n.Localizer, sub *model.Subscription) string {
+	params := i18n.Params{"name": sub.Plan.Name, "date": sub.CurrentPeriodEnd.Format(dateFormat)}
+	switch {
+	case sub.Status == model.SubscriptionStatusPastDue && sub.GraceUntil != nil:
+		params["date"] = sub.GraceUntil.Format(dateFormat)
+		return t.T("plans.status_past_due", params)
+	case sub.CancelAtPeriodEnd:
+		return t.T("plans.status_canceling", params)
+	default:
+		return t.T("plans.status_active", params)
+	}
+}
+
+// handleSubscribe subscribes the user to the plan with code. Like deposits,
+// the first month is granted without a payment step for now.
+func (h *BotHandler) handleSubscribe(c telebot.Context, code string) error {
+	t := h.t(c)
+	sender := c.Sender()
+	if sender == nil {
+		return fmt.Errorf("failed to get sender information")
+	}
+
+	user, err := h.repos.Users.GetByTelegramID(h.ctx(c), uint(sender.ID))
+	if err != nil {
+		return c.Send(t.T("error.load_user"))
+	}
+
+	plan, err := h.repos.Subscriptions.GetPlan(h.ctx(c), code)
+	if err != nil || !plan.IsActive {
+		return c.Send(t.T("plans.unavailable"))
+	}
+
+	sub, grant, err := h.repos.Subscriptions.Subscribe(h.ctx(c), user.ID, plan, time.Now())
+	if errors.Is(err, subscriptionrepo.ErrAlreadySubscribed) {
+		return c.Send(t.T("plans.already_subscribed"))
+	}
+	if err != nil {
+		h.logger.ErrorContext(h.ctx(c), "Failed to subscribe", "user_id", user.ID, "plan", plan.Code, logging.Err(err))
+		return c.Send(t.T("error.database"))
+	}
+
+	menu := &telebot.ReplyMarkup{
+		InlineKeyboard: [][]telebot.InlineButton{
+			{
+				{Text: t.T("button.view_credits"), Data: h.callbacks.Data("my_credits")},
+				{Text: t.T("button.main_menu"), Data: h.callbacks.Data("back_to_main")},
+			},
+		},
+	}
+
+	return c.Edit(t.N("plans.subscribed", grant.BalanceAfter, i18n.Params{
+		"name":    plan.Name,
+		"credits": grant.Amount,
+		"date":    sub.CurrentPeriodEnd.Format(dateFormat),
+	}), menu)
+}
+
+func (h *BotHandler) handleCancelPlan(c telebot.Context) error {
+	t := h.t(c)
+	sender := c.Sender()
+	if sender == nil {
+		return fmt.Errorf("failed to get sender information")
+	}
+
+	user, err := h.repos.Users.GetByTelegramID(h.ctx(c), uint(sender.ID))
+	if err != nil {
+		return c.Send(t.T("error.load_user"))
+	}
+
+	sub, err := h.repos.Subscriptions.Cancel(h.ctx(c), user.ID)
+	if errors.Is(err, subscriptionrepo.ErrNotExist) {
+		return c.Send(t.T("plans.not_subscribed"))
+	}
+	if err != nil {
+		h.logger.ErrorContext(h.ctx(c), "Failed to cancel subscription", "user_id", user.ID, logging.Err(err))
+		return c.Send(t.T("error.database"))
+	}
+
+	menu := &telebot.ReplyMarkup{
+		InlineKeyboard: [][]telebot.InlineButton{
+			{{Text: t.T("button.main_menu"), Data: h.callbacks.Data("back_to_main")}},
+		},
+	}
+	return c.Edit(t.T("plans.canceled", i18n.Params{
+		"name": sub.Plan.Name,
+		"date": sub.CurrentPeriodEnd.Format(dateFormat),
+	}), menu)
+}
+
+// NotifySubscription tells the user about a renewal. It implements
+// billing.Notifier.
+func (h *BotHandler) NotifySubscription(ctx context.Context, sub *model.Subscription, event billing.Event, grant *model.Transaction) error {
+	recipient, err := telegramRecipient(sub.User)
+	if err != nil {
+		return err
+	}
+	t := h.i18n.For(sub.User.Lang)
+
+	params := i18n.Params{"name": sub.Plan.Name}
+	var message string
+	switch event {
+	case billing.EventRenewed:
+		params["date"] = sub.CurrentPeriodEnd.Format(dateFormat)
+		message = t.N("plans.renewed", grant.Amount, params)
+	case billing.EventPastDue:
+		params["date"] = sub.GraceUntil.Format(dateFormat)
+		message = t.T("plans.past_due", params)
+	case billing.EventEnded:
+		if sub.Status == model.SubscriptionStatusExpired {
+			message = t.T("plans.expired", params)
+		} else {
+			message = t.T("plans.ended", params)
+		}
+	default:
+		return nil
+	}
+
+	_, err = h.bot.Send(recipient, message)
+	return err
+}
@@ -0,0 +1,234 @@
+package handler_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/bottest"
+	"github.com/Leul-Michael/image-generation/config"
+	"github.com/Leul-Michael/image-generation/model"
+	"gopkg.in/telebot.v3"
+)
+
+// TestSubscription has a user subscribe to a plan to unlock a premium
+// category, then follows two subscribers through the end of their first
+// month: one renews with part of the allowance rolled over, the other
+// cancels and loses it.
+func TestSubscription(t *testing.T) {
+	h := bottest.New(t, bottest.Options{FreeTier: &config.FreeTierConfig{Timezone: "UTC"}})
+	h.AddPlan(model.Plan{
+		Code:              "pro",
+		Name:              "Pro",
+		PriceEtb:          300,
+		MonthlyCredits:    40,
+		MaxRollover:       10,
+		Priority:          1,
+		PremiumCategories: true,
+	})
+	studio := h.AddCategory(model.Category{
+		Name:        "Studio",
+		Description: "Studio lighting and backdrops",
+		Emoji:       "📸",
+		IsPremium:   true,
+	})
+
+	renewing := telebot.User{ID: 8001, FirstName: "Abebe", LanguageCode: "en"}
+	canceling := telebot.User{ID: 8002, FirstName: "Kebede", LanguageCode: "en"}
+	renewingChat, cancelingChat := h.Chat(renewing), h.Chat(canceling)
+
+	started := time.Now()
+	firstEnd := model.NextPeriodEnd(started).Format("2006-01-02")
+	secondEnd := model.NextPeriodEnd(model.NextPeriodEnd(started)).Format("2006-01-02")
+
+	plansScreen := "⭐ Subscription plans\n\nGet image credits every month, plus extras:\n\nPro: 300 etb/month\n• 40 image credits a month\n• Up to 10 unused credits roll over to the next month\n• Priority in the generation queue\n• Premium categories 💎"
+	// Plan credits are listed as expiring at the end of their period
+	creditsScreen := func(credits int, periodEnd string) bottest.Reply {
+		text := fmt.Sprintf("💳 Your Credit Balance:\n\n🎨 Image Credits: %d\n🎬 Video Credits: 0\n\n💡 Credit Pricing:\n• 10 etb = 1 Image Credit\n• 20 etb = 2 Image Credits\n• 30 etb = 3 Image Credits\n• And so on...\n• 50 etb = 1 Video Credit\n\nCredits are used to generate amazing AI images and videos!", credits)
+		if credits > 0 {
+			text += fmt.Sprintf("\n\n⏳ Expiring credits:\n• %d credits on %s", credits, periodEnd)
+		}
+		return bottest.Reply{
+			Text: text,
+			Keyboard: [][]bottest.Button{
+				{{Text: "💰 Deposit Credits", Data: "deposit_credits"}, {Text: "⭐ Plans", Data: "plans"}},
+				{{Text: "🎬 Buy Video Credits", Data: "deposit_video"}},
+				{{Text: "🔙 Back to Main Menu", Data: "back_to_main"}},
+			},
+			Edit: true,
+		}
+	}
+	subscribed := bottest.Reply{
+		Text: fmt.Sprintf("✅ You are now on the Pro plan!\n\n🎨 Credits Added: 40\n💳 Your New Balance: 40 credits\n📅 Renews on: %s", firstEnd),
+		Keyboard: [][]bottest.Button{
+			{{Text: "💳 View Credits", Data: "my_credits"}, {Text: "🏠 Main Menu", Data: "back_to_main"}},
+		},
+		Edit: true,
+	}
+
+	renewingChat.Run(
+		bottest.Send("/start"),
+		bottest.Expect(bottest.Reply{
+			Text: "Hello Abebe! Welcome to Image Generation Bot! 🎨\n\nI can help you generate amazing images using AI. What would you like to do?\n\nYour current image credits: 0",
+			Keyboard: [][]bottest.Button{
+				{{Text: "🎨 Generate Image", Data: "generate_image"}, {Text: "🎬 Generate Video", Data: "generate_video"}},
+				{{Text: "💳 My Credits", Data: "my_credits"}, {Text: "📊 Trending Prompts", Data: "trending_prompts"}},
+				{{Text: "👥 Invite friends", Data: "invite_friends"}, {Text: "❓ Help", Data: "help"}},
+				{{Text: "🌐 Language", Data: "language"}},
+			},
+		}),
+
+		// Premium categories are marked, and locked without a plan
+		bottest.Click("generate_image"),
+		bottest.Expect(bottest.Reply{
+			Text: "🎨 Choose a category for your image generation:\n\nSelect the type of image you'd like to create!",
+			Keyboard: [][]bottest.Button{
+				{{Text: "📸 Studio 💎", Data: "category_" + studio.ID.String()}},
+				{{Text: "🔙 Back to Main Menu", Data: "back_to_main"}},
+			},
+			Edit: true,
+		}),
+		bottest.Click("📸 Studio 💎"),
+		bottest.Expect(bottest.Reply{
+			Text: "💎 This category is only available with a plan that includes premium categories.",
+			Keyboard: [][]bottest.Button{
+				{{Text: "⭐ Plans", Data: "plans"}, {Text: "🏠 Main Menu", Data: "back_to_main"}},
+			},
+			Edit: true,
+		}),
+
+		bottest.Click("plans"),
+		bottest.Expect(bottest.Reply{
+			Text: plansScreen,
+			Keyboard: [][]bottest.Button{
+				{{Text: "⭐ Pro: 300 etb/month", Data: "plan_pro"}},
+				{{Text: "🔙 Back to Credits", Data: "my_credits"}},
+			},
+			Edit: true,
+		}),
+		bottest.Click("plan_pro"),
+		bottest.Expect(subscribed),
+
+		bottest.Click("my_credits"),
+		bottest.Expect(creditsScreen(40, firstEnd)),
+		bottest.Click("plans"),
+		bottest.Expect(bottest.Reply{
+			Text: plansScreen + fmt.Sprintf("\n\n✅ You are on the Pro plan. It renews on %s.", firstEnd),
+			Keyboard: [][]bottest.Button{
+				{{Text: "❌ Cancel subscription", Data: "plans_cancel"}},
+				{{Text: "🔙 Back to Credits", Data: "my_credits"}},
+			},
+			Edit: true,
+		}),
+
+		// The plan opens the premium category
+		bottest.Click("🔙 Back to Credits"),
+		bottest.Expect(creditsScreen(40, firstEnd)),
+		bottest.Click("back_to_main"),
+		bottest.Expect(bottest.Reply{
+			Text: "Hello Abebe! Welcome to Image Generation Bot! 🎨\n\nI can help you generate amazing images using AI. What would you like to do?\n\nYour current image credits: 40",
+			Keyboard: [][]bottest.Button{
+				{{Text: "🎨 Generate Image", Data: "generate_image"}, {Text: "🎬 Generate Video", Data: "generate_video"}},
+				{{Text: "💳 My Credits", Data: "my_credits"}, {Text: "📊 Trending Prompts", Data: "trending_prompts"}},
+				{{Text: "👥 Invite friends", Data: "invite_friends"}, {Text: "❓ Help", Data: "help"}},
+				{{Text: "🌐 Language", Data: "language"}},
+			},
+			Edit: true,
+		}),
+		bottest.Click("generate_image"),
+		bottest.Expect(bottest.Reply{
+			Text: "🎨 Choose a category for your image generation:\n\nSelect the type of image you'd like to create!",
+			Keyboard: [][]bottest.Button{
+				{{Text: "📸 Studio 💎", Data: "category_" + studio.ID.String()}},
+				{{Text: "🔙 Back to Main Menu", Data: "back_to_main"}},
+			},
+			Edit: true,
+		}),
+		bottest.Click("📸 Studio 💎"),
+		bottest.Expect(bottest.Reply{
+			Text: "📸 Studio Category Selected!\n\nStudio lighting and backdrops\n\n✍️ Now, please describe the image you want to generate:\n\n💡 Examples:\n• A cute golden retriever puppy playing in a sunny meadow\n• A futuristic city with flying cars at night\n• A cozy cottage by a lake with mountains in the background\n\n💬 Type your prompt or use /cancel to go back:",
+			Edit: true,
+		}),
+		bottest.Send("/cancel"),
+		bottest.Expect(bottest.Reply{
+			Text:     "❌ Operation cancelled.\n\nReturning to main menu...",
+			Keyboard: [][]bottest.Button{{{Text: "🏠 Main Menu", Data: "back_to_main"}}},
+		}),
+	)
+
+	cancelingChat.Run(
+		bottest.Send("/start"),
+		bottest.Expect(bottest.Reply{
+			Text: "Hello Kebede! Welcome to Image Generation Bot! 🎨\n\nI can help you generate amazing images using AI. What would you like to do?\n\nYour current image credits: 0",
+			Keyboard: [][]bottest.Button{
+				{{Text: "🎨 Generate Image", Data: "generate_image"}, {Text: "🎬 Generate Video", Data: "generate_video"}},
+				{{Text: "💳 My Credits", Data: "my_credits"}, {Text: "📊 Trending Prompts", Data: "trending_prompts"}},
+				{{Text: "👥 Invite friends", Data: "invite_friends"}, {Text: "❓ Help", Data: "help"}},
+				{{Text: "🌐 Language", Data: "language"}},
+			},
+		}),
+		bottest.Click("my_credits"),
+		bottest.Expect(creditsScreen(0, firstEnd)),
+		bottest.Click("plans"),
+		bottest.Expect(bottest.Reply{
+			Text: plansScreen,
+			Keyboard: [][]bottest.Button{
+				{{Text: "⭐ Pro: 300 etb/month", Data: "plan_pro"}},
+				{{Text: "🔙 Back to Credits", Data: "my_credits"}},
+			},
+			Edit: true,
+		}),
+		bottest.Click("plan_pro"),
+		bottest.Expect(subscribed),
+		bottest.Click("my_credits"),
+		bottest.Expect(creditsScreen(40, firstEnd)),
+		bottest.Click("plans"),
+		bottest.Expect(bottest.Reply{
+			Text: plansScreen + fmt.Sprintf("\n\n✅ You are on the Pro plan. It renews on %s.", firstEnd),
+			Keyboard: [][]bottest.Button{
+				{{Text: "❌ Cancel subscription", Data: "plans_cancel"}},
+				{{Text: "🔙 Back to Credits", Data: "my_credits"}},
+			},
+			Edit: true,
+		}),
+		bottest.Click("plans_cancel"),
+		bottest.Expect(bottest.Reply{
+			Text:     fmt.Sprintf("Your Pro plan is canceled and ends on %s. You keep its perks until then; unused plan credits expire when it ends.", firstEnd),
+			Keyboard: [][]bottest.Button{{{Text: "🏠 Main Menu", Data: "back_to_main"}}},
+			Edit:     true,
+		}),
+	)
+
+	// A month later: 10 of the unused 40 roll over, and 40 more are granted
+	h.RunRenewals(model.NextPeriodEnd(started).Add(time.Minute))
+
+	renewingChat.Run(
+		bottest.Expect(bottest.Reply{Text: fmt.Sprintf("🔄 Your Pro plan has renewed: 40 credits added. Next renewal: %s.", secondEnd)}),
+		bottest.Send("/start"),
+		bottest.Expect(bottest.Reply{
+			Text: "Hello Abebe! Welcome to Image Generation Bot! 🎨\n\nI can help you generate amazing images using AI. What would you like to do?\n\nYour current image credits: 50",
+			Keyboard: [][]bottest.Button{
+				{{Text: "🎨 Generate Image", Data: "generate_image"}, {Text: "🎬 Generate Video", Data: "generate_video"}},
+				{{Text: "💳 My Credits", Data: "my_credits"}, {Text: "📊 Trending Prompts", Data: "trending_prompts"}},
+				{{Text: "👥 Invite friends", Data: "invite_friends"}, {Text: "❓ Help", Data: "help"}},
+				{{Text: "🌐 Language", Data: "language"}},
+			},
+		}),
+		// What rolled over now lasts until the end of the new period
+		bottest.Click("my_credits"),
+		bottest.Expect(creditsScreen(50, secondEnd)),
+	)
+	cancelingChat.Run(
+		bottest.Expect(bottest.Reply{Text: "Your Pro plan has ended and its unused credits have expired. You can subscribe again under ⭐ Plans."}),
+		bottest.Send("/start"),
+		bottest.Expect(bottest.Reply{
+			Text: "Hello Kebede! Welcome to Image Generation Bot! 🎨\n\nI can help you generate amazing images using AI. What would you like to do?\n\nYour current image credits: 0",
+			Keyboard: [][]bottest.Button{
+				{{Text: "🎨 Generate Image", Data: "generate_image"}, {Text: "🎬 Generate Video", Data: "generate_video"}},
+				{{Text: "💳 My Credits", Data: "my_credits"}, {Text: "📊 Trending Prompts", Data: "trending_prompts"}},
+				{{Text: "👥 Invite friends", Data: "invite_friends"}, {Text: "❓ Help", Data: "help"}},
+				{{Text: "🌐 Language", Data: "language"}},
+			},
+		}),
+	)
+}
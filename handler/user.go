@@ -5,16 +5,23 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
-	repository "github.com/Leul-Michael/image-generation/repository/user"
+	"github.com/Leul-Michael/image-generation/auth"
+	"github.com/Leul-Michael/image-generation/i18n"
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/Leul-Michael/image-generation/model"
 	"github.com/gin-gonic/gin"
 	"gopkg.in/telebot.v3"
-	"gorm.io/gorm"
 )
 
 type TelegramUser struct {
@@ -33,48 +40,119 @@ type TelegramInitData struct {
 }
 
 type UserHandler struct {
-	repo *repository.PostgresUserRepo
-	bot  *telebot.Bot
+	repos    Repos
+	bot      *telebot.Bot
+	i18n     *i18n.Bundle
+	sessions *auth.Sessions
+	// telegramMaxAge is how old signed Telegram auth data may be.
+	telegramMaxAge time.Duration
+	logger         *slog.Logger
 }
 
-func NewUserHandler(db *gorm.DB, bot *telebot.Bot) *UserHandler {
+func NewUserHandler(repos Repos, bot *telebot.Bot, bundle *i18n.Bundle, sessions *auth.Sessions, telegramMaxAge time.Duration, logger *slog.Logger) *UserHandler {
 	return &UserHandler{
-		repo: &repository.PostgresUserRepo{DB: db},
-		bot:  bot,
+		repos:          repos,
+		bot:            bot,
+		i18n:           bundle,
+		sessions:       sessions,
+		telegramMaxAge: telegramMaxAge,
+		logger:         logger,
 	}
 }
 
-func (h *UserHandler) VerifyTelegramInitData(initData string) (bool, error) {
-	values, err := url.ParseQuery(initData)
-	if err != nil {
-		return false, fmt.Errorf("failed to parse init data: %v", err)
+// requestLang picks the caller's language from an explicit ?lang=, the
+// stored Lang of the ?telegram_id= user, or the Accept-Language header, in
+// that order. Unsupported values fall through to English.
+func (h *UserHandler) requestLang(c *gin.Context) string {
+	if lang := c.Query("lang"); h.i18n.Supports(lang) {
+		return lang
+	}
+
+	if telegramID := c.Query("telegram_id"); telegramID != "" {
+		var telegramIDUint uint
+		fmt.Sscanf(telegramID, "%d", &telegramIDUint)
+		if user, err := h.repos.Users.GetByTelegramID(c.Request.Context(), telegramIDUint); err == nil && h.i18n.Supports(user.Lang) {
+			return user.Lang
+		}
+	}
+
+	for _, part := range strings.Split(c.GetHeader("Accept-Language"), ",") {
+		tag := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		lang := strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+		if h.i18n.Supports(lang) {
+			return lang
+		}
 	}
 
-	hash := values.Get("hash")
-	values.Del("hash")
+	return i18n.DefaultLang
+}
+
+var errTelegramAuthExpired = errors.New("auth data is too old")
 
+// dataCheckString joins every field except hash as sorted key=value lines,
+// the message Telegram signs for both Mini Apps and the Login Widget.
+func dataCheckString(values url.Values) string {
 	var keys []string
 	for k := range values {
-		keys = append(keys, k)
+		if k != "hash" {
+			keys = append(keys, k)
+		}
 	}
 	sort.Strings(keys)
 
-	var dataCheckString strings.Builder
+	var b strings.Builder
 	for i, k := range keys {
 		if i > 0 {
-			dataCheckString.WriteString("\n")
+			b.WriteString("\n")
 		}
-		dataCheckString.WriteString(k)
-		dataCheckString.WriteString("=")
-		dataCheckString.WriteString(values.Get(k))
+		b.WriteString(k)
+		b.WriteString("=")
+		b.WriteString(values.Get(k))
 	}
+	return b.String()
+}
 
-	secretKey := sha256.Sum256([]byte("WebAppData"))
-	hmacHash := hmac.New(sha256.New, secretKey[:])
-	hmacHash.Write([]byte(dataCheckString.String()))
-	calculatedHash := hex.EncodeToString(hmacHash.Sum(nil))
+// checkTelegramHash compares the hash field against the HMAC-SHA256 of the
+// data check string under secretKey, and rejects data signed more than
+// maxAge ago so intercepted payloads cannot be replayed forever.
+func (h *UserHandler) checkTelegramHash(values url.Values, secretKey []byte) (bool, error) {
+	mac := hmac.New(sha256.New, secretKey)
+	mac.Write([]byte(dataCheckString(values)))
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(values.Get("hash"))) {
+		return false, nil
+	}
 
-	return calculatedHash == hash, nil
+	authDate, err := strconv.ParseInt(values.Get("auth_date"), 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("invalid auth_date: %v", err)
+	}
+	if time.Since(time.Unix(authDate, 0)) > h.telegramMaxAge {
+		return false, errTelegramAuthExpired
+	}
+
+	return true, nil
+}
+
+// VerifyTelegramInitData checks Mini App initData. Its key is
+// HMAC-SHA256("WebAppData", bot_token).
+func (h *UserHandler) VerifyTelegramInitData(initData string) (bool, error) {
+	values, err := url.ParseQuery(initData)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse init data: %v", err)
+	}
+
+	mac := hmac.New(sha256.New, []byte("WebAppData"))
+	mac.Write([]byte(h.bot.Token))
+	return h.checkTelegramHash(values, mac.Sum(nil))
+}
+
+// VerifyTelegramLoginWidget checks data from the Login Widget used on the
+// website. Its key is SHA256(bot_token).
+func (h *UserHandler) VerifyTelegramLoginWidget(values url.Values) (bool, error) {
+	secretKey := sha256.Sum256([]byte(h.bot.Token))
+	return h.checkTelegramHash(values, secretKey[:])
 }
 
 func (h *UserHandler) HandleTelegramAuth(c *gin.Context) {
@@ -84,9 +162,11 @@ func (h *UserHandler) HandleTelegramAuth(c *gin.Context) {
 		return
 	}
 
-	fmt.Println("initData", initData)
-
 	valid, err := h.VerifyTelegramInitData(initData)
+	if errors.Is(err, errTelegramAuthExpired) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "init data has expired"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("verification failed: %v", err)})
 		return
@@ -109,45 +189,126 @@ func (h *UserHandler) HandleTelegramAuth(c *gin.Context) {
 		return
 	}
 
-	chat, err := h.bot.ChatByID(telegramUser.ID)
-	if err != nil {
+	if _, err := h.bot.ChatByID(telegramUser.ID); err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid Telegram user"})
 		return
 	}
 
-	// Create or update user using repository
-	user, err := h.repo.CreateOrUpdateUser(
+	h.signInTelegramUser(c, telegramUser)
+}
+
+// HandleTelegramWidgetAuth signs in with Login Widget data, sent either as
+// the query string of the widget's redirect (GET) or as the JSON object its
+// onauth callback receives (POST).
+func (h *UserHandler) HandleTelegramWidgetAuth(c *gin.Context) {
+	values := c.Request.URL.Query()
+	if c.Request.Method == http.MethodPost {
+		var err error
+		if values, err = widgetValues(c.Request.Body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+			return
+		}
+	}
+
+	if values.Get("hash") == "" || values.Get("id") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id and hash are required"})
+		return
+	}
+
+	valid, err := h.VerifyTelegramLoginWidget(values)
+	if errors.Is(err, errTelegramAuthExpired) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "login data has expired"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("verification failed: %v", err)})
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid login data"})
+		return
+	}
+
+	id, err := strconv.ParseInt(values.Get("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	h.signInTelegramUser(c, TelegramUser{
+		ID:        id,
+		FirstName: values.Get("first_name"),
+		LastName:  values.Get("last_name"),
+		Username:  values.Get("username"),
+		PhotoURL:  values.Get("photo_url"),
+	})
+}
+
+// widgetValues converts the widget's JSON object to the string fields that
+// were signed. Numbers such as id and auth_date are kept as written.
+func widgetValues(body io.Reader) (url.Values, error) {
+	decoder := json.NewDecoder(body)
+	decoder.UseNumber()
+
+	var fields map[string]any
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, err
+	}
+
+	values := url.Values{}
+	for k, v := range fields {
+		switch v := v.(type) {
+		case string:
+			values.Set(k, v)
+		case json.Number:
+			values.Set(k, v.String())
+		default:
+			return nil, fmt.Errorf("unexpected value for %s", k)
+		}
+	}
+	return values, nil
+}
+
+// signInTelegramUser creates or updates the account of a verified Telegram
+// user and replies with a session. The Mini App and the website both end
+// here, and so does the bot's /start, so one account covers all three.
+func (h *UserHandler) signInTelegramUser(c *gin.Context, telegramUser TelegramUser) {
+	// Usernames are unique and optional, so an empty one is stored as NULL.
+	var username, photoURL *string
+	if telegramUser.Username != "" {
+		username = &telegramUser.Username
+	}
+	if telegramUser.PhotoURL != "" {
+		photoURL = &telegramUser.PhotoURL
+	}
+
+	user, err := h.repos.Users.CreateOrUpdateUser(
 		c.Request.Context(),
 		uint(telegramUser.ID),
 		telegramUser.FirstName,
 		telegramUser.LastName,
-		&telegramUser.Username,
-		&telegramUser.PhotoURL,
+		username,
+		photoURL,
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to create/update user: %v", err)})
 		return
 	}
+	if user.IsDeactivated {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is deactivated"})
+		return
+	}
 
-	// Send welcome message for new users
+	// Send welcome message for new users. Website users may never have
+	// started the bot, in which case Telegram refuses the message.
 	if user.CreatedAt.Equal(user.UpdatedAt) {
-		_, err = h.bot.Send(chat, "Welcome to Image Generation AI! Your account has been created successfully.")
-		if err != nil {
-			fmt.Printf("Failed to send welcome message: %v\n", err)
+		recipient := &telebot.User{ID: telegramUser.ID}
+		if _, err := h.bot.Send(recipient, h.i18n.For(user.Lang).T("welcome.account_created")); err != nil {
+			h.logger.WarnContext(c.Request.Context(), "Failed to send welcome message", "user_id", user.ID, logging.Err(err))
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Authentication successful",
-		"user":    user,
-	})
-}
-
-func (h *UserHandler) HandleTelegramWebhook(c *gin.Context) {
-	// Handle Telegram webhook for additional integrations
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Webhook received",
-	})
+	respondWithSession(c, h.sessions, http.StatusOK, "Authentication successful", user)
 }
 
 func (h *UserHandler) VerifyTelegramUser(c *gin.Context) {
@@ -165,22 +326,7 @@ func (h *UserHandler) VerifyTelegramUser(c *gin.Context) {
 }
 
 func (h *UserHandler) GetCurrentUser(c *gin.Context) {
-	// This would typically require JWT middleware for authentication
-	// For now, we'll use telegram_id from query params
-	telegramID := c.Query("telegram_id")
-	if telegramID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "telegram_id is required"})
-		return
-	}
-
-	var telegramIDUint uint
-	fmt.Sscanf(telegramID, "%d", &telegramIDUint)
-
-	user, err := h.repo.GetByTelegramID(c.Request.Context(), telegramIDUint)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-		return
-	}
+	user := sessionUser(c)
 
 	c.JSON(http.StatusOK, gin.H{
 		"user": user,
@@ -188,12 +334,6 @@ func (h *UserHandler) GetCurrentUser(c *gin.Context) {
 }
 
 func (h *UserHandler) UpdateCurrentUser(c *gin.Context) {
-	telegramID := c.Query("telegram_id")
-	if telegramID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "telegram_id is required"})
-		return
-	}
-
 	var updateData struct {
 		FirstName string `json:"first_name"`
 		LastName  string `json:"last_name"`
@@ -205,15 +345,16 @@ func (h *UserHandler) UpdateCurrentUser(c *gin.Context) {
 		return
 	}
 
-	var telegramIDUint uint
-	fmt.Sscanf(telegramID, "%d", &telegramIDUint)
-
-	user, err := h.repo.GetByTelegramID(c.Request.Context(), telegramIDUint)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	if updateData.Lang != "" && !h.i18n.Supports(updateData.Lang) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":     "Unsupported language",
+			"supported": h.i18n.Languages(),
+		})
 		return
 	}
 
+	user := sessionUser(c)
+
 	// Update user fields
 	if updateData.FirstName != "" {
 		user.FirstName = updateData.FirstName
@@ -225,7 +366,7 @@ func (h *UserHandler) UpdateCurrentUser(c *gin.Context) {
 		user.Lang = updateData.Lang
 	}
 
-	if err := h.repo.Update(c.Request.Context(), *user); err != nil {
+	if err := h.repos.Users.Update(c.Request.Context(), *user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 		return
 	}
@@ -237,20 +378,7 @@ func (h *UserHandler) UpdateCurrentUser(c *gin.Context) {
 }
 
 func (h *UserHandler) GetUserCredits(c *gin.Context) {
-	telegramID := c.Query("telegram_id")
-	if telegramID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "telegram_id is required"})
-		return
-	}
-
-	var telegramIDUint uint
-	fmt.Sscanf(telegramID, "%d", &telegramIDUint)
-
-	user, err := h.repo.GetByTelegramID(c.Request.Context(), telegramIDUint)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-		return
-	}
+	user := sessionUser(c)
 
 	c.JSON(http.StatusOK, gin.H{
 		"credits": user.UserCredits,
@@ -258,15 +386,49 @@ func (h *UserHandler) GetUserCredits(c *gin.Context) {
 }
 
 func (h *UserHandler) GetCategories(c *gin.Context) {
-	// This would get categories from the database
+	lang := h.requestLang(c)
+
+	categories, err := h.repos.Categories.ListActive(c.Request.Context(), lang)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load categories"})
+		return
+	}
+
+	for i := range categories {
+		categories[i] = categories[i].Localized(lang)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Categories endpoint - to be implemented",
+		"lang":       lang,
+		"categories": categories,
 	})
 }
 
 func (h *UserHandler) GetTrendingPrompts(c *gin.Context) {
-	// This would get trending prompts from the database
+	lang := h.requestLang(c)
+
+	trendingPrompts, err := h.repos.TrendingPrompts.ListActive(c.Request.Context(), lang, 10)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load trending prompts"})
+		return
+	}
+
+	type trendingPromptResponse struct {
+		model.TrendingPrompt
+		DisplayPrompt string `json:"display_prompt"`
+	}
+
+	response := make([]trendingPromptResponse, 0, len(trendingPrompts))
+	for _, tp := range trendingPrompts {
+		tp.Category = tp.Category.Localized(lang)
+		response = append(response, trendingPromptResponse{
+			TrendingPrompt: tp,
+			DisplayPrompt:  tp.DisplayPrompt(lang),
+		})
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Trending prompts endpoint - to be implemented",
+		"lang":             lang,
+		"trending_prompts": response,
 	})
 }
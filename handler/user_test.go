@@ -0,0 +1,197 @@
+package handler_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/handler"
+	"github.com/Leul-Michael/image-generation/logging"
+	"gopkg.in/telebot.v3"
+)
+
+const telegramToken = "123456:test"
+
+// widgetKey and webAppKey are the keys Telegram signs Login Widget data and
+// Mini App initData with.
+func widgetKey() []byte {
+	key := sha256.Sum256([]byte(telegramToken))
+	return key[:]
+}
+
+func webAppKey() []byte {
+	mac := hmac.New(sha256.New, []byte("WebAppData"))
+	mac.Write([]byte(telegramToken))
+	return mac.Sum(nil)
+}
+
+// signTelegram returns fields with the hash Telegram would add under key.
+func signTelegram(fields map[string]string, key []byte) url.Values {
+	var lines []string
+	values := url.Values{}
+	for k, v := range fields {
+		lines = append(lines, k+"="+v)
+		values.Set(k, v)
+	}
+	sort.Strings(lines)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	values.Set("hash", hex.EncodeToString(mac.Sum(nil)))
+	return values
+}
+
+func newUserHandler(t *testing.T) *handler.UserHandler {
+	t.Helper()
+	bot, err := telebot.NewBot(telebot.Settings{Token: telegramToken, Offline: true})
+	if err != nil {
+		t.Fatalf("NewBot: %v", err)
+	}
+	return handler.NewUserHandler(handler.Repos{}, bot, nil, nil, time.Hour, logging.Discard())
+}
+
+// TestVerifyTelegramLoginWidget checks Login Widget data against the hash
+// Telegram signs it with, and its age.
+func TestVerifyTelegramLoginWidget(t *testing.T) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	fields := func(authDate string) map[string]string {
+		return map[string]string{"id": "7001", "first_name": "Abebe", "username": "abebe", "auth_date": authDate}
+	}
+
+	tests := []struct {
+		name    string
+		values  func() url.Values
+		want    bool
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			values: func() url.Values { return signTelegram(fields(now), widgetKey()) },
+			want:   true,
+		},
+		{
+			name: "tampered field",
+			values: func() url.Values {
+				values := signTelegram(fields(now), widgetKey())
+				values.Set("id", "7002")
+				return values
+			},
+		},
+		{
+			name: "added field",
+			values: func() url.Values {
+				values := signTelegram(fields(now), widgetKey())
+				values.Set("last_name", "Kebede")
+				return values
+			},
+		},
+		{
+			name: "missing hash",
+			values: func() url.Values {
+				values := signTelegram(fields(now), widgetKey())
+				values.Del("hash")
+				return values
+			},
+		},
+		{
+			name:   "signed with the Mini App key",
+			values: func() url.Values { return signTelegram(fields(now), webAppKey()) },
+		},
+		{
+			name: "expired auth_date",
+			values: func() url.Values {
+				return signTelegram(fields(strconv.FormatInt(time.Now().Add(-2*time.Hour).Unix(), 10)), widgetKey())
+			},
+			wantErr: true,
+		},
+		{
+			name:    "invalid auth_date",
+			values:  func() url.Values { return signTelegram(fields("yesterday"), widgetKey()) },
+			wantErr: true,
+		},
+	}
+
+	h := newUserHandler(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := h.VerifyTelegramLoginWidget(tt.values())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyTelegramLoginWidget error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("VerifyTelegramLoginWidget = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestVerifyTelegramInitData checks Mini App initData, which is signed with
+// a key derived differently from the Login Widget's.
+func TestVerifyTelegramInitData(t *testing.T) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	fields := func(authDate string) map[string]string {
+		return map[string]string{
+			"query_id":  "AAHdF6IQAAAAAN0XohDhrOrc",
+			"user":      `{"id":7001,"first_name":"Abebe","language_code":"am"}`,
+			"auth_date": authDate,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		initData func() string
+		want     bool
+		wantErr  bool
+	}{
+		{
+			name:     "valid",
+			initData: func() string { return signTelegram(fields(now), webAppKey()).Encode() },
+			want:     true,
+		},
+		{
+			// initData is keyed with HMAC("WebAppData", token), not the
+			// widget's SHA256(token)
+			name:     "signed with the Login Widget key",
+			initData: func() string { return signTelegram(fields(now), widgetKey()).Encode() },
+		},
+		{
+			name: "tampered user",
+			initData: func() string {
+				values := signTelegram(fields(now), webAppKey())
+				values.Set("user", `{"id":7002,"first_name":"Abebe","language_code":"am"}`)
+				return values.Encode()
+			},
+		},
+		{
+			name: "expired auth_date",
+			initData: func() string {
+				return signTelegram(fields(strconv.FormatInt(time.Now().Add(-2*time.Hour).Unix(), 10)), webAppKey()).Encode()
+			},
+			wantErr: true,
+		},
+		{
+			name:     "unparsable",
+			initData: func() string { return "user=%zz" },
+			wantErr:  true,
+		},
+	}
+
+	h := newUserHandler(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := h.VerifyTelegramInitData(tt.initData())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyTelegramInitData error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("VerifyTelegramInitData = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Leul-Michael/image-generation/generation"
+	"github.com/Leul-Michael/image-generation/i18n"
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/Leul-Michael/image-generation/model"
+	creditrepo "github.com/Leul-Michael/image-generation/repository/credit"
+	requestrepo "github.com/Leul-Michael/image-generation/repository/request"
+	"gopkg.in/telebot.v3"
+)
+
+func (h *BotHandler) handleGenerateVideo(c telebot.Context) error {
+	sender := c.Sender()
+	if sender == nil {
+		return fmt.Errorf("failed to get sender information")
+	}
+
+	// Set user state to waiting for a prompt, or a photo with a caption
+	if err := h.setState(c, &model.ConversationState{State: "waiting_video_prompt"}); err != nil {
+		return err
+	}
+
+	message := h.t(c).N("video.prompt", h.pricing.VideoGenerationCost)
+
+	// A delivered video can't be edited into text
+	if c.Callback() != nil && c.Message().Video == nil {
+		return c.Edit(message)
+	}
+	return c.Send(message)
+}
+
+func (h *BotHandler) handleVideoPromptInput(c telebot.Context, text string, sourceFileID *string) error {
+	if problem := validatePrompt(text); problem != "" {
+		return c.Send(h.t(c).T(problem))
+	}
+
+	translation, err := generation.ToEnglish(h.ctx(c), h.translator, text)
+	if err != nil {
+		h.logger.WarnContext(h.ctx(c), "Failed to translate video prompt, using original", logging.Err(err))
+	}
+
+	// Clear user state
+	h.clearState(c)
+
+	return h.submitVideo(c, translation, sourceFileID)
+}
+
+// handlePhotoMessage turns a photo sent while a video prompt is awaited into
+// an image-to-video request, with the caption as the prompt. Photos are
+// ignored anywhere else.
+func (h *BotHandler) handlePhotoMessage(c telebot.Context) error {
+	sender := c.Sender()
+	if sender == nil {
+		return nil
+	}
+
+	state := h.state(c)
+	if state == nil || state.State != "waiting_video_prompt" {
+		return nil
+	}
+
+	caption := strings.TrimSpace(c.Message().Caption)
+	if caption == "" {
+		return c.Send(h.t(c).T("video.caption_required"))
+	}
+
+	// Telebot keeps the largest size of the photo
+	fileID := c.Message().Photo.FileID
+	return h.handleVideoPromptInput(c, caption, &fileID)
+}
+
+// submitVideo records the video request. The queued message it sends is
+// edited by NotifyVideoProgress while a video worker follows the job, and
+// the video itself is delivered by NotifyVideoCompleted.
+func (h *BotHandler) submitVideo(c telebot.Context, translation generation.Translation, sourceFileID *string) error {
+	t := h.t(c)
+	sender := c.Sender()
+
+	user, err := h.repos.Users.GetByTelegramID(h.ctx(c), uint(sender.ID))
+	if err != nil {
+		return c.Send(t.T("error.load_user"))
+	}
+
+	sub := h.subscription(h.ctx(c), user.ID)
+	tier := rateTier(h.rateLimit, user, sub)
+	if message := h.throttled(h.ctx(c), t, user, tier); message != "" {
+		return c.Send(message)
+	}
+
+	cost := h.pricing.VideoGenerationCost
+	if cost > 0 && !h.hasCredits(h.ctx(c), user.ID, model.CreditTypeVideo, cost) {
+		return c.Send(t.N("video.no_credits", cost), h.depositVideoMarkup(t))
+	}
+	if message := h.takePrompt(t, user, tier); message != "" {
+		return c.Send(message)
+	}
+
+	queued, err := h.bot.Send(c.Recipient(), t.T("video.queued", i18n.Params{"prompt": translation.Original}))
+	if err != nil {
+		return err
+	}
+
+	request := model.VideoGenerationRequest{
+		UserID:            user.ID,
+		Prompt:            translation.Text,
+		OriginalPrompt:    translation.Original,
+		PromptLang:        translation.SourceLang,
+		SourceImageFileID: sourceFileID,
+		Status:            model.RequestStatusPending,
+		ChatID:            queued.Chat.ID,
+		MessageID:         queued.ID,
+		CreditsRequired:   cost,
+		CorrelationID:     logging.CorrelationID(h.ctx(c)),
+	}
+	if sub != nil {
+		request.Priority = sub.Plan.Priority
+	}
+
+	if err := h.repos.VideoRequests.Create(h.ctx(c), &request, tier.InFlight); err != nil {
+		if errors.Is(err, requestrepo.ErrTooManyInFlight) {
+			_, err := h.bot.Edit(queued, t.N("ratelimit.in_flight", tier.InFlight))
+			return err
+		}
+		if errors.Is(err, creditrepo.ErrInsufficientCredits) {
+			_, err := h.bot.Edit(queued, t.N("video.no_credits", cost), h.depositVideoMarkup(t))
+			return err
+		}
+		h.logger.ErrorContext(h.ctx(c), "Failed to create video generation request", "user_id", user.ID, logging.Err(err))
+		_, err := h.bot.Edit(queued, t.T("error.database"))
+		return err
+	}
+	return nil
+}
+
+// depositVideoMarkup offers a video credit deposit to a user who is out of
+// video credits.
+func (h *BotHandler) depositVideoMarkup(t *i18n.Localizer) *telebot.ReplyMarkup {
+	return &telebot.ReplyMarkup{
+		InlineKeyboard: [][]telebot.InlineButton{
+			{
+				{Text: t.T("button.deposit_video"), Data: h.callbacks.Data("deposit_video")},
+				{Text: t.T("button.main_menu"), Data: h.callbacks.Data("back_to_main")},
+			},
+		},
+	}
+}
+
+// OpenFile downloads a file a user sent to the bot. It implements
+// generation.FileSource, so video workers can fetch photos to animate.
+func (h *BotHandler) OpenFile(ctx context.Context, fileID string) (io.ReadCloser, error) {
+	return h.bot.File(&telebot.File{FileID: fileID})
+}
+
+// NotifyVideoProgress edits the queued message to show how far the video
+// is. With NotifyVideoCompleted and NotifyVideoFailed it implements
+// generation.VideoNotifier.
+func (h *BotHandler) NotifyVideoProgress(ctx context.Context, request *model.VideoGenerationRequest) error {
+	t := h.i18n.For(request.User.Lang)
+
+	message := telebot.StoredMessage{MessageID: strconv.Itoa(request.MessageID), ChatID: request.ChatID}
+	_, err := h.bot.Edit(message, t.T("video.progress", i18n.Params{
+		"prompt":   request.DisplayPrompt(),
+		"progress": request.Progress,
+	}))
+	return err
+}
+
+// NotifyVideoCompleted shows the progress as done and sends the video.
+func (h *BotHandler) NotifyVideoCompleted(ctx context.Context, request *model.VideoGenerationRequest) error {
+	// A first paid generation qualifies a referred user for the referral
+	// bonus, announced after the video itself.
+	if h.paidFor(ctx, request.ID) {
+		defer h.rewardReferral(ctx, &request.User)
+	}
+
+	if err := h.NotifyVideoProgress(ctx, request); err != nil {
+		h.logger.WarnContext(ctx, "Failed to report video progress", "request_id", request.ID, logging.Err(err))
+	}
+
+	recipient, err := telegramRecipient(request.User)
+	if err != nil {
+		return err
+	}
+	t := h.i18n.For(request.User.Lang)
+
+	menu := &telebot.ReplyMarkup{
+		InlineKeyboard: [][]telebot.InlineButton{
+			{
+				{Text: t.T("button.generate_another"), Data: h.callbacks.Data("generate_video")},
+				{Text: t.T("button.my_credits"), Data: h.callbacks.Data("my_credits")},
+			},
+			{
+				{Text: t.T("button.main_menu"), Data: h.callbacks.Data("back_to_main")},
+			},
+		},
+	}
+
+	params := i18n.Params{
+		"prompt":  request.DisplayPrompt(),
+		"seconds": request.GenerationTime,
+	}
+
+	// Placeholder providers return no video, only the result text
+	if request.VideoURL == "" {
+		_, err := h.bot.Send(recipient, t.T("video.placeholder_result", params), menu)
+		return err
+	}
+
+	video := &telebot.Video{
+		File:     telebot.FromURL(request.VideoURL),
+		Duration: request.DurationSeconds,
+		Caption:  t.T("video.result", params),
+	}
+	if request.ThumbnailURL != "" {
+		video.Thumbnail = &telebot.Photo{File: telebot.FromURL(request.ThumbnailURL)}
+	}
+	if _, err := h.bot.Send(recipient, video, menu); err != nil {
+		return fmt.Errorf("failed to send video: %w", err)
+	}
+	return nil
+}
+
+// NotifyVideoFailed tells the user their video could not be made. The
+// reason is logged by the worker and not shown to the user.
+func (h *BotHandler) NotifyVideoFailed(ctx context.Context, request *model.VideoGenerationRequest, reason error) error {
+	recipient, err := telegramRecipient(request.User)
+	if err != nil {
+		return err
+	}
+	t := h.i18n.For(request.User.Lang)
+
+	_, err = h.bot.Send(recipient, t.T("video.failed", i18n.Params{"prompt": truncate(request.DisplayPrompt(), 100)}), &telebot.ReplyMarkup{
+		InlineKeyboard: [][]telebot.InlineButton{
+			{
+				{Text: t.T("button.generate_another"), Data: h.callbacks.Data("generate_video")},
+				{Text: t.T("button.main_menu"), Data: h.callbacks.Data("back_to_main")},
+			},
+		},
+	})
+	return err
+}
@@ -0,0 +1,155 @@
+package handler_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/bottest"
+	"github.com/Leul-Michael/image-generation/config"
+	"github.com/Leul-Michael/image-generation/generation"
+	"gopkg.in/telebot.v3"
+)
+
+// TestVideo has a user buy video credits and make a video from a prompt and
+// another from a photo, following the progress edits until each video
+// arrives. The placeholder videos are refunded.
+func TestVideo(t *testing.T) {
+	videoURL := "https://videos.example.com/placeholder.mp4"
+	h := bottest.New(t, bottest.Options{VideoProvider: &generation.PlaceholderVideoProvider{Steps: 3, VideoURL: videoURL}})
+
+	user := telebot.User{ID: 9101, FirstName: "Abebe", LanguageCode: "en"}
+	chat := h.Chat(user)
+
+	expires := time.Now().Add(config.Default().Credits.BonusExpiry).Format("2006-01-02")
+
+	mainMenu := bottest.Reply{
+		Text: "Hello Abebe! Welcome to Image Generation Bot! 🎨\n\nI can help you generate amazing images using AI. What would you like to do?\n\nYour current image credits: 2",
+		Keyboard: [][]bottest.Button{
+			{{Text: "🎨 Generate Image", Data: "generate_image"}, {Text: "🎬 Generate Video", Data: "generate_video"}},
+			{{Text: "💳 My Credits", Data: "my_credits"}, {Text: "📊 Trending Prompts", Data: "trending_prompts"}},
+			{{Text: "👥 Invite friends", Data: "invite_friends"}, {Text: "❓ Help", Data: "help"}},
+			{{Text: "🌐 Language", Data: "language"}},
+		},
+	}
+	videoPrompt := "🎬 Generate a Video\n\n✍️ Describe the video you want to create:\n\n💡 Examples:\n• Waves crashing on a rocky shore at sunset\n• A hot air balloon drifting over snowy mountains\n\n🖼️ To bring a picture to life, send it as a photo with your description as the caption.\n\n🎬 Each video costs 1 video credit.\n\n💬 Type your prompt or use /cancel to go back:"
+	noCredits := bottest.Reply{
+		Text: "❌ You need 1 video credit to generate a video. Please buy video credits first.",
+		Keyboard: [][]bottest.Button{
+			{{Text: "🎬 Buy Video Credits", Data: "deposit_video"}, {Text: "🏠 Main Menu", Data: "back_to_main"}},
+		},
+	}
+	// generated expects the queued message, its progress edits and the
+	// video itself.
+	generated := func(prompt string) []bottest.Step {
+		progress := func(percent int) bottest.Step {
+			return bottest.Expect(bottest.Reply{
+				Text: fmt.Sprintf("🎬 Your video is being generated... %d%%\n\n📝 Prompt: %s\n\nI will send it here as soon as it is ready.", percent, prompt),
+				Edit: true,
+			})
+		}
+		return []bottest.Step{
+			bottest.Expect(bottest.Reply{Text: "⏳ Your video is queued...\n\n📝 Prompt: " + prompt + "\n\nVideos take a few minutes. I will update this message as it progresses."}),
+			progress(33),
+			progress(66),
+			progress(100),
+			bottest.Expect(bottest.Reply{
+				Text:  "✅ Video Generated Successfully!\n\n📝 Prompt: " + prompt + "\n⏱️ Generation Time: 0 seconds",
+				Video: videoURL,
+				Keyboard: [][]bottest.Button{
+					{{Text: "🔄 Generate Another", Data: "generate_video"}, {Text: "💳 My Credits", Data: "my_credits"}},
+					{{Text: "🏠 Main Menu", Data: "back_to_main"}},
+				},
+			}),
+		}
+	}
+
+	// New users have image credits only
+	chat.Run(
+		bottest.Send("/start"),
+		bottest.Expect(mainMenu),
+		bottest.Click("generate_video"),
+		bottest.Expect(bottest.Reply{Text: videoPrompt, Edit: true}),
+		bottest.Send("Waves crashing on a rocky shore"),
+		bottest.Expect(noCredits),
+
+		bottest.Click("deposit_video"),
+		bottest.Expect(bottest.Reply{
+			Text: "🎬 Buy Video Credits\n\nSelect how much you want to deposit:\n\n💡 Credit Conversion Rate:\n• 50 etb = 1 Video Credit\n\nChoose a preset amount or enter a custom amount:",
+			Keyboard: [][]bottest.Button{
+				{{Text: "50 etb · 1 video credit", Data: "deposit_video_50"}, {Text: "100 etb · 2 video credits", Data: "deposit_video_100"}},
+				{{Text: "250 etb · 5 video credits", Data: "deposit_video_250"}, {Text: "500 etb · 10 video credits", Data: "deposit_video_500"}},
+				{{Text: "✏️ Custom Amount", Data: "deposit_video_custom"}},
+				{{Text: "🔙 Back to Credits", Data: "my_credits"}},
+			},
+			Edit: true,
+		}),
+		bottest.Click("deposit_video_custom"),
+		bottest.Expect(bottest.Reply{
+			Text: "🎬 Custom Video Credit Deposit\n\nPlease enter the amount you want to deposit:\n\n💡 Credit Conversion:\n• 50 etb = 1 Video Credit\n• 100 etb = 2 Video Credits\n• 150 etb = 3 Video Credits\n\n⚠️ Note: Only multiples of 50 are converted to credits.\nFor example: If you deposit 75, only 50 will be used (1 credit).\n\n💬 Type your deposit amount or use /cancel to cancel:",
+			Edit: true,
+		}),
+		bottest.Send("30"),
+		bottest.Expect(bottest.Reply{Text: "❌ Minimum deposit is 50 etb to get 1 credit!\n\n💬 Please enter at least 50 or use /cancel:"}),
+		bottest.Send("120"),
+		bottest.Expect(bottest.Reply{
+			Text: "✅ Deposit Successful!\n\n💰 Amount Deposited: 120 etb\n🎬 Video Credits Added: 2\n\n💳 Your New Video Balance: 2 credits\n\n💔 Unused Amount: 20 etb\n⚠️ Note: 20 etb were not converted because you need multiples of 50 for credits.",
+			Keyboard: [][]bottest.Button{
+				{{Text: "💳 View Credits", Data: "my_credits"}, {Text: "🏠 Main Menu", Data: "back_to_main"}},
+			},
+		}),
+		bottest.Click("my_credits"),
+		bottest.Expect(bottest.Reply{
+			Text: "💳 Your Credit Balance:\n\n🎨 Image Credits: 2\n🎬 Video Credits: 2\n\n💡 Credit Pricing:\n• 10 etb = 1 Image Credit\n• 20 etb = 2 Image Credits\n• 30 etb = 3 Image Credits\n• And so on...\n• 50 etb = 1 Video Credit\n\nCredits are used to generate amazing AI images and videos!\n\n⏳ Expiring credits:\n• 2 credits on " + expires,
+			Keyboard: [][]bottest.Button{
+				{{Text: "💰 Deposit Credits", Data: "deposit_credits"}, {Text: "⭐ Plans", Data: "plans"}},
+				{{Text: "🎬 Buy Video Credits", Data: "deposit_video"}},
+				{{Text: "🔙 Back to Main Menu", Data: "back_to_main"}},
+			},
+			Edit: true,
+		}),
+
+		bottest.Click("back_to_main"),
+		bottest.Expect(bottest.Reply{Text: mainMenu.Text, Keyboard: mainMenu.Keyboard, Edit: true}),
+		bottest.Click("generate_video"),
+		bottest.Expect(bottest.Reply{Text: videoPrompt, Edit: true}),
+		bottest.Send("Waves crashing on a rocky shore"),
+	)
+	chat.Run(generated("Waves crashing on a rocky shore")...)
+
+	// A photo needs a caption to say what the video should show
+	chat.Run(
+		bottest.Click("🔄 Generate Another"),
+		bottest.Expect(bottest.Reply{Text: videoPrompt}),
+		bottest.SendPhoto(""),
+		bottest.Expect(bottest.Reply{Text: "🖼️ Please send the photo again with a description of the video as its caption.\n\n💬 Or use /cancel to go back:"}),
+		bottest.SendPhoto("Make the clouds drift slowly"),
+	)
+	chat.Run(generated("Make the clouds drift slowly")...)
+
+	var downloads int
+	for _, call := range h.Server.Calls() {
+		if call.Method == "getFile" {
+			downloads++
+		}
+	}
+	if downloads != 1 {
+		t.Errorf("photo was fetched %d times, want once", downloads)
+	}
+
+	// Neither placeholder video was charged
+	chat.Run(
+		bottest.Send("/start"),
+		bottest.Expect(mainMenu),
+		bottest.Click("my_credits"),
+		bottest.Expect(bottest.Reply{
+			Text: "💳 Your Credit Balance:\n\n🎨 Image Credits: 2\n🎬 Video Credits: 2\n\n💡 Credit Pricing:\n• 10 etb = 1 Image Credit\n• 20 etb = 2 Image Credits\n• 30 etb = 3 Image Credits\n• And so on...\n• 50 etb = 1 Video Credit\n\nCredits are used to generate amazing AI images and videos!\n\n⏳ Expiring credits:\n• 2 credits on " + expires,
+			Keyboard: [][]bottest.Button{
+				{{Text: "💰 Deposit Credits", Data: "deposit_credits"}, {Text: "⭐ Plans", Data: "plans"}},
+				{{Text: "🎬 Buy Video Credits", Data: "deposit_video"}},
+				{{Text: "🔙 Back to Main Menu", Data: "back_to_main"}},
+			},
+			Edit: true,
+		}),
+	)
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/telebot.v3"
+)
+
+// WebhookPoller is a telebot.Poller fed by Telegram webhook requests
+// received on the gin router, so the bot can run behind a load balancer on
+// several replicas instead of long polling from one.
+type WebhookPoller struct {
+	secret  string
+	updates chan telebot.Update
+}
+
+func NewWebhookPoller(secret string) *WebhookPoller {
+	return &WebhookPoller{
+		secret:  secret,
+		updates: make(chan telebot.Update, 100),
+	}
+}
+
+// Poll forwards updates received over HTTP to the bot until it is stopped.
+// Telegram won't send acknowledged updates again, so on stop the ones still
+// buffered, here or in dest, are handled before it returns. The HTTP server
+// has to be shut down first, so no more arrive.
+func (p *WebhookPoller) Poll(b *telebot.Bot, dest chan telebot.Update, stop chan struct{}) {
+	for {
+		select {
+		case update := <-p.updates:
+			select {
+			case dest <- update:
+			case <-stop:
+				p.drain(b, dest, update)
+				return
+			}
+		case <-stop:
+			p.drain(b, dest)
+			return
+		}
+	}
+}
+
+// drain handles the updates waiting in dest, then taken, then the rest of
+// the buffer, in the order they arrived.
+func (p *WebhookPoller) drain(b *telebot.Bot, dest chan telebot.Update, taken ...telebot.Update) {
+	processBuffered(b, dest)
+	for _, update := range taken {
+		b.ProcessUpdate(update)
+	}
+	processBuffered(b, p.updates)
+}
+
+// processBuffered handles the updates in updates until it is empty.
+func processBuffered(b *telebot.Bot, updates chan telebot.Update) {
+	for {
+		select {
+		case update := <-updates:
+			b.ProcessUpdate(update)
+		default:
+			return
+		}
+	}
+}
+
+func (p *WebhookPoller) HandleUpdate(c *gin.Context) {
+	token := c.GetHeader("X-Telegram-Bot-Api-Secret-Token")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(p.secret)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid secret token"})
+		return
+	}
+
+	var update telebot.Update
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid update"})
+		return
+	}
+
+	// Telegram retries updates that were not acknowledged, so rather than
+	// wait for room, a full buffer is left to it
+	select {
+	case p.updates <- update:
+		c.Status(http.StatusOK)
+	default:
+		c.Status(http.StatusServiceUnavailable)
+	}
+}
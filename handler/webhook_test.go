@@ -0,0 +1,64 @@
+package handler_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Leul-Michael/image-generation/handler"
+	"github.com/gin-gonic/gin"
+	"gopkg.in/telebot.v3"
+)
+
+// TestWebhookBacklog checks that updates are refused, for Telegram to retry,
+// once the buffer is full, and that the ones acknowledged are all handled
+// when the poller stops.
+func TestWebhookBacklog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	poller := handler.NewWebhookPoller("secret")
+	router := gin.New()
+	router.POST("/webhook", poller.HandleUpdate)
+
+	post := func(id int) int {
+		body := fmt.Sprintf(`{"update_id": %d, "message": {"message_id": %d, "text": "hi", "chat": {"id": 1}}}`, id, id)
+		request := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+		request.Header.Set("X-Telegram-Bot-Api-Secret-Token", "secret")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	acked := 0
+	for id := 1; ; id++ {
+		code := post(id)
+		if code == http.StatusServiceUnavailable {
+			break
+		}
+		if code != http.StatusOK {
+			t.Fatalf("update %d: status %d", id, code)
+		}
+		acked++
+	}
+
+	bot, err := telebot.NewBot(telebot.Settings{Offline: true, Synchronous: true})
+	if err != nil {
+		t.Fatalf("NewBot: %v", err)
+	}
+	handled := 0
+	bot.Handle(telebot.OnText, func(telebot.Context) error {
+		handled++
+		return nil
+	})
+
+	// Nothing takes from dest, as when the bot is stopping
+	dest := make(chan telebot.Update, 1)
+	stop := make(chan struct{})
+	close(stop)
+	poller.Poll(bot, dest, stop)
+
+	if handled != acked {
+		t.Errorf("handled %d updates on stop, want the %d acknowledged", handled, acked)
+	}
+}
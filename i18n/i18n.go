@@ -0,0 +1,180 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+//go:embed locales/*.json
+var localeFS embed.FS
+
+const DefaultLang = "en"
+
+// Params holds the values interpolated into {name} placeholders.
+type Params map[string]any
+
+type message struct {
+	One   string `json:"one"`
+	Other string `json:"other"`
+}
+
+// UnmarshalJSON accepts either a plain string or a {"one": ..., "other": ...} object.
+func (m *message) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		m.One = s
+		m.Other = s
+		return nil
+	}
+
+	type plain message
+	var p plain
+	if err := json.Unmarshal(b, &p); err != nil {
+		return err
+	}
+	if p.One == "" {
+		p.One = p.Other
+	}
+	*m = message(p)
+	return nil
+}
+
+type Bundle struct {
+	fallback string
+	messages map[string]map[string]message
+}
+
+// NewBundle loads every embedded locale file. English is the fallback language.
+func NewBundle() (*Bundle, error) {
+	entries, err := localeFS.ReadDir("locales")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read locales: %w", err)
+	}
+
+	b := &Bundle{
+		fallback: DefaultLang,
+		messages: make(map[string]map[string]message),
+	}
+
+	for _, entry := range entries {
+		data, err := localeFS.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read locale %s: %w", entry.Name(), err)
+		}
+
+		var messages map[string]message
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return nil, fmt.Errorf("failed to parse locale %s: %w", entry.Name(), err)
+		}
+
+		lang := strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))
+		b.messages[lang] = messages
+	}
+
+	if _, ok := b.messages[b.fallback]; !ok {
+		return nil, fmt.Errorf("fallback locale %q is missing", b.fallback)
+	}
+
+	return b, nil
+}
+
+// Languages returns the supported language codes in a stable order.
+func (b *Bundle) Languages() []string {
+	langs := make([]string, 0, len(b.messages))
+	for lang := range b.messages {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+func (b *Bundle) Supports(lang string) bool {
+	_, ok := b.messages[lang]
+	return ok
+}
+
+// For returns a Localizer for lang, falling back to English when lang is unknown.
+func (b *Bundle) For(lang string) *Localizer {
+	if !b.Supports(lang) {
+		lang = b.fallback
+	}
+	return &Localizer{bundle: b, lang: lang}
+}
+
+func (b *Bundle) lookup(lang, key string) (message, bool) {
+	if msg, ok := b.messages[lang][key]; ok {
+		return msg, true
+	}
+	msg, ok := b.messages[b.fallback][key]
+	return msg, ok
+}
+
+type Localizer struct {
+	bundle *Bundle
+	lang   string
+}
+
+func (l *Localizer) Lang() string {
+	return l.lang
+}
+
+// T renders the message for key. Unknown keys are returned as-is so missing
+// translations are visible instead of silently blank.
+func (l *Localizer) T(key string, params ...Params) string {
+	msg, ok := l.bundle.lookup(l.lang, key)
+	if !ok {
+		return key
+	}
+	return interpolate(msg.Other, params...)
+}
+
+// N renders the plural form of key for count. The count is available to the
+// message as {count}.
+func (l *Localizer) N(key string, count int, params ...Params) string {
+	msg, ok := l.bundle.lookup(l.lang, key)
+	if !ok {
+		return key
+	}
+
+	merged := Params{"count": count}
+	for _, p := range params {
+		for k, v := range p {
+			merged[k] = v
+		}
+	}
+
+	text := msg.Other
+	if pluralOne(l.lang, count) {
+		text = msg.One
+	}
+	return interpolate(text, merged)
+}
+
+// pluralOne reports whether count takes the "one" form in lang, following the
+// CLDR cardinal rules for the languages we ship.
+func pluralOne(lang string, count int) bool {
+	switch lang {
+	case "am":
+		return count == 0 || count == 1
+	default:
+		return count == 1
+	}
+}
+
+func interpolate(text string, params ...Params) string {
+	if len(params) == 0 || !strings.Contains(text, "{") {
+		return text
+	}
+
+	var pairs []string
+	for _, p := range params {
+		for k, v := range p {
+			pairs = append(pairs, "{"+k+"}", fmt.Sprint(v))
+		}
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
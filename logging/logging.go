@@ -0,0 +1,135 @@
+// Package logging builds the app's structured logger and carries a
+// correlation ID for each bot update and HTTP request through contexts, so
+// every line logged while handling one, including database and provider
+// calls, can be found together, and with its trace.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CorrelationKey is the attribute the correlation ID is logged under.
+const CorrelationKey = "correlation_id"
+
+// TraceKey is the attribute the trace ID of a sampled span is logged under.
+const TraceKey = "trace_id"
+
+// redacted replaces the values of sensitive attributes.
+const redacted = "[REDACTED]"
+
+// sensitive are attribute keys, or key suffixes after "_", whose values are
+// never logged.
+var sensitive = []string{
+	"token",
+	"secret",
+	"password",
+	"authorization",
+	"api_key",
+	"init_data",
+	"hash",
+	"email",
+	"payment_reference",
+}
+
+type Options struct {
+	Level slog.Level
+	// JSON writes one JSON object per line instead of key=value text.
+	JSON bool
+}
+
+// New returns a logger writing to w that adds the correlation ID of the
+// context to each record and redacts sensitive attributes.
+func New(w io.Writer, opts Options) *slog.Logger {
+	handlerOpts := &slog.HandlerOptions{
+		Level:       opts.Level,
+		ReplaceAttr: redact,
+	}
+
+	var h slog.Handler
+	if opts.JSON {
+		h = slog.NewJSONHandler(w, handlerOpts)
+	} else {
+		h = slog.NewTextHandler(w, handlerOpts)
+	}
+	return slog.New(contextHandler{h})
+}
+
+// Discard returns a logger that writes nothing.
+func Discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1}))
+}
+
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if IsSensitive(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+	return a
+}
+
+// IsSensitive reports whether values logged under key are redacted, e.g.
+// "token", "bot_token" or "Authorization".
+func IsSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitive {
+		if key == s || strings.HasSuffix(key, "_"+s) {
+			return true
+		}
+	}
+	return false
+}
+
+// contextHandler adds the correlation ID of the record's context, and the
+// trace ID of its span if that is sampled.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := CorrelationID(ctx); id != "" {
+		r.AddAttrs(slog.String(CorrelationKey, id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsSampled() {
+		r.AddAttrs(slog.String(TraceKey, sc.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+type correlationKey struct{}
+
+// NewCorrelationID returns a random ID for an update, request or job.
+func NewCorrelationID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithCorrelationID returns a copy of ctx carrying id.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationID returns the correlation ID of ctx, or "".
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// Err is the attribute errors are logged under.
+func Err(err error) slog.Attr {
+	return slog.Any("error", err)
+}
@@ -0,0 +1,86 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/Leul-Michael/image-generation/logging"
+)
+
+// TestRedact logs sensitive attributes through New, at the top level, in
+// groups and attached with With, and checks that none of their values are
+// written while lookalike keys are.
+func TestRedact(t *testing.T) {
+	var out bytes.Buffer
+	logger := logging.New(&out, logging.Options{Level: slog.LevelDebug, JSON: true})
+
+	logger.With("bot_token", "123456:secret").Info("Handled update",
+		"Authorization", "Bearer abc",
+		"user_email", "abebe@example.com",
+		"hashtag", "#ethiopia",
+		slog.Group("request", "password", "correct horse", "path", "/login"),
+	)
+	logger.WithGroup("payment").Info("Charged", "payment_reference", "TX-42", "amount", 100)
+
+	var lines []map[string]any
+	for _, line := range bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n")) {
+		var record map[string]any
+		if err := json.Unmarshal(line, &record); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", line, err)
+		}
+		lines = append(lines, record)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("logged %d lines, want 2:\n%s", len(lines), out.String())
+	}
+	update, payment := lines[0], lines[1]
+	request, _ := update["request"].(map[string]any)
+	group, _ := payment["payment"].(map[string]any)
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{name: "bot_token", got: update["bot_token"], want: "[REDACTED]"},
+		{name: "Authorization", got: update["Authorization"], want: "[REDACTED]"},
+		{name: "user_email", got: update["user_email"], want: "[REDACTED]"},
+		{name: "password in a group", got: request["password"], want: "[REDACTED]"},
+		{name: "payment_reference in a WithGroup group", got: group["payment_reference"], want: "[REDACTED]"},
+		{name: "hashtag", got: update["hashtag"], want: "#ethiopia"},
+		{name: "path in a group", got: request["path"], want: "/login"},
+		{name: "amount in a WithGroup group", got: group["amount"], want: float64(100)},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s logged as %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+// TestIsSensitive checks which keys are redacted: sensitive names in any
+// case, or ending in one after "_", but not keys merely starting with one.
+func TestIsSensitive(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"token", true},
+		{"bot_token", true},
+		{"Authorization", true},
+		{"user_email", true},
+		{"init_data", true},
+		{"hash", true},
+		{"hashtag", false},
+		{"tokens_used", false},
+		{"user_id", false},
+		{"emails_sent", false},
+	}
+	for _, tt := range tests {
+		if got := logging.IsSensitive(tt.key); got != tt.want {
+			t.Errorf("IsSensitive(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
@@ -2,30 +2,76 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 
 	"github.com/Leul-Michael/image-generation/application"
+	"github.com/Leul-Michael/image-generation/config"
 	"github.com/joho/godotenv"
 )
 
+const usage = `usage: image-generation <command> [arguments]
+
+commands:
+  serve                      run the HTTP server and bot (default)
+  worker                     run generation workers only
+  migrate [up|down [n]|status]
+  seed [-file catalog.yaml] [-dry-run] [-deactivate-missing] [-missing-only]
+  admin grant-credits -telegram-id ID -amount N [-type image] [-reason TEXT]
+  admin set-role -telegram-id ID -role ROLE
+  admin create-promo -code CODE (-credits N | -bonus-percent P) [-max-redemptions N] [-per-user N]
+                     [-starts TIME] [-ends TIME] [-langs en,am] [-segment new|customers]
+  admin create-plan -code CODE -name NAME -price ETB -credits N [-rollover N] [-priority N] [-premium]
+`
+
 func init() {
 	godotenv.Load()
 }
 
 func main() {
-	app, err := application.New()
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"))
 	if err != nil {
-		log.Fatal("failed to initialize the app: %w", err)
+		log.Fatal(err)
 	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
-	err = app.Start(ctx)
+	command, args := "serve", []string(nil)
+	if len(os.Args) > 1 {
+		command, args = os.Args[1], os.Args[2:]
+	}
+
+	switch command {
+	case "serve":
+		err = serve(ctx, cfg)
+	case "worker":
+		err = application.RunWorker(ctx, cfg)
+	case "migrate":
+		err = application.Migrate(ctx, cfg, args, os.Stdout)
+	case "seed":
+		err = application.Seed(ctx, cfg, args, os.Stdout)
+	case "admin":
+		err = application.Admin(ctx, cfg, args, os.Stdout)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		log.Fatalf("unknown command %q", command)
+	}
 
 	if err != nil {
 		log.Fatal(err)
 	}
 }
+
+func serve(ctx context.Context, cfg *config.Config) error {
+	app, err := application.New(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize the app: %w", err)
+	}
+
+	return app.Start(ctx)
+}
@@ -0,0 +1,241 @@
+// Package metrics exposes the app's Prometheus metrics: bot updates, HTTP
+// requests, the generation queues and providers, credits, and the database
+// pool.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/logging"
+	"github.com/Leul-Michael/image-generation/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "imagegen"
+
+// Generation types, the type label of generation metrics.
+const (
+	TypeImage = "image"
+	TypeVideo = "video"
+)
+
+// Metrics records the app's metrics. A nil *Metrics records nothing, so
+// components can be built without one.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	botUpdates        *prometheus.CounterVec
+	botUpdateDuration *prometheus.HistogramVec
+	httpDuration      *prometheus.HistogramVec
+	generations       *prometheus.CounterVec
+	generationLatency *prometheus.HistogramVec
+	providerErrors    *prometheus.CounterVec
+	creditsPurchased  *prometheus.CounterVec
+	creditsConsumed   *prometheus.CounterVec
+}
+
+// New returns Metrics registered, with the Go runtime and process
+// collectors, in a registry of their own.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		botUpdates: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "bot_updates_total",
+			Help:      "Bot updates handled, by kind, handler and outcome.",
+		}, []string{"kind", "handler", "outcome"}),
+		botUpdateDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "bot_update_duration_seconds",
+			Help:      "Time taken to handle bot updates, by kind and handler.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"kind", "handler"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to serve HTTP requests, by method, route and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		generations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "generations_total",
+			Help:      "Generation requests that ended, by type, provider and status.",
+		}, []string{"type", "provider", "status"}),
+		generationLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "generation_latency_seconds",
+			Help:      "Time from a generation request being made until it completed, by type, provider and category.",
+			Buckets:   []float64{1, 2.5, 5, 10, 20, 30, 60, 120, 300, 600, 1200},
+		}, []string{"type", "provider", "category"}),
+		providerErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "generation_provider_errors_total",
+			Help:      "Failed provider calls, by type and provider.",
+		}, []string{"type", "provider"}),
+		creditsPurchased: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "credits_purchased_total",
+			Help:      "Credits bought with deposits, by credit type.",
+		}, []string{"credit_type"}),
+		creditsConsumed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "credits_consumed_total",
+			Help:      "Credits charged for completed generations, by credit type.",
+		}, []string{"credit_type"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.botUpdates,
+		m.botUpdateDuration,
+		m.httpDuration,
+		m.generations,
+		m.generationLatency,
+		m.providerErrors,
+		m.creditsPurchased,
+		m.creditsConsumed,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// RegisterDB adds the connection pool stats of db.
+func (m *Metrics) RegisterDB(db *sql.DB, name string) {
+	if m == nil {
+		return
+	}
+	m.registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// QueueCounter counts the pending and processing requests of a queue.
+type QueueCounter interface {
+	CountQueued(ctx context.Context) (map[model.RequestStatus]int64, error)
+}
+
+// RegisterQueues adds the depth of the generation queues, by type and
+// status, counted by queues at each scrape.
+func (m *Metrics) RegisterQueues(queues map[string]QueueCounter, logger *slog.Logger) {
+	if m == nil {
+		return
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	m.registry.MustRegister(&queueCollector{queues: queues, logger: logger})
+}
+
+// BotUpdate records a handled bot update. kind is e.g. "callback" or
+// "command", handler the callback action or command.
+func (m *Metrics) BotUpdate(kind, handler string, err error, took time.Duration) {
+	if m == nil {
+		return
+	}
+	m.botUpdates.WithLabelValues(kind, handler, outcome(err)).Inc()
+	m.botUpdateDuration.WithLabelValues(kind, handler).Observe(took.Seconds())
+}
+
+// HTTPRequest records a served HTTP request. route is the route pattern,
+// never the path, to keep the label values few.
+func (m *Metrics) HTTPRequest(method, route string, status int, took time.Duration) {
+	if m == nil {
+		return
+	}
+	m.httpDuration.WithLabelValues(method, route, statusClass(status)).Observe(took.Seconds())
+}
+
+// GenerationCompleted records a completed generation, made took ago, and
+// the credits charged for it. category is the category slug, if any.
+func (m *Metrics) GenerationCompleted(typ, provider, category string, took time.Duration, creditType model.CreditType, credits int) {
+	if m == nil {
+		return
+	}
+	if category == "" {
+		category = "none"
+	}
+	m.generations.WithLabelValues(typ, provider, string(model.RequestStatusCompleted)).Inc()
+	m.generationLatency.WithLabelValues(typ, provider, category).Observe(took.Seconds())
+	if credits > 0 {
+		m.creditsConsumed.WithLabelValues(string(creditType)).Add(float64(credits))
+	}
+}
+
+// GenerationFailed records a failed generation.
+func (m *Metrics) GenerationFailed(typ, provider string) {
+	if m == nil {
+		return
+	}
+	m.generations.WithLabelValues(typ, provider, string(model.RequestStatusFailed)).Inc()
+}
+
+// ProviderError records a failed provider call.
+func (m *Metrics) ProviderError(typ, provider string) {
+	if m == nil {
+		return
+	}
+	m.providerErrors.WithLabelValues(typ, provider).Inc()
+}
+
+// CreditsPurchased records credits bought with a deposit.
+func (m *Metrics) CreditsPurchased(creditType model.CreditType, credits int) {
+	if m == nil {
+		return
+	}
+	m.creditsPurchased.WithLabelValues(string(creditType)).Add(float64(credits))
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// statusClass groups HTTP statuses as "2xx", "4xx" and so on.
+func statusClass(status int) string {
+	return string(rune('0'+status/100)) + "xx"
+}
+
+// queueCollector reports the queue depths when scraped, so they are never
+// stale and cost nothing between scrapes.
+type queueCollector struct {
+	queues map[string]QueueCounter
+	logger *slog.Logger
+}
+
+var queueDepthDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "generation_queue_depth"),
+	"Generation requests waiting or being generated, by type and status.",
+	[]string{"type", "status"}, nil,
+)
+
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueDepthDesc
+}
+
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(logging.WithCorrelationID(context.Background(), logging.NewCorrelationID()), 5*time.Second)
+	defer cancel()
+
+	for typ, queue := range c.queues {
+		counts, err := queue.CountQueued(ctx)
+		if err != nil {
+			c.logger.ErrorContext(ctx, "Failed to count generation queue", "type", typ, logging.Err(err))
+			ch <- prometheus.NewInvalidMetric(queueDepthDesc, err)
+			continue
+		}
+		for status, count := range counts {
+			ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(count), typ, string(status))
+		}
+	}
+}
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS prompt_enhancements;
+DROP TABLE IF EXISTS trending_prompt_translations;
+DROP TABLE IF EXISTS category_translations;
+DROP TABLE IF EXISTS trending_prompts;
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS image_generation_requests;
+DROP TABLE IF EXISTS generated_images;
+DROP TABLE IF EXISTS user_credits;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,163 @@
+-- Baseline schema matching what gorm AutoMigrate created before versioned
+-- migrations. Every statement is idempotent so existing databases can adopt
+-- this migration without changes.
+
+CREATE TABLE IF NOT EXISTS users (
+    id                UUID PRIMARY KEY,
+    created_at        TIMESTAMPTZ,
+    updated_at        TIMESTAMPTZ,
+    deleted_at        TIMESTAMPTZ,
+    first_name        VARCHAR(100) NOT NULL,
+    last_name         VARCHAR(100) NOT NULL,
+    email             VARCHAR(100) UNIQUE,
+    image             VARCHAR(255),
+    telegram_id       BIGINT NOT NULL UNIQUE,
+    telegram_username VARCHAR(100) NOT NULL UNIQUE,
+    password          TEXT,
+    phone_number      TEXT,
+    last_login        TIMESTAMPTZ,
+    role              TEXT DEFAULT 'user',
+    is_deactivated    BOOLEAN DEFAULT false,
+    lang              TEXT DEFAULT 'en'
+);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS categories (
+    id          UUID PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ,
+    deleted_at  TIMESTAMPTZ,
+    name        VARCHAR(100) NOT NULL UNIQUE,
+    description VARCHAR(500),
+    emoji       VARCHAR(50),
+    is_active   BOOLEAN DEFAULT true
+);
+CREATE INDEX IF NOT EXISTS idx_categories_deleted_at ON categories (deleted_at);
+
+CREATE TABLE IF NOT EXISTS user_credits (
+    id          UUID PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ,
+    deleted_at  TIMESTAMPTZ,
+    user_id     UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    credit_type VARCHAR(20) NOT NULL,
+    credits     BIGINT DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_user_credits_deleted_at ON user_credits (deleted_at);
+
+CREATE TABLE IF NOT EXISTS generated_images (
+    id                  UUID PRIMARY KEY,
+    created_at          TIMESTAMPTZ,
+    updated_at          TIMESTAMPTZ,
+    deleted_at          TIMESTAMPTZ,
+    user_id             UUID NOT NULL REFERENCES users (id),
+    category_id         UUID NOT NULL REFERENCES categories (id),
+    prompt              VARCHAR(500) NOT NULL,
+    image_url           VARCHAR(500) NOT NULL,
+    thumbnail_url       VARCHAR(500),
+    reference_image_url VARCHAR(500),
+    status              VARCHAR(20) NOT NULL DEFAULT 'completed',
+    error               VARCHAR(500),
+    generation_time     BIGINT NOT NULL,
+    credits_used        BIGINT NOT NULL,
+    is_private          BOOLEAN DEFAULT true,
+    model_used          VARCHAR(50),
+    prompt_tokens       BIGINT NOT NULL,
+    completion_tokens   BIGINT NOT NULL,
+    total_tokens        BIGINT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_generated_images_deleted_at ON generated_images (deleted_at);
+
+CREATE TABLE IF NOT EXISTS image_generation_requests (
+    id                  UUID PRIMARY KEY,
+    created_at          TIMESTAMPTZ,
+    updated_at          TIMESTAMPTZ,
+    deleted_at          TIMESTAMPTZ,
+    user_id             UUID NOT NULL REFERENCES users (id),
+    category_id         UUID NOT NULL REFERENCES categories (id),
+    prompt              VARCHAR(500) NOT NULL,
+    original_prompt     VARCHAR(500),
+    prompt_lang         VARCHAR(10) DEFAULT 'en',
+    reference_image_url VARCHAR(500),
+    status              VARCHAR(20) NOT NULL DEFAULT 'pending',
+    error               VARCHAR(500),
+    generated_image_id  UUID REFERENCES generated_images (id),
+    credits_required    BIGINT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_image_generation_requests_deleted_at ON image_generation_requests (deleted_at);
+ALTER TABLE image_generation_requests ADD COLUMN IF NOT EXISTS original_prompt VARCHAR(500);
+ALTER TABLE image_generation_requests ADD COLUMN IF NOT EXISTS prompt_lang VARCHAR(10) DEFAULT 'en';
+
+CREATE TABLE IF NOT EXISTS transactions (
+    id                 UUID PRIMARY KEY,
+    created_at         TIMESTAMPTZ,
+    updated_at         TIMESTAMPTZ,
+    deleted_at         TIMESTAMPTZ,
+    user_id            UUID NOT NULL REFERENCES users (id),
+    credit_type        VARCHAR(20) NOT NULL,
+    amount             BIGINT NOT NULL,
+    type               VARCHAR(20) NOT NULL,
+    description        VARCHAR(500),
+    balance_after      BIGINT NOT NULL,
+    reference_id       VARCHAR(100),
+    payment_provider   VARCHAR(50),
+    generated_image_id UUID REFERENCES generated_images (id)
+);
+CREATE INDEX IF NOT EXISTS idx_transactions_deleted_at ON transactions (deleted_at);
+
+CREATE TABLE IF NOT EXISTS trending_prompts (
+    id           UUID PRIMARY KEY,
+    created_at   TIMESTAMPTZ,
+    updated_at   TIMESTAMPTZ,
+    deleted_at   TIMESTAMPTZ,
+    prompt       VARCHAR(500) NOT NULL,
+    category_id  UUID NOT NULL REFERENCES categories (id),
+    use_count    BIGINT DEFAULT 0,
+    is_active    BOOLEAN DEFAULT true,
+    last_used_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_trending_prompts_deleted_at ON trending_prompts (deleted_at);
+
+CREATE TABLE IF NOT EXISTS category_translations (
+    id          UUID PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ,
+    deleted_at  TIMESTAMPTZ,
+    category_id UUID NOT NULL REFERENCES categories (id),
+    lang        VARCHAR(10) NOT NULL,
+    name        VARCHAR(100) NOT NULL,
+    description VARCHAR(500)
+);
+CREATE INDEX IF NOT EXISTS idx_category_translations_deleted_at ON category_translations (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_category_translations_lang ON category_translations (category_id, lang);
+
+CREATE TABLE IF NOT EXISTS trending_prompt_translations (
+    id                 UUID PRIMARY KEY,
+    created_at         TIMESTAMPTZ,
+    updated_at         TIMESTAMPTZ,
+    deleted_at         TIMESTAMPTZ,
+    trending_prompt_id UUID NOT NULL REFERENCES trending_prompts (id),
+    lang               VARCHAR(10) NOT NULL,
+    prompt             VARCHAR(500) NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_trending_prompt_translations_deleted_at ON trending_prompt_translations (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_trending_prompt_translations_lang ON trending_prompt_translations (trending_prompt_id, lang);
+
+CREATE TABLE IF NOT EXISTS prompt_enhancements (
+    id                UUID PRIMARY KEY,
+    created_at        TIMESTAMPTZ,
+    updated_at        TIMESTAMPTZ,
+    deleted_at        TIMESTAMPTZ,
+    user_id           UUID NOT NULL REFERENCES users (id),
+    category_id       UUID NOT NULL REFERENCES categories (id),
+    original_prompt   VARCHAR(500) NOT NULL,
+    enhanced_prompt   VARCHAR(500) NOT NULL,
+    accepted          BOOLEAN,
+    credits_charged   BIGINT NOT NULL DEFAULT 0,
+    model_used        VARCHAR(50),
+    prompt_tokens     BIGINT NOT NULL,
+    completion_tokens BIGINT NOT NULL,
+    total_tokens      BIGINT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_prompt_enhancements_deleted_at ON prompt_enhancements (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_prompt_enhancements_user_id ON prompt_enhancements (user_id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_image_generation_requests_user_status;
+DROP INDEX IF EXISTS idx_user_credits_user_type;
+DROP INDEX IF EXISTS idx_categories_active_name;
+DROP INDEX IF EXISTS idx_trending_prompts_active_use_count;
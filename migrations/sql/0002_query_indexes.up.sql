@@ -0,0 +1,17 @@
+-- Indexes for the hot bot queries. These are partial indexes, which
+-- AutoMigrate could not express.
+CREATE INDEX IF NOT EXISTS idx_trending_prompts_active_use_count
+    ON trending_prompts (use_count DESC)
+    WHERE is_active AND deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_categories_active_name
+    ON categories (name)
+    WHERE is_active AND deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_user_credits_user_type
+    ON user_credits (user_id, credit_type)
+    WHERE deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_image_generation_requests_user_status
+    ON image_generation_requests (user_id, status)
+    WHERE deleted_at IS NULL;
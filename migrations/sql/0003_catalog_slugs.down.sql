@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_trending_prompts_slug;
+ALTER TABLE trending_prompts DROP COLUMN IF EXISTS slug;
+
+DROP INDEX IF EXISTS idx_categories_slug;
+ALTER TABLE categories DROP COLUMN IF EXISTS slug;
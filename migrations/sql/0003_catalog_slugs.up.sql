@@ -0,0 +1,27 @@
+-- Stable slugs for catalog rows so seed files can update names, descriptions
+-- and prompts in place.
+
+ALTER TABLE categories ADD COLUMN slug VARCHAR(100);
+UPDATE categories
+   SET slug = trim(BOTH '-' FROM regexp_replace(lower(name), '[^a-z0-9]+', '-', 'g'));
+ALTER TABLE categories ALTER COLUMN slug SET NOT NULL;
+CREATE UNIQUE INDEX idx_categories_slug ON categories (slug);
+
+ALTER TABLE trending_prompts ADD COLUMN slug VARCHAR(100);
+-- Prompts from the original hard-coded seed get the slugs used in the
+-- catalog file; anything added by hand gets a unique placeholder.
+UPDATE trending_prompts AS tp
+   SET slug = known.slug
+  FROM (VALUES
+    ('business-headshot', 'Professional headshot of a confident business man, studio lighting, crisp details, corporate attire'),
+    ('bioluminescent-underwater', 'Bioluminescent underwater scene with glowing jellyfish, deep ocean blues, magical lighting'),
+    ('cherry-blossom-petals', 'Cherry blossom petals falling in slow motion, soft pink hues, dreamy spring atmosphere'),
+    ('majestic-lion', 'Majestic lion with flowing mane, golden hour lighting, African savanna background, photorealistic'),
+    ('enchanted-library', 'Enchanted library with floating books, magical glowing orbs, wizard''s study atmosphere'),
+    ('futuristic-fashion-model', 'Futuristic fashion model in iridescent outfit, neon city background, cyberpunk aesthetic'),
+    ('vintage-train', 'Vintage train traveling through autumn mountains, steam locomotive, nostalgic journey')
+  ) AS known (slug, prompt)
+ WHERE tp.prompt = known.prompt;
+UPDATE trending_prompts SET slug = 'prompt-' || id::text WHERE slug IS NULL;
+ALTER TABLE trending_prompts ALTER COLUMN slug SET NOT NULL;
+CREATE UNIQUE INDEX idx_trending_prompts_slug ON trending_prompts (slug);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS auth_tokens;
+
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified_at;
+
+-- Email-only accounts cannot exist without a Telegram ID.
+DELETE FROM users WHERE telegram_id IS NULL;
+UPDATE users SET telegram_username = 'user_' || id WHERE telegram_username IS NULL;
+ALTER TABLE users ALTER COLUMN telegram_username SET NOT NULL;
+ALTER TABLE users ALTER COLUMN telegram_id SET NOT NULL;
@@ -0,0 +1,16 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS referral_code VARCHAR(16);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_referral_code ON users (referral_code);
+
+CREATE TABLE IF NOT EXISTS referrals (
+    id           UUID PRIMARY KEY,
+    created_at   TIMESTAMPTZ,
+    updated_at   TIMESTAMPTZ,
+    deleted_at   TIMESTAMPTZ,
+    referrer_id  UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    referee_id   UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    rewarded_at  TIMESTAMPTZ
+);
+-- A user can be referred only once.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_referrals_referee_id ON referrals (referee_id);
+CREATE INDEX IF NOT EXISTS idx_referrals_referrer_id ON referrals (referrer_id);
+CREATE INDEX IF NOT EXISTS idx_referrals_deleted_at ON referrals (deleted_at);
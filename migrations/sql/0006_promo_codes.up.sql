@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS promo_codes (
+    id               UUID PRIMARY KEY,
+    created_at       TIMESTAMPTZ,
+    updated_at       TIMESTAMPTZ,
+    deleted_at       TIMESTAMPTZ,
+    code             VARCHAR(50) NOT NULL,
+    credits          BIGINT NOT NULL DEFAULT 0,
+    bonus_percent    BIGINT NOT NULL DEFAULT 0,
+    max_redemptions  BIGINT NOT NULL DEFAULT 0,
+    per_user_limit   BIGINT NOT NULL DEFAULT 1,
+    redemptions      BIGINT NOT NULL DEFAULT 0,
+    starts_at        TIMESTAMPTZ,
+    ends_at          TIMESTAMPTZ,
+    langs            TEXT,
+    segment          VARCHAR(20) NOT NULL DEFAULT '',
+    is_active        BOOLEAN DEFAULT TRUE,
+    CHECK (credits >= 0 AND bonus_percent >= 0),
+    CHECK (max_redemptions = 0 OR redemptions <= max_redemptions)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_promo_codes_code ON promo_codes (code);
+CREATE INDEX IF NOT EXISTS idx_promo_codes_deleted_at ON promo_codes (deleted_at);
+
+CREATE TABLE IF NOT EXISTS promo_redemptions (
+    id             UUID PRIMARY KEY,
+    created_at     TIMESTAMPTZ,
+    updated_at     TIMESTAMPTZ,
+    deleted_at     TIMESTAMPTZ,
+    promo_code_id  UUID NOT NULL REFERENCES promo_codes (id),
+    user_id        UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    credits        BIGINT NOT NULL DEFAULT 0,
+    bonus_percent  BIGINT NOT NULL DEFAULT 0,
+    applied_at     TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_promo_redemptions_promo_code_id ON promo_redemptions (promo_code_id);
+CREATE INDEX IF NOT EXISTS idx_promo_redemptions_user_id ON promo_redemptions (user_id);
+CREATE INDEX IF NOT EXISTS idx_promo_redemptions_deleted_at ON promo_redemptions (deleted_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_image_generation_requests_free;
+ALTER TABLE image_generation_requests DROP COLUMN IF EXISTS is_free;
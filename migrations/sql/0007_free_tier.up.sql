@@ -0,0 +1,2 @@
+ALTER TABLE image_generation_requests ADD COLUMN IF NOT EXISTS is_free BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX IF NOT EXISTS idx_image_generation_requests_free ON image_generation_requests (user_id, created_at) WHERE is_free AND deleted_at IS NULL;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_image_generation_requests_queue;
+ALTER TABLE image_generation_requests DROP COLUMN IF EXISTS priority;
+
+ALTER TABLE categories DROP COLUMN IF EXISTS is_premium;
+
+DROP TABLE IF EXISTS subscriptions;
+DROP TABLE IF EXISTS plans;
@@ -0,0 +1,51 @@
+CREATE TABLE IF NOT EXISTS plans (
+    id                  UUID PRIMARY KEY,
+    created_at          TIMESTAMPTZ,
+    updated_at          TIMESTAMPTZ,
+    deleted_at          TIMESTAMPTZ,
+    code                VARCHAR(50) NOT NULL,
+    name                VARCHAR(100) NOT NULL,
+    price_etb           BIGINT NOT NULL,
+    monthly_credits     BIGINT NOT NULL,
+    max_rollover        BIGINT NOT NULL DEFAULT 0,
+    priority            BIGINT NOT NULL DEFAULT 0,
+    premium_categories  BOOLEAN NOT NULL DEFAULT FALSE,
+    is_active           BOOLEAN DEFAULT TRUE,
+    CHECK (price_etb >= 0 AND monthly_credits >= 0 AND max_rollover >= 0)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_plans_code ON plans (code);
+CREATE INDEX IF NOT EXISTS idx_plans_deleted_at ON plans (deleted_at);
+
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id                    UUID PRIMARY KEY,
+    created_at            TIMESTAMPTZ,
+    updated_at            TIMESTAMPTZ,
+    deleted_at            TIMESTAMPTZ,
+    user_id               UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    plan_id               UUID NOT NULL REFERENCES plans (id),
+    status                VARCHAR(20) NOT NULL,
+    current_period_start  TIMESTAMPTZ NOT NULL,
+    current_period_end    TIMESTAMPTZ NOT NULL,
+    period_credits        BIGINT NOT NULL DEFAULT 0,
+    renew_at              TIMESTAMPTZ NOT NULL,
+    grace_until           TIMESTAMPTZ,
+    cancel_at_period_end  BOOLEAN NOT NULL DEFAULT FALSE,
+    ended_at              TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_subscriptions_user_id ON subscriptions (user_id);
+CREATE INDEX IF NOT EXISTS idx_subscriptions_deleted_at ON subscriptions (deleted_at);
+-- At most one live subscription per user
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subscriptions_live_user
+    ON subscriptions (user_id)
+    WHERE status IN ('active', 'past_due') AND deleted_at IS NULL;
+-- Renewal job queue
+CREATE INDEX IF NOT EXISTS idx_subscriptions_renew_at
+    ON subscriptions (renew_at)
+    WHERE status IN ('active', 'past_due') AND deleted_at IS NULL;
+
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS is_premium BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE image_generation_requests ADD COLUMN IF NOT EXISTS priority BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_image_generation_requests_queue
+    ON image_generation_requests (priority DESC, created_at)
+    WHERE status IN ('pending', 'processing') AND deleted_at IS NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE transactions DROP COLUMN IF EXISTS expires_at;
+
+DROP TABLE IF EXISTS credit_lots;
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS credit_lots (
+    id              UUID PRIMARY KEY,
+    created_at      TIMESTAMPTZ,
+    updated_at      TIMESTAMPTZ,
+    deleted_at      TIMESTAMPTZ,
+    user_id         UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    credit_type     VARCHAR(20) NOT NULL,
+    source          VARCHAR(20) NOT NULL,
+    transaction_id  UUID REFERENCES transactions (id),
+    reference_id    VARCHAR(100),
+    amount          BIGINT NOT NULL,
+    remaining       BIGINT NOT NULL,
+    expires_at      TIMESTAMPTZ,
+    reminded_at     TIMESTAMPTZ,
+    CHECK (remaining >= 0 AND remaining <= amount)
+);
+CREATE INDEX IF NOT EXISTS idx_credit_lots_deleted_at ON credit_lots (deleted_at);
+-- Charges spend a balance's unspent lots
+CREATE INDEX IF NOT EXISTS idx_credit_lots_unspent
+    ON credit_lots (user_id, credit_type, expires_at)
+    WHERE remaining > 0 AND deleted_at IS NULL;
+-- Expiry sweep and reminders
+CREATE INDEX IF NOT EXISTS idx_credit_lots_expires_at
+    ON credit_lots (expires_at)
+    WHERE remaining > 0 AND expires_at IS NOT NULL AND deleted_at IS NULL;
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+
+-- Balances from before lots become one opening lot that never expires
+INSERT INTO credit_lots (id, created_at, updated_at, user_id, credit_type, source, amount, remaining)
+SELECT gen_random_uuid(), NOW(), NOW(), user_id, credit_type, 'adjustment', credits, credits
+FROM user_credits
+WHERE credits > 0 AND deleted_at IS NULL;
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS video_generation_requests (
+    id                   UUID PRIMARY KEY,
+    created_at           TIMESTAMPTZ,
+    updated_at           TIMESTAMPTZ,
+    deleted_at           TIMESTAMPTZ,
+    user_id              UUID NOT NULL REFERENCES users (id),
+    prompt               VARCHAR(500) NOT NULL,
+    original_prompt      VARCHAR(500),
+    prompt_lang          VARCHAR(10) DEFAULT 'en',
+    source_image_file_id VARCHAR(200),
+    status               VARCHAR(20) NOT NULL DEFAULT 'pending',
+    error                VARCHAR(500),
+    provider_job_id      VARCHAR(200),
+    progress             BIGINT NOT NULL DEFAULT 0,
+    poll_at              TIMESTAMPTZ NOT NULL,
+    chat_id              BIGINT NOT NULL,
+    message_id           BIGINT NOT NULL,
+    credits_required     BIGINT NOT NULL,
+    priority             BIGINT NOT NULL DEFAULT 0,
+    video_url            VARCHAR(500),
+    thumbnail_url        VARCHAR(500),
+    duration_seconds     BIGINT NOT NULL DEFAULT 0,
+    model_used           VARCHAR(50),
+    generation_time      BIGINT NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_video_generation_requests_deleted_at ON video_generation_requests (deleted_at);
+-- Video workers claim due requests by priority
+CREATE INDEX IF NOT EXISTS idx_video_generation_requests_due
+    ON video_generation_requests (poll_at)
+    WHERE status IN ('pending', 'processing') AND deleted_at IS NULL;
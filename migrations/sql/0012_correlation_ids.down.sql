@@ -0,0 +1,2 @@
+ALTER TABLE video_generation_requests DROP COLUMN IF EXISTS correlation_id;
+ALTER TABLE image_generation_requests DROP COLUMN IF EXISTS correlation_id;
@@ -0,0 +1,2 @@
+ALTER TABLE image_generation_requests ADD COLUMN IF NOT EXISTS correlation_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE video_generation_requests ADD COLUMN IF NOT EXISTS correlation_id VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE image_generation_requests DROP COLUMN IF EXISTS trace_parent;
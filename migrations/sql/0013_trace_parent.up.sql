@@ -0,0 +1 @@
+ALTER TABLE image_generation_requests ADD COLUMN IF NOT EXISTS trace_parent VARCHAR(64) NOT NULL DEFAULT '';
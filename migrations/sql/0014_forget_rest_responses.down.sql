@@ -0,0 +1,2 @@
+-- The deleted responses can't be restored; nothing to undo.
+SELECT 1;
@@ -0,0 +1,4 @@
+-- Stored REST responses included auth responses with session tokens in
+-- them. Auth routes no longer take an Idempotency-Key; forget what was
+-- stored so those tokens don't stay in the table until the keys expire.
+DELETE FROM idempotency_keys WHERE key LIKE 'api:%';
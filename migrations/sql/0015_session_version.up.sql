@@ -0,0 +1,3 @@
+-- Session tokens carry the user's session version, which a password reset
+-- bumps to sign out every existing session.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS session_version BIGINT NOT NULL DEFAULT 0;
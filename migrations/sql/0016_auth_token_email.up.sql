@@ -0,0 +1,3 @@
+-- Verification tokens carry the address they confirm, so a linked address
+-- is only stored on the user once it is verified.
+ALTER TABLE auth_tokens ADD COLUMN IF NOT EXISTS email VARCHAR(100);
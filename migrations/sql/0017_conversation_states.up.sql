@@ -0,0 +1,14 @@
+-- Bot flow state moves out of process memory, so any replica can handle a
+-- user's next update.
+CREATE TABLE IF NOT EXISTS conversation_states (
+    telegram_id      BIGINT PRIMARY KEY,
+    state            VARCHAR(50) NOT NULL,
+    category_id      VARCHAR(36),
+    prompt_text      TEXT,
+    original_prompt  TEXT,
+    prompt_lang      VARCHAR(10),
+    enhanced_prompt  TEXT,
+    enhancement_id   UUID,
+    credit_type      VARCHAR(20),
+    updated_at       TIMESTAMPTZ
+);
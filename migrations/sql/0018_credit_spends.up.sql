@@ -0,0 +1,10 @@
+-- The lots each charge spent, so refunds restore them instead of granting
+-- credits that never expire.
+CREATE TABLE IF NOT EXISTS credit_spends (
+    id              UUID PRIMARY KEY,
+    created_at      TIMESTAMPTZ,
+    transaction_id  UUID NOT NULL REFERENCES transactions (id) ON DELETE CASCADE,
+    lot_id          UUID NOT NULL REFERENCES credit_lots (id) ON DELETE CASCADE,
+    amount          BIGINT NOT NULL CHECK (amount > 0)
+);
+CREATE INDEX IF NOT EXISTS idx_credit_spends_transaction_id ON credit_spends (transaction_id);
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type AuthTokenPurpose string
+
+const (
+	AuthTokenVerifyEmail   AuthTokenPurpose = "verify_email"
+	AuthTokenResetPassword AuthTokenPurpose = "reset_password"
+)
+
+// AuthToken is a single-use token sent by email. Only the SHA-256 of the
+// token is stored, so a database leak does not expose usable links.
+type AuthToken struct {
+	Base
+	UserID    uuid.UUID        `gorm:"type:uuid;not null;index" json:"user_id"`
+	Purpose   AuthTokenPurpose `gorm:"size:20;not null" json:"purpose"`
+	TokenHash string           `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	// Email is the address a verify_email token confirms. A linked address
+	// is only stored on the user once it is confirmed.
+	Email     *string    `gorm:"size:100" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+func (at *AuthToken) BeforeCreate(tx *gorm.DB) (err error) {
+	at.ID = uuid.New()
+	return
+}
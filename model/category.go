@@ -7,13 +7,53 @@ import (
 
 type Category struct {
 	Base
+	Slug        string `gorm:"size:100;not null;uniqueIndex" json:"slug"`
 	Name        string `gorm:"size:100;not null;unique" json:"name"`
 	Description string `gorm:"size:500" json:"description"`
 	Emoji       string `gorm:"size:50" json:"emoji"`
 	IsActive    bool   `gorm:"default:true" json:"is_active"`
+	// IsPremium categories are only open to subscribers whose plan includes
+	// premium categories.
+	IsPremium bool `gorm:"not null;default:false" json:"is_premium"`
+
+	Translations []CategoryTranslation `gorm:"foreignKey:CategoryID" json:"-"`
+}
+
+// CategoryTranslation holds the Name and Description of a category in a
+// non-English language. The columns on Category are the English originals.
+type CategoryTranslation struct {
+	Base
+	CategoryID  uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_category_translations_lang" json:"category_id"`
+	Lang        string    `gorm:"size:10;not null;uniqueIndex:idx_category_translations_lang" json:"lang"`
+	Name        string    `gorm:"size:100;not null" json:"name"`
+	Description string    `gorm:"size:500" json:"description"`
 }
 
 func (c *Category) BeforeCreate(tx *gorm.DB) (err error) {
 	c.ID = uuid.New()
 	return
 }
+
+func (ct *CategoryTranslation) BeforeCreate(tx *gorm.DB) (err error) {
+	ct.ID = uuid.New()
+	return
+}
+
+// Localized returns a copy of the category with its Name and Description in
+// lang, using the preloaded Translations. Missing translations fall back to
+// the English columns.
+func (c Category) Localized(lang string) Category {
+	for _, tr := range c.Translations {
+		if tr.Lang != lang {
+			continue
+		}
+		if tr.Name != "" {
+			c.Name = tr.Name
+		}
+		if tr.Description != "" {
+			c.Description = tr.Description
+		}
+		break
+	}
+	return c
+}
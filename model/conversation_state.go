@@ -0,0 +1,27 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ConversationState is where a Telegram user is in a multi-step bot flow,
+// such as waiting for a prompt or reviewing an enhanced one. It is stored
+// rather than kept in memory, so whichever replica gets the user's next
+// update can carry on.
+type ConversationState struct {
+	TelegramID     int64  `gorm:"primaryKey;autoIncrement:false" json:"telegram_id"`
+	State          string `gorm:"size:50;not null" json:"state"`
+	CategoryID     string `gorm:"size:36" json:"category_id"`
+	PromptText     string `gorm:"type:text" json:"prompt_text"`
+	OriginalPrompt string `gorm:"type:text" json:"original_prompt"`
+	PromptLang     string `gorm:"size:10" json:"prompt_lang"`
+
+	EnhancedPrompt string    `gorm:"type:text" json:"enhanced_prompt"`
+	EnhancementID  uuid.UUID `gorm:"type:uuid" json:"enhancement_id"`
+
+	// CreditType is the kind of credits a custom deposit buys.
+	CreditType CreditType `gorm:"type:varchar(20)" json:"credit_type"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CreditLot is the part of a balance that came from one ledger entry.
+// Charges spend lots first in, first out by soonest expiry, so credits about
+// to expire are used before those that never do. The Remaining of a user's
+// lots always adds up to their UserCredit balance.
+type CreditLot struct {
+	Base
+	UserID     uuid.UUID       `gorm:"type:uuid;not null" json:"user_id"`
+	CreditType CreditType      `gorm:"type:varchar(20);not null" json:"credit_type"`
+	Source     TransactionType `gorm:"type:varchar(20);not null" json:"source"`
+	// TransactionID is the granting transaction, nil for the opening lot of
+	// a balance from before lots were tracked.
+	TransactionID *uuid.UUID `gorm:"type:uuid" json:"transaction_id"`
+	// ReferenceID is copied from the granting transaction, e.g. the
+	// subscription whose period the credits belong to.
+	ReferenceID *string `gorm:"size:100" json:"reference_id"`
+	Amount      int     `gorm:"not null" json:"amount"`
+	Remaining   int     `gorm:"not null" json:"remaining"`
+	// ExpiresAt is nil for credits that never expire.
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RemindedAt *time.Time `json:"reminded_at"`
+}
+
+func (l *CreditLot) BeforeCreate(tx *gorm.DB) (err error) {
+	l.ID = uuid.New()
+	return
+}
+
+// NewCreditLot is the lot a positive transaction grants.
+func NewCreditLot(transaction *Transaction) *CreditLot {
+	return &CreditLot{
+		UserID:        transaction.UserID,
+		CreditType:    transaction.CreditType,
+		Source:        transaction.Type,
+		TransactionID: &transaction.ID,
+		ReferenceID:   transaction.ReferenceID,
+		Amount:        transaction.Amount,
+		Remaining:     transaction.Amount,
+		ExpiresAt:     transaction.ExpiresAt,
+	}
+}
+
+// SpendsBefore orders lots for charging: soonest expiry first, then oldest.
+func (l *CreditLot) SpendsBefore(other *CreditLot) bool {
+	switch {
+	case l.ExpiresAt != nil && other.ExpiresAt == nil:
+		return true
+	case l.ExpiresAt == nil && other.ExpiresAt != nil:
+		return false
+	case l.ExpiresAt != nil && !l.ExpiresAt.Equal(*other.ExpiresAt):
+		return l.ExpiresAt.Before(*other.ExpiresAt)
+	}
+	return l.CreatedAt.Before(other.CreatedAt)
+}
+
+// ExpiresAfter is when credits granted at now expire after ttl, nil if ttl
+// is zero and they never do.
+func ExpiresAfter(now time.Time, ttl time.Duration) *time.Time {
+	if ttl <= 0 {
+		return nil
+	}
+	expiresAt := now.Add(ttl)
+	return &expiresAt
+}
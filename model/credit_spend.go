@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CreditSpend is what a charge took from one lot. A refund gives credits
+// back to the lots they were spent from, keeping their source and expiry.
+type CreditSpend struct {
+	ID            uuid.UUID `gorm:"primaryKey" json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	TransactionID uuid.UUID `gorm:"type:uuid;not null" json:"transaction_id"`
+	LotID         uuid.UUID `gorm:"type:uuid;not null" json:"lot_id"`
+	Amount        int       `gorm:"not null" json:"amount"`
+}
+
+func (s *CreditSpend) BeforeCreate(tx *gorm.DB) (err error) {
+	s.ID = uuid.New()
+	return
+}
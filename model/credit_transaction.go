@@ -1,6 +1,8 @@
 package model
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -11,6 +13,24 @@ const (
 	TransactionTypePurchase TransactionType = "purchase"
 	TransactionTypeUsage    TransactionType = "usage"
 	TransactionTypeRefund   TransactionType = "refund"
+	// TransactionTypeAdjustment is a manual correction made by an operator.
+	TransactionTypeAdjustment TransactionType = "adjustment"
+	// TransactionTypeReferral is a bonus for inviting a user, or for joining
+	// through an invite.
+	TransactionTypeReferral TransactionType = "referral"
+	// TransactionTypePromo is credits from a promo code, either granted on
+	// redemption or as a bonus on a deposit.
+	TransactionTypePromo TransactionType = "promo"
+	// TransactionTypeSignupGrant is the free credits every new account gets.
+	TransactionTypeSignupGrant TransactionType = "signup_grant"
+	// TransactionTypeSubscription is a subscription plan's monthly credits.
+	TransactionTypeSubscription TransactionType = "subscription"
+	// TransactionTypeSubscriptionExpiry removes subscription credits that
+	// did not roll over, or were left when the subscription ended.
+	TransactionTypeSubscriptionExpiry TransactionType = "subscription_expiry"
+	// TransactionTypeExpiry removes bonus credits that were not spent before
+	// they expired.
+	TransactionTypeExpiry TransactionType = "expiry"
 )
 
 type Transaction struct {
@@ -26,6 +46,9 @@ type Transaction struct {
 	PaymentProvider  *string         `gorm:"size:50" json:"payment_provider"`
 	GeneratedImageID *uuid.UUID      `gorm:"type:uuid" json:"generated_image_id"` // Link to the generated image if this is a usage transaction
 	GeneratedImage   *GeneratedImage `gorm:"foreignKey:GeneratedImageID" json:"generated_image"`
+	// ExpiresAt is when the credits a positive transaction grants expire,
+	// nil if they never do.
+	ExpiresAt *time.Time `json:"expires_at"`
 }
 
 func (ct *Transaction) BeforeCreate(tx *gorm.DB) (err error) {
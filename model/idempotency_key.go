@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// IdempotencyKey records an action that must not run twice, such as a bot
+// callback or a REST request sent with an Idempotency-Key header. Until
+// ExpiresAt a repeat of Key is not run again.
+type IdempotencyKey struct {
+	Base
+	// Key is scoped by its kind and owner, e.g. "callback:<id>" or
+	// "api:user:<user id>:<header>".
+	Key string `gorm:"size:300;not null;uniqueIndex" json:"key"`
+	// RequestHash identifies the request a REST key was first used for, so
+	// it can't be replayed for a different one.
+	RequestHash string `gorm:"size:64;not null;default:''" json:"-"`
+	// StatusCode and Response are the stored REST response, set once the
+	// request completed.
+	StatusCode  int        `gorm:"not null;default:0" json:"status_code"`
+	Response    []byte     `json:"-"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   time.Time  `gorm:"not null;index" json:"expires_at"`
+}
+
+func (k *IdempotencyKey) BeforeCreate(tx *gorm.DB) (err error) {
+	k.ID = uuid.New()
+	return
+}
@@ -20,13 +20,23 @@ type ImageGenerationRequest struct {
 	User              User            `gorm:"foreignKey:UserID" json:"user"`
 	CategoryID        uuid.UUID       `gorm:"type:uuid;not null" json:"category_id"`
 	Category          Category        `gorm:"foreignKey:CategoryID" json:"category"`
-	Prompt            string          `gorm:"size:500;not null" json:"prompt"`
+	Prompt            string          `gorm:"size:500;not null" json:"prompt"`         // English prompt sent to the provider
+	OriginalPrompt    string          `gorm:"size:500" json:"original_prompt"`         // Prompt as typed by the user
+	PromptLang        string          `gorm:"size:10;default:'en'" json:"prompt_lang"` // Detected language of OriginalPrompt
 	ReferenceImageURL *string         `gorm:"size:500" json:"reference_image_url"`
 	Status            RequestStatus   `gorm:"type:varchar(20);not null;default:'pending'" json:"status"`
 	Error             *string         `gorm:"size:500" json:"error"`
 	GeneratedImageID  *uuid.UUID      `gorm:"type:uuid" json:"generated_image_id"`
 	GeneratedImage    *GeneratedImage `gorm:"foreignKey:GeneratedImageID" json:"generated_image"`
 	CreditsRequired   int             `gorm:"not null" json:"credits_required"`
+	IsFree            bool            `gorm:"not null;default:false" json:"is_free"` // Uses the daily free allowance instead of credits
+	Priority          int             `gorm:"not null;default:0" json:"priority"`    // From the user's plan; higher is claimed first
+	// CorrelationID is that of the bot update that made the request, so the
+	// worker's logs can be found with it.
+	CorrelationID string `gorm:"size:64;not null;default:''" json:"-"`
+	// TraceParent is the W3C trace context of the span that made the
+	// request, so the worker continues its trace.
+	TraceParent string `gorm:"size:64;not null;default:''" json:"-"`
 }
 
 func (igr *ImageGenerationRequest) BeforeCreate(tx *gorm.DB) (err error) {
@@ -0,0 +1,101 @@
+package model
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PromoSegment restricts a promo code to a group of users.
+type PromoSegment string
+
+const (
+	PromoSegmentAll PromoSegment = ""
+	// PromoSegmentNew is users who have never bought credits.
+	PromoSegmentNew PromoSegment = "new"
+	// PromoSegmentCustomers is users who have bought credits before.
+	PromoSegmentCustomers PromoSegment = "customers"
+)
+
+// PromoCode is a campaign code such as LAUNCH50. It either grants Credits
+// when redeemed, or BonusPercent extra credits on the user's next deposit.
+type PromoCode struct {
+	Base
+	Code         string `gorm:"size:50;not null;uniqueIndex" json:"code"` // stored upper case
+	Credits      int    `gorm:"not null;default:0" json:"credits"`
+	BonusPercent int    `gorm:"not null;default:0" json:"bonus_percent"`
+	// MaxRedemptions caps redemptions across all users; 0 means no cap.
+	MaxRedemptions int `gorm:"not null;default:0" json:"max_redemptions"`
+	PerUserLimit   int `gorm:"not null;default:1" json:"per_user_limit"`
+	Redemptions    int `gorm:"not null;default:0" json:"redemptions"`
+	// StartsAt and EndsAt bound when the code can be redeemed; nil is open.
+	StartsAt *time.Time `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+	// Langs limits the code to users with these languages; empty allows all.
+	Langs    []string     `gorm:"serializer:json;type:text" json:"langs"`
+	Segment  PromoSegment `gorm:"size:20;not null;default:''" json:"segment"`
+	IsActive bool         `gorm:"default:true" json:"is_active"`
+}
+
+func (p *PromoCode) BeforeCreate(tx *gorm.DB) (err error) {
+	p.ID = uuid.New()
+	return
+}
+
+// Open reports whether the code can be redeemed at now, ignoring limits.
+func (p *PromoCode) Open(now time.Time) bool {
+	if !p.IsActive {
+		return false
+	}
+	if p.StartsAt != nil && now.Before(*p.StartsAt) {
+		return false
+	}
+	return p.EndsAt == nil || now.Before(*p.EndsAt)
+}
+
+// Exhausted reports whether every redemption has been used.
+func (p *PromoCode) Exhausted() bool {
+	return p.MaxRedemptions > 0 && p.Redemptions >= p.MaxRedemptions
+}
+
+// Eligible reports whether a user with lang, who has or has not bought
+// credits before, may redeem the code.
+func (p *PromoCode) Eligible(lang string, hasPurchased bool) bool {
+	if len(p.Langs) > 0 && !slices.Contains(p.Langs, lang) {
+		return false
+	}
+	switch p.Segment {
+	case PromoSegmentNew:
+		return !hasPurchased
+	case PromoSegmentCustomers:
+		return hasPurchased
+	}
+	return true
+}
+
+// PromoRedemption is one use of a promo code. A deposit bonus stays pending
+// until the user's next deposit, which sets AppliedAt; credits are applied
+// at once.
+type PromoRedemption struct {
+	Base
+	PromoCodeID  uuid.UUID  `gorm:"type:uuid;not null;index" json:"promo_code_id"`
+	PromoCode    PromoCode  `gorm:"foreignKey:PromoCodeID" json:"promo_code"`
+	UserID       uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	Credits      int        `gorm:"not null;default:0" json:"credits"`
+	BonusPercent int        `gorm:"not null;default:0" json:"bonus_percent"`
+	AppliedAt    *time.Time `json:"applied_at"`
+}
+
+func (r *PromoRedemption) BeforeCreate(tx *gorm.DB) (err error) {
+	r.ID = uuid.New()
+	return
+}
+
+// NormalizePromoCode is the form codes are stored and looked up in, so users
+// can type launch50 for LAUNCH50.
+func NormalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
@@ -0,0 +1,28 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type PromptEnhancement struct {
+	Base
+	UserID         uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	User           User      `gorm:"foreignKey:UserID" json:"user"`
+	CategoryID     uuid.UUID `gorm:"type:uuid;not null" json:"category_id"`
+	Category       Category  `gorm:"foreignKey:CategoryID" json:"category"`
+	OriginalPrompt string    `gorm:"size:500;not null" json:"original_prompt"`
+	EnhancedPrompt string    `gorm:"size:500;not null" json:"enhanced_prompt"`
+	Accepted       *bool     `json:"accepted"` // nil until the user accepts or rejects the rewrite
+	CreditsCharged int       `gorm:"not null;default:0" json:"credits_charged"`
+
+	ModelUsed        string `gorm:"size:50" json:"model_used"`
+	PromptTokens     int    `gorm:"not null" json:"prompt_tokens"`
+	CompletionTokens int    `gorm:"not null" json:"completion_tokens"`
+	TotalTokens      int    `gorm:"not null" json:"total_tokens"`
+}
+
+func (pe *PromptEnhancement) BeforeCreate(tx *gorm.DB) (err error) {
+	pe.ID = uuid.New()
+	return
+}
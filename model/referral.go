@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Referral records that Referee joined through Referrer's invite link. The
+// bonus credits are granted once, when the referee first buys credits or
+// generates an image, and RewardedAt is set then.
+type Referral struct {
+	Base
+	ReferrerID uuid.UUID  `gorm:"type:uuid;not null;index" json:"referrer_id"`
+	Referrer   User       `gorm:"foreignKey:ReferrerID" json:"-"`
+	RefereeID  uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex" json:"referee_id"`
+	Referee    User       `gorm:"foreignKey:RefereeID" json:"-"`
+	RewardedAt *time.Time `json:"rewarded_at"`
+}
+
+func (r *Referral) BeforeCreate(tx *gorm.DB) (err error) {
+	r.ID = uuid.New()
+	return
+}
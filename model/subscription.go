@@ -0,0 +1,81 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Plan is a monthly subscription tier such as Basic or Pro.
+type Plan struct {
+	Base
+	Code           string `gorm:"size:50;not null;uniqueIndex" json:"code"` // e.g. "pro", used in bot buttons
+	Name           string `gorm:"size:100;not null" json:"name"`
+	PriceEtb       int    `gorm:"not null" json:"price_etb"`
+	MonthlyCredits int    `gorm:"not null" json:"monthly_credits"`
+	// MaxRollover is how many unused credits of a period's allowance carry
+	// over to the next one. The rest expire at renewal.
+	MaxRollover int `gorm:"not null;default:0" json:"max_rollover"`
+	// Priority puts subscribers' requests ahead of those with a lower
+	// priority in the generation queue. Pay-as-you-go requests have 0.
+	Priority          int  `gorm:"not null;default:0" json:"priority"`
+	PremiumCategories bool `gorm:"not null;default:false" json:"premium_categories"`
+	IsActive          bool `gorm:"default:true" json:"is_active"`
+}
+
+type SubscriptionStatus string
+
+const (
+	SubscriptionStatusActive SubscriptionStatus = "active"
+	// SubscriptionStatusPastDue is a subscription whose renewal could not
+	// be charged. It keeps its perks until GraceUntil.
+	SubscriptionStatusPastDue SubscriptionStatus = "past_due"
+	// SubscriptionStatusCanceled ended at the end of a period because the
+	// user canceled it or the plan was retired.
+	SubscriptionStatusCanceled SubscriptionStatus = "canceled"
+	// SubscriptionStatusExpired ended because a renewal was not paid within
+	// the grace period.
+	SubscriptionStatusExpired SubscriptionStatus = "expired"
+)
+
+// Subscription is a user's plan. A user has at most one live (active or
+// past due) subscription.
+type Subscription struct {
+	Base
+	UserID             uuid.UUID          `gorm:"type:uuid;not null;index" json:"user_id"`
+	User               User               `gorm:"foreignKey:UserID" json:"-"`
+	PlanID             uuid.UUID          `gorm:"type:uuid;not null" json:"plan_id"`
+	Plan               Plan               `gorm:"foreignKey:PlanID" json:"plan"`
+	Status             SubscriptionStatus `gorm:"size:20;not null" json:"status"`
+	CurrentPeriodStart time.Time          `gorm:"not null" json:"current_period_start"`
+	CurrentPeriodEnd   time.Time          `gorm:"not null" json:"current_period_end"`
+	// PeriodCredits is the current period's allowance: the plan's monthly
+	// credits plus what rolled over.
+	PeriodCredits int `gorm:"not null;default:0" json:"period_credits"`
+	// RenewAt is when the renewal job next looks at the subscription.
+	RenewAt           time.Time  `gorm:"not null" json:"renew_at"`
+	GraceUntil        *time.Time `json:"grace_until"`
+	CancelAtPeriodEnd bool       `gorm:"not null;default:false" json:"cancel_at_period_end"`
+	EndedAt           *time.Time `json:"ended_at"`
+}
+
+func (p *Plan) BeforeCreate(tx *gorm.DB) (err error) {
+	p.ID = uuid.New()
+	return
+}
+
+func (s *Subscription) BeforeCreate(tx *gorm.DB) (err error) {
+	s.ID = uuid.New()
+	return
+}
+
+// Live reports whether the subscription still gives its plan's perks.
+func (s *Subscription) Live() bool {
+	return s.Status == SubscriptionStatusActive || s.Status == SubscriptionStatusPastDue
+}
+
+// NextPeriodEnd is a month after start.
+func NextPeriodEnd(start time.Time) time.Time {
+	return start.AddDate(0, 1, 0)
+}
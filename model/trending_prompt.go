@@ -9,15 +9,43 @@ import (
 
 type TrendingPrompt struct {
 	Base
+	Slug       string    `gorm:"size:100;not null;uniqueIndex" json:"slug"`
 	Prompt     string    `gorm:"size:500;not null" json:"prompt"`
 	CategoryID uuid.UUID `gorm:"type:uuid;not null" json:"category_id"`
 	Category   Category  `gorm:"foreignKey:CategoryID" json:"category"`
 	UseCount   int       `gorm:"default:0" json:"use_count"`
 	IsActive   bool      `gorm:"default:true" json:"is_active"`
 	LastUsedAt time.Time `json:"last_used_at"`
+
+	Translations []TrendingPromptTranslation `gorm:"foreignKey:TrendingPromptID" json:"-"`
+}
+
+// TrendingPromptTranslation is a display-only translation of a trending
+// prompt. Generation always uses the English TrendingPrompt.Prompt.
+type TrendingPromptTranslation struct {
+	Base
+	TrendingPromptID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_trending_prompt_translations_lang" json:"trending_prompt_id"`
+	Lang             string    `gorm:"size:10;not null;uniqueIndex:idx_trending_prompt_translations_lang" json:"lang"`
+	Prompt           string    `gorm:"size:500;not null" json:"prompt"`
 }
 
 func (tp *TrendingPrompt) BeforeCreate(tx *gorm.DB) (err error) {
 	tp.ID = uuid.New()
 	return
 }
+
+func (tpt *TrendingPromptTranslation) BeforeCreate(tx *gorm.DB) (err error) {
+	tpt.ID = uuid.New()
+	return
+}
+
+// DisplayPrompt returns the prompt text to show a user reading lang, falling
+// back to the English prompt when no translation was preloaded.
+func (tp *TrendingPrompt) DisplayPrompt(lang string) string {
+	for _, tr := range tp.Translations {
+		if tr.Lang == lang && tr.Prompt != "" {
+			return tr.Prompt
+		}
+	}
+	return tp.Prompt
+}
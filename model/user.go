@@ -27,16 +27,19 @@ type User struct {
 	FirstName        string       `gorm:"size:100;not null" json:"first_name"`
 	LastName         string       `gorm:"size:100;not null" json:"last_name"`
 	Email            *string      `gorm:"size:100;unique" json:"email"`
+	EmailVerifiedAt  *time.Time   `json:"email_verified_at"`
 	Image            *string      `gorm:"size:255" json:"image"`
-	TelegramID       uint         `gorm:"unique;not null" json:"telegram_id"`
-	TelegramUsername *string      `gorm:"size:100;unique;not null" json:"telegram_username"`
-	Password         *string      `json:"-"`
+	TelegramID       *uint        `gorm:"unique" json:"telegram_id"` // nil for accounts registered by email
+	TelegramUsername *string      `gorm:"size:100;unique" json:"telegram_username"`
+	Password         *string      `json:"-"`                           // bcrypt hash
+	SessionVersion   int          `gorm:"not null;default:0" json:"-"` // signed into session tokens; bumped to revoke them
 	PhoneNumber      *string      `json:"phone_number"`
 	LastLogin        *time.Time   `json:"last_login"`
 	Role             Role         `gorm:"default:'user'" json:"role"`
 	IsDeactivated    bool         `gorm:"default:false" json:"is_deactivated"`
 	UserCredits      []UserCredit `gorm:"foreignKey:UserID" json:"user_credits"`
 	Lang             string       `gorm:"default:'en'" json:"lang"`
+	ReferralCode     *string      `gorm:"size:16;unique" json:"referral_code"` // assigned when the user first opens the invite screen
 }
 
 func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
@@ -0,0 +1,58 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// VideoGenerationRequest is a text- or image-to-video job. Video providers
+// take minutes, so the request follows the provider's job between polls and
+// keeps the result itself once it is done.
+type VideoGenerationRequest struct {
+	Base
+	UserID         uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
+	User           User      `gorm:"foreignKey:UserID" json:"user"`
+	Prompt         string    `gorm:"size:500;not null" json:"prompt"`         // English prompt sent to the provider
+	OriginalPrompt string    `gorm:"size:500" json:"original_prompt"`         // Prompt as typed by the user
+	PromptLang     string    `gorm:"size:10;default:'en'" json:"prompt_lang"` // Detected language of OriginalPrompt
+	// SourceImageFileID is the Telegram file of the photo to animate, nil
+	// for text-to-video. File URLs contain the bot token, so only the ID is
+	// stored.
+	SourceImageFileID *string       `gorm:"size:200" json:"source_image_file_id"`
+	Status            RequestStatus `gorm:"type:varchar(20);not null;default:'pending'" json:"status"`
+	Error             *string       `gorm:"size:500" json:"error"`
+	ProviderJobID     *string       `gorm:"size:200" json:"provider_job_id"`    // Set once the provider accepted the job
+	Progress          int           `gorm:"not null;default:0" json:"progress"` // Percent, as last reported by the provider
+	// PollAt is when a worker next checks the job. Claiming a request moves
+	// it forward, which also keeps other workers off it meanwhile.
+	PollAt time.Time `gorm:"not null" json:"poll_at"`
+	// ChatID and MessageID are the Telegram message showing the progress.
+	ChatID          int64 `gorm:"not null" json:"chat_id"`
+	MessageID       int   `gorm:"not null" json:"message_id"`
+	CreditsRequired int   `gorm:"not null" json:"credits_required"`
+	Priority        int   `gorm:"not null;default:0" json:"priority"` // From the user's plan; higher is claimed first
+
+	VideoURL        string `gorm:"size:500" json:"video_url"`
+	ThumbnailURL    string `gorm:"size:500" json:"thumbnail_url"`
+	DurationSeconds int    `gorm:"not null;default:0" json:"duration_seconds"` // Length of the video
+	ModelUsed       string `gorm:"size:50" json:"model_used"`
+	GenerationTime  int    `gorm:"not null;default:0" json:"generation_time"` // Time taken to generate in seconds
+	// CorrelationID is that of the bot update that made the request, so the
+	// worker's logs can be found with it.
+	CorrelationID string `gorm:"size:64;not null;default:''" json:"-"`
+}
+
+func (vgr *VideoGenerationRequest) BeforeCreate(tx *gorm.DB) (err error) {
+	vgr.ID = uuid.New()
+	return
+}
+
+// DisplayPrompt is the prompt as the user typed it.
+func (vgr *VideoGenerationRequest) DisplayPrompt() string {
+	if vgr.OriginalPrompt != "" {
+		return vgr.OriginalPrompt
+	}
+	return vgr.Prompt
+}
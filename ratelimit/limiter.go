@@ -0,0 +1,89 @@
+// Package ratelimit throttles users and clients with token buckets. Buckets
+// live in memory, so each process limits the requests it sees; with several
+// bot or API replicas a client gets up to the limit from each of them.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// pruneInterval is how often buckets that have refilled are dropped. A full
+// bucket is the same as no bucket.
+const pruneInterval = time.Minute
+
+// Rate is a token bucket: Burst requests at once, then one more every Every.
+// A zero Burst means no limit.
+type Rate struct {
+	Burst int
+	Every time.Duration
+}
+
+// Unlimited reports whether the rate lets everything through.
+func (r Rate) Unlimited() bool {
+	return r.Burst <= 0
+}
+
+// Limiter holds a token bucket per key, e.g. per user or per client IP.
+// Buckets of different rates must use different keys.
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	pruned  time.Time
+}
+
+type bucket struct {
+	tokens float64
+	at     time.Time // when tokens was last brought up to date
+	full   time.Time // when the bucket will have refilled
+}
+
+func New() *Limiter {
+	return &Limiter{buckets: make(map[string]*bucket)}
+}
+
+// Allow takes a token from key's bucket as of now. When the bucket is empty
+// it reports false and how long until a token is available.
+func (l *Limiter) Allow(key string, rate Rate, now time.Time) (bool, time.Duration) {
+	if rate.Unlimited() {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.pruned) >= pruneInterval {
+		l.prune(now)
+	}
+
+	burst := float64(rate.Burst)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, at: now}
+		l.buckets[key] = b
+	}
+
+	if elapsed := now.Sub(b.at); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+float64(elapsed)/float64(rate.Every))
+		b.at = now
+	}
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) * float64(rate.Every))
+	}
+
+	b.tokens--
+	b.full = now.Add(time.Duration((burst - b.tokens) * float64(rate.Every)))
+	return true, 0
+}
+
+// prune drops the buckets that have refilled by now. mu must be held.
+func (l *Limiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if !now.Before(b.full) {
+			delete(l.buckets, key)
+		}
+	}
+	l.pruned = now
+}
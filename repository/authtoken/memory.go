@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/model"
+	"github.com/google/uuid"
+)
+
+// MemoryAuthTokenRepo is an in-memory AuthTokenRepo for tests.
+type MemoryAuthTokenRepo struct {
+	mu     sync.Mutex
+	tokens []model.AuthToken
+}
+
+var _ AuthTokenRepo = (*MemoryAuthTokenRepo)(nil)
+
+func NewMemoryAuthTokenRepo() *MemoryAuthTokenRepo {
+	return &MemoryAuthTokenRepo{}
+}
+
+func (mr *MemoryAuthTokenRepo) Create(ctx context.Context, token *model.AuthToken) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	now := time.Now()
+	token.ID, token.CreatedAt, token.UpdatedAt = uuid.New(), now, now
+	mr.tokens = append(mr.tokens, *token)
+	return nil
+}
+
+func (mr *MemoryAuthTokenRepo) Consume(ctx context.Context, purpose model.AuthTokenPurpose, tokenHash string) (*model.AuthToken, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	now := time.Now()
+	for i := range mr.tokens {
+		token := &mr.tokens[i]
+		if token.TokenHash == tokenHash && token.Purpose == purpose && token.UsedAt == nil && token.ExpiresAt.After(now) {
+			token.UsedAt = &now
+			consumed := *token
+			return &consumed, nil
+		}
+	}
+	return nil, ErrNotExist
+}
+
+func (mr *MemoryAuthTokenRepo) RevokeAll(ctx context.Context, userID uuid.UUID, purpose model.AuthTokenPurpose) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	now := time.Now()
+	for i := range mr.tokens {
+		token := &mr.tokens[i]
+		if token.UserID == userID && token.Purpose == purpose && token.UsedAt == nil {
+			token.UsedAt = &now
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AuthTokenRepo stores single-use email tokens by their hash.
+type AuthTokenRepo interface {
+	Create(ctx context.Context, token *model.AuthToken) error
+	// Consume marks the unused, unexpired token with this hash and purpose
+	// as used and returns it. Each token can be consumed once; later calls
+	// return ErrNotExist.
+	Consume(ctx context.Context, purpose model.AuthTokenPurpose, tokenHash string) (*model.AuthToken, error)
+	// RevokeAll marks the user's unused tokens for purpose as used, e.g. to
+	// invalidate older reset links once the password changed.
+	RevokeAll(ctx context.Context, userID uuid.UUID, purpose model.AuthTokenPurpose) error
+}
+
+var ErrNotExist = errors.New("token not found or expired")
+
+type PostgresAuthTokenRepo struct {
+	DB *gorm.DB
+}
+
+var _ AuthTokenRepo = (*PostgresAuthTokenRepo)(nil)
+
+func (pr *PostgresAuthTokenRepo) Create(ctx context.Context, token *model.AuthToken) error {
+	if err := pr.DB.WithContext(ctx).Create(token).Error; err != nil {
+		return fmt.Errorf("failed to create auth token: %w", err)
+	}
+	return nil
+}
+
+func (pr *PostgresAuthTokenRepo) Consume(ctx context.Context, purpose model.AuthTokenPurpose, tokenHash string) (*model.AuthToken, error) {
+	var tokens []model.AuthToken
+	now := time.Now()
+
+	// A single UPDATE ... RETURNING, so two requests with the same token
+	// cannot both succeed.
+	err := pr.DB.WithContext(ctx).
+		Model(&tokens).
+		Clauses(clause.Returning{}).
+		Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", tokenHash, purpose, now).
+		Update("used_at", now).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume auth token: %w", err)
+	}
+	if len(tokens) == 0 {
+		return nil, ErrNotExist
+	}
+	return &tokens[0], nil
+}
+
+func (pr *PostgresAuthTokenRepo) RevokeAll(ctx context.Context, userID uuid.UUID, purpose model.AuthTokenPurpose) error {
+	err := pr.DB.WithContext(ctx).
+		Model(&model.AuthToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now()).Error
+	if err != nil {
+		return fmt.Errorf("failed to revoke auth tokens: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/model"
+	"github.com/google/uuid"
+)
+
+// MemoryCategoryRepo is an in-memory CategoryRepo for tests. Categories are
+// stored with all their Translations and filtered by lang on read.
+type MemoryCategoryRepo struct {
+	mu         sync.Mutex
+	categories map[uuid.UUID]model.Category
+}
+
+var _ CategoryRepo = (*MemoryCategoryRepo)(nil)
+
+func NewMemoryCategoryRepo() *MemoryCategoryRepo {
+	return &MemoryCategoryRepo{categories: make(map[uuid.UUID]model.Category)}
+}
+
+func (mr *MemoryCategoryRepo) ListActive(ctx context.Context, lang string) ([]model.Category, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	var categories []model.Category
+	for _, category := range mr.categories {
+		if category.IsActive {
+			categories = append(categories, withTranslations(category, lang))
+		}
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		return categories[i].Name < categories[j].Name
+	})
+	return categories, nil
+}
+
+func (mr *MemoryCategoryRepo) GetByID(ctx context.Context, id uuid.UUID, lang string) (*model.Category, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	category, ok := mr.categories[id]
+	if !ok {
+		return nil, ErrNotExist
+	}
+	category = withTranslations(category, lang)
+	return &category, nil
+}
+
+func (mr *MemoryCategoryRepo) Create(ctx context.Context, category *model.Category) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	now := time.Now()
+	category.ID, category.CreatedAt, category.UpdatedAt = uuid.New(), now, now
+	for i := range category.Translations {
+		category.Translations[i].CategoryID = category.ID
+	}
+	mr.categories[category.ID] = *category
+	return nil
+}
+
+func withTranslations(category model.Category, lang string) model.Category {
+	var translations []model.CategoryTranslation
+	for _, tr := range category.Translations {
+		if tr.Lang == lang {
+			translations = append(translations, tr)
+		}
+	}
+	category.Translations = translations
+	return category
+}
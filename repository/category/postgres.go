@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Leul-Michael/image-generation/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CategoryRepo returns categories with the Translations for lang preloaded,
+// ready for Category.Localized.
+type CategoryRepo interface {
+	ListActive(ctx context.Context, lang string) ([]model.Category, error)
+	GetByID(ctx context.Context, id uuid.UUID, lang string) (*model.Category, error)
+	Create(ctx context.Context, category *model.Category) error
+}
+
+var ErrNotExist = errors.New("category not found")
+
+type PostgresCategoryRepo struct {
+	DB *gorm.DB
+}
+
+var _ CategoryRepo = (*PostgresCategoryRepo)(nil)
+
+func (pr *PostgresCategoryRepo) ListActive(ctx context.Context, lang string) ([]model.Category, error) {
+	var categories []model.Category
+	err := pr.DB.WithContext(ctx).
+		Where("is_active = ?", true).
+		Preload("Translations", "lang = ?", lang).
+		Order("name ASC").
+		Find(&categories).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list categories: %w", err)
+	}
+	return categories, nil
+}
+
+func (pr *PostgresCategoryRepo) GetByID(ctx context.Context, id uuid.UUID, lang string) (*model.Category, error) {
+	var category model.Category
+	err := pr.DB.WithContext(ctx).
+		Where("id = ?", id).
+		Preload("Translations", "lang = ?", lang).
+		First(&category).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotExist
+		}
+		return nil, fmt.Errorf("failed to get category: %w", err)
+	}
+	return &category, nil
+}
+
+func (pr *PostgresCategoryRepo) Create(ctx context.Context, category *model.Category) error {
+	if err := pr.DB.WithContext(ctx).Create(category).Error; err != nil {
+		return fmt.Errorf("failed to create category: %w", err)
+	}
+	return nil
+}
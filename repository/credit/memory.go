@@ -0,0 +1,362 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/model"
+	txrepo "github.com/Leul-Michael/image-generation/repository/transaction"
+	"github.com/google/uuid"
+)
+
+type creditKey struct {
+	userID     uuid.UUID
+	creditType model.CreditType
+}
+
+// lotSpend is a CreditSpend with the charge it belongs to and how much of it
+// was refunded.
+type lotSpend struct {
+	model.CreditSpend
+	charge   *model.Transaction
+	refunded int
+}
+
+// MemoryUserCreditRepo is an in-memory UserCreditRepo for tests. Applied
+// transactions are recorded in Transactions.
+type MemoryUserCreditRepo struct {
+	mu      sync.Mutex
+	credits map[creditKey]*model.UserCredit
+	lots    []model.CreditLot
+	spends  []lotSpend
+
+	Transactions *txrepo.MemoryTransactionRepo
+}
+
+var _ UserCreditRepo = (*MemoryUserCreditRepo)(nil)
+
+func NewMemoryUserCreditRepo(transactions *txrepo.MemoryTransactionRepo) *MemoryUserCreditRepo {
+	return &MemoryUserCreditRepo{
+		credits:      make(map[creditKey]*model.UserCredit),
+		Transactions: transactions,
+	}
+}
+
+// Set overwrites a balance without recording a transaction, for test setup.
+func (mr *MemoryUserCreditRepo) Set(userID uuid.UUID, creditType model.CreditType, credits int) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	mr.balance(userID, creditType).Credits = credits
+}
+
+// balance returns the stored balance, creating an empty one. mu must be held.
+func (mr *MemoryUserCreditRepo) balance(userID uuid.UUID, creditType model.CreditType) *model.UserCredit {
+	key := creditKey{userID, creditType}
+	if userCredit, ok := mr.credits[key]; ok {
+		return userCredit
+	}
+
+	now := time.Now()
+	userCredit := &model.UserCredit{UserID: userID, CreditType: creditType}
+	userCredit.ID, userCredit.CreatedAt, userCredit.UpdatedAt = uuid.New(), now, now
+	mr.credits[key] = userCredit
+	return userCredit
+}
+
+func (mr *MemoryUserCreditRepo) Get(ctx context.Context, userID uuid.UUID, creditType model.CreditType) (*model.UserCredit, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	userCredit, ok := mr.credits[creditKey{userID, creditType}]
+	if !ok {
+		return nil, ErrNotExist
+	}
+	copied := *userCredit
+	return &copied, nil
+}
+
+func (mr *MemoryUserCreditRepo) ListByUser(ctx context.Context, userID uuid.UUID) ([]model.UserCredit, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	var credits []model.UserCredit
+	for _, creditType := range []model.CreditType{model.CreditTypeImage, model.CreditTypeVideo} {
+		if userCredit, ok := mr.credits[creditKey{userID, creditType}]; ok {
+			credits = append(credits, *userCredit)
+		}
+	}
+	return credits, nil
+}
+
+func (mr *MemoryUserCreditRepo) Apply(ctx context.Context, transaction *model.Transaction) (*model.UserCredit, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	var spend []uuid.UUID
+	if transaction.Amount < 0 {
+		for _, lot := range mr.unspent(transaction.UserID, transaction.CreditType, nil) {
+			spend = append(spend, lot.ID)
+		}
+	}
+	return mr.apply(ctx, transaction, spend)
+}
+
+func (mr *MemoryUserCreditRepo) Refund(ctx context.Context, refund *model.Transaction) (*model.UserCredit, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	left := refund.Amount
+	for i, spend := range mr.spends {
+		if left <= 0 || !spend.refundedBy(refund) {
+			continue
+		}
+		restored := min(spend.Amount, left)
+		if lot := mr.lot(spend.LotID); lot != nil {
+			lot.Remaining += restored
+		}
+		mr.spends[i].refunded += restored
+		left -= restored
+	}
+
+	userCredit := mr.balance(refund.UserID, refund.CreditType)
+	return mr.record(ctx, userCredit, refund, left)
+}
+
+func (mr *MemoryUserCreditRepo) Paid(ctx context.Context, referenceID string) (bool, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	var paid bool
+	var charged, refunded int
+	for _, spend := range mr.spends {
+		if !spend.charges(referenceID) {
+			continue
+		}
+		if lot := mr.lot(spend.LotID); lot != nil && slices.Contains(paidSources, lot.Source) {
+			paid = true
+		}
+		charged += spend.Amount
+		refunded += spend.refunded
+	}
+	return paid && refunded < charged, nil
+}
+
+func (mr *MemoryUserCreditRepo) Lots(ctx context.Context, userID uuid.UUID, creditType model.CreditType) ([]model.CreditLot, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	return mr.unspent(userID, creditType, nil), nil
+}
+
+func (mr *MemoryUserCreditRepo) ExpireDue(ctx context.Context, now time.Time) ([]model.Transaction, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	var expired []model.Transaction
+	for _, key := range mr.keys() {
+		lots := mr.unspent(key.userID, key.creditType, func(lot *model.CreditLot) bool {
+			return dueBonus(lot, now)
+		})
+
+		transaction := expiry(lots)
+		if transaction == nil {
+			continue
+		}
+		if _, err := mr.apply(ctx, transaction, ids(lots)); err != nil {
+			return expired, err
+		}
+		expired = append(expired, *transaction)
+	}
+	return expired, nil
+}
+
+func (mr *MemoryUserCreditRepo) ClaimReminders(ctx context.Context, now, until time.Time) ([]Expiring, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	var lots []model.CreditLot
+	for i := range mr.lots {
+		if dueBonus(&mr.lots[i], until) && mr.lots[i].RemindedAt == nil {
+			mr.lots[i].RemindedAt = &now
+			lots = append(lots, mr.lots[i])
+		}
+	}
+	slices.SortStableFunc(lots, func(a, b model.CreditLot) int {
+		return a.ExpiresAt.Compare(*b.ExpiresAt)
+	})
+	return group(lots), nil
+}
+
+// Referenced is LotsTx: the user's unspent lots of creditType granted under
+// reference, in spending order.
+func (mr *MemoryUserCreditRepo) Referenced(userID uuid.UUID, creditType model.CreditType, reference string) []model.CreditLot {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	return mr.unspent(userID, creditType, func(lot *model.CreditLot) bool {
+		return lot.ReferenceID != nil && *lot.ReferenceID == reference
+	})
+}
+
+// Expire is ExpireTx: it applies transaction, taking the credits from lots
+// in order.
+func (mr *MemoryUserCreditRepo) Expire(ctx context.Context, transaction *model.Transaction, lots []model.CreditLot) (*model.UserCredit, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	userCredit, err := mr.apply(ctx, transaction, ids(lots))
+	if err != nil {
+		return nil, err
+	}
+	for i := range lots {
+		if lot := mr.lot(lots[i].ID); lot != nil {
+			lots[i].Remaining = lot.Remaining
+		}
+	}
+	return userCredit, nil
+}
+
+// Extend is ExtendTx: it moves the expiry of the unspent lots among lots to
+// expiresAt.
+func (mr *MemoryUserCreditRepo) Extend(lots []model.CreditLot, expiresAt time.Time) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	for _, lot := range lots {
+		if stored := mr.lot(lot.ID); stored != nil && stored.Remaining > 0 {
+			stored.ExpiresAt, stored.RemindedAt = &expiresAt, nil
+		}
+	}
+}
+
+// apply records transaction, spending a charge from the lots with ids in
+// order. mu must be held.
+func (mr *MemoryUserCreditRepo) apply(ctx context.Context, transaction *model.Transaction, spend []uuid.UUID) (*model.UserCredit, error) {
+	userCredit := mr.balance(transaction.UserID, transaction.CreditType)
+	if userCredit.Credits+transaction.Amount < 0 {
+		return nil, ErrInsufficientCredits
+	}
+
+	var spends []lotSpend
+	amount := -transaction.Amount
+	for _, id := range spend {
+		lot := mr.lot(id)
+		if amount <= 0 || lot == nil {
+			continue
+		}
+		spent := min(lot.Remaining, amount)
+		if spent == 0 {
+			continue
+		}
+		lot.Remaining -= spent
+		amount -= spent
+		spends = append(spends, newSpend(transaction, id, spent))
+	}
+
+	userCredit, err := mr.record(ctx, userCredit, transaction, transaction.Amount)
+	if err != nil {
+		return nil, err
+	}
+	mr.spends = append(mr.spends, spends...)
+	return userCredit, nil
+}
+
+// record applies transaction to userCredit, records it, and adds granted
+// credits of it as a new lot. mu must be held.
+func (mr *MemoryUserCreditRepo) record(ctx context.Context, userCredit *model.UserCredit, transaction *model.Transaction, granted int) (*model.UserCredit, error) {
+	userCredit.Credits += transaction.Amount
+	userCredit.UpdatedAt = time.Now()
+
+	transaction.BalanceAfter = userCredit.Credits
+	if err := mr.Transactions.Create(ctx, transaction); err != nil {
+		return nil, err
+	}
+
+	if granted > 0 {
+		lot := model.NewCreditLot(transaction)
+		lot.Amount, lot.Remaining = granted, granted
+		lot.ID, lot.CreatedAt, lot.UpdatedAt = uuid.New(), transaction.CreatedAt, transaction.CreatedAt
+		mr.lots = append(mr.lots, *lot)
+	}
+
+	copied := *userCredit
+	return &copied, nil
+}
+
+// unspent returns copies of the unspent lots of a balance that match keep,
+// or all of them if keep is nil, in spending order. mu must be held.
+func (mr *MemoryUserCreditRepo) unspent(userID uuid.UUID, creditType model.CreditType, keep func(*model.CreditLot) bool) []model.CreditLot {
+	var lots []model.CreditLot
+	for i := range mr.lots {
+		lot := &mr.lots[i]
+		if lot.UserID == userID && lot.CreditType == creditType && lot.Remaining > 0 && (keep == nil || keep(lot)) {
+			lots = append(lots, *lot)
+		}
+	}
+	slices.SortStableFunc(lots, func(a, b model.CreditLot) int {
+		switch {
+		case a.SpendsBefore(&b):
+			return -1
+		case b.SpendsBefore(&a):
+			return 1
+		}
+		return 0
+	})
+	return lots
+}
+
+// lot returns the stored lot with id. mu must be held.
+func (mr *MemoryUserCreditRepo) lot(id uuid.UUID) *model.CreditLot {
+	for i := range mr.lots {
+		if mr.lots[i].ID == id {
+			return &mr.lots[i]
+		}
+	}
+	return nil
+}
+
+// keys returns every balance in a stable order. mu must be held.
+func (mr *MemoryUserCreditRepo) keys() []creditKey {
+	var keys []creditKey
+	for key := range mr.credits {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b creditKey) int {
+		if c := slices.Compare(a.userID[:], b.userID[:]); c != 0 {
+			return c
+		}
+		return strings.Compare(string(a.creditType), string(b.creditType))
+	})
+	return keys
+}
+
+func newSpend(charge *model.Transaction, lotID uuid.UUID, amount int) lotSpend {
+	return lotSpend{CreditSpend: model.CreditSpend{LotID: lotID, Amount: amount}, charge: charge}
+}
+
+// charges reports whether s belongs to a usage charge with referenceID.
+func (s lotSpend) charges(referenceID string) bool {
+	return s.charge.Type == model.TransactionTypeUsage && s.charge.ReferenceID != nil && *s.charge.ReferenceID == referenceID
+}
+
+// refundedBy reports whether refund gives s back.
+func (s lotSpend) refundedBy(refund *model.Transaction) bool {
+	return refund.ReferenceID != nil && s.charge.UserID == refund.UserID && s.charges(*refund.ReferenceID)
+}
+
+// dueBonus is dueBonuses for one lot.
+func dueBonus(lot *model.CreditLot, at time.Time) bool {
+	return lot.Remaining > 0 && lot.ExpiresAt != nil && !lot.ExpiresAt.After(at) && lot.Source != model.TransactionTypeSubscription
+}
+
+func ids(lots []model.CreditLot) []uuid.UUID {
+	ids := make([]uuid.UUID, len(lots))
+	for i, lot := range lots {
+		ids[i] = lot.ID
+	}
+	return ids
+}
@@ -0,0 +1,487 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type UserCreditRepo interface {
+	Get(ctx context.Context, userID uuid.UUID, creditType model.CreditType) (*model.UserCredit, error)
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]model.UserCredit, error)
+	// Apply adds transaction.Amount (negative to charge) to the user's
+	// balance of transaction.CreditType and records the transaction with its
+	// BalanceAfter, atomically. It returns ErrInsufficientCredits rather than
+	// let a balance go negative.
+	Apply(ctx context.Context, transaction *model.Transaction) (*model.UserCredit, error)
+	// Refund is Apply for a refund of the usage charges with its ReferenceID.
+	// The credits go back to the lots those charges spent.
+	Refund(ctx context.Context, refund *model.Transaction) (*model.UserCredit, error)
+	// Paid reports whether the usage charges with referenceID spent credits
+	// that were paid for, by a purchase or a subscription, rather than only
+	// granted ones. Charges refunded in full weren't paid.
+	Paid(ctx context.Context, referenceID string) (bool, error)
+
+	// Lots returns the user's unspent lots of creditType in the order
+	// charges spend them.
+	Lots(ctx context.Context, userID uuid.UUID, creditType model.CreditType) ([]model.CreditLot, error)
+	// ExpireDue removes the unspent bonus credits that expired by now, with
+	// one expiry transaction per balance, and returns those transactions.
+	// Subscription credits are left to renewals, which roll some over.
+	ExpireDue(ctx context.Context, now time.Time) ([]model.Transaction, error)
+	// ClaimReminders returns the unspent bonus credits that expire by until
+	// and nobody was reminded of, one Expiring per balance, and marks them
+	// reminded at now.
+	ClaimReminders(ctx context.Context, now, until time.Time) ([]Expiring, error)
+}
+
+// Expiring is credits of one balance that expire soon.
+type Expiring struct {
+	UserID     uuid.UUID
+	CreditType model.CreditType
+	Credits    int
+	// ExpiresAt is when the first of them expire.
+	ExpiresAt time.Time
+}
+
+// paidSources are the lots of credits users paid for.
+var paidSources = []model.TransactionType{model.TransactionTypePurchase, model.TransactionTypeSubscription}
+
+// spendOrder is the order charges spend lots in: soonest expiry first, then
+// oldest, as model.CreditLot.SpendsBefore.
+const spendOrder = "expires_at ASC NULLS LAST, created_at ASC"
+
+var (
+	ErrNotExist            = errors.New("credit balance not found")
+	ErrInsufficientCredits = errors.New("insufficient credits")
+)
+
+type PostgresUserCreditRepo struct {
+	DB *gorm.DB
+}
+
+var _ UserCreditRepo = (*PostgresUserCreditRepo)(nil)
+
+func (pr *PostgresUserCreditRepo) Get(ctx context.Context, userID uuid.UUID, creditType model.CreditType) (*model.UserCredit, error) {
+	var userCredit model.UserCredit
+	err := pr.DB.WithContext(ctx).
+		Where("user_id = ? AND credit_type = ?", userID, creditType).
+		First(&userCredit).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotExist
+		}
+		return nil, fmt.Errorf("failed to get credits: %w", err)
+	}
+	return &userCredit, nil
+}
+
+func (pr *PostgresUserCreditRepo) ListByUser(ctx context.Context, userID uuid.UUID) ([]model.UserCredit, error) {
+	var credits []model.UserCredit
+	if err := pr.DB.WithContext(ctx).Where("user_id = ?", userID).Find(&credits).Error; err != nil {
+		return nil, fmt.Errorf("failed to list credits: %w", err)
+	}
+	return credits, nil
+}
+
+func (pr *PostgresUserCreditRepo) Apply(ctx context.Context, transaction *model.Transaction) (*model.UserCredit, error) {
+	var userCredit *model.UserCredit
+	err := pr.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		userCredit, err = ApplyTx(tx, transaction)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return userCredit, nil
+}
+
+func (pr *PostgresUserCreditRepo) Refund(ctx context.Context, refund *model.Transaction) (*model.UserCredit, error) {
+	var userCredit *model.UserCredit
+	err := pr.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		userCredit, err = RefundTx(tx, refund)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return userCredit, nil
+}
+
+func (pr *PostgresUserCreditRepo) Paid(ctx context.Context, referenceID string) (bool, error) {
+	db := pr.DB.WithContext(ctx)
+	var count int64
+	if err := db.Model(&model.CreditSpend{}).
+		Joins("JOIN credit_lots ON credit_lots.id = credit_spends.lot_id").
+		Where("credit_spends.transaction_id IN (?)", charges(db, referenceID)).
+		Where("credit_lots.source IN ?", paidSources).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check paid credits: %w", err)
+	}
+	if count == 0 {
+		return false, nil
+	}
+
+	// Charges are negative and refunds positive
+	var net int64
+	if err := db.Model(&model.Transaction{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("reference_id = ? AND type IN ?", referenceID, []model.TransactionType{model.TransactionTypeUsage, model.TransactionTypeRefund}).
+		Scan(&net).Error; err != nil {
+		return false, fmt.Errorf("failed to check refunded credits: %w", err)
+	}
+	return net < 0, nil
+}
+
+func (pr *PostgresUserCreditRepo) Lots(ctx context.Context, userID uuid.UUID, creditType model.CreditType) ([]model.CreditLot, error) {
+	var lots []model.CreditLot
+	if err := pr.DB.WithContext(ctx).
+		Where("user_id = ? AND credit_type = ? AND remaining > 0", userID, creditType).
+		Order(spendOrder).
+		Find(&lots).Error; err != nil {
+		return nil, fmt.Errorf("failed to list credit lots: %w", err)
+	}
+	return lots, nil
+}
+
+func (pr *PostgresUserCreditRepo) ExpireDue(ctx context.Context, now time.Time) ([]model.Transaction, error) {
+	var balances []struct {
+		UserID     uuid.UUID
+		CreditType model.CreditType
+	}
+	if err := pr.DB.WithContext(ctx).
+		Model(&model.CreditLot{}).
+		Scopes(dueBonuses(now)).
+		Distinct("user_id", "credit_type").
+		Find(&balances).Error; err != nil {
+		return nil, fmt.Errorf("failed to find expired credits: %w", err)
+	}
+
+	var expired []model.Transaction
+	for _, balance := range balances {
+		var transaction *model.Transaction
+		err := pr.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			// Charges change lots with the balance locked, so lock it first.
+			if _, err := lockTx(tx, balance.UserID, balance.CreditType); err != nil {
+				return err
+			}
+
+			var lots []model.CreditLot
+			if err := tx.Where("user_id = ? AND credit_type = ?", balance.UserID, balance.CreditType).
+				Scopes(dueBonuses(now)).
+				Order(spendOrder).
+				Find(&lots).Error; err != nil {
+				return fmt.Errorf("failed to load credit lots: %w", err)
+			}
+
+			transaction = expiry(lots)
+			if transaction == nil {
+				return nil
+			}
+			_, err := ExpireTx(tx, transaction, lots)
+			return err
+		})
+		if err != nil {
+			return expired, fmt.Errorf("failed to expire credits: %w", err)
+		}
+		if transaction != nil {
+			expired = append(expired, *transaction)
+		}
+	}
+	return expired, nil
+}
+
+// ClaimReminders uses SKIP LOCKED so it never waits on a charge, and
+// several jobs can't remind of the same lot.
+func (pr *PostgresUserCreditRepo) ClaimReminders(ctx context.Context, now, until time.Time) ([]Expiring, error) {
+	var expiring []Expiring
+
+	err := pr.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var lots []model.CreditLot
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Scopes(dueBonuses(until)).
+			Where("reminded_at IS NULL").
+			Order("expires_at ASC").
+			Find(&lots).Error; err != nil {
+			return err
+		}
+		if len(lots) == 0 {
+			return nil
+		}
+
+		if err := tx.Model(&model.CreditLot{}).Where("id IN ?", ids(lots)).Update("reminded_at", now).Error; err != nil {
+			return err
+		}
+
+		expiring = group(lots)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim expiry reminders: %w", err)
+	}
+	return expiring, nil
+}
+
+// ApplyTx is Apply within an existing database transaction, for writes that
+// charge credits together with other rows. The balance row is locked until
+// tx ends and is created if the user has none yet. A charge spends the
+// balance's lots in spendOrder; a grant adds a lot expiring at
+// transaction.ExpiresAt.
+func ApplyTx(tx *gorm.DB, transaction *model.Transaction) (*model.UserCredit, error) {
+	userCredit, err := lockTx(tx, transaction.UserID, transaction.CreditType)
+	if err != nil {
+		return nil, err
+	}
+
+	if userCredit.Credits+transaction.Amount < 0 {
+		return nil, ErrInsufficientCredits
+	}
+
+	if transaction.Amount < 0 {
+		var lots []model.CreditLot
+		if err := tx.Where("user_id = ? AND credit_type = ? AND remaining > 0", transaction.UserID, transaction.CreditType).
+			Order(spendOrder).
+			Find(&lots).Error; err != nil {
+			return nil, fmt.Errorf("failed to load credit lots: %w", err)
+		}
+		spends, err := spendTx(tx, lots, -transaction.Amount)
+		if err != nil {
+			return nil, err
+		}
+		if userCredit, err = recordTx(tx, userCredit, transaction, 0); err != nil {
+			return nil, err
+		}
+		for i := range spends {
+			spends[i].TransactionID = transaction.ID
+		}
+		if len(spends) > 0 {
+			if err := tx.Create(&spends).Error; err != nil {
+				return nil, fmt.Errorf("failed to record credit spends: %w", err)
+			}
+		}
+		return userCredit, nil
+	}
+
+	return recordTx(tx, userCredit, transaction, transaction.Amount)
+}
+
+// RefundTx is Refund within an existing database transaction. What a charge
+// took from each lot is restored, so the credits keep their source and
+// expire when they would have; only an amount no spend was recorded for,
+// as for charges from before spends were, is granted as a new lot.
+func RefundTx(tx *gorm.DB, refund *model.Transaction) (*model.UserCredit, error) {
+	userCredit, err := lockTx(tx, refund.UserID, refund.CreditType)
+	if err != nil {
+		return nil, err
+	}
+
+	var spends []model.CreditSpend
+	if refund.ReferenceID != nil {
+		if err := tx.Where("transaction_id IN (?)", charges(tx, *refund.ReferenceID)).
+			Order("created_at ASC").
+			Find(&spends).Error; err != nil {
+			return nil, fmt.Errorf("failed to load credit spends: %w", err)
+		}
+	}
+
+	left := refund.Amount
+	for _, spend := range spends {
+		restored := min(spend.Amount, left)
+		if restored <= 0 {
+			break
+		}
+		if err := tx.Model(&model.CreditLot{}).Where("id = ?", spend.LotID).
+			Update("remaining", gorm.Expr("remaining + ?", restored)).Error; err != nil {
+			return nil, fmt.Errorf("failed to restore credit lot: %w", err)
+		}
+		left -= restored
+	}
+
+	return recordTx(tx, userCredit, refund, left)
+}
+
+// ExpireTx is ApplyTx for a transaction removing credits from lots, in
+// their order, rather than from the lots a charge would spend. Remaining is
+// updated in lots.
+func ExpireTx(tx *gorm.DB, transaction *model.Transaction, lots []model.CreditLot) (*model.UserCredit, error) {
+	userCredit, err := lockTx(tx, transaction.UserID, transaction.CreditType)
+	if err != nil {
+		return nil, err
+	}
+
+	if userCredit.Credits+transaction.Amount < 0 {
+		return nil, ErrInsufficientCredits
+	}
+
+	if _, err := spendTx(tx, lots, -transaction.Amount); err != nil {
+		return nil, err
+	}
+
+	return recordTx(tx, userCredit, transaction, 0)
+}
+
+// LotsTx locks the balance of creditType until tx ends and returns its
+// unspent lots granted under reference, such as a subscription, in
+// spendOrder.
+func LotsTx(tx *gorm.DB, userID uuid.UUID, creditType model.CreditType, reference string) ([]model.CreditLot, error) {
+	if _, err := lockTx(tx, userID, creditType); err != nil {
+		return nil, err
+	}
+
+	var lots []model.CreditLot
+	if err := tx.Where("user_id = ? AND credit_type = ? AND reference_id = ? AND remaining > 0", userID, creditType, reference).
+		Order(spendOrder).
+		Find(&lots).Error; err != nil {
+		return nil, fmt.Errorf("failed to load credit lots: %w", err)
+	}
+	return lots, nil
+}
+
+// ExtendTx moves the expiry of the unspent lots among lots to expiresAt.
+func ExtendTx(tx *gorm.DB, lots []model.CreditLot, expiresAt time.Time) error {
+	var ids []uuid.UUID
+	for _, lot := range lots {
+		if lot.Remaining > 0 {
+			ids = append(ids, lot.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if err := tx.Model(&model.CreditLot{}).Where("id IN ?", ids).Updates(map[string]any{
+		"expires_at":  expiresAt,
+		"reminded_at": nil,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to extend credit lots: %w", err)
+	}
+	return nil
+}
+
+// lockTx returns the balance of creditType, locked until tx ends, creating
+// it if the user has none yet.
+func lockTx(tx *gorm.DB, userID uuid.UUID, creditType model.CreditType) (*model.UserCredit, error) {
+	userCredit := model.UserCredit{UserID: userID, CreditType: creditType}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND credit_type = ?", userID, creditType).
+		FirstOrCreate(&userCredit).Error; err != nil {
+		return nil, fmt.Errorf("failed to load credits: %w", err)
+	}
+	return &userCredit, nil
+}
+
+// spendTx takes amount from lots in order and returns what it took from
+// each. The balance, not its lots, decides whether a charge fits, so lots
+// running out first (only possible for a balance changed outside the
+// ledger) is not an error.
+func spendTx(tx *gorm.DB, lots []model.CreditLot, amount int) ([]model.CreditSpend, error) {
+	var spends []model.CreditSpend
+	for i := range lots {
+		if amount == 0 {
+			break
+		}
+
+		spent := min(lots[i].Remaining, amount)
+		if spent == 0 {
+			continue
+		}
+		lots[i].Remaining -= spent
+		amount -= spent
+
+		if err := tx.Model(&lots[i]).Update("remaining", lots[i].Remaining).Error; err != nil {
+			return nil, fmt.Errorf("failed to spend credit lot: %w", err)
+		}
+		spends = append(spends, model.CreditSpend{LotID: lots[i].ID, Amount: spent})
+	}
+	return spends, nil
+}
+
+// recordTx applies transaction to the locked userCredit, records it, and
+// adds granted credits of it as a new lot.
+func recordTx(tx *gorm.DB, userCredit *model.UserCredit, transaction *model.Transaction, granted int) (*model.UserCredit, error) {
+	if err := userCredit.UpdateBalance(tx, transaction.Amount); err != nil {
+		return nil, fmt.Errorf("failed to update credits: %w", err)
+	}
+
+	transaction.BalanceAfter = userCredit.Credits
+	if err := tx.Create(transaction).Error; err != nil {
+		return nil, fmt.Errorf("failed to create transaction record: %w", err)
+	}
+
+	if granted > 0 {
+		lot := model.NewCreditLot(transaction)
+		lot.Amount, lot.Remaining = granted, granted
+		if err := tx.Create(lot).Error; err != nil {
+			return nil, fmt.Errorf("failed to create credit lot: %w", err)
+		}
+	}
+
+	return userCredit, nil
+}
+
+// charges is the query for the IDs of the usage transactions with
+// referenceID.
+func charges(tx *gorm.DB, referenceID string) *gorm.DB {
+	return tx.Session(&gorm.Session{NewDB: true}).Model(&model.Transaction{}).
+		Select("id").
+		Where("reference_id = ? AND type = ?", referenceID, model.TransactionTypeUsage)
+}
+
+// dueBonuses scopes a query to the unspent lots that expire by at and that
+// ExpireDue sweeps.
+func dueBonuses(at time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("remaining > 0 AND expires_at <= ? AND source <> ?", at, model.TransactionTypeSubscription)
+	}
+}
+
+// expiry is the ledger entry removing what is left of lots, which belong to
+// one balance, or nil if nothing is.
+func expiry(lots []model.CreditLot) *model.Transaction {
+	credits := Unspent(lots)
+	if credits == 0 {
+		return nil
+	}
+
+	return &model.Transaction{
+		UserID:      lots[0].UserID,
+		CreditType:  lots[0].CreditType,
+		Amount:      -credits,
+		Type:        model.TransactionTypeExpiry,
+		Description: "Bonus credits expired",
+	}
+}
+
+// group sums lots ordered by expiry into one Expiring per balance.
+func group(lots []model.CreditLot) []Expiring {
+	var expiring []Expiring
+	index := make(map[creditKey]int)
+	for _, lot := range lots {
+		key := creditKey{lot.UserID, lot.CreditType}
+		i, ok := index[key]
+		if !ok {
+			i = len(expiring)
+			index[key] = i
+			expiring = append(expiring, Expiring{UserID: lot.UserID, CreditType: lot.CreditType, ExpiresAt: *lot.ExpiresAt})
+		}
+		expiring[i].Credits += lot.Remaining
+	}
+	return expiring
+}
+
+// Unspent is the credits left in lots.
+func Unspent(lots []model.CreditLot) int {
+	var credits int
+	for _, lot := range lots {
+		credits += lot.Remaining
+	}
+	return credits
+}
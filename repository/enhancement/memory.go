@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/model"
+	creditrepo "github.com/Leul-Michael/image-generation/repository/credit"
+	"github.com/google/uuid"
+)
+
+// MemoryPromptEnhancementRepo is an in-memory PromptEnhancementRepo for
+// tests. Charges are applied to Credits.
+type MemoryPromptEnhancementRepo struct {
+	mu      sync.Mutex
+	records map[uuid.UUID]model.PromptEnhancement
+
+	Credits *creditrepo.MemoryUserCreditRepo
+}
+
+var _ PromptEnhancementRepo = (*MemoryPromptEnhancementRepo)(nil)
+
+func NewMemoryPromptEnhancementRepo(credits *creditrepo.MemoryUserCreditRepo) *MemoryPromptEnhancementRepo {
+	return &MemoryPromptEnhancementRepo{
+		records: make(map[uuid.UUID]model.PromptEnhancement),
+		Credits: credits,
+	}
+}
+
+func (mr *MemoryPromptEnhancementRepo) CountByUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	var count int64
+	for _, record := range mr.records {
+		if record.UserID == userID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (mr *MemoryPromptEnhancementRepo) Create(ctx context.Context, record *model.PromptEnhancement) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	now := time.Now()
+	record.ID, record.CreatedAt, record.UpdatedAt = uuid.New(), now, now
+
+	if record.CreditsCharged > 0 {
+		if _, err := mr.Credits.Apply(ctx, charge(record)); err != nil {
+			return err
+		}
+	}
+
+	mr.records[record.ID] = *record
+	return nil
+}
+
+func (mr *MemoryPromptEnhancementRepo) SetAccepted(ctx context.Context, id uuid.UUID, accepted bool) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	record, ok := mr.records[id]
+	if !ok {
+		return ErrNotExist
+	}
+	record.Accepted = &accepted
+	mr.records[id] = record
+	return nil
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Leul-Michael/image-generation/model"
+	creditrepo "github.com/Leul-Michael/image-generation/repository/credit"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type PromptEnhancementRepo interface {
+	CountByUser(ctx context.Context, userID uuid.UUID) (int64, error)
+	// Create stores the enhancement and, when CreditsCharged is set, takes
+	// them from the user's image balance in the same transaction. It returns
+	// creditrepo.ErrInsufficientCredits without storing anything if the
+	// balance is too low.
+	Create(ctx context.Context, record *model.PromptEnhancement) error
+	SetAccepted(ctx context.Context, id uuid.UUID, accepted bool) error
+}
+
+var ErrNotExist = errors.New("prompt enhancement not found")
+
+type PostgresPromptEnhancementRepo struct {
+	DB *gorm.DB
+}
+
+var _ PromptEnhancementRepo = (*PostgresPromptEnhancementRepo)(nil)
+
+func (pr *PostgresPromptEnhancementRepo) CountByUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	var count int64
+	err := pr.DB.WithContext(ctx).
+		Model(&model.PromptEnhancement{}).
+		Where("user_id = ?", userID).
+		Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count prompt enhancements: %w", err)
+	}
+	return count, nil
+}
+
+func (pr *PostgresPromptEnhancementRepo) Create(ctx context.Context, record *model.PromptEnhancement) error {
+	return pr.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(record).Error; err != nil {
+			return fmt.Errorf("failed to create enhancement record: %w", err)
+		}
+
+		if record.CreditsCharged == 0 {
+			return nil
+		}
+
+		_, err := creditrepo.ApplyTx(tx, charge(record))
+		return err
+	})
+}
+
+func (pr *PostgresPromptEnhancementRepo) SetAccepted(ctx context.Context, id uuid.UUID, accepted bool) error {
+	err := pr.DB.WithContext(ctx).
+		Model(&model.PromptEnhancement{}).
+		Where("id = ?", id).
+		Update("accepted", accepted).Error
+	if err != nil {
+		return fmt.Errorf("failed to update prompt enhancement: %w", err)
+	}
+	return nil
+}
+
+// charge is the usage transaction for an enhancement, referencing it by ID.
+func charge(record *model.PromptEnhancement) *model.Transaction {
+	referenceID := record.ID.String()
+	return &model.Transaction{
+		UserID:      record.UserID,
+		CreditType:  model.CreditTypeImage,
+		Amount:      -record.CreditsCharged,
+		Type:        model.TransactionTypeUsage,
+		Description: fmt.Sprintf("Prompt enhancement (%d tokens)", record.TotalTokens),
+		ReferenceID: &referenceID,
+	}
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/model"
+	"github.com/google/uuid"
+)
+
+// MemoryIdempotencyKeyRepo is an in-memory IdempotencyKeyRepo for tests.
+type MemoryIdempotencyKeyRepo struct {
+	mu   sync.Mutex
+	keys map[string]model.IdempotencyKey
+}
+
+var _ IdempotencyKeyRepo = (*MemoryIdempotencyKeyRepo)(nil)
+
+func NewMemoryIdempotencyKeyRepo() *MemoryIdempotencyKeyRepo {
+	return &MemoryIdempotencyKeyRepo{keys: make(map[string]model.IdempotencyKey)}
+}
+
+func (mr *MemoryIdempotencyKeyRepo) Claim(ctx context.Context, key *model.IdempotencyKey) (*model.IdempotencyKey, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := mr.keys[key.Key]; ok && existing.ExpiresAt.After(now) {
+		return &existing, ErrExists
+	}
+
+	key.ID, key.CreatedAt, key.UpdatedAt = uuid.New(), now, now
+	mr.keys[key.Key] = *key
+	return key, nil
+}
+
+func (mr *MemoryIdempotencyKeyRepo) Complete(ctx context.Context, key *model.IdempotencyKey, statusCode int, response []byte) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	now := time.Now()
+	key.StatusCode, key.Response, key.CompletedAt = statusCode, response, &now
+	if stored, ok := mr.keys[key.Key]; ok && stored.ID == key.ID {
+		mr.keys[key.Key] = *key
+	}
+	return nil
+}
+
+func (mr *MemoryIdempotencyKeyRepo) Release(ctx context.Context, key *model.IdempotencyKey) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if stored, ok := mr.keys[key.Key]; ok && stored.ID == key.ID {
+		delete(mr.keys, key.Key)
+	}
+	return nil
+}
+
+func (mr *MemoryIdempotencyKeyRepo) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	var deleted int64
+	for k, key := range mr.keys {
+		if !key.ExpiresAt.After(now) {
+			delete(mr.keys, k)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
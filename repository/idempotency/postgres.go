@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IdempotencyKeyRepo remembers actions that have run, so repeats of them
+// can be told apart from new ones.
+type IdempotencyKeyRepo interface {
+	// Claim stores key unless an unexpired key with the same Key exists, in
+	// which case it returns that one and ErrExists. An expired key is
+	// replaced.
+	Claim(ctx context.Context, key *model.IdempotencyKey) (*model.IdempotencyKey, error)
+	// Complete stores the response of the action key was claimed for.
+	Complete(ctx context.Context, key *model.IdempotencyKey, statusCode int, response []byte) error
+	// Release deletes key so the action can be tried again, e.g. after it
+	// failed.
+	Release(ctx context.Context, key *model.IdempotencyKey) error
+	// DeleteExpired deletes the keys that expired by now and returns how
+	// many there were.
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+var ErrExists = errors.New("idempotency key already used")
+
+type PostgresIdempotencyKeyRepo struct {
+	DB *gorm.DB
+}
+
+var _ IdempotencyKeyRepo = (*PostgresIdempotencyKeyRepo)(nil)
+
+// Claim relies on the unique index on key, so of two concurrent claims only
+// one inserts.
+func (pr *PostgresIdempotencyKeyRepo) Claim(ctx context.Context, key *model.IdempotencyKey) (*model.IdempotencyKey, error) {
+	var existing model.IdempotencyKey
+
+	err := pr.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().
+			Where("key = ? AND expires_at <= ?", key.Key, time.Now()).
+			Delete(&model.IdempotencyKey{}).Error; err != nil {
+			return fmt.Errorf("failed to delete expired idempotency key: %w", err)
+		}
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(key)
+		if result.Error != nil {
+			return fmt.Errorf("failed to claim idempotency key: %w", result.Error)
+		}
+		if result.RowsAffected > 0 {
+			return nil
+		}
+
+		if err := tx.Where("key = ?", key.Key).First(&existing).Error; err != nil {
+			return fmt.Errorf("failed to load idempotency key: %w", err)
+		}
+		return ErrExists
+	})
+	if errors.Is(err, ErrExists) {
+		return &existing, ErrExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (pr *PostgresIdempotencyKeyRepo) Complete(ctx context.Context, key *model.IdempotencyKey, statusCode int, response []byte) error {
+	now := time.Now()
+	if err := pr.DB.WithContext(ctx).Model(key).Updates(map[string]any{
+		"status_code":  statusCode,
+		"response":     response,
+		"completed_at": now,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+
+	key.StatusCode, key.Response, key.CompletedAt = statusCode, response, &now
+	return nil
+}
+
+func (pr *PostgresIdempotencyKeyRepo) Release(ctx context.Context, key *model.IdempotencyKey) error {
+	if err := pr.DB.WithContext(ctx).Unscoped().Delete(key).Error; err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+func (pr *PostgresIdempotencyKeyRepo) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	result := pr.DB.WithContext(ctx).Unscoped().Where("expires_at <= ?", now).Delete(&model.IdempotencyKey{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/model"
+	"github.com/google/uuid"
+)
+
+// MemoryGeneratedImageRepo is an in-memory GeneratedImageRepo for tests.
+type MemoryGeneratedImageRepo struct {
+	mu     sync.Mutex
+	images []model.GeneratedImage
+}
+
+var _ GeneratedImageRepo = (*MemoryGeneratedImageRepo)(nil)
+
+func NewMemoryGeneratedImageRepo() *MemoryGeneratedImageRepo {
+	return &MemoryGeneratedImageRepo{}
+}
+
+func (mr *MemoryGeneratedImageRepo) Create(ctx context.Context, image *model.GeneratedImage) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	now := time.Now()
+	image.ID, image.CreatedAt, image.UpdatedAt = uuid.New(), now, now
+	mr.images = append(mr.images, *image)
+	return nil
+}
+
+func (mr *MemoryGeneratedImageRepo) GetByID(ctx context.Context, id uuid.UUID) (*model.GeneratedImage, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	for _, image := range mr.images {
+		if image.ID == id {
+			return &image, nil
+		}
+	}
+	return nil, ErrNotExist
+}
+
+func (mr *MemoryGeneratedImageRepo) ListByUser(ctx context.Context, userID uuid.UUID, limit int) ([]model.GeneratedImage, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	var images []model.GeneratedImage
+	for i := len(mr.images) - 1; i >= 0 && len(images) < limit; i-- {
+		if mr.images[i].UserID == userID {
+			images = append(images, mr.images[i])
+		}
+	}
+	return images, nil
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Leul-Michael/image-generation/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type GeneratedImageRepo interface {
+	Create(ctx context.Context, image *model.GeneratedImage) error
+	GetByID(ctx context.Context, id uuid.UUID) (*model.GeneratedImage, error)
+	// ListByUser returns the user's newest images first.
+	ListByUser(ctx context.Context, userID uuid.UUID, limit int) ([]model.GeneratedImage, error)
+}
+
+var ErrNotExist = errors.New("generated image not found")
+
+type PostgresGeneratedImageRepo struct {
+	DB *gorm.DB
+}
+
+var _ GeneratedImageRepo = (*PostgresGeneratedImageRepo)(nil)
+
+func (pr *PostgresGeneratedImageRepo) Create(ctx context.Context, image *model.GeneratedImage) error {
+	if err := pr.DB.WithContext(ctx).Create(image).Error; err != nil {
+		return fmt.Errorf("failed to create generated image: %w", err)
+	}
+	return nil
+}
+
+func (pr *PostgresGeneratedImageRepo) GetByID(ctx context.Context, id uuid.UUID) (*model.GeneratedImage, error) {
+	var image model.GeneratedImage
+	if err := pr.DB.WithContext(ctx).Where("id = ?", id).First(&image).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotExist
+		}
+		return nil, fmt.Errorf("failed to get generated image: %w", err)
+	}
+	return &image, nil
+}
+
+func (pr *PostgresGeneratedImageRepo) ListByUser(ctx context.Context, userID uuid.UUID, limit int) ([]model.GeneratedImage, error) {
+	var images []model.GeneratedImage
+	err := pr.DB.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&images).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list generated images: %w", err)
+	}
+	return images, nil
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/model"
+	creditrepo "github.com/Leul-Michael/image-generation/repository/credit"
+	"github.com/google/uuid"
+)
+
+// MemoryPromoCodeRepo is an in-memory PromoCodeRepo for tests. Credits are
+// paid into Credits, expiring after BonusExpiry, and its Transactions also
+// tell who has bought before.
+type MemoryPromoCodeRepo struct {
+	mu          sync.Mutex
+	codes       map[string]*model.PromoCode
+	redemptions []model.PromoRedemption
+
+	Credits     *creditrepo.MemoryUserCreditRepo
+	BonusExpiry time.Duration
+}
+
+var _ PromoCodeRepo = (*MemoryPromoCodeRepo)(nil)
+
+func NewMemoryPromoCodeRepo(credits *creditrepo.MemoryUserCreditRepo) *MemoryPromoCodeRepo {
+	return &MemoryPromoCodeRepo{
+		codes:   make(map[string]*model.PromoCode),
+		Credits: credits,
+	}
+}
+
+func (mr *MemoryPromoCodeRepo) Create(ctx context.Context, promo *model.PromoCode) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if _, ok := mr.codes[promo.Code]; ok {
+		return ErrCodeTaken
+	}
+
+	now := time.Now()
+	promo.ID, promo.CreatedAt, promo.UpdatedAt = uuid.New(), now, now
+	stored := *promo
+	mr.codes[promo.Code] = &stored
+	return nil
+}
+
+func (mr *MemoryPromoCodeRepo) GetByCode(ctx context.Context, code string) (*model.PromoCode, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	promo, ok := mr.codes[code]
+	if !ok {
+		return nil, ErrNotExist
+	}
+	copied := *promo
+	return &copied, nil
+}
+
+func (mr *MemoryPromoCodeRepo) Redeem(ctx context.Context, code string, user *model.User) (*model.PromoRedemption, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	promo, ok := mr.codes[code]
+	if !ok {
+		return nil, ErrNotExist
+	}
+
+	var used int
+	for _, redemption := range mr.redemptions {
+		if redemption.PromoCodeID == promo.ID && redemption.UserID == user.ID {
+			used++
+		}
+	}
+	if err := check(promo, user, used, mr.hasPurchased(ctx, user.ID), time.Now()); err != nil {
+		return nil, err
+	}
+
+	redemption := newRedemption(promo, user.ID)
+	now := time.Now()
+	redemption.ID, redemption.CreatedAt, redemption.UpdatedAt = uuid.New(), now, now
+	redemption.PromoCode = *promo
+
+	if promo.Credits > 0 {
+		if _, err := mr.Credits.Apply(ctx, grant(&redemption, model.ExpiresAfter(time.Now(), mr.BonusExpiry))); err != nil {
+			return nil, err
+		}
+	}
+
+	promo.Redemptions++
+	redemption.PromoCode.Redemptions = promo.Redemptions
+	mr.redemptions = append(mr.redemptions, redemption)
+	return &redemption, nil
+}
+
+func (mr *MemoryPromoCodeRepo) ApplyDepositBonus(ctx context.Context, userID uuid.UUID, purchased int) (*model.PromoRedemption, *model.Transaction, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	// Redemptions are appended in order, so the first pending one is the
+	// oldest
+	for i := range mr.redemptions {
+		redemption := &mr.redemptions[i]
+		if redemption.UserID != userID || redemption.AppliedAt != nil || redemption.BonusPercent == 0 {
+			continue
+		}
+
+		transaction := depositBonus(redemption, purchased, model.ExpiresAfter(time.Now(), mr.BonusExpiry))
+		if transaction == nil {
+			return nil, nil, ErrNotExist
+		}
+		if _, err := mr.Credits.Apply(ctx, transaction); err != nil {
+			return nil, nil, err
+		}
+
+		now := time.Now()
+		redemption.AppliedAt, redemption.UpdatedAt = &now, now
+		applied := *redemption
+		return &applied, transaction, nil
+	}
+	return nil, nil, ErrNotExist
+}
+
+// hasPurchased reports whether the user has a purchase transaction.
+func (mr *MemoryPromoCodeRepo) hasPurchased(ctx context.Context, userID uuid.UUID) bool {
+	transactions, _ := mr.Credits.Transactions.ListByUser(ctx, userID, math.MaxInt)
+	for _, transaction := range transactions {
+		if transaction.Type == model.TransactionTypePurchase {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/model"
+	creditrepo "github.com/Leul-Michael/image-generation/repository/credit"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PromoCodeRepo interface {
+	// Create returns ErrCodeTaken if promo.Code is in use.
+	Create(ctx context.Context, promo *model.PromoCode) error
+	GetByCode(ctx context.Context, code string) (*model.PromoCode, error)
+	// Redeem records a redemption of code by user and grants its credits,
+	// checking the validity window, limits and eligibility under a lock on
+	// the code, so concurrent redemptions cannot exceed MaxRedemptions or
+	// PerUserLimit. The returned redemption has PromoCode loaded.
+	Redeem(ctx context.Context, code string, user *model.User) (*model.PromoRedemption, error)
+	// ApplyDepositBonus pays the user's oldest pending deposit bonus on a
+	// deposit of purchased credits. It returns ErrNotExist when there is no
+	// bonus to pay.
+	ApplyDepositBonus(ctx context.Context, userID uuid.UUID, purchased int) (*model.PromoRedemption, *model.Transaction, error)
+}
+
+var (
+	ErrNotExist     = errors.New("promo code not found")
+	ErrCodeTaken    = errors.New("promo code already exists")
+	ErrNotOpen      = errors.New("promo code is not valid at this time")
+	ErrExhausted    = errors.New("promo code has been fully redeemed")
+	ErrLimitReached = errors.New("promo code already redeemed by this user")
+	ErrNotEligible  = errors.New("user is not eligible for this promo code")
+)
+
+type PostgresPromoCodeRepo struct {
+	DB *gorm.DB
+	// BonusExpiry is how long promo credits last, forever when zero.
+	BonusExpiry time.Duration
+}
+
+var _ PromoCodeRepo = (*PostgresPromoCodeRepo)(nil)
+
+func (pr *PostgresPromoCodeRepo) Create(ctx context.Context, promo *model.PromoCode) error {
+	result := pr.DB.WithContext(ctx).
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "code"}}, DoNothing: true}).
+		Create(promo)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create promo code: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrCodeTaken
+	}
+	return nil
+}
+
+func (pr *PostgresPromoCodeRepo) GetByCode(ctx context.Context, code string) (*model.PromoCode, error) {
+	var promo model.PromoCode
+	if err := pr.DB.WithContext(ctx).Where("code = ?", code).First(&promo).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotExist
+		}
+		return nil, fmt.Errorf("failed to get promo code: %w", err)
+	}
+	return &promo, nil
+}
+
+func (pr *PostgresPromoCodeRepo) Redeem(ctx context.Context, code string, user *model.User) (*model.PromoRedemption, error) {
+	var redemption model.PromoRedemption
+	err := pr.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var promo model.PromoCode
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("code = ?", code).
+			First(&promo).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotExist
+			}
+			return fmt.Errorf("failed to load promo code: %w", err)
+		}
+
+		var used, purchases int64
+		if err := tx.Model(&model.PromoRedemption{}).
+			Where("promo_code_id = ? AND user_id = ?", promo.ID, user.ID).
+			Count(&used).Error; err != nil {
+			return fmt.Errorf("failed to count redemptions: %w", err)
+		}
+		if err := tx.Model(&model.Transaction{}).
+			Where("user_id = ? AND type = ?", user.ID, model.TransactionTypePurchase).
+			Count(&purchases).Error; err != nil {
+			return fmt.Errorf("failed to count purchases: %w", err)
+		}
+		if err := check(&promo, user, int(used), purchases > 0, time.Now()); err != nil {
+			return err
+		}
+
+		redemption = newRedemption(&promo, user.ID)
+		if err := tx.Create(&redemption).Error; err != nil {
+			return fmt.Errorf("failed to create redemption: %w", err)
+		}
+		if err := tx.Model(&promo).Update("redemptions", gorm.Expr("redemptions + 1")).Error; err != nil {
+			return fmt.Errorf("failed to count redemption: %w", err)
+		}
+		promo.Redemptions++
+		redemption.PromoCode = promo
+
+		if promo.Credits > 0 {
+			if _, err := creditrepo.ApplyTx(tx, grant(&redemption, model.ExpiresAfter(time.Now(), pr.BonusExpiry))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &redemption, nil
+}
+
+func (pr *PostgresPromoCodeRepo) ApplyDepositBonus(ctx context.Context, userID uuid.UUID, purchased int) (*model.PromoRedemption, *model.Transaction, error) {
+	var redemption model.PromoRedemption
+	var transaction *model.Transaction
+	err := pr.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND applied_at IS NULL AND bonus_percent > 0", userID).
+			Order("created_at").
+			First(&redemption).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotExist
+			}
+			return fmt.Errorf("failed to load pending bonus: %w", err)
+		}
+		if err := tx.Where("id = ?", redemption.PromoCodeID).First(&redemption.PromoCode).Error; err != nil {
+			return fmt.Errorf("failed to load promo code: %w", err)
+		}
+
+		transaction = depositBonus(&redemption, purchased, model.ExpiresAfter(time.Now(), pr.BonusExpiry))
+		if transaction == nil {
+			return ErrNotExist
+		}
+		if _, err := creditrepo.ApplyTx(tx, transaction); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		redemption.AppliedAt = &now
+		if err := tx.Model(&redemption).Update("applied_at", now).Error; err != nil {
+			return fmt.Errorf("failed to update redemption: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &redemption, transaction, nil
+}
+
+// check applies the rules of promo to a redemption by user, who has used
+// the code used times before.
+func check(promo *model.PromoCode, user *model.User, used int, hasPurchased bool, now time.Time) error {
+	switch {
+	case !promo.Open(now):
+		return ErrNotOpen
+	case promo.Exhausted():
+		return ErrExhausted
+	case promo.PerUserLimit > 0 && used >= promo.PerUserLimit:
+		return ErrLimitReached
+	case !promo.Eligible(user.Lang, hasPurchased):
+		return ErrNotEligible
+	}
+	return nil
+}
+
+// newRedemption is a redemption of promo by userID. Credits are applied at
+// once, so only a deposit bonus is left pending.
+func newRedemption(promo *model.PromoCode, userID uuid.UUID) model.PromoRedemption {
+	redemption := model.PromoRedemption{
+		PromoCodeID:  promo.ID,
+		UserID:       userID,
+		Credits:      promo.Credits,
+		BonusPercent: promo.BonusPercent,
+	}
+	if promo.BonusPercent == 0 {
+		now := time.Now()
+		redemption.AppliedAt = &now
+	}
+	return redemption
+}
+
+// grant is the ledger entry for the credits of redemption, expiring at
+// expiresAt.
+func grant(redemption *model.PromoRedemption, expiresAt *time.Time) *model.Transaction {
+	reference := redemption.ID.String()
+	return &model.Transaction{
+		UserID:      redemption.UserID,
+		CreditType:  model.CreditTypeImage,
+		Amount:      redemption.Credits,
+		Type:        model.TransactionTypePromo,
+		Description: fmt.Sprintf("Promo code %s", redemption.PromoCode.Code),
+		ReferenceID: &reference,
+		ExpiresAt:   expiresAt,
+	}
+}
+
+// depositBonus is the ledger entry for redemption's bonus on a deposit of
+// purchased credits, rounded down. It is nil when that rounds to nothing, so
+// the bonus stays pending for a bigger deposit.
+func depositBonus(redemption *model.PromoRedemption, purchased int, expiresAt *time.Time) *model.Transaction {
+	bonus := purchased * redemption.BonusPercent / 100
+	if bonus <= 0 {
+		return nil
+	}
+
+	reference := redemption.ID.String()
+	return &model.Transaction{
+		UserID:      redemption.UserID,
+		CreditType:  model.CreditTypeImage,
+		Amount:      bonus,
+		Type:        model.TransactionTypePromo,
+		Description: fmt.Sprintf("Promo code %s: %d%% deposit bonus", redemption.PromoCode.Code, redemption.BonusPercent),
+		ReferenceID: &reference,
+		ExpiresAt:   expiresAt,
+	}
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/model"
+	creditrepo "github.com/Leul-Michael/image-generation/repository/credit"
+	userrepo "github.com/Leul-Michael/image-generation/repository/user"
+	"github.com/google/uuid"
+)
+
+// MemoryReferralRepo is an in-memory ReferralRepo for tests. Bonuses are
+// paid into Credits, expiring after BonusExpiry.
+type MemoryReferralRepo struct {
+	mu        sync.Mutex
+	referrals []model.Referral
+
+	Users       *userrepo.MemoryUserRepo
+	Credits     *creditrepo.MemoryUserCreditRepo
+	BonusExpiry time.Duration
+}
+
+var _ ReferralRepo = (*MemoryReferralRepo)(nil)
+
+func NewMemoryReferralRepo(users *userrepo.MemoryUserRepo, credits *creditrepo.MemoryUserCreditRepo) *MemoryReferralRepo {
+	return &MemoryReferralRepo{
+		Users:   users,
+		Credits: credits,
+	}
+}
+
+func (mr *MemoryReferralRepo) Create(ctx context.Context, referral *model.Referral) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	for _, existing := range mr.referrals {
+		if existing.RefereeID == referral.RefereeID {
+			return ErrAlreadyReferred
+		}
+	}
+
+	now := time.Now()
+	referral.ID, referral.CreatedAt, referral.UpdatedAt = uuid.New(), now, now
+	mr.referrals = append(mr.referrals, *referral)
+	return nil
+}
+
+func (mr *MemoryReferralRepo) Reward(ctx context.Context, refereeID uuid.UUID, referrerBonus, refereeBonus int) (*model.Referral, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	var referral *model.Referral
+	for i := range mr.referrals {
+		if mr.referrals[i].RefereeID == refereeID && mr.referrals[i].RewardedAt == nil {
+			referral = &mr.referrals[i]
+		}
+	}
+	if referral == nil {
+		return nil, ErrNotExist
+	}
+
+	// Bonuses only add credits, so applying them cannot fail halfway.
+	for _, transaction := range bonuses(referral, referrerBonus, refereeBonus, model.ExpiresAfter(time.Now(), mr.BonusExpiry)) {
+		if _, err := mr.Credits.Apply(ctx, transaction); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	referral.RewardedAt, referral.UpdatedAt = &now, now
+
+	rewarded := *referral
+	if referrer, err := mr.Users.GetById(ctx, rewarded.ReferrerID); err == nil {
+		rewarded.Referrer = *referrer
+	}
+	if referee, err := mr.Users.GetById(ctx, rewarded.RefereeID); err == nil {
+		rewarded.Referee = *referee
+	}
+	return &rewarded, nil
+}
+
+func (mr *MemoryReferralRepo) Stats(ctx context.Context, referrerID uuid.UUID) (*Stats, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	var stats Stats
+	for _, referral := range mr.referrals {
+		if referral.ReferrerID != referrerID {
+			continue
+		}
+		stats.Joined++
+		if referral.RewardedAt != nil {
+			stats.Rewarded++
+		}
+	}
+	return &stats, nil
+}
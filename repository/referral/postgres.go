@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/model"
+	creditrepo "github.com/Leul-Michael/image-generation/repository/credit"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ReferralRepo interface {
+	// Create attributes referral.RefereeID to referral.ReferrerID. It
+	// returns ErrAlreadyReferred if the referee was referred before.
+	Create(ctx context.Context, referral *model.Referral) error
+	// Reward grants the bonus credits of the referee's referral and marks it
+	// rewarded, together, and returns it with Referrer and Referee loaded. It
+	// returns ErrNotExist when there is no referral left to reward, so it
+	// can be called after every purchase or generation.
+	Reward(ctx context.Context, refereeID uuid.UUID, referrerBonus, refereeBonus int) (*model.Referral, error)
+	Stats(ctx context.Context, referrerID uuid.UUID) (*Stats, error)
+}
+
+// Stats counts a referrer's referrals.
+type Stats struct {
+	// Joined is every user who signed up through the referrer's link.
+	Joined int64 `json:"joined"`
+	// Rewarded is those who have bought credits or generated an image.
+	Rewarded int64 `json:"rewarded"`
+}
+
+var (
+	ErrNotExist        = errors.New("referral not found")
+	ErrAlreadyReferred = errors.New("user was already referred")
+)
+
+type PostgresReferralRepo struct {
+	DB *gorm.DB
+	// BonusExpiry is how long referral bonuses last, forever when zero.
+	BonusExpiry time.Duration
+}
+
+var _ ReferralRepo = (*PostgresReferralRepo)(nil)
+
+func (pr *PostgresReferralRepo) Create(ctx context.Context, referral *model.Referral) error {
+	result := pr.DB.WithContext(ctx).
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "referee_id"}}, DoNothing: true}).
+		Create(referral)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create referral: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrAlreadyReferred
+	}
+	return nil
+}
+
+func (pr *PostgresReferralRepo) Reward(ctx context.Context, refereeID uuid.UUID, referrerBonus, refereeBonus int) (*model.Referral, error) {
+	var referral model.Referral
+	err := pr.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// The row lock makes a purchase and a generation finishing at the
+		// same time pay the bonus once.
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("referee_id = ? AND rewarded_at IS NULL", refereeID).
+			First(&referral).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotExist
+			}
+			return fmt.Errorf("failed to load referral: %w", err)
+		}
+
+		for _, transaction := range bonuses(&referral, referrerBonus, refereeBonus, model.ExpiresAfter(time.Now(), pr.BonusExpiry)) {
+			if _, err := creditrepo.ApplyTx(tx, transaction); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		referral.RewardedAt = &now
+		if err := tx.Model(&referral).Update("rewarded_at", now).Error; err != nil {
+			return fmt.Errorf("failed to update referral: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pr.DB.WithContext(ctx).
+		Preload("Referrer").
+		Preload("Referee").
+		Where("id = ?", referral.ID).
+		First(&referral).Error; err != nil {
+		return nil, fmt.Errorf("failed to reload referral: %w", err)
+	}
+	return &referral, nil
+}
+
+func (pr *PostgresReferralRepo) Stats(ctx context.Context, referrerID uuid.UUID) (*Stats, error) {
+	var stats Stats
+	err := pr.DB.WithContext(ctx).
+		Model(&model.Referral{}).
+		Where("referrer_id = ?", referrerID).
+		Select("COUNT(*) AS joined, COUNT(rewarded_at) AS rewarded").
+		Scan(&stats).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count referrals: %w", err)
+	}
+	return &stats, nil
+}
+
+// bonuses are the ledger entries that reward referral, expiring at
+// expiresAt. A bonus of zero is left out.
+func bonuses(referral *model.Referral, referrerBonus, refereeBonus int, expiresAt *time.Time) []*model.Transaction {
+	reference := referral.ID.String()
+
+	var transactions []*model.Transaction
+	if referrerBonus > 0 {
+		transactions = append(transactions, &model.Transaction{
+			UserID:      referral.ReferrerID,
+			CreditType:  model.CreditTypeImage,
+			Amount:      referrerBonus,
+			Type:        model.TransactionTypeReferral,
+			Description: "Referral bonus for inviting a friend",
+			ReferenceID: &reference,
+			ExpiresAt:   expiresAt,
+		})
+	}
+	if refereeBonus > 0 {
+		transactions = append(transactions, &model.Transaction{
+			UserID:      referral.RefereeID,
+			CreditType:  model.CreditTypeImage,
+			Amount:      refereeBonus,
+			Type:        model.TransactionTypeReferral,
+			Description: "Referral bonus for joining through an invite",
+			ReferenceID: &reference,
+			ExpiresAt:   expiresAt,
+		})
+	}
+	return transactions
+}
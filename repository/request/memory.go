@@ -0,0 +1,308 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/model"
+	categoryrepo "github.com/Leul-Michael/image-generation/repository/category"
+	creditrepo "github.com/Leul-Michael/image-generation/repository/credit"
+	imagerepo "github.com/Leul-Michael/image-generation/repository/image"
+	userrepo "github.com/Leul-Michael/image-generation/repository/user"
+	"github.com/google/uuid"
+)
+
+// MemoryImageGenerationRequestRepo is an in-memory
+// ImageGenerationRequestRepo for tests. Claimed requests get their User and
+// Category from Users and Categories; completed ones are stored in Images.
+// Credits are reserved from and refunded to Credits. The in-flight cap also
+// counts the user's requests in Videos, if set.
+type MemoryImageGenerationRequestRepo struct {
+	mu       sync.Mutex
+	requests []model.ImageGenerationRequest
+
+	Users      *userrepo.MemoryUserRepo
+	Categories *categoryrepo.MemoryCategoryRepo
+	Images     *imagerepo.MemoryGeneratedImageRepo
+	Credits    *creditrepo.MemoryUserCreditRepo
+	Videos     InFlightCounter
+}
+
+// InFlightCounter counts a user's pending and processing requests. The
+// memory repos use it to see each other's requests for the in-flight cap.
+type InFlightCounter interface {
+	CountInFlight(ctx context.Context, userID uuid.UUID) (int64, error)
+}
+
+// CountOthersInFlight is what counter counts for userID, or 0 without a
+// counter.
+func CountOthersInFlight(ctx context.Context, counter InFlightCounter, userID uuid.UUID) (int64, error) {
+	if counter == nil {
+		return 0, nil
+	}
+	return counter.CountInFlight(ctx, userID)
+}
+
+var _ ImageGenerationRequestRepo = (*MemoryImageGenerationRequestRepo)(nil)
+
+func NewMemoryImageGenerationRequestRepo(users *userrepo.MemoryUserRepo, categories *categoryrepo.MemoryCategoryRepo, images *imagerepo.MemoryGeneratedImageRepo, credits *creditrepo.MemoryUserCreditRepo) *MemoryImageGenerationRequestRepo {
+	return &MemoryImageGenerationRequestRepo{
+		Users:      users,
+		Categories: categories,
+		Images:     images,
+		Credits:    credits,
+	}
+}
+
+// Create counts Videos before taking its own lock, so unlike Postgres it
+// doesn't serialize against video requests created at the same moment.
+func (mr *MemoryImageGenerationRequestRepo) Create(ctx context.Context, request *model.ImageGenerationRequest, maxInFlight int) error {
+	videos, err := CountOthersInFlight(ctx, mr.Videos, request.UserID)
+	if err != nil {
+		return err
+	}
+
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if maxInFlight > 0 && mr.countInFlight(request.UserID)+videos >= int64(maxInFlight) {
+		return ErrTooManyInFlight
+	}
+
+	now := time.Now()
+	request.ID, request.CreatedAt, request.UpdatedAt = uuid.New(), now, now
+	if request.CreditsRequired > 0 {
+		if _, err := mr.Credits.Apply(ctx, charge(request)); err != nil {
+			return err
+		}
+	}
+	if request.Status == "" {
+		request.Status = model.RequestStatusPending
+	}
+	mr.requests = append(mr.requests, *request)
+	return nil
+}
+
+func (mr *MemoryImageGenerationRequestRepo) GetByID(ctx context.Context, id uuid.UUID) (*model.ImageGenerationRequest, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	for _, request := range mr.requests {
+		if request.ID == id {
+			return &request, nil
+		}
+	}
+	return nil, ErrNotExist
+}
+
+func (mr *MemoryImageGenerationRequestRepo) ListByUser(ctx context.Context, userID uuid.UUID, limit int) ([]model.ImageGenerationRequest, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	var requests []model.ImageGenerationRequest
+	for i := len(mr.requests) - 1; i >= 0 && len(requests) < limit; i-- {
+		if mr.requests[i].UserID == userID {
+			requests = append(requests, mr.requests[i])
+		}
+	}
+	return requests, nil
+}
+
+func (mr *MemoryImageGenerationRequestRepo) CountByStatus(ctx context.Context, userID uuid.UUID, status model.RequestStatus) (int64, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	var count int64
+	for _, request := range mr.requests {
+		if request.UserID == userID && request.Status == status {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (mr *MemoryImageGenerationRequestRepo) CountInFlight(ctx context.Context, userID uuid.UUID) (int64, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	return mr.countInFlight(userID), nil
+}
+
+// countInFlight mirrors the Postgres count. mu must be held.
+func (mr *MemoryImageGenerationRequestRepo) countInFlight(userID uuid.UUID) int64 {
+	var count int64
+	for _, request := range mr.requests {
+		if request.UserID == userID && (request.Status == model.RequestStatusPending || request.Status == model.RequestStatusProcessing) {
+			count++
+		}
+	}
+	return count
+}
+
+func (mr *MemoryImageGenerationRequestRepo) CountQueued(ctx context.Context) (map[model.RequestStatus]int64, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	counts := map[model.RequestStatus]int64{
+		model.RequestStatusPending:    0,
+		model.RequestStatusProcessing: 0,
+	}
+	for _, request := range mr.requests {
+		if _, ok := counts[request.Status]; ok {
+			counts[request.Status]++
+		}
+	}
+	return counts, nil
+}
+
+func (mr *MemoryImageGenerationRequestRepo) CountFreeSince(ctx context.Context, userID uuid.UUID, since time.Time) (int64, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	return mr.countFree(userID, since), nil
+}
+
+func (mr *MemoryImageGenerationRequestRepo) CreateFree(ctx context.Context, request *model.ImageGenerationRequest, since time.Time, limit, maxInFlight int) error {
+	videos, err := CountOthersInFlight(ctx, mr.Videos, request.UserID)
+	if err != nil {
+		return err
+	}
+
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if maxInFlight > 0 && mr.countInFlight(request.UserID)+videos >= int64(maxInFlight) {
+		return ErrTooManyInFlight
+	}
+	if mr.countFree(request.UserID, since) >= int64(limit) {
+		return ErrAllowanceUsed
+	}
+
+	now := time.Now()
+	request.ID, request.CreatedAt, request.UpdatedAt = uuid.New(), now, now
+	request.IsFree, request.CreditsRequired = true, 0
+	if request.Status == "" {
+		request.Status = model.RequestStatusPending
+	}
+	mr.requests = append(mr.requests, *request)
+	return nil
+}
+
+// countFree mirrors the Postgres count. mu must be held.
+func (mr *MemoryImageGenerationRequestRepo) countFree(userID uuid.UUID, since time.Time) int64 {
+	var count int64
+	for _, request := range mr.requests {
+		if request.UserID == userID && request.IsFree && !request.CreatedAt.Before(since) && request.Status != model.RequestStatusFailed {
+			count++
+		}
+	}
+	return count
+}
+
+func (mr *MemoryImageGenerationRequestRepo) ClaimNext(ctx context.Context, staleBefore time.Time, maxProcessing int) (*model.ImageGenerationRequest, error) {
+	mr.mu.Lock()
+	var next *model.ImageGenerationRequest
+	processing := 0
+	for i := range mr.requests {
+		request := &mr.requests[i]
+		if request.Status == model.RequestStatusProcessing && !request.UpdatedAt.Before(staleBefore) {
+			processing++
+		}
+		if request.Status == model.RequestStatusPending ||
+			request.Status == model.RequestStatusProcessing && request.UpdatedAt.Before(staleBefore) {
+			// requests are in creation order, so the first of a priority is
+			// the oldest
+			if next == nil || request.Priority > next.Priority {
+				next = request
+			}
+		}
+	}
+	var claimed *model.ImageGenerationRequest
+	if next != nil && (maxProcessing <= 0 || processing < maxProcessing) {
+		next.Status = model.RequestStatusProcessing
+		next.UpdatedAt = time.Now()
+		copied := *next
+		claimed = &copied
+	}
+	mr.mu.Unlock()
+
+	if claimed == nil {
+		return nil, ErrNotExist
+	}
+
+	if user, err := mr.Users.GetById(ctx, claimed.UserID); err == nil {
+		claimed.User = *user
+	}
+	if category, err := mr.Categories.GetByID(ctx, claimed.CategoryID, ""); err == nil {
+		claimed.Category = *category
+	}
+	return claimed, nil
+}
+
+func (mr *MemoryImageGenerationRequestRepo) Complete(ctx context.Context, request *model.ImageGenerationRequest, image *model.GeneratedImage) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if !mr.processing(request.ID) {
+		return ErrNotProcessing
+	}
+
+	if err := mr.Images.Create(ctx, image); err != nil {
+		return err
+	}
+	if unused := request.CreditsRequired - image.CreditsUsed; unused > 0 {
+		if _, err := mr.Credits.Refund(ctx, refund(request, unused, "Refund for unused image generation credits")); err != nil {
+			return err
+		}
+	}
+
+	request.Status = model.RequestStatusCompleted
+	request.GeneratedImageID = &image.ID
+	mr.update(request)
+	return nil
+}
+
+func (mr *MemoryImageGenerationRequestRepo) Fail(ctx context.Context, request *model.ImageGenerationRequest, message string) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if !mr.processing(request.ID) {
+		return ErrNotProcessing
+	}
+
+	if request.CreditsRequired > 0 {
+		if _, err := mr.Credits.Refund(ctx, refund(request, request.CreditsRequired, "Refund for failed image generation")); err != nil {
+			return err
+		}
+	}
+
+	request.Status = model.RequestStatusFailed
+	request.Error = &message
+	mr.update(request)
+	return nil
+}
+
+// processing reports whether the request with id is processing. mu must be
+// held.
+func (mr *MemoryImageGenerationRequestRepo) processing(id uuid.UUID) bool {
+	for _, request := range mr.requests {
+		if request.ID == id {
+			return request.Status == model.RequestStatusProcessing
+		}
+	}
+	return false
+}
+
+// update stores the status fields of request. mu must be held.
+func (mr *MemoryImageGenerationRequestRepo) update(request *model.ImageGenerationRequest) {
+	for i := range mr.requests {
+		if mr.requests[i].ID == request.ID {
+			mr.requests[i].Status = request.Status
+			mr.requests[i].Error = request.Error
+			mr.requests[i].GeneratedImageID = request.GeneratedImageID
+			mr.requests[i].UpdatedAt = time.Now()
+			return
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/model"
+	creditrepo "github.com/Leul-Michael/image-generation/repository/credit"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ImageGenerationRequestRepo stores generation requests and is the queue the
+// generation worker takes them from.
+type ImageGenerationRequestRepo interface {
+	// Create stores request and reserves its CreditsRequired from the
+	// user's image balance, atomically. It returns ErrTooManyInFlight if the
+	// user already has maxInFlight image and video requests pending or
+	// processing, and creditrepo.ErrInsufficientCredits if the balance is
+	// too low, without storing anything. A maxInFlight of 0 means no cap.
+	Create(ctx context.Context, request *model.ImageGenerationRequest, maxInFlight int) error
+	GetByID(ctx context.Context, id uuid.UUID) (*model.ImageGenerationRequest, error)
+	// ListByUser returns the user's newest requests first.
+	ListByUser(ctx context.Context, userID uuid.UUID, limit int) ([]model.ImageGenerationRequest, error)
+	// CountByStatus counts the user's requests in status.
+	CountByStatus(ctx context.Context, userID uuid.UUID, status model.RequestStatus) (int64, error)
+	// CountFreeSince counts the user's free requests created since since
+	// that have not failed, i.e. the part of the daily allowance used.
+	CountFreeSince(ctx context.Context, userID uuid.UUID, since time.Time) (int64, error)
+	// CreateFree stores request as free if the user has made fewer than
+	// limit free requests since since, and returns ErrAllowanceUsed
+	// otherwise. maxInFlight caps it like Create.
+	CreateFree(ctx context.Context, request *model.ImageGenerationRequest, since time.Time, limit, maxInFlight int) error
+	// CountInFlight counts the user's pending and processing requests.
+	CountInFlight(ctx context.Context, userID uuid.UUID) (int64, error)
+	// CountQueued counts all pending and processing requests by status.
+	CountQueued(ctx context.Context) (map[model.RequestStatus]int64, error)
+
+	// ClaimNext marks the oldest pending request of the highest Priority, or
+	// one stuck in processing since before staleBefore, as processing and returns it with its User
+	// and Category. It returns ErrNotExist when the queue is empty, or when
+	// maxProcessing > 0 and that many requests are already processing (not
+	// counting stuck ones).
+	ClaimNext(ctx context.Context, staleBefore time.Time, maxProcessing int) (*model.ImageGenerationRequest, error)
+	// Complete stores image, links the credits reserved for the request to
+	// it and marks the request completed, atomically. Credits reserved
+	// beyond image.CreditsUsed are refunded. It returns ErrNotProcessing if
+	// the request has already been completed or failed.
+	Complete(ctx context.Context, request *model.ImageGenerationRequest, image *model.GeneratedImage) error
+	// Fail marks the request failed with message and refunds the credits
+	// reserved for it. It returns ErrNotProcessing if the request has
+	// already been completed or failed.
+	Fail(ctx context.Context, request *model.ImageGenerationRequest, message string) error
+}
+
+// claimLock is the advisory lock ClaimNext holds while checking the
+// processing cap, so two workers can't both take the last slot.
+const claimLock = 7_340_001
+
+var (
+	ErrNotExist        = errors.New("generation request not found")
+	ErrAllowanceUsed   = errors.New("daily free generations used up")
+	ErrTooManyInFlight = errors.New("too many generation requests in flight")
+	// ErrNotProcessing means another worker finished the request first,
+	// e.g. after taking it over as stale.
+	ErrNotProcessing = errors.New("generation request is no longer processing")
+)
+
+// inFlight are the statuses of requests that count towards the in-flight
+// cap.
+var inFlight = []model.RequestStatus{model.RequestStatusPending, model.RequestStatusProcessing}
+
+// LockInFlight locks the user's row, so their requests are created one at a
+// time, and returns ErrTooManyInFlight if they already have limit image and
+// video requests pending or processing. A limit of 0 means no cap. Video
+// requests are created under the same lock.
+func LockInFlight(tx *gorm.DB, userID uuid.UUID, limit int) error {
+	var user model.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&user, "id = ?", userID).Error; err != nil {
+		return fmt.Errorf("failed to lock user: %w", err)
+	}
+	if limit <= 0 {
+		return nil
+	}
+
+	var images, videos int64
+	if err := tx.Model(&model.ImageGenerationRequest{}).Where("user_id = ? AND status IN ?", userID, inFlight).Count(&images).Error; err != nil {
+		return fmt.Errorf("failed to count in-flight generation requests: %w", err)
+	}
+	if err := tx.Model(&model.VideoGenerationRequest{}).Where("user_id = ? AND status IN ?", userID, inFlight).Count(&videos).Error; err != nil {
+		return fmt.Errorf("failed to count in-flight video generation requests: %w", err)
+	}
+	if images+videos >= int64(limit) {
+		return ErrTooManyInFlight
+	}
+	return nil
+}
+
+type PostgresImageGenerationRequestRepo struct {
+	DB *gorm.DB
+}
+
+var _ ImageGenerationRequestRepo = (*PostgresImageGenerationRequestRepo)(nil)
+
+func (pr *PostgresImageGenerationRequestRepo) Create(ctx context.Context, request *model.ImageGenerationRequest, maxInFlight int) error {
+	return pr.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := LockInFlight(tx, request.UserID, maxInFlight); err != nil {
+			return err
+		}
+		if err := tx.Omit(clause.Associations).Create(request).Error; err != nil {
+			return fmt.Errorf("failed to create generation request: %w", err)
+		}
+		if request.CreditsRequired > 0 {
+			if _, err := creditrepo.ApplyTx(tx, charge(request)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (pr *PostgresImageGenerationRequestRepo) GetByID(ctx context.Context, id uuid.UUID) (*model.ImageGenerationRequest, error) {
+	var request model.ImageGenerationRequest
+	if err := pr.DB.WithContext(ctx).Where("id = ?", id).First(&request).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotExist
+		}
+		return nil, fmt.Errorf("failed to get generation request: %w", err)
+	}
+	return &request, nil
+}
+
+func (pr *PostgresImageGenerationRequestRepo) ListByUser(ctx context.Context, userID uuid.UUID, limit int) ([]model.ImageGenerationRequest, error) {
+	var requests []model.ImageGenerationRequest
+	err := pr.DB.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&requests).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list generation requests: %w", err)
+	}
+	return requests, nil
+}
+
+func (pr *PostgresImageGenerationRequestRepo) CountByStatus(ctx context.Context, userID uuid.UUID, status model.RequestStatus) (int64, error) {
+	var count int64
+	err := pr.DB.WithContext(ctx).
+		Model(&model.ImageGenerationRequest{}).
+		Where("user_id = ? AND status = ?", userID, status).
+		Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count generation requests: %w", err)
+	}
+	return count, nil
+}
+
+func (pr *PostgresImageGenerationRequestRepo) CountFreeSince(ctx context.Context, userID uuid.UUID, since time.Time) (int64, error) {
+	count, err := countFree(pr.DB.WithContext(ctx), userID, since)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count free generation requests: %w", err)
+	}
+	return count, nil
+}
+
+// CreateFree locks the user's row while counting, so concurrent requests
+// can't both take the last free generation.
+func (pr *PostgresImageGenerationRequestRepo) CreateFree(ctx context.Context, request *model.ImageGenerationRequest, since time.Time, limit, maxInFlight int) error {
+	return pr.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := LockInFlight(tx, request.UserID, maxInFlight); err != nil {
+			return err
+		}
+
+		count, err := countFree(tx, request.UserID, since)
+		if err != nil {
+			return fmt.Errorf("failed to count free generation requests: %w", err)
+		}
+		if count >= int64(limit) {
+			return ErrAllowanceUsed
+		}
+
+		request.IsFree, request.CreditsRequired = true, 0
+		if err := tx.Omit(clause.Associations).Create(request).Error; err != nil {
+			return fmt.Errorf("failed to create generation request: %w", err)
+		}
+		return nil
+	})
+}
+
+func (pr *PostgresImageGenerationRequestRepo) CountInFlight(ctx context.Context, userID uuid.UUID) (int64, error) {
+	var count int64
+	err := pr.DB.WithContext(ctx).
+		Model(&model.ImageGenerationRequest{}).
+		Where("user_id = ? AND status IN ?", userID, inFlight).
+		Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count in-flight generation requests: %w", err)
+	}
+	return count, nil
+}
+
+func (pr *PostgresImageGenerationRequestRepo) CountQueued(ctx context.Context) (map[model.RequestStatus]int64, error) {
+	var rows []struct {
+		Status model.RequestStatus
+		Count  int64
+	}
+	err := pr.DB.WithContext(ctx).
+		Model(&model.ImageGenerationRequest{}).
+		Select("status, COUNT(*) AS count").
+		Where("status IN ?", []model.RequestStatus{model.RequestStatusPending, model.RequestStatusProcessing}).
+		Group("status").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count queued generation requests: %w", err)
+	}
+
+	counts := map[model.RequestStatus]int64{
+		model.RequestStatusPending:    0,
+		model.RequestStatusProcessing: 0,
+	}
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+func countFree(db *gorm.DB, userID uuid.UUID, since time.Time) (int64, error) {
+	var count int64
+	err := db.Model(&model.ImageGenerationRequest{}).
+		Where("user_id = ? AND is_free AND created_at >= ? AND status <> ?", userID, since, model.RequestStatusFailed).
+		Count(&count).Error
+	return count, err
+}
+
+// ClaimNext uses FOR UPDATE SKIP LOCKED, so workers in any number of
+// processes can share the queue. With a processing cap the claims are
+// serialized by an advisory lock instead.
+func (pr *PostgresImageGenerationRequestRepo) ClaimNext(ctx context.Context, staleBefore time.Time, maxProcessing int) (*model.ImageGenerationRequest, error) {
+	var request model.ImageGenerationRequest
+
+	err := pr.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if maxProcessing > 0 {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", claimLock).Error; err != nil {
+				return err
+			}
+
+			var processing int64
+			if err := tx.Model(&model.ImageGenerationRequest{}).
+				Where("status = ? AND updated_at >= ?", model.RequestStatusProcessing, staleBefore).
+				Count(&processing).Error; err != nil {
+				return err
+			}
+			if processing >= int64(maxProcessing) {
+				return gorm.ErrRecordNotFound
+			}
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? OR (status = ? AND updated_at < ?)", model.RequestStatusPending, model.RequestStatusProcessing, staleBefore).
+			Order("priority DESC, created_at ASC").
+			First(&request).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&request).Update("status", model.RequestStatusProcessing).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotExist
+		}
+		return nil, fmt.Errorf("failed to claim generation request: %w", err)
+	}
+
+	if err := pr.DB.WithContext(ctx).Preload("User").Preload("Category").First(&request, "id = ?", request.ID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load generation request: %w", err)
+	}
+
+	return &request, nil
+}
+
+func (pr *PostgresImageGenerationRequestRepo) Complete(ctx context.Context, request *model.ImageGenerationRequest, image *model.GeneratedImage) error {
+	err := pr.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(image).Error; err != nil {
+			return fmt.Errorf("failed to save generated image: %w", err)
+		}
+
+		result := tx.Model(request).
+			Where("status = ?", model.RequestStatusProcessing).
+			Updates(map[string]any{
+				"status":             model.RequestStatusCompleted,
+				"generated_image_id": image.ID,
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to mark generation request completed: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotProcessing
+		}
+
+		if err := tx.Model(&model.Transaction{}).
+			Where("reference_id = ? AND type = ?", request.ID.String(), model.TransactionTypeUsage).
+			Update("generated_image_id", image.ID).Error; err != nil {
+			return fmt.Errorf("failed to link credit transaction to image: %w", err)
+		}
+
+		if unused := request.CreditsRequired - image.CreditsUsed; unused > 0 {
+			if _, err := creditrepo.RefundTx(tx, refund(request, unused, "Refund for unused image generation credits")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	request.Status = model.RequestStatusCompleted
+	request.GeneratedImageID = &image.ID
+	return nil
+}
+
+func (pr *PostgresImageGenerationRequestRepo) Fail(ctx context.Context, request *model.ImageGenerationRequest, message string) error {
+	err := pr.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(request).
+			Where("status = ?", model.RequestStatusProcessing).
+			Updates(map[string]any{
+				"status": model.RequestStatusFailed,
+				"error":  message,
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to mark generation request failed: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotProcessing
+		}
+
+		if request.CreditsRequired > 0 {
+			if _, err := creditrepo.RefundTx(tx, refund(request, request.CreditsRequired, "Refund for failed image generation")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	request.Status = model.RequestStatusFailed
+	request.Error = &message
+	return nil
+}
+
+// charge is the usage transaction reserving the credits for a request,
+// referencing it by ID. Complete links it to the generated image.
+func charge(request *model.ImageGenerationRequest) *model.Transaction {
+	referenceID := request.ID.String()
+	return &model.Transaction{
+		UserID:      request.UserID,
+		CreditType:  model.CreditTypeImage,
+		Amount:      -request.CreditsRequired,
+		Type:        model.TransactionTypeUsage,
+		Description: fmt.Sprintf("Image generation in %s", request.Category.Name),
+		ReferenceID: &referenceID,
+	}
+}
+
+// refund gives back credits charge reserved for request, to the lots the
+// charge spent them from.
+func refund(request *model.ImageGenerationRequest, credits int, description string) *model.Transaction {
+	referenceID := request.ID.String()
+	return &model.Transaction{
+		UserID:      request.UserID,
+		CreditType:  model.CreditTypeImage,
+		Amount:      credits,
+		Type:        model.TransactionTypeRefund,
+		Description: description,
+		ReferenceID: &referenceID,
+	}
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/model"
+)
+
+// MemoryConversationStateRepo is an in-memory ConversationStateRepo for
+// tests. It hands out copies, so a state changed by a handler is only seen
+// by others once saved, as with Postgres.
+type MemoryConversationStateRepo struct {
+	mu     sync.Mutex
+	states map[int64]model.ConversationState
+}
+
+var _ ConversationStateRepo = (*MemoryConversationStateRepo)(nil)
+
+func NewMemoryConversationStateRepo() *MemoryConversationStateRepo {
+	return &MemoryConversationStateRepo{states: make(map[int64]model.ConversationState)}
+}
+
+func (mr *MemoryConversationStateRepo) Get(ctx context.Context, telegramID int64) (*model.ConversationState, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	state, ok := mr.states[telegramID]
+	if !ok {
+		return nil, ErrNotExist
+	}
+	return &state, nil
+}
+
+func (mr *MemoryConversationStateRepo) Save(ctx context.Context, state *model.ConversationState) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	state.UpdatedAt = time.Now()
+	mr.states[state.TelegramID] = *state
+	return nil
+}
+
+func (mr *MemoryConversationStateRepo) Delete(ctx context.Context, telegramID int64) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	delete(mr.states, telegramID)
+	return nil
+}
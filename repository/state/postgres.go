@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Leul-Michael/image-generation/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ConversationStateRepo keeps each Telegram user's place in the bot flows,
+// one state per user.
+type ConversationStateRepo interface {
+	// Get returns the user's state, or ErrNotExist if they are in no flow.
+	Get(ctx context.Context, telegramID int64) (*model.ConversationState, error)
+	// Save stores state, replacing the user's previous one.
+	Save(ctx context.Context, state *model.ConversationState) error
+	// Delete forgets the user's state, if any.
+	Delete(ctx context.Context, telegramID int64) error
+}
+
+var ErrNotExist = errors.New("conversation state not found")
+
+type PostgresConversationStateRepo struct {
+	DB *gorm.DB
+}
+
+var _ ConversationStateRepo = (*PostgresConversationStateRepo)(nil)
+
+func (pr *PostgresConversationStateRepo) Get(ctx context.Context, telegramID int64) (*model.ConversationState, error) {
+	var state model.ConversationState
+	err := pr.DB.WithContext(ctx).First(&state, "telegram_id = ?", telegramID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load conversation state: %w", err)
+	}
+	return &state, nil
+}
+
+func (pr *PostgresConversationStateRepo) Save(ctx context.Context, state *model.ConversationState) error {
+	if err := pr.DB.WithContext(ctx).
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(state).Error; err != nil {
+		return fmt.Errorf("failed to save conversation state: %w", err)
+	}
+	return nil
+}
+
+func (pr *PostgresConversationStateRepo) Delete(ctx context.Context, telegramID int64) error {
+	if err := pr.DB.WithContext(ctx).Delete(&model.ConversationState{}, "telegram_id = ?", telegramID).Error; err != nil {
+		return fmt.Errorf("failed to delete conversation state: %w", err)
+	}
+	return nil
+}
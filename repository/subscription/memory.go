@@ -0,0 +1,252 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/model"
+	creditrepo "github.com/Leul-Michael/image-generation/repository/credit"
+	userrepo "github.com/Leul-Michael/image-generation/repository/user"
+	"github.com/google/uuid"
+)
+
+// MemorySubscriptionRepo is an in-memory SubscriptionRepo for tests. Claimed
+// subscriptions get their User from Users; credits are granted and expired
+// in Credits.
+type MemorySubscriptionRepo struct {
+	mu            sync.Mutex
+	plans         []model.Plan
+	subscriptions []model.Subscription
+
+	Users   *userrepo.MemoryUserRepo
+	Credits *creditrepo.MemoryUserCreditRepo
+}
+
+var _ SubscriptionRepo = (*MemorySubscriptionRepo)(nil)
+
+func NewMemorySubscriptionRepo(users *userrepo.MemoryUserRepo, credits *creditrepo.MemoryUserCreditRepo) *MemorySubscriptionRepo {
+	return &MemorySubscriptionRepo{
+		Users:   users,
+		Credits: credits,
+	}
+}
+
+func (mr *MemorySubscriptionRepo) CreatePlan(ctx context.Context, plan *model.Plan) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	for _, existing := range mr.plans {
+		if existing.Code == plan.Code {
+			return ErrPlanCodeTaken
+		}
+	}
+
+	now := time.Now()
+	plan.ID, plan.CreatedAt, plan.UpdatedAt = uuid.New(), now, now
+	mr.plans = append(mr.plans, *plan)
+	return nil
+}
+
+func (mr *MemorySubscriptionRepo) ListPlans(ctx context.Context) ([]model.Plan, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	var plans []model.Plan
+	for _, plan := range mr.plans {
+		if plan.IsActive {
+			plans = append(plans, plan)
+		}
+	}
+	slices.SortStableFunc(plans, func(a, b model.Plan) int { return a.PriceEtb - b.PriceEtb })
+	return plans, nil
+}
+
+func (mr *MemorySubscriptionRepo) GetPlan(ctx context.Context, code string) (*model.Plan, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	for _, plan := range mr.plans {
+		if plan.Code == code {
+			return &plan, nil
+		}
+	}
+	return nil, ErrPlanNotExist
+}
+
+func (mr *MemorySubscriptionRepo) Current(ctx context.Context, userID uuid.UUID) (*model.Subscription, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	sub := mr.live(userID)
+	if sub == nil {
+		return nil, ErrNotExist
+	}
+	return mr.loaded(*sub), nil
+}
+
+func (mr *MemorySubscriptionRepo) Subscribe(ctx context.Context, userID uuid.UUID, plan *model.Plan, now time.Time) (*model.Subscription, *model.Transaction, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if mr.live(userID) != nil {
+		return nil, nil, ErrAlreadySubscribed
+	}
+
+	sub := newSubscription(userID, plan, now)
+	sub.ID, sub.CreatedAt, sub.UpdatedAt = uuid.New(), now, now
+
+	grant := allowance(sub, plan)
+	if _, err := mr.Credits.Apply(ctx, grant); err != nil {
+		return nil, nil, err
+	}
+	mr.subscriptions = append(mr.subscriptions, *sub)
+
+	sub.Plan = *plan
+	return sub, grant, nil
+}
+
+func (mr *MemorySubscriptionRepo) Cancel(ctx context.Context, userID uuid.UUID) (*model.Subscription, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	sub := mr.live(userID)
+	if sub == nil {
+		return nil, ErrNotExist
+	}
+	sub.CancelAtPeriodEnd, sub.UpdatedAt = true, time.Now()
+	return mr.loaded(*sub), nil
+}
+
+func (mr *MemorySubscriptionRepo) ClaimDue(ctx context.Context, now, lease time.Time) (*model.Subscription, error) {
+	mr.mu.Lock()
+	var claimed *model.Subscription
+	for i := range mr.subscriptions {
+		sub := &mr.subscriptions[i]
+		if !sub.Live() || sub.RenewAt.After(now) {
+			continue
+		}
+		if claimed == nil || sub.RenewAt.Before(claimed.RenewAt) {
+			claimed = sub
+		}
+	}
+	if claimed == nil {
+		mr.mu.Unlock()
+		return nil, ErrNotExist
+	}
+	claimed.RenewAt = lease
+	sub := mr.loaded(*claimed)
+	mr.mu.Unlock()
+
+	if user, err := mr.Users.GetById(ctx, sub.UserID); err == nil {
+		sub.User = *user
+	}
+	return sub, nil
+}
+
+func (mr *MemorySubscriptionRepo) Renew(ctx context.Context, sub *model.Subscription) (*model.Transaction, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	stored := mr.stored(sub.ID)
+	if stored == nil {
+		return nil, ErrNotExist
+	}
+
+	lots := mr.Credits.Referenced(sub.UserID, model.CreditTypeImage, sub.ID.String())
+	rolled, expiry := rollover(sub, lots)
+	if expiry != nil {
+		if _, err := mr.Credits.Expire(ctx, expiry, lots); err != nil {
+			return nil, err
+		}
+	}
+
+	renewed := *sub
+	startPeriod(&renewed, sub.CurrentPeriodEnd, sub.Plan.MonthlyCredits+rolled)
+	mr.Credits.Extend(lots, renewed.CurrentPeriodEnd)
+	grant := allowance(&renewed, &sub.Plan)
+	if _, err := mr.Credits.Apply(ctx, grant); err != nil {
+		return nil, err
+	}
+
+	*sub = renewed
+	mr.update(stored, sub)
+	return grant, nil
+}
+
+func (mr *MemorySubscriptionRepo) MarkPastDue(ctx context.Context, sub *model.Subscription, retryAt, graceUntil time.Time) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	stored := mr.stored(sub.ID)
+	if stored == nil {
+		return ErrNotExist
+	}
+
+	sub.Status, sub.RenewAt, sub.GraceUntil = model.SubscriptionStatusPastDue, retryAt, &graceUntil
+	mr.update(stored, sub)
+	return nil
+}
+
+func (mr *MemorySubscriptionRepo) End(ctx context.Context, sub *model.Subscription, status model.SubscriptionStatus, now time.Time) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	stored := mr.stored(sub.ID)
+	if stored == nil {
+		return ErrNotExist
+	}
+
+	lots := mr.Credits.Referenced(sub.UserID, model.CreditTypeImage, sub.ID.String())
+	if expiry := expireUnused(sub, creditrepo.Unspent(lots), "Subscription ended"); expiry != nil {
+		if _, err := mr.Credits.Expire(ctx, expiry, lots); err != nil {
+			return err
+		}
+	}
+
+	sub.Status, sub.EndedAt = status, &now
+	mr.update(stored, sub)
+	return nil
+}
+
+// live returns the user's stored live subscription. mu must be held.
+func (mr *MemorySubscriptionRepo) live(userID uuid.UUID) *model.Subscription {
+	for i := range mr.subscriptions {
+		if mr.subscriptions[i].UserID == userID && mr.subscriptions[i].Live() {
+			return &mr.subscriptions[i]
+		}
+	}
+	return nil
+}
+
+// stored returns the stored subscription with id. mu must be held.
+func (mr *MemorySubscriptionRepo) stored(id uuid.UUID) *model.Subscription {
+	for i := range mr.subscriptions {
+		if mr.subscriptions[i].ID == id {
+			return &mr.subscriptions[i]
+		}
+	}
+	return nil
+}
+
+// loaded returns a copy of sub with its Plan. mu must be held.
+func (mr *MemorySubscriptionRepo) loaded(sub model.Subscription) *model.Subscription {
+	for _, plan := range mr.plans {
+		if plan.ID == sub.PlanID {
+			sub.Plan = plan
+		}
+	}
+	return &sub
+}
+
+// update copies the state fields of sub into stored. mu must be held.
+func (mr *MemorySubscriptionRepo) update(stored, sub *model.Subscription) {
+	stored.Status = sub.Status
+	stored.CurrentPeriodStart, stored.CurrentPeriodEnd = sub.CurrentPeriodStart, sub.CurrentPeriodEnd
+	stored.PeriodCredits = sub.PeriodCredits
+	stored.RenewAt = sub.RenewAt
+	stored.GraceUntil = sub.GraceUntil
+	stored.EndedAt = sub.EndedAt
+	stored.UpdatedAt = time.Now()
+}
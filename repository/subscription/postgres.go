@@ -0,0 +1,328 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/model"
+	creditrepo "github.com/Leul-Michael/image-generation/repository/credit"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SubscriptionRepo stores plans and subscriptions, and grants and expires
+// subscription credits through the Transaction ledger.
+type SubscriptionRepo interface {
+	// CreatePlan returns ErrPlanCodeTaken if plan.Code is in use.
+	CreatePlan(ctx context.Context, plan *model.Plan) error
+	// ListPlans returns the active plans, cheapest first.
+	ListPlans(ctx context.Context) ([]model.Plan, error)
+	GetPlan(ctx context.Context, code string) (*model.Plan, error)
+
+	// Current returns the user's live subscription with Plan loaded, or
+	// ErrNotExist.
+	Current(ctx context.Context, userID uuid.UUID) (*model.Subscription, error)
+	// Subscribe starts a month of plan at now and grants its credits. It
+	// returns ErrAlreadySubscribed if the user has a live subscription.
+	Subscribe(ctx context.Context, userID uuid.UUID, plan *model.Plan, now time.Time) (*model.Subscription, *model.Transaction, error)
+	// Cancel ends the user's live subscription at the end of its period.
+	Cancel(ctx context.Context, userID uuid.UUID) (*model.Subscription, error)
+
+	// ClaimDue returns a live subscription whose RenewAt has passed, with
+	// User and Plan loaded, and moves its RenewAt to lease so other renewal
+	// jobs skip it meanwhile. It returns ErrNotExist when none is due.
+	ClaimDue(ctx context.Context, now, lease time.Time) (*model.Subscription, error)
+	// Renew starts the next period of sub: allowance credits beyond the
+	// plan's MaxRollover expire and the monthly credits are granted.
+	Renew(ctx context.Context, sub *model.Subscription) (*model.Transaction, error)
+	// MarkPastDue records a failed renewal, to be retried at retryAt.
+	MarkPastDue(ctx context.Context, sub *model.Subscription, retryAt, graceUntil time.Time) error
+	// End stops sub with status, expiring the unused allowance credits.
+	End(ctx context.Context, sub *model.Subscription, status model.SubscriptionStatus, now time.Time) error
+}
+
+var (
+	ErrNotExist          = errors.New("subscription not found")
+	ErrPlanNotExist      = errors.New("plan not found")
+	ErrPlanCodeTaken     = errors.New("plan code already exists")
+	ErrAlreadySubscribed = errors.New("user already has a subscription")
+)
+
+var liveStatuses = []model.SubscriptionStatus{model.SubscriptionStatusActive, model.SubscriptionStatusPastDue}
+
+type PostgresSubscriptionRepo struct {
+	DB *gorm.DB
+}
+
+var _ SubscriptionRepo = (*PostgresSubscriptionRepo)(nil)
+
+func (pr *PostgresSubscriptionRepo) CreatePlan(ctx context.Context, plan *model.Plan) error {
+	result := pr.DB.WithContext(ctx).
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "code"}}, DoNothing: true}).
+		Create(plan)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create plan: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrPlanCodeTaken
+	}
+	return nil
+}
+
+func (pr *PostgresSubscriptionRepo) ListPlans(ctx context.Context) ([]model.Plan, error) {
+	var plans []model.Plan
+	if err := pr.DB.WithContext(ctx).Where("is_active").Order("price_etb ASC").Find(&plans).Error; err != nil {
+		return nil, fmt.Errorf("failed to list plans: %w", err)
+	}
+	return plans, nil
+}
+
+func (pr *PostgresSubscriptionRepo) GetPlan(ctx context.Context, code string) (*model.Plan, error) {
+	var plan model.Plan
+	if err := pr.DB.WithContext(ctx).Where("code = ?", code).First(&plan).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPlanNotExist
+		}
+		return nil, fmt.Errorf("failed to get plan: %w", err)
+	}
+	return &plan, nil
+}
+
+func (pr *PostgresSubscriptionRepo) Current(ctx context.Context, userID uuid.UUID) (*model.Subscription, error) {
+	var sub model.Subscription
+	if err := pr.DB.WithContext(ctx).
+		Preload("Plan").
+		Where("user_id = ? AND status IN ?", userID, liveStatuses).
+		First(&sub).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotExist
+		}
+		return nil, fmt.Errorf("failed to get subscription: %w", err)
+	}
+	return &sub, nil
+}
+
+func (pr *PostgresSubscriptionRepo) Subscribe(ctx context.Context, userID uuid.UUID, plan *model.Plan, now time.Time) (*model.Subscription, *model.Transaction, error) {
+	sub := newSubscription(userID, plan, now)
+	var grant *model.Transaction
+
+	err := pr.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Locking the user serializes concurrent subscribes; the partial
+		// unique index backs this up.
+		var user model.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&user, "id = ?", userID).Error; err != nil {
+			return fmt.Errorf("failed to lock user: %w", err)
+		}
+
+		var live int64
+		if err := tx.Model(&model.Subscription{}).Where("user_id = ? AND status IN ?", userID, liveStatuses).Count(&live).Error; err != nil {
+			return fmt.Errorf("failed to check subscriptions: %w", err)
+		}
+		if live > 0 {
+			return ErrAlreadySubscribed
+		}
+
+		if err := tx.Create(sub).Error; err != nil {
+			return fmt.Errorf("failed to create subscription: %w", err)
+		}
+
+		grant = allowance(sub, plan)
+		if _, err := creditrepo.ApplyTx(tx, grant); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sub.Plan = *plan
+	return sub, grant, nil
+}
+
+func (pr *PostgresSubscriptionRepo) Cancel(ctx context.Context, userID uuid.UUID) (*model.Subscription, error) {
+	result := pr.DB.WithContext(ctx).
+		Model(&model.Subscription{}).
+		Where("user_id = ? AND status IN ?", userID, liveStatuses).
+		Update("cancel_at_period_end", true)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to cancel subscription: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrNotExist
+	}
+	return pr.Current(ctx, userID)
+}
+
+// ClaimDue uses FOR UPDATE SKIP LOCKED, like the generation queue, so
+// renewal jobs in any number of processes can run at once.
+func (pr *PostgresSubscriptionRepo) ClaimDue(ctx context.Context, now, lease time.Time) (*model.Subscription, error) {
+	var sub model.Subscription
+
+	err := pr.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status IN ? AND renew_at <= ?", liveStatuses, now).
+			Order("renew_at ASC").
+			First(&sub).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&sub).Update("renew_at", lease).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotExist
+		}
+		return nil, fmt.Errorf("failed to claim subscription: %w", err)
+	}
+
+	if err := pr.DB.WithContext(ctx).Preload("User").Preload("Plan").First(&sub, "id = ?", sub.ID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load subscription: %w", err)
+	}
+	return &sub, nil
+}
+
+func (pr *PostgresSubscriptionRepo) Renew(ctx context.Context, sub *model.Subscription) (*model.Transaction, error) {
+	var grant *model.Transaction
+
+	err := pr.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		lots, err := creditrepo.LotsTx(tx, sub.UserID, model.CreditTypeImage, sub.ID.String())
+		if err != nil {
+			return err
+		}
+
+		rolled, expiry := rollover(sub, lots)
+		if expiry != nil {
+			if _, err := creditrepo.ExpireTx(tx, expiry, lots); err != nil {
+				return err
+			}
+		}
+
+		renewed := *sub
+		startPeriod(&renewed, sub.CurrentPeriodEnd, sub.Plan.MonthlyCredits+rolled)
+		if err := creditrepo.ExtendTx(tx, lots, renewed.CurrentPeriodEnd); err != nil {
+			return err
+		}
+		grant = allowance(&renewed, &sub.Plan)
+		if _, err := creditrepo.ApplyTx(tx, grant); err != nil {
+			return err
+		}
+
+		if err := tx.Model(sub).Updates(map[string]any{
+			"status":               renewed.Status,
+			"current_period_start": renewed.CurrentPeriodStart,
+			"current_period_end":   renewed.CurrentPeriodEnd,
+			"period_credits":       renewed.PeriodCredits,
+			"renew_at":             renewed.RenewAt,
+			"grace_until":          nil,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to renew subscription: %w", err)
+		}
+
+		*sub = renewed
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return grant, nil
+}
+
+func (pr *PostgresSubscriptionRepo) MarkPastDue(ctx context.Context, sub *model.Subscription, retryAt, graceUntil time.Time) error {
+	if err := pr.DB.WithContext(ctx).Model(sub).Updates(map[string]any{
+		"status":      model.SubscriptionStatusPastDue,
+		"renew_at":    retryAt,
+		"grace_until": graceUntil,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to mark subscription past due: %w", err)
+	}
+
+	sub.Status, sub.RenewAt, sub.GraceUntil = model.SubscriptionStatusPastDue, retryAt, &graceUntil
+	return nil
+}
+
+func (pr *PostgresSubscriptionRepo) End(ctx context.Context, sub *model.Subscription, status model.SubscriptionStatus, now time.Time) error {
+	return pr.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		lots, err := creditrepo.LotsTx(tx, sub.UserID, model.CreditTypeImage, sub.ID.String())
+		if err != nil {
+			return err
+		}
+
+		if expiry := expireUnused(sub, creditrepo.Unspent(lots), "Subscription ended"); expiry != nil {
+			if _, err := creditrepo.ExpireTx(tx, expiry, lots); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(sub).Updates(map[string]any{
+			"status":   status,
+			"ended_at": now,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to end subscription: %w", err)
+		}
+
+		sub.Status, sub.EndedAt = status, &now
+		return nil
+	})
+}
+
+func newSubscription(userID uuid.UUID, plan *model.Plan, now time.Time) *model.Subscription {
+	sub := &model.Subscription{UserID: userID, PlanID: plan.ID}
+	startPeriod(sub, now, plan.MonthlyCredits)
+	return sub
+}
+
+// startPeriod makes sub active for a month from start with an allowance of
+// credits.
+func startPeriod(sub *model.Subscription, start time.Time, credits int) {
+	sub.Status = model.SubscriptionStatusActive
+	sub.CurrentPeriodStart = start
+	sub.CurrentPeriodEnd = model.NextPeriodEnd(start)
+	sub.PeriodCredits = credits
+	sub.RenewAt = sub.CurrentPeriodEnd
+	sub.GraceUntil = nil
+}
+
+// rollover splits the unspent lots of sub's ending period into the credits
+// that carry over and an expiry transaction for the rest, nil if nothing
+// expires. The oldest credits expire first.
+func rollover(sub *model.Subscription, lots []model.CreditLot) (int, *model.Transaction) {
+	unused := creditrepo.Unspent(lots)
+	rolled := min(unused, sub.Plan.MaxRollover)
+	return rolled, expireUnused(sub, unused-rolled, "Unused subscription credits expired")
+}
+
+func expireUnused(sub *model.Subscription, credits int, description string) *model.Transaction {
+	if credits <= 0 {
+		return nil
+	}
+
+	reference := sub.ID.String()
+	return &model.Transaction{
+		UserID:      sub.UserID,
+		CreditType:  model.CreditTypeImage,
+		Amount:      -credits,
+		Type:        model.TransactionTypeSubscriptionExpiry,
+		Description: description,
+		ReferenceID: &reference,
+	}
+}
+
+// allowance is the ledger entry granting plan's monthly credits for sub's
+// current period, which they expire with unless they roll over.
+func allowance(sub *model.Subscription, plan *model.Plan) *model.Transaction {
+	reference := sub.ID.String()
+	periodEnd := sub.CurrentPeriodEnd
+	return &model.Transaction{
+		UserID:      sub.UserID,
+		CreditType:  model.CreditTypeImage,
+		Amount:      plan.MonthlyCredits,
+		Type:        model.TransactionTypeSubscription,
+		Description: fmt.Sprintf("%s plan credits for %s", plan.Name, sub.CurrentPeriodStart.Format("2006-01-02")),
+		ReferenceID: &reference,
+		ExpiresAt:   &periodEnd,
+	}
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/model"
+	"github.com/google/uuid"
+)
+
+// MemoryTransactionRepo is an in-memory TransactionRepo for tests.
+type MemoryTransactionRepo struct {
+	mu           sync.Mutex
+	transactions []model.Transaction
+}
+
+var _ TransactionRepo = (*MemoryTransactionRepo)(nil)
+
+func NewMemoryTransactionRepo() *MemoryTransactionRepo {
+	return &MemoryTransactionRepo{}
+}
+
+func (mr *MemoryTransactionRepo) Create(ctx context.Context, transaction *model.Transaction) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	now := time.Now()
+	transaction.ID, transaction.CreatedAt, transaction.UpdatedAt = uuid.New(), now, now
+	mr.transactions = append(mr.transactions, *transaction)
+	return nil
+}
+
+func (mr *MemoryTransactionRepo) ListByUser(ctx context.Context, userID uuid.UUID, limit int) ([]model.Transaction, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	var transactions []model.Transaction
+	for i := len(mr.transactions) - 1; i >= 0 && len(transactions) < limit; i-- {
+		if mr.transactions[i].UserID == userID {
+			transactions = append(transactions, mr.transactions[i])
+		}
+	}
+	return transactions, nil
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Leul-Michael/image-generation/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TransactionRepo is the credit ledger. Balances themselves live in
+// UserCredit; see the credit repository for changing them.
+type TransactionRepo interface {
+	Create(ctx context.Context, transaction *model.Transaction) error
+	// ListByUser returns the user's newest transactions first.
+	ListByUser(ctx context.Context, userID uuid.UUID, limit int) ([]model.Transaction, error)
+}
+
+type PostgresTransactionRepo struct {
+	DB *gorm.DB
+}
+
+var _ TransactionRepo = (*PostgresTransactionRepo)(nil)
+
+func (pr *PostgresTransactionRepo) Create(ctx context.Context, transaction *model.Transaction) error {
+	if err := pr.DB.WithContext(ctx).Create(transaction).Error; err != nil {
+		return fmt.Errorf("failed to create transaction: %w", err)
+	}
+	return nil
+}
+
+func (pr *PostgresTransactionRepo) ListByUser(ctx context.Context, userID uuid.UUID, limit int) ([]model.Transaction, error) {
+	var transactions []model.Transaction
+	err := pr.DB.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&transactions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transactions: %w", err)
+	}
+	return transactions, nil
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/model"
+	categoryrepo "github.com/Leul-Michael/image-generation/repository/category"
+	"github.com/google/uuid"
+)
+
+// MemoryTrendingPromptRepo is an in-memory TrendingPromptRepo for tests.
+// Categories, when set, is used to fill in each prompt's Category.
+type MemoryTrendingPromptRepo struct {
+	mu      sync.Mutex
+	prompts map[uuid.UUID]model.TrendingPrompt
+
+	Categories *categoryrepo.MemoryCategoryRepo
+}
+
+var _ TrendingPromptRepo = (*MemoryTrendingPromptRepo)(nil)
+
+func NewMemoryTrendingPromptRepo(categories *categoryrepo.MemoryCategoryRepo) *MemoryTrendingPromptRepo {
+	return &MemoryTrendingPromptRepo{
+		prompts:    make(map[uuid.UUID]model.TrendingPrompt),
+		Categories: categories,
+	}
+}
+
+func (mr *MemoryTrendingPromptRepo) ListActive(ctx context.Context, lang string, limit int) ([]model.TrendingPrompt, error) {
+	mr.mu.Lock()
+	var prompts []model.TrendingPrompt
+	for _, prompt := range mr.prompts {
+		if prompt.IsActive {
+			prompts = append(prompts, prompt)
+		}
+	}
+	mr.mu.Unlock()
+
+	sort.Slice(prompts, func(i, j int) bool {
+		return prompts[i].UseCount > prompts[j].UseCount
+	})
+	if len(prompts) > limit {
+		prompts = prompts[:limit]
+	}
+
+	for i := range prompts {
+		var translations []model.TrendingPromptTranslation
+		for _, tr := range prompts[i].Translations {
+			if tr.Lang == lang {
+				translations = append(translations, tr)
+			}
+		}
+		prompts[i].Translations = translations
+
+		if mr.Categories != nil {
+			if category, err := mr.Categories.GetByID(ctx, prompts[i].CategoryID, lang); err == nil {
+				prompts[i].Category = *category
+			}
+		}
+	}
+	return prompts, nil
+}
+
+func (mr *MemoryTrendingPromptRepo) GetByID(ctx context.Context, id uuid.UUID) (*model.TrendingPrompt, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	prompt, ok := mr.prompts[id]
+	if !ok {
+		return nil, ErrNotExist
+	}
+	return &prompt, nil
+}
+
+func (mr *MemoryTrendingPromptRepo) Create(ctx context.Context, prompt *model.TrendingPrompt) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	now := time.Now()
+	prompt.ID, prompt.CreatedAt, prompt.UpdatedAt = uuid.New(), now, now
+	for i := range prompt.Translations {
+		prompt.Translations[i].TrendingPromptID = prompt.ID
+	}
+	mr.prompts[prompt.ID] = *prompt
+	return nil
+}
+
+func (mr *MemoryTrendingPromptRepo) RecordUse(ctx context.Context, id uuid.UUID) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	prompt, ok := mr.prompts[id]
+	if !ok {
+		return ErrNotExist
+	}
+	prompt.UseCount++
+	prompt.LastUsedAt = time.Now()
+	mr.prompts[id] = prompt
+	return nil
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type TrendingPromptRepo interface {
+	// ListActive returns the most used active prompts with their Category,
+	// and the Translations of both in lang.
+	ListActive(ctx context.Context, lang string, limit int) ([]model.TrendingPrompt, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*model.TrendingPrompt, error)
+	Create(ctx context.Context, prompt *model.TrendingPrompt) error
+	// RecordUse bumps the use count and last-used time.
+	RecordUse(ctx context.Context, id uuid.UUID) error
+}
+
+var ErrNotExist = errors.New("trending prompt not found")
+
+type PostgresTrendingPromptRepo struct {
+	DB *gorm.DB
+}
+
+var _ TrendingPromptRepo = (*PostgresTrendingPromptRepo)(nil)
+
+func (pr *PostgresTrendingPromptRepo) ListActive(ctx context.Context, lang string, limit int) ([]model.TrendingPrompt, error) {
+	var prompts []model.TrendingPrompt
+	err := pr.DB.WithContext(ctx).
+		Where("is_active = ?", true).
+		Preload("Category.Translations", "lang = ?", lang).
+		Preload("Translations", "lang = ?", lang).
+		Order("use_count DESC").
+		Limit(limit).
+		Find(&prompts).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trending prompts: %w", err)
+	}
+	return prompts, nil
+}
+
+func (pr *PostgresTrendingPromptRepo) GetByID(ctx context.Context, id uuid.UUID) (*model.TrendingPrompt, error) {
+	var prompt model.TrendingPrompt
+	if err := pr.DB.WithContext(ctx).Where("id = ?", id).First(&prompt).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotExist
+		}
+		return nil, fmt.Errorf("failed to get trending prompt: %w", err)
+	}
+	return &prompt, nil
+}
+
+func (pr *PostgresTrendingPromptRepo) Create(ctx context.Context, prompt *model.TrendingPrompt) error {
+	if err := pr.DB.WithContext(ctx).Create(prompt).Error; err != nil {
+		return fmt.Errorf("failed to create trending prompt: %w", err)
+	}
+	return nil
+}
+
+func (pr *PostgresTrendingPromptRepo) RecordUse(ctx context.Context, id uuid.UUID) error {
+	err := pr.DB.WithContext(ctx).
+		Model(&model.TrendingPrompt{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"use_count":    gorm.Expr("use_count + 1"),
+			"last_used_at": time.Now(),
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to record trending prompt use: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,372 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/model"
+	creditrepo "github.com/Leul-Michael/image-generation/repository/credit"
+	"github.com/google/uuid"
+)
+
+// MemoryUserRepo is an in-memory UserRepo for tests. New users get empty
+// image and video balances in Credits, which are also used to fill in
+// UserCredits on read, plus SignupGrant image credits expiring after
+// BonusExpiry.
+type MemoryUserRepo struct {
+	mu    sync.Mutex
+	users map[uuid.UUID]model.User
+
+	Credits     *creditrepo.MemoryUserCreditRepo
+	SignupGrant int
+	BonusExpiry time.Duration
+}
+
+var _ UserRepo = (*MemoryUserRepo)(nil)
+
+func NewMemoryUserRepo(credits *creditrepo.MemoryUserCreditRepo) *MemoryUserRepo {
+	return &MemoryUserRepo{
+		users:   make(map[uuid.UUID]model.User),
+		Credits: credits,
+	}
+}
+
+// withCredits returns a copy of user with UserCredits loaded. mu must be held.
+func (mr *MemoryUserRepo) withCredits(ctx context.Context, user model.User) *model.User {
+	user.UserCredits, _ = mr.Credits.ListByUser(ctx, user.ID)
+	return &user
+}
+
+func (mr *MemoryUserRepo) GetById(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	user, ok := mr.users[id]
+	if !ok || user.DeletedAt.Valid {
+		return nil, ErrNotExist
+	}
+	return mr.withCredits(ctx, user), nil
+}
+
+func (mr *MemoryUserRepo) GetByTelegramID(ctx context.Context, telegramID uint) (*model.User, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	user, ok := mr.findByTelegramID(telegramID)
+	if !ok {
+		return nil, ErrNotExist
+	}
+	return mr.withCredits(ctx, user), nil
+}
+
+func (mr *MemoryUserRepo) findByTelegramID(telegramID uint) (model.User, bool) {
+	for _, user := range mr.users {
+		if user.TelegramID != nil && *user.TelegramID == telegramID && !user.DeletedAt.Valid {
+			return user, true
+		}
+	}
+	return model.User{}, false
+}
+
+func (mr *MemoryUserRepo) CreateOrUpdateUser(ctx context.Context, telegramID uint, firstName, lastName string, username, photoURL *string) (*model.User, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	now := time.Now()
+	user, ok := mr.findByTelegramID(telegramID)
+	if !ok {
+		user = model.User{
+			TelegramID: &telegramID,
+			Role:       model.RoleUser,
+			Lang:       "en",
+		}
+		user.ID, user.CreatedAt = uuid.New(), now
+
+		if err := mr.createBalances(ctx, user.ID, true); err != nil {
+			return nil, err
+		}
+	} else {
+		user.LastLogin = &now
+	}
+
+	user.FirstName = firstName
+	user.LastName = lastName
+	user.TelegramUsername = username
+	if photoURL != nil {
+		user.Image = photoURL
+	}
+	user.UpdatedAt = now
+	mr.users[user.ID] = user
+
+	return mr.withCredits(ctx, user), nil
+}
+
+func (mr *MemoryUserRepo) EmailExists(ctx context.Context, email string) int64 {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	var count int64
+	for _, user := range mr.users {
+		if user.Email != nil && *user.Email == email {
+			count++
+		}
+	}
+	return count
+}
+
+func (mr *MemoryUserRepo) ComparePassword(ctx context.Context, email string) (*Sub, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	var sub Sub
+	for _, user := range mr.users {
+		if user.Email != nil && *user.Email == email {
+			sub.Id = user.ID
+			sub.IsDeactivated = user.IsDeactivated
+			sub.EmailVerifiedAt = user.EmailVerifiedAt
+			if user.Password != nil {
+				sub.Password = *user.Password
+			}
+			break
+		}
+	}
+	return &sub, nil
+}
+
+func (mr *MemoryUserRepo) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	for _, user := range mr.users {
+		if user.Email != nil && *user.Email == email && !user.DeletedAt.Valid {
+			return mr.withCredits(ctx, user), nil
+		}
+	}
+	return nil, ErrNotExist
+}
+
+func (mr *MemoryUserRepo) GetByReferralCode(ctx context.Context, code string) (*model.User, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	for _, user := range mr.users {
+		if user.ReferralCode != nil && *user.ReferralCode == code && !user.DeletedAt.Valid {
+			return mr.withCredits(ctx, user), nil
+		}
+	}
+	return nil, ErrNotExist
+}
+
+func (mr *MemoryUserRepo) Register(ctx context.Context, user *model.User) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	unverified := user.Email != nil && user.EmailVerifiedAt == nil
+	for _, holder := range mr.users {
+		if holder.Email == nil || user.Email == nil || *holder.Email != *user.Email {
+			continue
+		}
+		if holder.EmailVerifiedAt != nil {
+			return ErrEmailTaken
+		}
+		user.Email = nil
+	}
+
+	now := time.Now()
+	user.ID, user.CreatedAt, user.UpdatedAt = uuid.New(), now, now
+	if user.Role == "" {
+		user.Role = model.RoleUser
+	}
+	if user.Lang == "" {
+		user.Lang = "en"
+	}
+	mr.users[user.ID] = *user
+
+	return mr.createBalances(ctx, user.ID, !unverified)
+}
+
+// grantVerified mirrors PostgresUserRepo.grantVerifiedTx. mu must be held.
+func (mr *MemoryUserRepo) grantVerified(ctx context.Context, userID uuid.UUID) error {
+	if mr.SignupGrant <= 0 {
+		return nil
+	}
+
+	transactions, err := mr.Credits.Transactions.ListByUser(ctx, userID, math.MaxInt)
+	if err != nil {
+		return err
+	}
+	for _, transaction := range transactions {
+		if transaction.Type == model.TransactionTypeSignupGrant {
+			return nil
+		}
+	}
+
+	if _, err := mr.Credits.Apply(ctx, signupGrant(userID, mr.SignupGrant, model.ExpiresAfter(time.Now(), mr.BonusExpiry))); err != nil {
+		return fmt.Errorf("failed to apply signup grant: %w", err)
+	}
+	return nil
+}
+
+// createBalances mirrors PostgresUserRepo.createBalances.
+func (mr *MemoryUserRepo) createBalances(ctx context.Context, userID uuid.UUID, grant bool) error {
+	mr.Credits.Set(userID, model.CreditTypeImage, 0)
+	mr.Credits.Set(userID, model.CreditTypeVideo, 0)
+
+	if grant && mr.SignupGrant > 0 {
+		if _, err := mr.Credits.Apply(ctx, signupGrant(userID, mr.SignupGrant, model.ExpiresAfter(time.Now(), mr.BonusExpiry))); err != nil {
+			return fmt.Errorf("failed to apply signup grant: %w", err)
+		}
+	}
+	return nil
+}
+
+func (mr *MemoryUserRepo) Insert(ctx context.Context, user model.User) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	now := time.Now()
+	user.ID, user.CreatedAt, user.UpdatedAt = uuid.New(), now, now
+	mr.users[user.ID] = user
+	return nil
+}
+
+func (mr *MemoryUserRepo) Update(ctx context.Context, user model.User) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if _, ok := mr.users[user.ID]; !ok {
+		return ErrNotExist
+	}
+	user.UpdatedAt = time.Now()
+	user.UserCredits = nil
+	mr.users[user.ID] = user
+	return nil
+}
+
+// UpdateField supports the columns the handlers update one at a time.
+func (mr *MemoryUserRepo) UpdateField(ctx context.Context, id uuid.UUID, field string, value any) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	user, ok := mr.users[id]
+	if !ok {
+		return ErrNotExist
+	}
+
+	switch field {
+	case "lang":
+		user.Lang = value.(string)
+	case "role":
+		user.Role = model.Role(fmt.Sprint(value))
+	case "is_deactivated":
+		user.IsDeactivated = value.(bool)
+	case "email":
+		email := value.(string)
+		user.Email = &email
+	case "password":
+		password := value.(string)
+		user.Password = &password
+	case "last_login":
+		lastLogin := value.(time.Time)
+		user.LastLogin = &lastLogin
+	case "email_verified_at":
+		verifiedAt := value.(time.Time)
+		user.EmailVerifiedAt = &verifiedAt
+	default:
+		return fmt.Errorf("memory user repo: unsupported field %q", field)
+	}
+
+	user.UpdatedAt = time.Now()
+	mr.users[id] = user
+	return nil
+}
+
+func (mr *MemoryUserRepo) ClaimEmail(ctx context.Context, id uuid.UUID, email string) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	user, ok := mr.users[id]
+	if !ok {
+		return ErrNotExist
+	}
+	for _, holder := range mr.users {
+		if holder.ID == id || holder.Email == nil || *holder.Email != email {
+			continue
+		}
+		if holder.EmailVerifiedAt != nil {
+			return ErrEmailTaken
+		}
+		holder.Email = nil
+		mr.users[holder.ID] = holder
+	}
+
+	now := time.Now()
+	user.Email, user.EmailVerifiedAt, user.UpdatedAt = &email, &now, now
+	mr.users[id] = user
+	return mr.grantVerified(ctx, id)
+}
+
+func (mr *MemoryUserRepo) VerifyEmail(ctx context.Context, id uuid.UUID) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	user, ok := mr.users[id]
+	if !ok {
+		return ErrNotExist
+	}
+	now := time.Now()
+	user.EmailVerifiedAt, user.UpdatedAt = &now, now
+	mr.users[id] = user
+	return mr.grantVerified(ctx, id)
+}
+
+func (mr *MemoryUserRepo) ChangePassword(ctx context.Context, id uuid.UUID, hash string) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	user, ok := mr.users[id]
+	if !ok {
+		return ErrNotExist
+	}
+	user.Password = &hash
+	user.SessionVersion++
+	user.UpdatedAt = time.Now()
+	mr.users[id] = user
+	return nil
+}
+
+func (mr *MemoryUserRepo) AssignReferralCode(ctx context.Context, id uuid.UUID, code string) (string, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	user, ok := mr.users[id]
+	if !ok {
+		return "", ErrNotExist
+	}
+	if user.ReferralCode == nil {
+		for _, other := range mr.users {
+			if other.ReferralCode != nil && *other.ReferralCode == code {
+				return "", fmt.Errorf("referral code %q is taken", code)
+			}
+		}
+		user.ReferralCode = &code
+		mr.users[id] = user
+	}
+	return *user.ReferralCode, nil
+}
+
+func (mr *MemoryUserRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	user, ok := mr.users[id]
+	if !ok {
+		return nil
+	}
+	user.DeletedAt.Time, user.DeletedAt.Valid = time.Now(), true
+	mr.users[id] = user
+	return nil
+}
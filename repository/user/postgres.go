@@ -7,27 +7,66 @@ import (
 	"time"
 
 	"github.com/Leul-Michael/image-generation/model"
+	creditrepo "github.com/Leul-Michael/image-generation/repository/credit"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PostgresUserRepo struct {
 	DB *gorm.DB
+	// SignupGrant is the image credits each new user starts with, or gets
+	// once they verify the email they registered with. They expire
+	// BonusExpiry after they are granted, or never when it is zero.
+	SignupGrant int
+	BonusExpiry time.Duration
 }
 
 type UserRepo interface {
 	GetById(ctx context.Context, id uuid.UUID) (*model.User, error)
 	GetByTelegramID(ctx context.Context, telegramID uint) (*model.User, error)
+	GetByEmail(ctx context.Context, email string) (*model.User, error)
+	GetByReferralCode(ctx context.Context, code string) (*model.User, error)
+	// CreateOrUpdateUser signs in the Telegram user, creating them on their
+	// first visit. A nil photoURL keeps the photo already stored, as bot
+	// updates don't carry one.
 	CreateOrUpdateUser(ctx context.Context, telegramID uint, firstName, lastName string, username, photoURL *string) (*model.User, error)
 	EmailExists(ctx context.Context, email string) int64
-	ComparePassword(ctx context.Context, sub interface{}) (*Sub, error)
+	ComparePassword(ctx context.Context, email string) (*Sub, error)
 	Insert(ctx context.Context, user model.User) error
+	// Register creates an account without Telegram, with the same empty
+	// balances as CreateOrUpdateUser. An account registered with an email it
+	// hasn't verified gets the signup grant once it does. ErrEmailTaken is
+	// returned if another account has verified the email; an account holding
+	// it unverified keeps it, and the new one is created without it until it
+	// is verified, as ClaimEmail.
+	Register(ctx context.Context, user *model.User) error
 	Update(ctx context.Context, user model.User) error
 	UpdateField(ctx context.Context, id uuid.UUID, field string, value interface{}) error
+	// ClaimEmail sets email as the user's verified address. An account
+	// holding the same address without having verified it loses it, since
+	// the user has just proven they own it; ErrEmailTaken is returned if
+	// another account has verified it. A signup grant held back until the
+	// email was verified is paid.
+	ClaimEmail(ctx context.Context, id uuid.UUID, email string) error
+	// VerifyEmail marks the address the user holds as verified, and pays a
+	// signup grant held back until it was.
+	VerifyEmail(ctx context.Context, id uuid.UUID) error
+	// ChangePassword sets the password hash and bumps SessionVersion, which
+	// signs the user out of every existing session.
+	ChangePassword(ctx context.Context, id uuid.UUID, hash string) error
+	// AssignReferralCode gives the user code as their referral code unless
+	// they already have one, and returns the code they end up with.
+	AssignReferralCode(ctx context.Context, id uuid.UUID, code string) (string, error)
 	Delete(ctx context.Context, id uuid.UUID) error
 }
 
-var ErrNotExist = errors.New("user not found")
+var (
+	ErrNotExist   = errors.New("user not found")
+	ErrEmailTaken = errors.New("email is already registered")
+)
+
+var _ UserRepo = (*PostgresUserRepo)(nil)
 
 func (pr *PostgresUserRepo) GetById(ctx context.Context, id uuid.UUID) (*model.User, error) {
 	var user model.User
@@ -55,20 +94,111 @@ func (pr *PostgresUserRepo) EmailExists(ctx context.Context, email string) int64
 }
 
 type Sub struct {
-	Id            uuid.UUID `json:"id"`
-	Password      string    `json:"password"`
-	IsDeactivated bool      `json:"is_deactivated"`
+	Id              uuid.UUID  `json:"id"`
+	Password        string     `json:"password"`
+	IsDeactivated   bool       `json:"is_deactivated"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
 }
 
 func (pr *PostgresUserRepo) ComparePassword(ctx context.Context, email string) (*Sub, error) {
 	var sub Sub
-	err := pr.DB.WithContext(ctx).Model(&model.User{}).Where("email = ?", email).Select("id, password, is_deactivated").Scan(&sub).Error
+	err := pr.DB.WithContext(ctx).Model(&model.User{}).Where("email = ?", email).Select("id, password, is_deactivated, email_verified_at").Scan(&sub).Error
 	if err != nil {
 		return nil, err
 	}
 	return &sub, nil
 }
 
+func (pr *PostgresUserRepo) Register(ctx context.Context, user *model.User) error {
+	return pr.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		unverified := user.Email != nil && user.EmailVerifiedAt == nil
+		if user.Email != nil {
+			var holder model.User
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Select("id, email_verified_at").
+				Where("email = ?", *user.Email).
+				First(&holder).Error
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+			case err != nil:
+				return fmt.Errorf("failed to check email: %w", err)
+			case holder.EmailVerifiedAt != nil:
+				return ErrEmailTaken
+			default:
+				// Whoever verifies the address first gets it
+				user.Email = nil
+			}
+		}
+
+		if err := tx.Create(user).Error; err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+		return pr.createBalances(tx, user.ID, !unverified)
+	})
+}
+
+// createBalances gives a new user empty image and video balances, then the
+// signup grant as a ledger entry if grant is set.
+func (pr *PostgresUserRepo) createBalances(tx *gorm.DB, userID uuid.UUID, grant bool) error {
+	for _, creditType := range []model.CreditType{model.CreditTypeImage, model.CreditTypeVideo} {
+		credit := model.UserCredit{
+			UserID:     userID,
+			CreditType: creditType,
+			Credits:    0,
+		}
+		if err := tx.Create(&credit).Error; err != nil {
+			return fmt.Errorf("failed to create %s credits: %w", creditType, err)
+		}
+	}
+
+	if grant && pr.SignupGrant > 0 {
+		if _, err := creditrepo.ApplyTx(tx, signupGrant(userID, pr.SignupGrant, model.ExpiresAfter(time.Now(), pr.BonusExpiry))); err != nil {
+			return fmt.Errorf("failed to apply signup grant: %w", err)
+		}
+	}
+	return nil
+}
+
+// grantVerifiedTx pays the signup grant to a user who has just verified
+// their email, unless they had it already. The user row is locked until tx
+// ends, so verifying twice at once pays it once.
+func (pr *PostgresUserRepo) grantVerifiedTx(tx *gorm.DB, userID uuid.UUID) error {
+	if pr.SignupGrant <= 0 {
+		return nil
+	}
+
+	var user model.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", userID).First(&user).Error; err != nil {
+		return fmt.Errorf("failed to load user: %w", err)
+	}
+
+	var count int64
+	if err := tx.Model(&model.Transaction{}).
+		Where("user_id = ? AND type = ?", userID, model.TransactionTypeSignupGrant).
+		Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check signup grant: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	if _, err := creditrepo.ApplyTx(tx, signupGrant(userID, pr.SignupGrant, model.ExpiresAfter(time.Now(), pr.BonusExpiry))); err != nil {
+		return fmt.Errorf("failed to apply signup grant: %w", err)
+	}
+	return nil
+}
+
+func signupGrant(userID uuid.UUID, credits int, expiresAt *time.Time) *model.Transaction {
+	return &model.Transaction{
+		UserID:      userID,
+		CreditType:  model.CreditTypeImage,
+		Amount:      credits,
+		Type:        model.TransactionTypeSignupGrant,
+		Description: "Welcome credits for new accounts",
+		ExpiresAt:   expiresAt,
+	}
+}
+
 func (pr *PostgresUserRepo) Insert(ctx context.Context, user model.User) error {
 	if err := pr.DB.WithContext(ctx).Model(&model.User{}).Create(&user).Error; err != nil {
 		return err
@@ -94,6 +224,82 @@ func (pr *PostgresUserRepo) UpdateField(ctx context.Context, id uuid.UUID, field
 	return nil
 }
 
+func (pr *PostgresUserRepo) ClaimEmail(ctx context.Context, id uuid.UUID, email string) error {
+	return pr.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var holder model.User
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id, email_verified_at").
+			Where("email = ?", email).
+			First(&holder).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+		case err != nil:
+			return fmt.Errorf("failed to check email: %w", err)
+		case holder.ID != id && holder.EmailVerifiedAt != nil:
+			return ErrEmailTaken
+		case holder.ID != id:
+			if err := tx.Model(&model.User{}).Where("id = ?", holder.ID).Update("email", nil).Error; err != nil {
+				return fmt.Errorf("failed to release email: %w", err)
+			}
+		}
+
+		if err := tx.Model(&model.User{}).
+			Where("id = ?", id).
+			Updates(map[string]any{"email": email, "email_verified_at": time.Now()}).
+			Error; err != nil {
+			return fmt.Errorf("failed to claim email: %w", err)
+		}
+		return pr.grantVerifiedTx(tx, id)
+	})
+}
+
+func (pr *PostgresUserRepo) VerifyEmail(ctx context.Context, id uuid.UUID) error {
+	return pr.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.User{}).Where("id = ?", id).Update("email_verified_at", time.Now()).Error; err != nil {
+			return fmt.Errorf("failed to verify email: %w", err)
+		}
+		return pr.grantVerifiedTx(tx, id)
+	})
+}
+
+func (pr *PostgresUserRepo) ChangePassword(ctx context.Context, id uuid.UUID, hash string) error {
+	if err := pr.DB.WithContext(ctx).
+		Model(&model.User{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"password":        hash,
+			"session_version": gorm.Expr("session_version + 1"),
+		}).
+		Error; err != nil {
+		return fmt.Errorf("failed to change password: %w", err)
+	}
+	return nil
+}
+
+func (pr *PostgresUserRepo) AssignReferralCode(ctx context.Context, id uuid.UUID, code string) (string, error) {
+	// Only fill in a missing code, so two screens opened at once cannot
+	// hand out different links.
+	if err := pr.DB.WithContext(ctx).
+		Model(&model.User{}).
+		Where("id = ? AND referral_code IS NULL", id).
+		Update("referral_code", code).
+		Error; err != nil {
+		return "", fmt.Errorf("failed to assign referral code: %w", err)
+	}
+
+	var user model.User
+	if err := pr.DB.WithContext(ctx).Select("referral_code").Where("id = ?", id).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrNotExist
+		}
+		return "", fmt.Errorf("failed to load referral code: %w", err)
+	}
+	if user.ReferralCode == nil {
+		return "", fmt.Errorf("user %s has no referral code", id)
+	}
+	return *user.ReferralCode, nil
+}
+
 func (pr *PostgresUserRepo) Delete(ctx context.Context, id uuid.UUID) error {
 	if err := pr.DB.WithContext(ctx).Delete(&model.User{}, id).Error; err != nil {
 		return err
@@ -117,6 +323,37 @@ func (pr *PostgresUserRepo) GetByTelegramID(ctx context.Context, telegramID uint
 	return &user, nil
 }
 
+func (pr *PostgresUserRepo) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	var user model.User
+	err := pr.DB.WithContext(ctx).
+		Preload("UserCredits").
+		Where("email = ?", email).
+		First(&user).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotExist
+		}
+		return nil, fmt.Errorf("failed to get user by email: %w", err)
+	}
+	return &user, nil
+}
+
+func (pr *PostgresUserRepo) GetByReferralCode(ctx context.Context, code string) (*model.User, error) {
+	var user model.User
+	err := pr.DB.WithContext(ctx).
+		Where("referral_code = ?", code).
+		First(&user).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotExist
+		}
+		return nil, fmt.Errorf("failed to get user by referral code: %w", err)
+	}
+	return &user, nil
+}
+
 func (pr *PostgresUserRepo) CreateOrUpdateUser(ctx context.Context, telegramID uint, firstName, lastName string, username, photoURL *string) (*model.User, error) {
 	tx := pr.DB.WithContext(ctx).Begin()
 	if tx.Error != nil {
@@ -131,7 +368,7 @@ func (pr *PostgresUserRepo) CreateOrUpdateUser(ctx context.Context, telegramID u
 			user = model.User{
 				FirstName:        firstName,
 				LastName:         lastName,
-				TelegramID:       telegramID,
+				TelegramID:       &telegramID,
 				TelegramUsername: username,
 				Image:            photoURL,
 				Role:             model.RoleUser,
@@ -142,26 +379,10 @@ func (pr *PostgresUserRepo) CreateOrUpdateUser(ctx context.Context, telegramID u
 				return nil, fmt.Errorf("failed to create user: %w", err)
 			}
 
-			imageCredits := model.UserCredit{
-				UserID:     user.ID,
-				CreditType: model.CreditTypeImage,
-				Credits:    0,
-			}
-			if err := tx.Create(&imageCredits).Error; err != nil {
+			if err := pr.createBalances(tx, user.ID, true); err != nil {
 				tx.Rollback()
-				return nil, fmt.Errorf("failed to create image credits: %w", err)
+				return nil, err
 			}
-
-			videoCredits := model.UserCredit{
-				UserID:     user.ID,
-				CreditType: model.CreditTypeVideo,
-				Credits:    0,
-			}
-			if err := tx.Create(&videoCredits).Error; err != nil {
-				tx.Rollback()
-				return nil, fmt.Errorf("failed to create video credits: %w", err)
-			}
-
 		} else {
 			tx.Rollback()
 			return nil, fmt.Errorf("failed to check user existence: %w", result.Error)
@@ -170,7 +391,9 @@ func (pr *PostgresUserRepo) CreateOrUpdateUser(ctx context.Context, telegramID u
 		user.FirstName = firstName
 		user.LastName = lastName
 		user.TelegramUsername = username
-		user.Image = photoURL
+		if photoURL != nil {
+			user.Image = photoURL
+		}
 		now := time.Now()
 		user.LastLogin = &now
 
@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/model"
+	creditrepo "github.com/Leul-Michael/image-generation/repository/credit"
+	requestrepo "github.com/Leul-Michael/image-generation/repository/request"
+	userrepo "github.com/Leul-Michael/image-generation/repository/user"
+	"github.com/google/uuid"
+)
+
+// MemoryVideoGenerationRequestRepo is an in-memory
+// VideoGenerationRequestRepo for tests. Claimed requests get their User from
+// Users. Credits are reserved from and refunded to Credits. The in-flight
+// cap also counts the user's requests in Images, if set.
+type MemoryVideoGenerationRequestRepo struct {
+	mu       sync.Mutex
+	requests []model.VideoGenerationRequest
+
+	Users   *userrepo.MemoryUserRepo
+	Credits *creditrepo.MemoryUserCreditRepo
+	Images  requestrepo.InFlightCounter
+}
+
+var _ VideoGenerationRequestRepo = (*MemoryVideoGenerationRequestRepo)(nil)
+
+func NewMemoryVideoGenerationRequestRepo(users *userrepo.MemoryUserRepo, credits *creditrepo.MemoryUserCreditRepo) *MemoryVideoGenerationRequestRepo {
+	return &MemoryVideoGenerationRequestRepo{
+		Users:   users,
+		Credits: credits,
+	}
+}
+
+func (mr *MemoryVideoGenerationRequestRepo) Create(ctx context.Context, request *model.VideoGenerationRequest, maxInFlight int) error {
+	images, err := requestrepo.CountOthersInFlight(ctx, mr.Images, request.UserID)
+	if err != nil {
+		return err
+	}
+
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if maxInFlight > 0 && mr.countInFlight(request.UserID)+images >= int64(maxInFlight) {
+		return requestrepo.ErrTooManyInFlight
+	}
+
+	now := time.Now()
+	request.ID, request.CreatedAt, request.UpdatedAt = uuid.New(), now, now
+	if request.Status == "" {
+		request.Status = model.RequestStatusPending
+	}
+	if request.PollAt.IsZero() {
+		request.PollAt = now
+	}
+	if request.CreditsRequired > 0 {
+		if _, err := mr.Credits.Apply(ctx, charge(request)); err != nil {
+			return err
+		}
+	}
+	mr.requests = append(mr.requests, *request)
+	return nil
+}
+
+func (mr *MemoryVideoGenerationRequestRepo) CountInFlight(ctx context.Context, userID uuid.UUID) (int64, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	return mr.countInFlight(userID), nil
+}
+
+// countInFlight mirrors the Postgres count. mu must be held.
+func (mr *MemoryVideoGenerationRequestRepo) countInFlight(userID uuid.UUID) int64 {
+	var count int64
+	for _, request := range mr.requests {
+		if request.UserID == userID && (request.Status == model.RequestStatusPending || request.Status == model.RequestStatusProcessing) {
+			count++
+		}
+	}
+	return count
+}
+
+func (mr *MemoryVideoGenerationRequestRepo) CountQueued(ctx context.Context) (map[model.RequestStatus]int64, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	counts := map[model.RequestStatus]int64{
+		model.RequestStatusPending:    0,
+		model.RequestStatusProcessing: 0,
+	}
+	for _, request := range mr.requests {
+		if _, ok := counts[request.Status]; ok {
+			counts[request.Status]++
+		}
+	}
+	return counts, nil
+}
+
+func (mr *MemoryVideoGenerationRequestRepo) ClaimNext(ctx context.Context, now, until time.Time, maxRunning int) (*model.VideoGenerationRequest, error) {
+	mr.mu.Lock()
+	running := 0
+	for _, request := range mr.requests {
+		if request.Status == model.RequestStatusProcessing {
+			running++
+		}
+	}
+	full := maxRunning > 0 && running >= maxRunning
+
+	var next *model.VideoGenerationRequest
+	for i := range mr.requests {
+		request := &mr.requests[i]
+		if request.Status != model.RequestStatusPending && request.Status != model.RequestStatusProcessing || request.PollAt.After(now) {
+			continue
+		}
+		if full && request.Status == model.RequestStatusPending {
+			continue
+		}
+		if next == nil || request.Priority > next.Priority ||
+			request.Priority == next.Priority && request.PollAt.Before(next.PollAt) {
+			next = request
+		}
+	}
+	var claimed *model.VideoGenerationRequest
+	if next != nil {
+		next.Status, next.PollAt = model.RequestStatusProcessing, until
+		next.UpdatedAt = time.Now()
+		copied := *next
+		claimed = &copied
+	}
+	mr.mu.Unlock()
+
+	if claimed == nil {
+		return nil, ErrNotExist
+	}
+
+	if user, err := mr.Users.GetById(ctx, claimed.UserID); err == nil {
+		claimed.User = *user
+	}
+	return claimed, nil
+}
+
+func (mr *MemoryVideoGenerationRequestRepo) Start(ctx context.Context, request *model.VideoGenerationRequest, jobID string) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	request.ProviderJobID = &jobID
+	mr.update(request)
+	return nil
+}
+
+func (mr *MemoryVideoGenerationRequestRepo) UpdateProgress(ctx context.Context, request *model.VideoGenerationRequest, progress int) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	request.Progress = progress
+	mr.update(request)
+	return nil
+}
+
+func (mr *MemoryVideoGenerationRequestRepo) Complete(ctx context.Context, request *model.VideoGenerationRequest, creditsUsed int) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if unused := request.CreditsRequired - creditsUsed; unused > 0 {
+		if _, err := mr.Credits.Refund(ctx, refund(request, unused, "Refund for unused video generation credits")); err != nil {
+			return err
+		}
+	}
+
+	request.Status, request.Progress = model.RequestStatusCompleted, 100
+	mr.update(request)
+	return nil
+}
+
+func (mr *MemoryVideoGenerationRequestRepo) Fail(ctx context.Context, request *model.VideoGenerationRequest, message string) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if !mr.processing(request.ID) {
+		return requestrepo.ErrNotProcessing
+	}
+
+	if request.CreditsRequired > 0 {
+		if _, err := mr.Credits.Refund(ctx, refund(request, request.CreditsRequired, "Refund for failed video generation")); err != nil {
+			return err
+		}
+	}
+
+	request.Status = model.RequestStatusFailed
+	request.Error = &message
+	mr.update(request)
+	return nil
+}
+
+// processing reports whether the request with id is processing. mu must be
+// held.
+func (mr *MemoryVideoGenerationRequestRepo) processing(id uuid.UUID) bool {
+	for _, request := range mr.requests {
+		if request.ID == id {
+			return request.Status == model.RequestStatusProcessing
+		}
+	}
+	return false
+}
+
+// update stores the fields of request the worker changes, keeping PollAt as
+// the last claim set it. mu must be held.
+func (mr *MemoryVideoGenerationRequestRepo) update(request *model.VideoGenerationRequest) {
+	for i := range mr.requests {
+		if mr.requests[i].ID == request.ID {
+			pollAt := mr.requests[i].PollAt
+			mr.requests[i] = *request
+			mr.requests[i].User = model.User{}
+			mr.requests[i].PollAt = pollAt
+			mr.requests[i].UpdatedAt = time.Now()
+			return
+		}
+	}
+}
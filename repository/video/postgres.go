@@ -0,0 +1,274 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Leul-Michael/image-generation/model"
+	creditrepo "github.com/Leul-Michael/image-generation/repository/credit"
+	requestrepo "github.com/Leul-Michael/image-generation/repository/request"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// VideoGenerationRequestRepo stores video requests and is the queue the video
+// worker takes them from. A request stays in the queue while its provider
+// job runs, and is claimed again each time it is due for a poll.
+type VideoGenerationRequestRepo interface {
+	// Create stores request, due to be claimed right away unless PollAt is
+	// set, and reserves its CreditsRequired from the user's video balance.
+	// Like the image repo's Create it returns
+	// requestrepo.ErrTooManyInFlight if the user already has maxInFlight
+	// image and video requests pending or processing, 0 meaning no cap, and
+	// creditrepo.ErrInsufficientCredits if the balance is too low.
+	Create(ctx context.Context, request *model.VideoGenerationRequest, maxInFlight int) error
+	// CountInFlight counts the user's pending and processing requests.
+	CountInFlight(ctx context.Context, userID uuid.UUID) (int64, error)
+	// CountQueued counts all pending and processing requests by status.
+	CountQueued(ctx context.Context) (map[model.RequestStatus]int64, error)
+
+	// ClaimNext marks the due request of the highest Priority, pending or
+	// processing with PollAt at or before now, as processing and not due
+	// again until until. It returns the request with its User, or
+	// ErrNotExist when none is due. When maxRunning > 0 and that many
+	// requests are processing, pending ones wait and only polls are claimed.
+	ClaimNext(ctx context.Context, now, until time.Time, maxRunning int) (*model.VideoGenerationRequest, error)
+	// Start records the job the provider started for request.
+	Start(ctx context.Context, request *model.VideoGenerationRequest, jobID string) error
+	UpdateProgress(ctx context.Context, request *model.VideoGenerationRequest, progress int) error
+	// Complete stores the result fields of request and marks it completed.
+	// Credits reserved beyond creditsUsed are refunded.
+	Complete(ctx context.Context, request *model.VideoGenerationRequest, creditsUsed int) error
+	// Fail marks the request failed with message and refunds the credits
+	// reserved for it. It returns requestrepo.ErrNotProcessing if the
+	// request has already been completed or failed.
+	Fail(ctx context.Context, request *model.VideoGenerationRequest, message string) error
+}
+
+// claimLock is the advisory lock ClaimNext holds while checking the
+// running cap, so two workers can't both start the last job.
+const claimLock = 7_340_002
+
+var ErrNotExist = errors.New("video generation request not found")
+
+type PostgresVideoGenerationRequestRepo struct {
+	DB *gorm.DB
+}
+
+var _ VideoGenerationRequestRepo = (*PostgresVideoGenerationRequestRepo)(nil)
+
+func (pr *PostgresVideoGenerationRequestRepo) Create(ctx context.Context, request *model.VideoGenerationRequest, maxInFlight int) error {
+	if request.PollAt.IsZero() {
+		request.PollAt = time.Now()
+	}
+	return pr.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := requestrepo.LockInFlight(tx, request.UserID, maxInFlight); err != nil {
+			return err
+		}
+		if err := tx.Create(request).Error; err != nil {
+			return fmt.Errorf("failed to create video generation request: %w", err)
+		}
+		if request.CreditsRequired > 0 {
+			if _, err := creditrepo.ApplyTx(tx, charge(request)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (pr *PostgresVideoGenerationRequestRepo) CountInFlight(ctx context.Context, userID uuid.UUID) (int64, error) {
+	var count int64
+	err := pr.DB.WithContext(ctx).
+		Model(&model.VideoGenerationRequest{}).
+		Where("user_id = ? AND status IN ?", userID, []model.RequestStatus{model.RequestStatusPending, model.RequestStatusProcessing}).
+		Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count in-flight video generation requests: %w", err)
+	}
+	return count, nil
+}
+
+func (pr *PostgresVideoGenerationRequestRepo) CountQueued(ctx context.Context) (map[model.RequestStatus]int64, error) {
+	var rows []struct {
+		Status model.RequestStatus
+		Count  int64
+	}
+	err := pr.DB.WithContext(ctx).
+		Model(&model.VideoGenerationRequest{}).
+		Select("status, COUNT(*) AS count").
+		Where("status IN ?", []model.RequestStatus{model.RequestStatusPending, model.RequestStatusProcessing}).
+		Group("status").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count queued video generation requests: %w", err)
+	}
+
+	counts := map[model.RequestStatus]int64{
+		model.RequestStatusPending:    0,
+		model.RequestStatusProcessing: 0,
+	}
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+// ClaimNext uses FOR UPDATE SKIP LOCKED, so workers in any number of
+// processes can share the queue. With a running cap the claims are
+// serialized by an advisory lock instead.
+func (pr *PostgresVideoGenerationRequestRepo) ClaimNext(ctx context.Context, now, until time.Time, maxRunning int) (*model.VideoGenerationRequest, error) {
+	var request model.VideoGenerationRequest
+
+	err := pr.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		statuses := []model.RequestStatus{model.RequestStatusPending, model.RequestStatusProcessing}
+		if maxRunning > 0 {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", claimLock).Error; err != nil {
+				return err
+			}
+
+			var running int64
+			if err := tx.Model(&model.VideoGenerationRequest{}).
+				Where("status = ?", model.RequestStatusProcessing).
+				Count(&running).Error; err != nil {
+				return err
+			}
+			if running >= int64(maxRunning) {
+				statuses = []model.RequestStatus{model.RequestStatusProcessing}
+			}
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status IN ? AND poll_at <= ?", statuses, now).
+			Order("priority DESC, poll_at ASC").
+			First(&request).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&request).Updates(map[string]any{
+			"status":  model.RequestStatusProcessing,
+			"poll_at": until,
+		}).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotExist
+		}
+		return nil, fmt.Errorf("failed to claim video generation request: %w", err)
+	}
+
+	if err := pr.DB.WithContext(ctx).Preload("User").First(&request, "id = ?", request.ID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load video generation request: %w", err)
+	}
+
+	return &request, nil
+}
+
+func (pr *PostgresVideoGenerationRequestRepo) Start(ctx context.Context, request *model.VideoGenerationRequest, jobID string) error {
+	if err := pr.DB.WithContext(ctx).Model(request).Update("provider_job_id", jobID).Error; err != nil {
+		return fmt.Errorf("failed to record video job: %w", err)
+	}
+
+	request.ProviderJobID = &jobID
+	return nil
+}
+
+func (pr *PostgresVideoGenerationRequestRepo) UpdateProgress(ctx context.Context, request *model.VideoGenerationRequest, progress int) error {
+	if err := pr.DB.WithContext(ctx).Model(request).Update("progress", progress).Error; err != nil {
+		return fmt.Errorf("failed to update video progress: %w", err)
+	}
+
+	request.Progress = progress
+	return nil
+}
+
+func (pr *PostgresVideoGenerationRequestRepo) Complete(ctx context.Context, request *model.VideoGenerationRequest, creditsUsed int) error {
+	err := pr.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(request).Updates(map[string]any{
+			"status":           model.RequestStatusCompleted,
+			"progress":         100,
+			"video_url":        request.VideoURL,
+			"thumbnail_url":    request.ThumbnailURL,
+			"duration_seconds": request.DurationSeconds,
+			"model_used":       request.ModelUsed,
+			"generation_time":  request.GenerationTime,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to complete video generation request: %w", err)
+		}
+
+		if unused := request.CreditsRequired - creditsUsed; unused > 0 {
+			if _, err := creditrepo.RefundTx(tx, refund(request, unused, "Refund for unused video generation credits")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	request.Status, request.Progress = model.RequestStatusCompleted, 100
+	return nil
+}
+
+func (pr *PostgresVideoGenerationRequestRepo) Fail(ctx context.Context, request *model.VideoGenerationRequest, message string) error {
+	err := pr.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(request).
+			Where("status = ?", model.RequestStatusProcessing).
+			Updates(map[string]any{
+				"status": model.RequestStatusFailed,
+				"error":  message,
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to mark video generation request failed: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return requestrepo.ErrNotProcessing
+		}
+
+		if request.CreditsRequired > 0 {
+			if _, err := creditrepo.RefundTx(tx, refund(request, request.CreditsRequired, "Refund for failed video generation")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	request.Status = model.RequestStatusFailed
+	request.Error = &message
+	return nil
+}
+
+// charge is the usage transaction reserving the credits for a request,
+// referencing it by ID.
+func charge(request *model.VideoGenerationRequest) *model.Transaction {
+	referenceID := request.ID.String()
+	return &model.Transaction{
+		UserID:      request.UserID,
+		CreditType:  model.CreditTypeVideo,
+		Amount:      -request.CreditsRequired,
+		Type:        model.TransactionTypeUsage,
+		Description: "Video generation",
+		ReferenceID: &referenceID,
+	}
+}
+
+// refund gives back credits charge reserved for request, to the lots the
+// charge spent them from.
+func refund(request *model.VideoGenerationRequest, credits int, description string) *model.Transaction {
+	referenceID := request.ID.String()
+	return &model.Transaction{
+		UserID:      request.UserID,
+		CreditType:  model.CreditTypeVideo,
+		Amount:      credits,
+		Type:        model.TransactionTypeRefund,
+		Description: description,
+		ReferenceID: &referenceID,
+	}
+}
@@ -0,0 +1,403 @@
+package seed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Leul-Michael/image-generation/migrations"
+	"github.com/Leul-Michael/image-generation/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type Options struct {
+	// DryRun computes the changes without writing them.
+	DryRun bool
+	// DeactivateMissing deactivates categories and trending prompts whose
+	// slugs are not in the catalog. Without it they are left alone.
+	DeactivateMissing bool
+	// MissingOnly creates the rows that don't exist yet and leaves existing
+	// ones, which an operator may have edited, as they are.
+	MissingOnly bool
+}
+
+type Action string
+
+const (
+	ActionCreate     Action = "create"
+	ActionUpdate     Action = "update"
+	ActionDeactivate Action = "deactivate"
+)
+
+// Change is one row created, updated or deactivated by Apply.
+type Change struct {
+	Action Action
+	Kind   string // e.g. "category" or "trending prompt translation"
+	Key    string // slug, or slug/lang for translations
+	Fields []FieldChange
+}
+
+type FieldChange struct {
+	Field string
+	Old   any
+	New   any
+}
+
+func (c Change) String() string {
+	var b strings.Builder
+
+	switch c.Action {
+	case ActionCreate:
+		b.WriteString("+ ")
+	case ActionUpdate:
+		b.WriteString("~ ")
+	case ActionDeactivate:
+		b.WriteString("- ")
+	}
+	fmt.Fprintf(&b, "%s %s", c.Kind, c.Key)
+
+	for _, f := range c.Fields {
+		fmt.Fprintf(&b, "\n    %s: %s -> %s", f.Field, show(f.Old), show(f.New))
+	}
+	return b.String()
+}
+
+func show(v any) string {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	if utf8.RuneCountInString(s) > 60 {
+		s = string([]rune(s)[:59]) + "…"
+	}
+	return fmt.Sprintf("%q", s)
+}
+
+var errDryRun = errors.New("dry run")
+
+// Apply upserts the catalog by slug in a single transaction and returns the
+// changes it made. In dry-run mode the transaction is rolled back, so the
+// returned changes are exactly what a real run would do. Trending prompt use
+// counts are never touched. The migration lock is held throughout, so
+// replicas seeding at the same time take turns and never seed a schema
+// being migrated.
+func Apply(ctx context.Context, db *gorm.DB, catalog *Catalog, opts Options) ([]Change, error) {
+	var changes []Change
+
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrations.LockKey).Error; err != nil {
+			return fmt.Errorf("failed to take migration lock: %w", err)
+		}
+
+		a := &applier{tx: tx, missingOnly: opts.MissingOnly}
+
+		if err := a.categories(catalog.Categories, opts); err != nil {
+			return err
+		}
+		if err := a.trendingPrompts(catalog.TrendingPrompts, opts); err != nil {
+			return err
+		}
+
+		changes = a.changes
+		if opts.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		err = nil
+	}
+
+	return changes, err
+}
+
+type applier struct {
+	tx          *gorm.DB
+	missingOnly bool
+	changes     []Change
+
+	categoryIDs   map[string]uuid.UUID
+	categorySlugs map[uuid.UUID]string
+}
+
+func (a *applier) record(action Action, kind, key string, fields ...FieldChange) {
+	a.changes = append(a.changes, Change{Action: action, Kind: kind, Key: key, Fields: fields})
+}
+
+// diff collects the fields that differ and the column updates for them.
+type diff struct {
+	fields  []FieldChange
+	updates map[string]any
+}
+
+func (d *diff) compare(field, column string, old, new any) {
+	if old == new {
+		return
+	}
+	d.fields = append(d.fields, FieldChange{Field: field, Old: old, New: new})
+	if d.updates == nil {
+		d.updates = make(map[string]any)
+	}
+	d.updates[column] = new
+}
+
+func (a *applier) categories(seeds []Category, opts Options) error {
+	a.categoryIDs = make(map[string]uuid.UUID)
+	a.categorySlugs = make(map[uuid.UUID]string)
+
+	var slugs []string
+	for _, seed := range seeds {
+		slugs = append(slugs, seed.Slug)
+
+		var category model.Category
+		err := a.tx.Unscoped().Where("slug = ?", seed.Slug).First(&category).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			category = model.Category{
+				Slug:        seed.Slug,
+				Name:        seed.Name,
+				Description: seed.Description,
+				Emoji:       seed.Emoji,
+				IsPremium:   seed.Premium,
+			}
+			if err := a.create(&category, seed.IsActive()); err != nil {
+				return fmt.Errorf("failed to create category %s: %w", seed.Slug, err)
+			}
+			a.record(ActionCreate, "category", seed.Slug)
+
+		case err != nil:
+			return fmt.Errorf("failed to load category %s: %w", seed.Slug, err)
+
+		case a.missingOnly:
+			// Keep the existing row as it is
+
+		default:
+			var d diff
+			d.compare("name", "name", category.Name, seed.Name)
+			d.compare("description", "description", category.Description, seed.Description)
+			d.compare("emoji", "emoji", category.Emoji, seed.Emoji)
+			d.compare("premium", "is_premium", category.IsPremium, seed.Premium)
+			d.compare("active", "is_active", category.IsActive, seed.IsActive())
+			d.compare("deleted", "deleted_at", category.DeletedAt.Valid, false)
+			if len(d.fields) > 0 {
+				if _, ok := d.updates["deleted_at"]; ok {
+					d.updates["deleted_at"] = nil // restore soft-deleted rows
+				}
+				if err := a.tx.Unscoped().Model(&category).Updates(d.updates).Error; err != nil {
+					return fmt.Errorf("failed to update category %s: %w", seed.Slug, err)
+				}
+				a.record(ActionUpdate, "category", seed.Slug, d.fields...)
+			}
+		}
+
+		a.categoryIDs[seed.Slug] = category.ID
+		a.categorySlugs[category.ID] = seed.Slug
+
+		for _, lang := range sortedKeys(seed.Translations) {
+			if err := a.categoryTranslation(category.ID, seed.Slug, lang, seed.Translations[lang]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if opts.DeactivateMissing {
+		var stale []model.Category
+		query := a.tx.Where("is_active")
+		if len(slugs) > 0 {
+			query = query.Where("slug NOT IN ?", slugs)
+		}
+		if err := query.Find(&stale).Error; err != nil {
+			return fmt.Errorf("failed to find removed categories: %w", err)
+		}
+
+		for _, category := range stale {
+			if err := a.tx.Model(&category).Update("is_active", false).Error; err != nil {
+				return fmt.Errorf("failed to deactivate category %s: %w", category.Slug, err)
+			}
+			a.record(ActionDeactivate, "category", category.Slug)
+		}
+	}
+
+	return nil
+}
+
+func (a *applier) categoryTranslation(categoryID uuid.UUID, slug, lang string, seed CategoryTranslation) error {
+	key := slug + "/" + lang
+
+	var translation model.CategoryTranslation
+	err := a.tx.Where("category_id = ? AND lang = ?", categoryID, lang).First(&translation).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		translation = model.CategoryTranslation{
+			CategoryID:  categoryID,
+			Lang:        lang,
+			Name:        seed.Name,
+			Description: seed.Description,
+		}
+		if err := a.tx.Create(&translation).Error; err != nil {
+			return fmt.Errorf("failed to create category translation %s: %w", key, err)
+		}
+		a.record(ActionCreate, "category translation", key)
+
+	case err != nil:
+		return fmt.Errorf("failed to load category translation %s: %w", key, err)
+
+	case a.missingOnly:
+		// Keep the existing row as it is
+
+	default:
+		var d diff
+		d.compare("name", "name", translation.Name, seed.Name)
+		d.compare("description", "description", translation.Description, seed.Description)
+		if len(d.fields) > 0 {
+			if err := a.tx.Model(&translation).Updates(d.updates).Error; err != nil {
+				return fmt.Errorf("failed to update category translation %s: %w", key, err)
+			}
+			a.record(ActionUpdate, "category translation", key, d.fields...)
+		}
+	}
+
+	return nil
+}
+
+func (a *applier) trendingPrompts(seeds []TrendingPrompt, opts Options) error {
+	var slugs []string
+	for _, seed := range seeds {
+		slugs = append(slugs, seed.Slug)
+		categoryID := a.categoryIDs[seed.Category]
+
+		var prompt model.TrendingPrompt
+		err := a.tx.Unscoped().Where("slug = ?", seed.Slug).First(&prompt).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			prompt = model.TrendingPrompt{
+				Slug:       seed.Slug,
+				Prompt:     seed.Prompt,
+				CategoryID: categoryID,
+			}
+			if err := a.create(&prompt, seed.IsActive()); err != nil {
+				return fmt.Errorf("failed to create trending prompt %s: %w", seed.Slug, err)
+			}
+			a.record(ActionCreate, "trending prompt", seed.Slug)
+
+		case err != nil:
+			return fmt.Errorf("failed to load trending prompt %s: %w", seed.Slug, err)
+
+		case a.missingOnly:
+			// Keep the existing row as it is
+
+		default:
+			oldCategory, ok := a.categorySlugs[prompt.CategoryID]
+			if !ok {
+				oldCategory = prompt.CategoryID.String()
+			}
+
+			var d diff
+			d.compare("prompt", "prompt", prompt.Prompt, seed.Prompt)
+			d.compare("category", "category_id", oldCategory, seed.Category)
+			d.compare("active", "is_active", prompt.IsActive, seed.IsActive())
+			d.compare("deleted", "deleted_at", prompt.DeletedAt.Valid, false)
+			if len(d.fields) > 0 {
+				if _, ok := d.updates["category_id"]; ok {
+					d.updates["category_id"] = categoryID
+				}
+				if _, ok := d.updates["deleted_at"]; ok {
+					d.updates["deleted_at"] = nil // restore soft-deleted rows
+				}
+				if err := a.tx.Unscoped().Model(&prompt).Updates(d.updates).Error; err != nil {
+					return fmt.Errorf("failed to update trending prompt %s: %w", seed.Slug, err)
+				}
+				a.record(ActionUpdate, "trending prompt", seed.Slug, d.fields...)
+			}
+		}
+
+		for _, lang := range sortedKeys(seed.Translations) {
+			if err := a.promptTranslation(prompt.ID, seed.Slug, lang, seed.Translations[lang]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if opts.DeactivateMissing {
+		var stale []model.TrendingPrompt
+		query := a.tx.Where("is_active")
+		if len(slugs) > 0 {
+			query = query.Where("slug NOT IN ?", slugs)
+		}
+		if err := query.Find(&stale).Error; err != nil {
+			return fmt.Errorf("failed to find removed trending prompts: %w", err)
+		}
+
+		for _, prompt := range stale {
+			if err := a.tx.Model(&prompt).Update("is_active", false).Error; err != nil {
+				return fmt.Errorf("failed to deactivate trending prompt %s: %w", prompt.Slug, err)
+			}
+			a.record(ActionDeactivate, "trending prompt", prompt.Slug)
+		}
+	}
+
+	return nil
+}
+
+func (a *applier) promptTranslation(promptID uuid.UUID, slug, lang, text string) error {
+	key := slug + "/" + lang
+
+	var translation model.TrendingPromptTranslation
+	err := a.tx.Where("trending_prompt_id = ? AND lang = ?", promptID, lang).First(&translation).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		translation = model.TrendingPromptTranslation{
+			TrendingPromptID: promptID,
+			Lang:             lang,
+			Prompt:           text,
+		}
+		if err := a.tx.Create(&translation).Error; err != nil {
+			return fmt.Errorf("failed to create trending prompt translation %s: %w", key, err)
+		}
+		a.record(ActionCreate, "trending prompt translation", key)
+
+	case err != nil:
+		return fmt.Errorf("failed to load trending prompt translation %s: %w", key, err)
+
+	case a.missingOnly:
+		// Keep the existing row as it is
+
+	default:
+		var d diff
+		d.compare("prompt", "prompt", translation.Prompt, text)
+		if len(d.fields) > 0 {
+			if err := a.tx.Model(&translation).Updates(d.updates).Error; err != nil {
+				return fmt.Errorf("failed to update trending prompt translation %s: %w", key, err)
+			}
+			a.record(ActionUpdate, "trending prompt translation", key, d.fields...)
+		}
+	}
+
+	return nil
+}
+
+// create inserts row and then sets is_active. gorm skips the zero value on
+// insert and applies the column default (true), so inactive rows need the
+// second update.
+func (a *applier) create(row any, active bool) error {
+	if err := a.tx.Create(row).Error; err != nil {
+		return err
+	}
+	if !active {
+		return a.tx.Model(row).Update("is_active", false).Error
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,135 @@
+// Package seed keeps the category and trending prompt catalog in a
+// declarative file and applies it to the database.
+package seed
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed catalog.yaml
+var defaultCatalog []byte
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+type Catalog struct {
+	Categories      []Category       `yaml:"categories" json:"categories"`
+	TrendingPrompts []TrendingPrompt `yaml:"trending_prompts" json:"trending_prompts"`
+}
+
+type Category struct {
+	Slug        string `yaml:"slug" json:"slug"`
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description" json:"description"`
+	Emoji       string `yaml:"emoji" json:"emoji"`
+	// Premium categories need a plan with premium categories.
+	Premium bool `yaml:"premium" json:"premium"`
+	// Active defaults to true when omitted.
+	Active       *bool                          `yaml:"active" json:"active"`
+	Translations map[string]CategoryTranslation `yaml:"translations" json:"translations"`
+}
+
+type CategoryTranslation struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description" json:"description"`
+}
+
+type TrendingPrompt struct {
+	Slug     string `yaml:"slug" json:"slug"`
+	Category string `yaml:"category" json:"category"` // category slug
+	Prompt   string `yaml:"prompt" json:"prompt"`
+	// Active defaults to true when omitted.
+	Active       *bool             `yaml:"active" json:"active"`
+	Translations map[string]string `yaml:"translations" json:"translations"`
+}
+
+func (c Category) IsActive() bool {
+	return c.Active == nil || *c.Active
+}
+
+func (p TrendingPrompt) IsActive() bool {
+	return p.Active == nil || *p.Active
+}
+
+// Default returns the catalog embedded in the binary.
+func Default() (*Catalog, error) {
+	return Parse(defaultCatalog, "catalog.yaml")
+}
+
+// Load reads a catalog file. Files ending in .json are parsed as JSON,
+// anything else as YAML.
+func Load(path string) (*Catalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seed file: %w", err)
+	}
+	return Parse(data, path)
+}
+
+// Parse decodes and validates a catalog. name is used to pick the format
+// and in error messages.
+func Parse(data []byte, name string) (*Catalog, error) {
+	var catalog Catalog
+
+	var err error
+	if strings.EqualFold(filepath.Ext(name), ".json") {
+		err = json.Unmarshal(data, &catalog)
+	} else {
+		err = yaml.Unmarshal(data, &catalog)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse seed file %s: %w", name, err)
+	}
+
+	if err := catalog.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid seed file %s: %w", name, err)
+	}
+	return &catalog, nil
+}
+
+// Validate checks slugs are well-formed and unique and that every trending
+// prompt refers to a category in the catalog.
+func (c *Catalog) Validate() error {
+	var errs []error
+
+	categories := make(map[string]bool)
+	for i, category := range c.Categories {
+		switch {
+		case !slugPattern.MatchString(category.Slug):
+			errs = append(errs, fmt.Errorf("categories[%d]: invalid slug %q", i, category.Slug))
+		case categories[category.Slug]:
+			errs = append(errs, fmt.Errorf("categories[%d]: duplicate slug %q", i, category.Slug))
+		}
+		if category.Name == "" {
+			errs = append(errs, fmt.Errorf("category %q: name is required", category.Slug))
+		}
+		categories[category.Slug] = true
+	}
+
+	prompts := make(map[string]bool)
+	for i, prompt := range c.TrendingPrompts {
+		switch {
+		case !slugPattern.MatchString(prompt.Slug):
+			errs = append(errs, fmt.Errorf("trending_prompts[%d]: invalid slug %q", i, prompt.Slug))
+		case prompts[prompt.Slug]:
+			errs = append(errs, fmt.Errorf("trending_prompts[%d]: duplicate slug %q", i, prompt.Slug))
+		}
+		if prompt.Prompt == "" {
+			errs = append(errs, fmt.Errorf("trending prompt %q: prompt is required", prompt.Slug))
+		}
+		if !categories[prompt.Category] {
+			errs = append(errs, fmt.Errorf("trending prompt %q: unknown category %q", prompt.Slug, prompt.Category))
+		}
+		prompts[prompt.Slug] = true
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,89 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// spanKey is where a query's span is kept on the statement between the
+// before and after callbacks.
+const spanKey = "tracing:span"
+
+// query is a traced query's span and the context it was started in, put
+// back once the query ends.
+type query struct {
+	span   trace.Span
+	parent context.Context
+}
+
+// Gorm returns a gorm plugin that traces each query as a child of the span
+// in its context. Queries outside a trace, such as workers polling the
+// queues, are not traced. Like the query log, the spans leave query
+// parameters out.
+func Gorm() gorm.Plugin {
+	return gormPlugin{}
+}
+
+type gormPlugin struct{}
+
+func (gormPlugin) Name() string {
+	return "tracing"
+}
+
+func (gormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("tracing:before_create", startQuery("create")),
+		cb.Create().After("gorm:create").Register("tracing:after_create", endQuery),
+		cb.Query().Before("gorm:query").Register("tracing:before_query", startQuery("select")),
+		cb.Query().After("gorm:query").Register("tracing:after_query", endQuery),
+		cb.Update().Before("gorm:update").Register("tracing:before_update", startQuery("update")),
+		cb.Update().After("gorm:update").Register("tracing:after_update", endQuery),
+		cb.Delete().Before("gorm:delete").Register("tracing:before_delete", startQuery("delete")),
+		cb.Delete().After("gorm:delete").Register("tracing:after_delete", endQuery),
+		cb.Row().Before("gorm:row").Register("tracing:before_row", startQuery("row")),
+		cb.Row().After("gorm:row").Register("tracing:after_row", endQuery),
+		cb.Raw().Before("gorm:raw").Register("tracing:before_raw", startQuery("raw")),
+		cb.Raw().After("gorm:raw").Register("tracing:after_raw", endQuery),
+	)
+}
+
+func startQuery(operation string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		if tx.Statement.Context == nil || !trace.SpanContextFromContext(tx.Statement.Context).IsValid() {
+			return
+		}
+		parent := tx.Statement.Context
+		ctx, span := Start(parent, "db."+operation,
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation", operation),
+		)
+		tx.Statement.Context = ctx
+		tx.InstanceSet(spanKey, query{span: span, parent: parent})
+	}
+}
+
+func endQuery(tx *gorm.DB) {
+	value, ok := tx.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	q := value.(query)
+	tx.Statement.Context = q.parent
+	span := q.span
+
+	span.SetAttributes(
+		attribute.String("db.statement", tx.Statement.SQL.String()),
+		attribute.String("db.sql.table", tx.Statement.Table),
+		attribute.Int64("db.rows_affected", tx.RowsAffected),
+	)
+	err := tx.Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = nil
+	}
+	End(span, err)
+}
@@ -0,0 +1,115 @@
+// Package tracing sets up OpenTelemetry tracing and follows an image
+// generation from the bot update that asks for it to the message delivering
+// it. The stages are the prompt being queued with its credits reserved
+// (generation.submit), the worker picking it up (generation.process), the
+// provider call (generation.provider), storing the image
+// (generation.complete) and the Telegram send (telegram.send). Prompts are
+// not moderated and images are not uploaded anywhere, so there are no spans
+// for those. The trace context is stored with the request, so the worker
+// that picks it up continues the same trace.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentation names the tracer the app's own spans are made with.
+const instrumentation = "github.com/Leul-Michael/image-generation"
+
+type Options struct {
+	ServiceName string
+	// Endpoint is the host:port of an OTLP/HTTP collector, e.g.
+	// "localhost:4318".
+	Endpoint string
+	// Insecure sends spans over plain HTTP, for a local collector.
+	Insecure bool
+	// SampleRatio is the share of new traces kept, from 0 to 1. Traces
+	// continued from a sampled parent are always kept.
+	SampleRatio float64
+}
+
+// Setup installs a tracer provider exporting spans to the collector at
+// opts.Endpoint, and W3C trace context propagation. Shutdown flushes the
+// spans not yet exported.
+func Setup(ctx context.Context, opts Options) (shutdown func(context.Context) error, err error) {
+	exporterOpts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(opts.Endpoint)}
+	if opts.Insecure {
+		exporterOpts = append(exporterOpts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(opts.ServiceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+// Start starts a span of the app's tracer. Until Setup is called the span
+// records nothing.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentation).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// Record adds a span for a stage that has already ended, such as the time a
+// request waited in the queue.
+func Record(ctx context.Context, name string, started, ended time.Time, attrs ...attribute.KeyValue) {
+	_, span := otel.Tracer(instrumentation).Start(ctx, name, trace.WithTimestamp(started), trace.WithAttributes(attrs...))
+	span.End(trace.WithTimestamp(ended))
+}
+
+// End ends span, marking it failed if err is not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceParent is the W3C header the trace context is stored as.
+const traceParent = "traceparent"
+
+// Inject returns the trace context of ctx as a traceparent header value, to
+// be stored with work picked up later, or "" when ctx has no span.
+func Inject(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get(traceParent)
+}
+
+// Extract returns ctx continuing the trace stored by Inject. An empty or
+// invalid value leaves ctx as it is.
+func Extract(ctx context.Context, value string) context.Context {
+	if value == "" {
+		return ctx
+	}
+	return propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{traceParent: value})
+}